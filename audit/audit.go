@@ -0,0 +1,143 @@
+// Package audit writes the compliance audit trail to the audit_logs table.
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"genomic-api/models"
+
+	"gorm.io/gorm"
+)
+
+// Actions recorded in the audit trail
+const (
+	ActionCreate         = "create"
+	ActionUpdate         = "update"
+	ActionDelete         = "delete"
+	ActionLogin          = "login"
+	ActionLoginFailed    = "login_failed"
+	ActionLogout         = "logout"
+	ActionPasswordChange = "password_change"
+	ActionPasswordReset  = "password_reset"
+	ActionRevokeSessions = "revoke_sessions"
+	ActionRevoke         = "revoke"
+	ActionPresign        = "presign" // a signed download URL was issued
+)
+
+// Resource types recorded in the audit trail
+const (
+	ResourceUser           = "user"
+	ResourceGenome         = "genome"
+	ResourceSample         = "sample"
+	ResourceCohort         = "cohort"
+	ResourceSequenceFile   = "sequence_file"
+	ResourceVariantFile    = "variant_file"
+	ResourceServiceAccount = "service_account"
+	ResourceAPIKey         = "api_key"
+)
+
+// Entry is one audited event. Before and After are the resource as it was
+// and as it is now; either may be nil for creates and deletes.
+type Entry struct {
+	UserID           int // acting user, 0 if unknown
+	ServiceAccountID int // acting service account for API key callers
+	Action           string
+	ResourceType     string
+	ResourceID       int
+	Before           interface{}
+	After            interface{}
+	Extra            map[string]interface{} // additional context such as the client IP
+}
+
+// Record writes e to the audit trail using tx, so it commits or rolls back
+// together with the change it describes. Entries are hash chained; see
+// appendToChain.
+func Record(tx *gorm.DB, e Entry) error {
+	details, err := buildDetails(e)
+	if err != nil {
+		return err
+	}
+	log := models.AuditLog{
+		UserID:           nullableID(e.UserID),
+		ServiceAccountID: nullableID(e.ServiceAccountID),
+		Action:           e.Action,
+		ResourceType:     e.ResourceType,
+		ResourceID:       e.ResourceID,
+		Timestamp:        time.Now(),
+		Details:          details,
+	}
+	// Runs as a savepoint inside the caller's transaction, or as its own
+	// transaction when tx isn't one, so the chain lock is always scoped
+	return tx.Transaction(func(tx *gorm.DB) error {
+		return appendToChain(tx, &log)
+	})
+}
+
+func nullableID(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+// buildDetails renders the JSON stored in AuditLog.Details. Creates carry the
+// new state, deletes the old one, and updates only the fields that changed
+// as {"field": {"before": ..., "after": ...}}.
+func buildDetails(e Entry) (string, error) {
+	details := map[string]interface{}{}
+	for k, v := range e.Extra {
+		details[k] = v
+	}
+
+	before, err := toMap(e.Before)
+	if err != nil {
+		return "", err
+	}
+	after, err := toMap(e.After)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case before != nil && after != nil:
+		details["changes"] = diff(before, after)
+	case after != nil:
+		details["after"] = after
+	case before != nil:
+		details["before"] = before
+	}
+
+	out, err := json.Marshal(details)
+	return string(out), err
+}
+
+// toMap converts a model to its JSON field map; fields tagged json:"-" such
+// as password and key hashes never reach the audit trail.
+func toMap(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(raw, &m)
+	return m, err
+}
+
+func diff(before, after map[string]interface{}) map[string]interface{} {
+	changes := map[string]interface{}{}
+	for k, b := range before {
+		if a, ok := after[k]; !ok || !reflect.DeepEqual(a, b) {
+			changes[k] = map[string]interface{}{"before": b, "after": after[k]}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = map[string]interface{}{"before": nil, "after": a}
+		}
+	}
+	return changes
+}
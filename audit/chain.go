@@ -0,0 +1,236 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"genomic-api/models"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// chainLockID is the Postgres advisory lock serializing appends to the chain
+const chainLockID = 7236011
+
+// verifyBatchSize is how many rows Verify loads at a time
+const verifyBatchSize = 1000
+
+// chainedFields is the canonical form of an entry that gets hashed. The field
+// order is fixed by the struct, and the row ID is left out because it's only
+// known after the insert; deleting or reordering rows still breaks PrevHash.
+type chainedFields struct {
+	PrevHash         string `json:"prev_hash"`
+	UserID           *int   `json:"user_id"`
+	ServiceAccountID *int   `json:"service_account_id"`
+	Action           string `json:"action"`
+	ResourceType     string `json:"resource_type"`
+	ResourceID       int    `json:"resource_id"`
+	Timestamp        string `json:"timestamp"`
+	Details          string `json:"details"`
+}
+
+// chainTime is the form of a timestamp that gets hashed. audit_logs.timestamp
+// is a timestamp without time zone holding microseconds, so a row read back
+// comes out in UTC at microsecond precision whatever it was written with.
+func chainTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// entryHash computes the chain hash of an audit row
+func entryHash(l models.AuditLog) string {
+	canonical, _ := json.Marshal(chainedFields{
+		PrevHash:         l.PrevHash,
+		UserID:           l.UserID,
+		ServiceAccountID: l.ServiceAccountID,
+		Action:           l.Action,
+		ResourceType:     l.ResourceType,
+		ResourceID:       l.ResourceID,
+		Timestamp:        chainTime(l.Timestamp).Format(time.RFC3339Nano),
+		Details:          l.Details,
+	})
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// appendToChain links l to the newest entry and inserts it. The advisory
+// lock is held until the surrounding transaction ends, so concurrent writers
+// can't both link to the same predecessor.
+func appendToChain(tx *gorm.DB, l *models.AuditLog) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", chainLockID).Error; err != nil {
+		return err
+	}
+	var last models.AuditLog
+	err := tx.Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return err
+	}
+	// Stored as hashed: Postgres would round the nanoseconds, and drops the
+	// zone of a non-UTC time without converting it
+	l.Timestamp = chainTime(l.Timestamp)
+	l.PrevHash = last.Hash
+	l.Hash = entryHash(*l)
+	return tx.Create(l).Error
+}
+
+// checkpointKey signs checkpoints so they can't be forged along with a
+// rewritten chain by someone with only database access
+func checkpointKey() []byte {
+	return []byte(os.Getenv("AUDIT_CHECKPOINT_KEY"))
+}
+
+func checkpointSignature(auditLogID int, hash string) string {
+	key := checkpointKey()
+	if len(key) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strconv.Itoa(auditLogID) + ":" + hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Checkpoint records the current head of the chain, unless it hasn't moved
+// since the last checkpoint. The checkpoint is also written to the service
+// log so a copy exists outside the database.
+func Checkpoint(db *gorm.DB) error {
+	var head models.AuditLog
+	if err := db.Order("id DESC").Limit(1).Find(&head).Error; err != nil {
+		return err
+	}
+	if head.ID == 0 || head.Hash == "" {
+		return nil
+	}
+	var last models.AuditCheckpoint
+	if err := db.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	if last.AuditLogID == head.ID {
+		return nil
+	}
+
+	checkpoint := models.AuditCheckpoint{
+		AuditLogID: head.ID,
+		Hash:       head.Hash,
+		Signature:  checkpointSignature(head.ID, head.Hash),
+	}
+	if err := db.Create(&checkpoint).Error; err != nil {
+		return err
+	}
+	log.Info().
+		Int("checkpoint_id", checkpoint.ID).
+		Int("audit_log_id", checkpoint.AuditLogID).
+		Str("hash", checkpoint.Hash).
+		Msg("audit chain checkpoint")
+	return nil
+}
+
+// RunCheckpoints calls Checkpoint every interval until ctx is cancelled
+func RunCheckpoints(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Checkpoint(db); err != nil {
+				log.Error().Err(err).Msg("audit checkpoint failed")
+			}
+		}
+	}
+}
+
+// BrokenLink describes the first place the chain fails to verify
+type BrokenLink struct {
+	AuditLogID   int    `json:"audit_log_id,omitempty"`
+	CheckpointID int    `json:"checkpoint_id,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// VerifyResult is the outcome of walking the audit chain
+type VerifyResult struct {
+	Valid              bool        `json:"valid"`
+	EntriesChecked     int         `json:"entries_checked"`
+	UnchainedEntries   int         `json:"unchained_entries"` // rows written before hash chaining was enabled
+	CheckpointsChecked int         `json:"checkpoints_checked"`
+	FirstBroken        *BrokenLink `json:"first_broken,omitempty"`
+}
+
+// Verify walks audit_logs in order, recomputing every hash and link, then
+// checks each checkpoint against the row it pinned. It stops at the first
+// problem found.
+func Verify(db *gorm.DB) (VerifyResult, error) {
+	var result VerifyResult
+	hashes := map[int]string{} // only rows referenced by checkpoints are kept
+
+	var checkpoints []models.AuditCheckpoint
+	if err := db.Order("id").Find(&checkpoints).Error; err != nil {
+		return result, err
+	}
+	pinned := map[int]bool{}
+	for _, cp := range checkpoints {
+		pinned[cp.AuditLogID] = true
+	}
+
+	prevHash := ""
+	chained := false
+	lastID := 0
+	for {
+		var batch []models.AuditLog
+		if err := db.Where("id > ?", lastID).Order("id").Limit(verifyBatchSize).Find(&batch).Error; err != nil {
+			return result, err
+		}
+		for _, entry := range batch {
+			lastID = entry.ID
+			// Rows from before chaining was introduced have no hash; they
+			// may only appear before the first chained row
+			if entry.Hash == "" && !chained {
+				result.UnchainedEntries++
+				continue
+			}
+			chained = true
+			result.EntriesChecked++
+
+			if entry.PrevHash != prevHash {
+				result.FirstBroken = &BrokenLink{AuditLogID: entry.ID, Reason: "prev_hash does not match the previous entry"}
+				return result, nil
+			}
+			if entryHash(entry) != entry.Hash {
+				result.FirstBroken = &BrokenLink{AuditLogID: entry.ID, Reason: "hash does not match entry contents"}
+				return result, nil
+			}
+			prevHash = entry.Hash
+			if pinned[entry.ID] {
+				hashes[entry.ID] = entry.Hash
+			}
+		}
+		if len(batch) < verifyBatchSize {
+			break
+		}
+	}
+
+	for _, cp := range checkpoints {
+		result.CheckpointsChecked++
+		hash, ok := hashes[cp.AuditLogID]
+		switch {
+		case !ok:
+			result.FirstBroken = &BrokenLink{CheckpointID: cp.ID, AuditLogID: cp.AuditLogID, Reason: "checkpointed entry is missing"}
+		case hash != cp.Hash:
+			result.FirstBroken = &BrokenLink{CheckpointID: cp.ID, AuditLogID: cp.AuditLogID, Reason: "checkpoint hash does not match entry"}
+		case len(checkpointKey()) > 0 && !hmac.Equal([]byte(cp.Signature), []byte(checkpointSignature(cp.AuditLogID, cp.Hash))):
+			result.FirstBroken = &BrokenLink{CheckpointID: cp.ID, AuditLogID: cp.AuditLogID, Reason: "checkpoint signature is invalid"}
+		}
+		if result.FirstBroken != nil {
+			return result, nil
+		}
+	}
+
+	result.Valid = true
+	return result, nil
+}
@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"genomic-api/models"
+	"genomic-api/testdb"
+
+	"gorm.io/gorm"
+)
+
+func TestEntryHashSurvivesTimestampRoundTrip(t *testing.T) {
+	userID := 7
+	written := models.AuditLog{
+		UserID:       &userID,
+		Action:       ActionUpdate,
+		ResourceType: ResourceSample,
+		ResourceID:   3,
+		Timestamp:    time.Date(2024, 5, 6, 9, 30, 15, 123456789, time.FixedZone("CEST", 2*60*60)),
+		Details:      `{"changes":{}}`,
+		PrevHash:     "abc",
+	}
+	// What a timestamp without time zone column hands back
+	read := written
+	read.Timestamp = time.Date(2024, 5, 6, 7, 30, 15, 123456000, time.UTC)
+
+	if entryHash(written) != entryHash(read) {
+		t.Fatal("hash changed when the timestamp came back in UTC at microsecond precision")
+	}
+	later := read
+	later.Timestamp = read.Timestamp.Add(time.Microsecond)
+	if entryHash(later) == entryHash(read) {
+		t.Fatal("hash ignores a one microsecond change in the timestamp")
+	}
+}
+
+func TestEntryHashCoversFields(t *testing.T) {
+	userID, otherID := 1, 2
+	base := models.AuditLog{
+		UserID:       &userID,
+		Action:       ActionCreate,
+		ResourceType: ResourceGenome,
+		ResourceID:   4,
+		Timestamp:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Details:      "{}",
+	}
+	changes := map[string]func(*models.AuditLog){
+		"prev_hash":          func(l *models.AuditLog) { l.PrevHash = "x" },
+		"user_id":            func(l *models.AuditLog) { l.UserID = &otherID },
+		"service_account_id": func(l *models.AuditLog) { l.ServiceAccountID = &otherID },
+		"action":             func(l *models.AuditLog) { l.Action = ActionDelete },
+		"resource_type":      func(l *models.AuditLog) { l.ResourceType = ResourceCohort },
+		"resource_id":        func(l *models.AuditLog) { l.ResourceID = 5 },
+		"timestamp":          func(l *models.AuditLog) { l.Timestamp = l.Timestamp.Add(time.Second) },
+		"details":            func(l *models.AuditLog) { l.Details = `{"a":1}` },
+	}
+	for field, change := range changes {
+		changed := base
+		change(&changed)
+		if entryHash(changed) == entryHash(base) {
+			t.Errorf("changing %s does not change the hash", field)
+		}
+	}
+}
+
+func TestVerifyAfterDatabaseRoundTrip(t *testing.T) {
+	db := testdb.Open(t)
+
+	for i := 1; i <= 3; i++ {
+		err := Record(db, Entry{
+			UserID:       1,
+			Action:       ActionUpdate,
+			ResourceType: ResourceSample,
+			ResourceID:   i,
+			Before:       map[string]interface{}{"name": "before"},
+			After:        map[string]interface{}{"name": "after"},
+		})
+		if err != nil {
+			t.Fatalf("record: %v", err)
+		}
+	}
+	// A caller-built entry with a zone and nanoseconds Postgres won't keep
+	entry := models.AuditLog{
+		Action:       ActionLoginFailed,
+		ResourceType: ResourceUser,
+		Timestamp:    time.Now().In(time.FixedZone("UTC-5", -5*60*60)),
+		Details:      "{}",
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error { return appendToChain(tx, &entry) }); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := Checkpoint(db); err != nil {
+		t.Fatalf("checkpoint: %v", err)
+	}
+
+	result, err := Verify(db)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !result.Valid || result.EntriesChecked != 4 || result.CheckpointsChecked != 1 {
+		t.Fatalf("verify = %+v, want a valid chain of 4 entries and 1 checkpoint", result)
+	}
+
+	var second models.AuditLog
+	db.Order("id").Offset(1).First(&second)
+	db.Exec("UPDATE audit_logs SET details = ? WHERE id = ?", `{"forged":true}`, second.ID)
+	result, err = Verify(db)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if result.Valid || result.FirstBroken == nil || result.FirstBroken.AuditLogID != second.ID {
+		t.Fatalf("verify after tampering = %+v, want entry %d reported", result, second.ID)
+	}
+}
@@ -0,0 +1,172 @@
+// Package bam reads BAM files: the SAM header text, the reference sequences
+// the reads are aligned to, and the position and flags of each alignment.
+package bam
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxTextLength bounds the SAM header text read into memory
+const maxTextLength = 1 << 28
+
+// Reference is a reference sequence reads can be aligned to
+type Reference struct {
+	Name   string
+	Length int64
+}
+
+// Header is a BAM header
+type Header struct {
+	Text string // SAM header lines
+	Refs []Reference
+}
+
+// ReadHeader reads the header from the start of a decompressed BAM stream,
+// leaving r at the first alignment
+func ReadHeader(r io.Reader) (*Header, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil || string(magic[:]) != "BAM\x01" {
+		return nil, errors.New("not a BAM file")
+	}
+	var textLength, refs int32
+	if err := binary.Read(r, binary.LittleEndian, &textLength); err != nil || textLength < 0 || textLength > maxTextLength {
+		return nil, errors.New("invalid BAM header")
+	}
+	text := make([]byte, textLength)
+	if _, err := io.ReadFull(r, text); err != nil {
+		return nil, errors.New("truncated BAM header")
+	}
+	if err := binary.Read(r, binary.LittleEndian, &refs); err != nil || refs < 0 || refs > 1<<24 {
+		return nil, errors.New("invalid BAM header")
+	}
+	header := &Header{Text: strings.TrimRight(string(text), "\x00"), Refs: make([]Reference, 0, refs)}
+	for i := int32(0); i < refs; i++ {
+		var nameLength int32
+		if err := binary.Read(r, binary.LittleEndian, &nameLength); err != nil || nameLength < 1 || nameLength > 1<<16 {
+			return nil, errors.New("invalid BAM reference list")
+		}
+		name := make([]byte, nameLength+4) // the name, NUL and the reference length
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, errors.New("truncated BAM reference list")
+		}
+		header.Refs = append(header.Refs, Reference{
+			Name:   string(name[:nameLength-1]),
+			Length: int64(binary.LittleEndian.Uint32(name[nameLength:])),
+		})
+	}
+	return header, nil
+}
+
+// Names are the reference names, in header order
+func (h *Header) Names() []string {
+	names := make([]string, len(h.Refs))
+	for i, ref := range h.Refs {
+		names[i] = ref.Name
+	}
+	return names
+}
+
+// Lines returns the header lines of one record type, such as "@SQ" or
+// "@RG", as tag -> value
+func (h *Header) Lines(recordType string) []map[string]string {
+	var lines []map[string]string
+	for _, line := range strings.Split(h.Text, "\n") {
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if fields[0] != recordType {
+			continue
+		}
+		tags := make(map[string]string, len(fields)-1)
+		for _, field := range fields[1:] {
+			if len(field) > 3 && field[2] == ':' {
+				tags[field[:2]] = field[3:]
+			}
+		}
+		lines = append(lines, tags)
+	}
+	return lines
+}
+
+// Flags of an alignment
+const (
+	FlagPaired        = 0x1
+	FlagProperPair    = 0x2
+	FlagUnmapped      = 0x4
+	FlagMateUnmapped  = 0x8
+	FlagRead1         = 0x40
+	FlagRead2         = 0x80
+	FlagSecondary     = 0x100
+	FlagQCFail        = 0x200
+	FlagDuplicate     = 0x400
+	FlagSupplementary = 0x800
+)
+
+// Alignment is the fixed-length part of a BAM record and where it ends
+type Alignment struct {
+	RefID     int32 // -1 when unplaced
+	Pos       int32 // 0-based, -1 when unplaced
+	End       int32 // 0-based exclusive: Pos plus the reference length of the CIGAR, or Pos+1 without one
+	MapQ      uint8
+	Flag      uint16
+	MateRefID int32
+}
+
+// CIGAR operations that consume the reference: M, D, N, = and X
+const refConsumingOps = 1<<0 | 1<<2 | 1<<3 | 1<<7 | 1<<8
+
+// ReadAlignment reads the next record from a decompressed BAM stream
+// positioned after the header or a previous record, and returns io.EOF
+// after the last. Only the fixed-length fields and the CIGAR are decoded;
+// the read name, bases, qualities and tags are skipped.
+func ReadAlignment(r io.Reader) (Alignment, error) {
+	var fixed [36]byte
+	n, err := io.ReadFull(r, fixed[:])
+	if err == io.EOF {
+		return Alignment{}, io.EOF
+	}
+	if err != nil {
+		return Alignment{}, fmt.Errorf("truncated BAM record after %d bytes", n)
+	}
+	size := int64(binary.LittleEndian.Uint32(fixed[0:]))
+	if size < 32 {
+		return Alignment{}, errors.New("invalid BAM record length")
+	}
+	alignment := Alignment{
+		RefID:     int32(binary.LittleEndian.Uint32(fixed[4:])),
+		Pos:       int32(binary.LittleEndian.Uint32(fixed[8:])),
+		MapQ:      fixed[13],
+		Flag:      binary.LittleEndian.Uint16(fixed[18:]),
+		MateRefID: int32(binary.LittleEndian.Uint32(fixed[24:])),
+	}
+	nameLength, cigarOps := int64(fixed[12]), int64(binary.LittleEndian.Uint16(fixed[16:]))
+	if 32+nameLength+4*cigarOps > size {
+		return Alignment{}, errors.New("invalid BAM record length")
+	}
+	if _, err := io.CopyN(io.Discard, r, nameLength); err != nil {
+		return Alignment{}, errors.New("truncated BAM record")
+	}
+	cigar := make([]byte, 4*cigarOps)
+	if _, err := io.ReadFull(r, cigar); err != nil {
+		return Alignment{}, errors.New("truncated BAM record")
+	}
+	// A read with too many operations to fit keeps them in its CG tag, with
+	// a placeholder here whose N spans the same reference length
+	var refLength int32
+	for i := 0; i < len(cigar); i += 4 {
+		op := binary.LittleEndian.Uint32(cigar[i:])
+		if refConsumingOps&(1<<(op&0xf)) != 0 {
+			refLength += int32(op >> 4)
+		}
+	}
+	if refLength == 0 {
+		refLength = 1
+	}
+	alignment.End = alignment.Pos + refLength
+	if _, err := io.CopyN(io.Discard, r, size-32-nameLength-4*cigarOps); err != nil {
+		return Alignment{}, errors.New("truncated BAM record")
+	}
+	return alignment, nil
+}
@@ -0,0 +1,119 @@
+package bam
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+// testdata/small.bam has a 177-byte header block, then ten alignments on
+// chr1 and chr2 in two blocks, the third record split between them, and
+// the EOF block
+const smallHeaderBlock = 177
+
+const smallText = "@HD\tVN:1.6\tSO:coordinate\n" +
+	"@SQ\tSN:chr1\tLN:1000\tM5:0123456789abcdef0123456789abcdef\n" +
+	"@SQ\tSN:chr2\tLN:500\n" +
+	"@RG\tID:rg1\tSM:DONOR1\n" +
+	"@RG\tID:rg2\tSM:DONOR1\tLB:lib2\n" +
+	"@PG\tID:gen\tPN:gen\n"
+
+func openSmall(t *testing.T) *bgzf.Reader {
+	t.Helper()
+	data, err := os.ReadFile("testdata/small.bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bgzf.NewReader(bytes.NewReader(data))
+}
+
+func TestReadHeader(t *testing.T) {
+	r := openSmall(t)
+	header, err := ReadHeader(r)
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	// The NULs padding the text are dropped
+	if header.Text != smallText {
+		t.Errorf("Text = %q, want %q", header.Text, smallText)
+	}
+	if want := []Reference{{"chr1", 1000}, {"chr2", 500}}; !reflect.DeepEqual(header.Refs, want) {
+		t.Errorf("Refs = %v, want %v", header.Refs, want)
+	}
+	if names := header.Names(); !reflect.DeepEqual(names, []string{"chr1", "chr2"}) {
+		t.Errorf("Names = %q", names)
+	}
+	if offset := r.Offset(); offset != bgzf.MakeOffset(smallHeaderBlock, 0) {
+		t.Errorf("ReadHeader left the reader at %s, want the first alignment at %d:0", offset, smallHeaderBlock)
+	}
+
+	sq := []map[string]string{
+		{"SN": "chr1", "LN": "1000", "M5": "0123456789abcdef0123456789abcdef"},
+		{"SN": "chr2", "LN": "500"},
+	}
+	if got := header.Lines("@SQ"); !reflect.DeepEqual(got, sq) {
+		t.Errorf("Lines(@SQ) = %v, want %v", got, sq)
+	}
+	rg := []map[string]string{{"ID": "rg1", "SM": "DONOR1"}, {"ID": "rg2", "SM": "DONOR1", "LB": "lib2"}}
+	if got := header.Lines("@RG"); !reflect.DeepEqual(got, rg) {
+		t.Errorf("Lines(@RG) = %v, want %v", got, rg)
+	}
+	if got := header.Lines("@CO"); got != nil {
+		t.Errorf("Lines(@CO) = %v, want none", got)
+	}
+}
+
+func TestHeaderLinesCRLF(t *testing.T) {
+	header := &Header{Text: "@RG\tID:rg1\tSM:D1\r\n@RG\tID:rg2\tbad\tSM:D2\r\n"}
+	want := []map[string]string{{"ID": "rg1", "SM": "D1"}, {"ID": "rg2", "SM": "D2"}}
+	if got := header.Lines("@RG"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines(@RG) = %v, want %v", got, want)
+	}
+}
+
+// rawHeader is a BAM header with the given text and references, each a
+// name length followed by the name
+func rawHeader(textLength int32, text string, refs int32, names ...interface{}) []byte {
+	var b bytes.Buffer
+	b.WriteString("BAM\x01")
+	binary.Write(&b, binary.LittleEndian, textLength)
+	b.WriteString(text)
+	binary.Write(&b, binary.LittleEndian, refs)
+	for _, name := range names {
+		switch name := name.(type) {
+		case int32:
+			binary.Write(&b, binary.LittleEndian, name)
+		case string:
+			b.WriteString(name)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestReadHeaderErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"not BAM", []byte("CRAM"), "not a BAM file"},
+		{"empty", nil, "not a BAM file"},
+		{"negative text length", rawHeader(-1, "", 0), "invalid BAM header"},
+		{"truncated text", rawHeader(10, "@HD", 0)[:11], "truncated BAM header"},
+		{"negative reference count", rawHeader(0, "", -1), "invalid BAM header"},
+		{"empty reference name", rawHeader(0, "", 1, int32(0)), "invalid BAM reference list"},
+		{"truncated reference", rawHeader(0, "", 1, int32(5), "chr1\x00"), "truncated BAM reference list"},
+		{"missing reference", rawHeader(0, "", 2, int32(5), "chr1\x00\x10\x00\x00\x00"), "invalid BAM reference list"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadHeader(bytes.NewReader(test.header))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("ReadHeader = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
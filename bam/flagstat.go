@@ -0,0 +1,65 @@
+package bam
+
+// Flagstat tallies alignments by flag the way samtools flagstat does,
+// counting QC-passed and QC-failed reads together
+type Flagstat struct {
+	Total          int64
+	QCFailed       int64
+	Secondary      int64
+	Supplementary  int64
+	Duplicates     int64
+	Mapped         int64
+	Paired         int64 // primary alignments of reads paired in sequencing
+	Read1          int64
+	Read2          int64
+	ProperlyPaired int64 // paired, mapped and flagged as a proper pair
+	BothMapped     int64 // paired, with the read and its mate mapped
+	Singletons     int64 // paired and mapped, with the mate unmapped
+	MateOtherChrom int64 // both mapped, to different references
+}
+
+// Add counts one alignment
+func (f *Flagstat) Add(a Alignment) {
+	f.Total++
+	flag := a.Flag
+	if flag&FlagQCFail != 0 {
+		f.QCFailed++
+	}
+	if flag&FlagDuplicate != 0 {
+		f.Duplicates++
+	}
+	if flag&FlagUnmapped == 0 {
+		f.Mapped++
+	}
+	switch {
+	case flag&FlagSecondary != 0:
+		f.Secondary++
+		return
+	case flag&FlagSupplementary != 0:
+		f.Supplementary++
+		return
+	case flag&FlagPaired == 0:
+		return
+	}
+	f.Paired++
+	if flag&FlagRead1 != 0 {
+		f.Read1++
+	}
+	if flag&FlagRead2 != 0 {
+		f.Read2++
+	}
+	if flag&FlagUnmapped != 0 {
+		return
+	}
+	if flag&FlagProperPair != 0 {
+		f.ProperlyPaired++
+	}
+	if flag&FlagMateUnmapped != 0 {
+		f.Singletons++
+		return
+	}
+	f.BothMapped++
+	if a.MateRefID != a.RefID {
+		f.MateOtherChrom++
+	}
+}
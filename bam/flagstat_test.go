@@ -0,0 +1,92 @@
+package bam
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// smallAlignments are the records of testdata/small.bam. The third is
+// split between two blocks.
+var smallAlignments = []Alignment{
+	{RefID: 0, Pos: 99, End: 111, MapQ: 60, Flag: 0x63, MateRefID: 0},  // 5M2D5M
+	{RefID: 0, Pos: 199, End: 209, MapQ: 60, Flag: 0x93, MateRefID: 0}, // 10M
+	{RefID: 0, Pos: 299, End: 305, MapQ: 60, Flag: 0x41, MateRefID: 1}, // 4S6M
+	{RefID: 0, Pos: 399, End: 409, MapQ: 60, Flag: 0x49, MateRefID: 0}, // 10M, mate unmapped
+	{RefID: 0, Pos: 399, End: 400, MapQ: 0, Flag: 0x85, MateRefID: 0},  // unmapped, placed by its mate
+	{RefID: 1, Pos: 9, End: 19, MapQ: 60, Flag: 0x453, MateRefID: 1},   // duplicate
+	{RefID: 1, Pos: 19, End: 29, MapQ: 60, Flag: 0x100, MateRefID: -1}, // secondary
+	{RefID: 1, Pos: 29, End: 36, MapQ: 60, Flag: 0x800, MateRefID: -1}, // supplementary, 3H7M
+	{RefID: 1, Pos: 39, End: 49, MapQ: 60, Flag: 0x200, MateRefID: -1}, // QC failed
+	{RefID: -1, Pos: -1, End: 0, MapQ: 0, Flag: 0x4, MateRefID: -1},    // unplaced
+}
+
+func TestReadAlignment(t *testing.T) {
+	r := openSmall(t)
+	if _, err := ReadHeader(r); err != nil {
+		t.Fatal(err)
+	}
+	var got []Alignment
+	for {
+		a, err := ReadAlignment(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadAlignment: %v", err)
+		}
+		got = append(got, a)
+	}
+	if !reflect.DeepEqual(got, smallAlignments) {
+		t.Errorf("got %+v\nwant %+v", got, smallAlignments)
+	}
+}
+
+// rawAlignment is a BAM record with the given block size, name length and
+// CIGAR operation count, followed by tail
+func rawAlignment(size uint32, nameLength uint8, cigarOps uint16, tail []byte) []byte {
+	fixed := make([]byte, 36)
+	binary.LittleEndian.PutUint32(fixed[0:], size)
+	fixed[12] = nameLength
+	binary.LittleEndian.PutUint16(fixed[16:], cigarOps)
+	return append(fixed, tail...)
+}
+
+func TestReadAlignmentErrors(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		record []byte
+		want   string
+	}{
+		{"truncated fixed fields", rawAlignment(34, 2, 0, nil)[:20], "truncated BAM record after 20 bytes"},
+		{"too short", rawAlignment(31, 0, 0, nil), "invalid BAM record length"},
+		{"CIGAR beyond the record", rawAlignment(34, 2, 1, []byte("a\x00")), "invalid BAM record length"},
+		{"truncated name", rawAlignment(40, 4, 0, []byte("a")), "truncated BAM record"},
+		{"truncated CIGAR", rawAlignment(40, 2, 1, []byte("a\x00\x01")), "truncated BAM record"},
+		{"truncated rest", rawAlignment(40, 2, 0, []byte("a\x00")), "truncated BAM record"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadAlignment(bytes.NewReader(test.record))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("ReadAlignment = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestFlagstat(t *testing.T) {
+	var f Flagstat
+	for _, a := range smallAlignments {
+		f.Add(a)
+	}
+	// What samtools flagstat reports, QC-passed and QC-failed together
+	want := Flagstat{
+		Total: 10, QCFailed: 1, Secondary: 1, Supplementary: 1, Duplicates: 1, Mapped: 8,
+		Paired: 6, Read1: 4, Read2: 2, ProperlyPaired: 3, BothMapped: 4, Singletons: 1, MateOtherChrom: 1,
+	}
+	if f != want {
+		t.Errorf("Flagstat = %+v\nwant %+v", f, want)
+	}
+}
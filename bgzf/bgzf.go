@@ -0,0 +1,220 @@
+// Package bgzf reads and writes BGZF, the blocked gzip format of BAM files,
+// bgzipped VCFs and their indexes. A BGZF file is a series of gzip members
+// of at most 64 KiB each, so a position in the uncompressed stream can be
+// addressed by a virtual offset: the block's offset in the file and the
+// offset within the block's uncompressed data.
+package bgzf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// MaxBlockSize is the largest a block can be, compressed or not
+const MaxBlockSize = 1 << 16
+
+// EOF is the empty block that ends every well-formed BGZF file
+var EOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+	0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// ErrNotBGZF is returned for data that isn't a BGZF block
+var ErrNotBGZF = errors.New("not a BGZF block")
+
+// Offset is a virtual file offset
+type Offset uint64
+
+// MakeOffset is the virtual offset of byte within of the block starting at block
+func MakeOffset(block int64, within int) Offset {
+	return Offset(block)<<16 | Offset(within)
+}
+
+// Block is the file offset of the block the virtual offset points into
+func (o Offset) Block() int64 {
+	return int64(o >> 16)
+}
+
+// Within is the offset into the block's uncompressed data
+func (o Offset) Within() int {
+	return int(o & 0xffff)
+}
+
+func (o Offset) String() string {
+	return fmt.Sprintf("%d:%d", o.Block(), o.Within())
+}
+
+// IsBGZF reports whether header, the first bytes of a file, starts a BGZF
+// block rather than plain gzip or uncompressed data
+func IsBGZF(header []byte) bool {
+	return len(header) >= 16 && header[0] == 0x1f && header[1] == 0x8b && header[3]&4 != 0 &&
+		header[12] == 'B' && header[13] == 'C'
+}
+
+// ReadBlock reads one block from r, returning its uncompressed data and its
+// size in the file. It returns io.EOF if r is at its end.
+func ReadBlock(r io.Reader) ([]byte, int, error) {
+	var header [18]byte
+	if _, err := io.ReadFull(r, header[:12]); err != nil {
+		return nil, 0, err
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[3]&4 == 0 {
+		return nil, 0, ErrNotBGZF
+	}
+	extra := make([]byte, binary.LittleEndian.Uint16(header[10:12]))
+	if _, err := io.ReadFull(r, extra); err != nil {
+		return nil, 0, unexpected(err)
+	}
+	size := -1
+	for i := 0; i+4 <= len(extra); {
+		length := int(binary.LittleEndian.Uint16(extra[i+2:]))
+		if extra[i] == 'B' && extra[i+1] == 'C' && length == 2 && i+6 <= len(extra) {
+			size = int(binary.LittleEndian.Uint16(extra[i+4:])) + 1
+		}
+		i += 4 + length
+	}
+	rest := size - 12 - len(extra)
+	if size < 0 || rest < 8 {
+		return nil, 0, ErrNotBGZF
+	}
+	body := make([]byte, rest)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, unexpected(err)
+	}
+	trailer := body[rest-8:]
+	data, err := io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(body[:rest-8])), MaxBlockSize+1))
+	if err != nil {
+		return nil, 0, fmt.Errorf("bgzf: %w", err)
+	}
+	if uint32(len(data)) != binary.LittleEndian.Uint32(trailer[4:]) || crc32.ChecksumIEEE(data) != binary.LittleEndian.Uint32(trailer) {
+		return nil, 0, errors.New("bgzf: block checksum mismatch")
+	}
+	return data, size, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Compress encodes data as BGZF blocks, without the EOF block
+func Compress(data []byte) []byte {
+	var out bytes.Buffer
+	for len(data) > 0 {
+		// Leave room for incompressible data to fit in a block when stored
+		n := len(data)
+		if n > 0xff00 {
+			n = 0xff00
+		}
+		writeBlock(&out, data[:n])
+		data = data[n:]
+	}
+	return out.Bytes()
+}
+
+func writeBlock(out *bytes.Buffer, data []byte) {
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+	if compressed.Len()+26 > MaxBlockSize {
+		compressed.Reset()
+		w, _ = flate.NewWriter(&compressed, flate.NoCompression)
+		w.Write(data)
+		w.Close()
+	}
+	header := []byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 6, 0, 'B', 'C', 2, 0, 0, 0}
+	binary.LittleEndian.PutUint16(header[16:], uint16(compressed.Len()+25))
+	out.Write(header)
+	out.Write(compressed.Bytes())
+	binary.Write(out, binary.LittleEndian, crc32.ChecksumIEEE(data))
+	binary.Write(out, binary.LittleEndian, uint32(len(data)))
+}
+
+// Reader decompresses a BGZF stream, keeping track of the virtual offset
+type Reader struct {
+	r     io.Reader
+	block int64 // file offset of the current block
+	size  int   // its size in the file
+	data  []byte
+	pos   int
+}
+
+// NewReader reads the BGZF stream r, which starts at a block boundary
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// next moves to the next non-empty block
+func (r *Reader) next() error {
+	for r.pos >= len(r.data) {
+		data, size, err := ReadBlock(r.r)
+		if err != nil {
+			return err
+		}
+		r.block += int64(r.size)
+		r.size, r.data, r.pos = size, data, 0
+	}
+	return nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if err := r.next(); err != nil {
+		return 0, err
+	}
+	n := copy(p, r.data[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// ReadByte reads a single byte
+func (r *Reader) ReadByte() (byte, error) {
+	if err := r.next(); err != nil {
+		return 0, err
+	}
+	r.pos++
+	return r.data[r.pos-1], nil
+}
+
+// UnreadByte steps back over the last byte read
+func (r *Reader) UnreadByte() error {
+	if r.pos == 0 {
+		return errors.New("bgzf: nothing to unread")
+	}
+	r.pos--
+	return nil
+}
+
+// Offset is the virtual offset of the next byte to be read. At the end of
+// a block it points to the start of the next one.
+func (r *Reader) Offset() Offset {
+	if r.pos >= len(r.data) {
+		return MakeOffset(r.block+int64(r.size), 0)
+	}
+	return MakeOffset(r.block, r.pos)
+}
+
+// ReadBytes reads up to and including the next delim, as bufio.Reader does.
+// If the stream ends first, it returns what was read and io.EOF.
+func (r *Reader) ReadBytes(delim byte) ([]byte, error) {
+	var line []byte
+	for {
+		if err := r.next(); err != nil {
+			return line, err
+		}
+		if i := bytes.IndexByte(r.data[r.pos:], delim); i >= 0 {
+			line = append(line, r.data[r.pos:r.pos+i+1]...)
+			r.pos += i + 1
+			return line, nil
+		}
+		line = append(line, r.data[r.pos:]...)
+		r.pos = len(r.data)
+	}
+}
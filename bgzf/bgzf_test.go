@@ -0,0 +1,198 @@
+package bgzf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// testdata/lines.gz holds two blocks and the EOF block:
+//
+//	offset  0, 46 bytes: "first line\nsecond "
+//	offset 46, 41 bytes: "line\nthird line\n"
+//	offset 87, 28 bytes: EOF
+//
+// testdata/plain.gz is "first line\n" compressed with plain gzip.
+const (
+	block1 = 46
+	block2 = 41
+)
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReadBlock(t *testing.T) {
+	r := bytes.NewReader(readFile(t, "lines.gz"))
+	for _, want := range []struct {
+		data string
+		size int
+	}{
+		{"first line\nsecond ", block1},
+		{"line\nthird line\n", block2},
+		{"", len(EOF)},
+	} {
+		data, size, err := ReadBlock(r)
+		if err != nil {
+			t.Fatalf("ReadBlock: %v", err)
+		}
+		if string(data) != want.data || size != want.size {
+			t.Errorf("ReadBlock = %q, %d; want %q, %d", data, size, want.data, want.size)
+		}
+	}
+	if _, _, err := ReadBlock(r); err != io.EOF {
+		t.Errorf("ReadBlock at the end = %v, want io.EOF", err)
+	}
+}
+
+func TestReadBlockErrors(t *testing.T) {
+	file := readFile(t, "lines.gz")
+	corrupt := func(at int) []byte {
+		data := bytes.Clone(file[:block1])
+		data[at] ^= 0xff
+		return data
+	}
+	noSubfield := bytes.Clone(file[:block1])
+	noSubfield[12] = 'X'
+	for _, test := range []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"bad CRC", corrupt(block1 - 8), nil},
+		{"bad ISIZE", corrupt(block1 - 4), nil},
+		{"truncated", file[:block1-1], io.ErrUnexpectedEOF},
+		{"truncated header", file[:10], io.ErrUnexpectedEOF},
+		{"plain gzip", readFile(t, "plain.gz"), ErrNotBGZF},
+		{"no BC subfield", noSubfield, ErrNotBGZF},
+		{"not gzip", []byte("first line\nsecond line\n"), ErrNotBGZF},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := ReadBlock(bytes.NewReader(test.data))
+			switch {
+			case test.want == nil && (err == nil || err.Error() != "bgzf: block checksum mismatch"):
+				t.Errorf("ReadBlock = %v, want a checksum mismatch", err)
+			case test.want != nil && !errors.Is(err, test.want):
+				t.Errorf("ReadBlock = %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestIsBGZF(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header []byte
+		want   bool
+	}{
+		{"BGZF", readFile(t, "lines.gz"), true},
+		{"EOF block", EOF, true},
+		{"plain gzip", readFile(t, "plain.gz"), false},
+		{"short", EOF[:15], false},
+		{"text", []byte("##fileformat=VCFv4.2\n"), false},
+	} {
+		if got := IsBGZF(test.header); got != test.want {
+			t.Errorf("IsBGZF(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	o := MakeOffset(block1, 5)
+	if o.Block() != block1 || o.Within() != 5 || o.String() != "46:5" {
+		t.Errorf("MakeOffset(46, 5) = %s, block %d, within %d", o, o.Block(), o.Within())
+	}
+	if uint64(o) != block1<<16|5 {
+		t.Errorf("MakeOffset(46, 5) = %#x, want %#x", uint64(o), block1<<16|5)
+	}
+	if MakeOffset(0, MaxBlockSize-1) >= MakeOffset(1, 0) {
+		t.Error("offsets in a block don't sort before the next block")
+	}
+}
+
+func TestReaderOffsets(t *testing.T) {
+	r := NewReader(bytes.NewReader(readFile(t, "lines.gz")))
+	if got := r.Offset(); got != 0 {
+		t.Errorf("Offset before reading = %s, want 0:0", got)
+	}
+	for _, want := range []struct {
+		line   string
+		offset Offset
+	}{
+		{"first line\n", MakeOffset(0, 11)},
+		// The line runs on into the second block
+		{"second line\n", MakeOffset(block1, 5)},
+		// The end of a block is the start of the next
+		{"third line\n", MakeOffset(block1+block2, 0)},
+	} {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("ReadBytes: %v", err)
+		}
+		if string(line) != want.line || r.Offset() != want.offset {
+			t.Errorf("ReadBytes = %q at %s, want %q at %s", line, r.Offset(), want.line, want.offset)
+		}
+	}
+	if line, err := r.ReadBytes('\n'); err != io.EOF || len(line) != 0 {
+		t.Errorf("ReadBytes at the end = %q, %v; want io.EOF", line, err)
+	}
+}
+
+func TestReaderUnreadByte(t *testing.T) {
+	r := NewReader(bytes.NewReader(readFile(t, "lines.gz")))
+	if err := r.UnreadByte(); err == nil {
+		t.Error("UnreadByte before reading succeeded")
+	}
+	b, err := r.ReadByte()
+	if err != nil || b != 'f' {
+		t.Fatalf("ReadByte = %q, %v", b, err)
+	}
+	if err := r.UnreadByte(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Offset() != 0 {
+		t.Errorf("Offset after UnreadByte = %s, want 0:0", r.Offset())
+	}
+	data, err := io.ReadAll(r)
+	if err != nil || string(data) != "first line\nsecond line\nthird line\n" {
+		t.Errorf("ReadAll = %q, %v", data, err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	// Random bytes don't compress, so each block is stored
+	data := make([]byte, 0xff00+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	compressed := Compress(data)
+	r := bytes.NewReader(compressed)
+	var got []byte
+	var blocks int
+	for {
+		block, size, err := ReadBlock(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadBlock: %v", err)
+		}
+		if size > MaxBlockSize {
+			t.Errorf("block of %d bytes", size)
+		}
+		got = append(got, block...)
+		blocks++
+	}
+	if blocks != 2 || !bytes.Equal(got, data) {
+		t.Errorf("Compress gave %d blocks holding %d bytes, want 2 holding %d", blocks, len(got), len(data))
+	}
+	if Compress(nil) != nil {
+		t.Error("Compress(nil) isn't empty")
+	}
+}
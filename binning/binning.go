@@ -0,0 +1,70 @@
+// Package binning implements the hierarchical binning scheme of the SAM
+// specification (also used by UCSC and BAI indexes). Every interval is
+// assigned the smallest bin that contains it, so the records overlapping a
+// region can only be in the handful of bins returned by Overlapping.
+//
+// Coordinates are 0-based and half-open. Bins cover positions up to 2^29;
+// intervals reaching beyond that all go in bin 0.
+package binning
+
+// MaxPos is the end of the binned coordinate space
+const MaxPos = 1 << 29
+
+// For returns the bin of the interval [beg, end)
+func For(beg, end int64) int {
+	if beg < 0 {
+		beg = 0
+	}
+	if end <= beg {
+		end = beg + 1
+	}
+	if end > MaxPos {
+		return 0
+	}
+	end--
+	switch {
+	case beg>>14 == end>>14:
+		return int(((1<<15)-1)/7 + beg>>14)
+	case beg>>17 == end>>17:
+		return int(((1<<12)-1)/7 + beg>>17)
+	case beg>>20 == end>>20:
+		return int(((1<<9)-1)/7 + beg>>20)
+	case beg>>23 == end>>23:
+		return int(((1<<6)-1)/7 + beg>>23)
+	case beg>>26 == end>>26:
+		return int(((1<<3)-1)/7 + beg>>26)
+	}
+	return 0
+}
+
+// Overlapping returns every bin that can hold an interval overlapping
+// [beg, end)
+func Overlapping(beg, end int64) []int {
+	return OverlappingIn(beg, end, 14, 5)
+}
+
+// OverlappingIn is Overlapping for a scheme whose smallest bins span
+// 2^minShift positions, with depth levels below bin 0. CSI indexes choose
+// their own; the SAM scheme is 14 and 5.
+func OverlappingIn(beg, end int64, minShift, depth uint) []int {
+	maxPos := int64(1) << (minShift + 3*depth)
+	if beg < 0 {
+		beg = 0
+	}
+	if end > maxPos {
+		end = maxPos
+	}
+	if beg >= end {
+		beg = end - 1
+	}
+	end--
+	bins := []int{0}
+	for level := uint(1); level <= depth; level++ {
+		offset := (int64(1)<<(3*level) - 1) / 7
+		shift := minShift + 3*(depth-level)
+		for k := offset + beg>>shift; k <= offset+end>>shift; k++ {
+			bins = append(bins, int(k))
+		}
+	}
+	return bins
+}
@@ -0,0 +1,105 @@
+package binning
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// Values of reg2bin in section 5.3 of the SAM specification
+func TestFor(t *testing.T) {
+	tests := []struct {
+		beg, end int64
+		want     int
+	}{
+		{0, 1, 4681},
+		{0, 1 << 14, 4681},
+		{1 << 14, 1<<14 + 1, 4682},
+		{1<<14 - 1, 1<<14 + 1, 585},
+		{0, 1 << 17, 585},
+		{0, 1<<17 + 1, 73},
+		{0, 1 << 20, 73},
+		{0, 1<<20 + 1, 9},
+		{0, 1 << 23, 9},
+		{0, 1<<23 + 1, 1},
+		{0, 1 << 26, 1},
+		{0, 1<<26 + 1, 0},
+		{0, MaxPos, 0},
+		{MaxPos - 1, MaxPos, 37448},
+		{1 << 26, 1 << 27, 2},
+		{100000, 100001, 4681 + 100000>>14},
+		// Zero-length intervals, such as insertions, are binned as one base
+		{100000, 100000, 4681 + 100000>>14},
+		// Beyond the binned space everything goes in bin 0
+		{MaxPos, MaxPos + 1, 0},
+		{-5, 1, 4681},
+	}
+	for _, tt := range tests {
+		if got := For(tt.beg, tt.end); got != tt.want {
+			t.Errorf("For(%d, %d) = %d, want %d", tt.beg, tt.end, got, tt.want)
+		}
+	}
+}
+
+// Values of reg2bins in section 5.3 of the SAM specification
+func TestOverlapping(t *testing.T) {
+	tests := []struct {
+		beg, end int64
+		want     []int
+	}{
+		{0, 1, []int{0, 1, 9, 73, 585, 4681}},
+		{0, 1<<14 + 1, []int{0, 1, 9, 73, 585, 4681, 4682}},
+		{100000, 200000, []int{0, 1, 9, 73, 585, 586, 4687, 4688, 4689, 4690, 4691, 4692, 4693}},
+		{MaxPos - 1, MaxPos, []int{0, 8, 72, 584, 4680, 37448}},
+		// An empty region is treated as its first base
+		{100000, 100000, []int{0, 1, 9, 73, 585, 4687}},
+	}
+	for _, tt := range tests {
+		if got := Overlapping(tt.beg, tt.end); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Overlapping(%d, %d) = %v, want %v", tt.beg, tt.end, got, tt.want)
+		}
+	}
+	if got := len(Overlapping(0, MaxPos)); got != 37449 {
+		t.Errorf("Overlapping the whole space gives %d bins, want all 37449", got)
+	}
+}
+
+func TestOverlappingInCSI(t *testing.T) {
+	// A CSI index with one more level than BAI, for references up to 2^32
+	got := OverlappingIn(0, 1, 14, 6)
+	want := []int{0, 1, 9, 73, 585, 4681, 37449}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("OverlappingIn(0, 1, 14, 6) = %v, want %v", got, want)
+	}
+	if got := OverlappingIn(1<<32-1, 1<<32, 14, 6); got[len(got)-1] != 37449+(1<<32-1)>>14 {
+		t.Errorf("last bin of the last position = %d, want %d", got[len(got)-1], 37449+(1<<32-1)>>14)
+	}
+}
+
+// Every record overlapping a region must be in one of the region's bins
+func TestRecordBinsAreFound(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	checked := 0
+	for i := 0; i < 10000; i++ {
+		beg := rng.Int63n(MaxPos)
+		end := beg + 1 + rng.Int63n(1<<(rng.Intn(20)+1))
+		// A query starting somewhere near the record
+		qbeg := max(0, beg-rng.Int63n(1<<(rng.Intn(20)+1)))
+		qend := qbeg + 1 + rng.Int63n(1<<(rng.Intn(20)+1))
+		if end > MaxPos || qend > MaxPos || end <= qbeg || beg >= qend {
+			continue
+		}
+		checked++
+		bin := For(beg, end)
+		found := false
+		for _, b := range Overlapping(qbeg, qend) {
+			found = found || b == bin
+		}
+		if !found {
+			t.Fatalf("record [%d, %d) in bin %d is not among the bins of [%d, %d)", beg, end, bin, qbeg, qend)
+		}
+	}
+	if checked < 1000 {
+		t.Fatalf("only %d overlapping pairs were checked", checked)
+	}
+}
@@ -0,0 +1,260 @@
+// Package cram reads the parts of a CRAM file that can be read without its
+// reference or codecs: the SAM header, and the container headers that say
+// how many records each container holds.
+package cram
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"genomic-api/bam"
+)
+
+// maxBlockSize bounds the header block read into memory
+const maxBlockSize = 1 << 28
+
+// Block compression methods
+const (
+	methodRaw  = 0
+	methodGzip = 1
+)
+
+// EOF is the empty container that ends a CRAM 3 file
+var EOF = []byte{
+	0x0f, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0x0f, 0xe0, 0x45, 0x4f, 0x46, 0x00, 0x00, 0x00,
+	0x00, 0x01, 0x00, 0x05, 0xbd, 0xd9, 0x4f, 0x00, 0x01, 0x00, 0x06, 0x06, 0x01, 0x00, 0x01, 0x00,
+	0x01, 0x00, 0xee, 0x63, 0x01, 0x4b,
+}
+
+// EOF2 is the empty container that ends a CRAM 2.1 file
+var EOF2 = []byte{
+	0x0b, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xe0, 0x45, 0x4f, 0x46, 0x00, 0x00, 0x00,
+	0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x06, 0x06, 0x01, 0x00, 0x01, 0x00, 0x01, 0x00,
+}
+
+// Reader reads a CRAM file's containers in order
+type Reader struct {
+	r      *bufio.Reader
+	Major  int
+	Minor  int
+	header *bam.Header
+}
+
+// NewReader reads the file definition and the header container from r
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{r: bufio.NewReaderSize(r, 1<<16)}
+	var definition [26]byte
+	if _, err := io.ReadFull(reader.r, definition[:]); err != nil || string(definition[:4]) != "CRAM" {
+		return nil, errors.New("not a CRAM file")
+	}
+	reader.Major, reader.Minor = int(definition[4]), int(definition[5])
+	if reader.Major != 2 && reader.Major != 3 {
+		return nil, fmt.Errorf("CRAM %d.%d is not supported", reader.Major, reader.Minor)
+	}
+	length, _, err := reader.containerHeader()
+	if err != nil {
+		return nil, err
+	}
+	// The SAM header is the first block of the first container; anything
+	// after it is padding left for the header to grow into
+	container := io.LimitReader(reader.r, length)
+	text, err := reader.headerBlock(container)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, container); err != nil {
+		return nil, err
+	}
+	reader.header = newHeader(text)
+	return reader, nil
+}
+
+// Header is the SAM header. Its references come from the @SQ lines.
+func (r *Reader) Header() *bam.Header {
+	return r.header
+}
+
+// NextContainer skips over the next container and returns how many records
+// it holds, or io.EOF after the last
+func (r *Reader) NextContainer() (int64, error) {
+	if _, err := r.r.Peek(1); err != nil {
+		return 0, err
+	}
+	length, records, err := r.containerHeader()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.r.Discard(int(length)); err != nil {
+		return 0, errors.New("truncated CRAM container")
+	}
+	return records, nil
+}
+
+// containerHeader reads a container header, returning the size of the
+// blocks that follow it and the number of records it holds
+func (r *Reader) containerHeader() (int64, int64, error) {
+	var length int32
+	if err := binary.Read(r.r, binary.LittleEndian, &length); err != nil || length < 0 {
+		return 0, 0, errors.New("invalid CRAM container header")
+	}
+	var records int64
+	// reference ID, start, span, records, record counter, bases, blocks
+	for i := 0; i < 7; i++ {
+		var value int64
+		var err error
+		if i == 4 || i == 5 {
+			value, err = ltf8(r.r)
+		} else {
+			var v int32
+			v, err = itf8(r.r)
+			value = int64(v)
+		}
+		if err != nil {
+			return 0, 0, errors.New("invalid CRAM container header")
+		}
+		if i == 3 {
+			records = value
+		}
+	}
+	landmarks, err := itf8(r.r)
+	if err != nil || landmarks < 0 {
+		return 0, 0, errors.New("invalid CRAM container header")
+	}
+	for i := int32(0); i < landmarks; i++ {
+		if _, err := itf8(r.r); err != nil {
+			return 0, 0, errors.New("invalid CRAM container header")
+		}
+	}
+	if r.Major >= 3 {
+		if _, err := r.r.Discard(4); err != nil { // CRC32
+			return 0, 0, errors.New("truncated CRAM container header")
+		}
+	}
+	return int64(length), records, nil
+}
+
+// headerBlock reads the block holding the SAM header text
+func (r *Reader) headerBlock(container io.Reader) (string, error) {
+	buffered := bufio.NewReader(container)
+	var method [2]byte // compression method, content type
+	if _, err := io.ReadFull(buffered, method[:]); err != nil {
+		return "", errors.New("truncated CRAM header block")
+	}
+	var sizes [3]int32 // content ID, compressed size, raw size
+	for i := range sizes {
+		var err error
+		if sizes[i], err = itf8(buffered); err != nil {
+			return "", errors.New("invalid CRAM header block")
+		}
+	}
+	if sizes[1] < 0 || sizes[1] > maxBlockSize || sizes[2] < 0 || sizes[2] > maxBlockSize {
+		return "", errors.New("invalid CRAM header block")
+	}
+	data := make([]byte, sizes[1])
+	if _, err := io.ReadFull(buffered, data); err != nil {
+		return "", errors.New("truncated CRAM header block")
+	}
+	switch method[0] {
+	case methodRaw:
+	case methodGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("CRAM header block: %w", err)
+		}
+		if data, err = io.ReadAll(io.LimitReader(gz, maxBlockSize)); err != nil {
+			return "", fmt.Errorf("CRAM header block: %w", err)
+		}
+	default:
+		return "", fmt.Errorf("CRAM header block uses compression method %d, which is not supported", method[0])
+	}
+	if len(data) < 4 {
+		return "", errors.New("invalid CRAM header block")
+	}
+	textLength := int(binary.LittleEndian.Uint32(data))
+	if textLength < 0 || textLength > len(data)-4 {
+		return "", errors.New("invalid CRAM header block")
+	}
+	// The rest of the container is read through by the caller, so what is
+	// left in buffered needn't be
+	return string(bytes.TrimRight(data[4:4+textLength], "\x00")), nil
+}
+
+// newHeader is a header with the references its @SQ lines declare
+func newHeader(text string) *bam.Header {
+	header := &bam.Header{Text: text}
+	for _, sq := range header.Lines("@SQ") {
+		length, _ := strconv.ParseInt(sq["LN"], 10, 64)
+		header.Refs = append(header.Refs, bam.Reference{Name: sq["SN"], Length: length})
+	}
+	return header
+}
+
+// itf8 reads a CRAM ITF8 integer: 1 to 5 bytes, the number of leading 1
+// bits in the first saying how many follow
+func itf8(r io.ByteReader) (int32, error) {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	var extra int
+	switch {
+	case b0&0x80 == 0:
+		return int32(b0), nil
+	case b0&0x40 == 0:
+		extra = 1
+	case b0&0x20 == 0:
+		extra = 2
+	case b0&0x10 == 0:
+		extra = 3
+	default:
+		extra = 4
+	}
+	value := uint32(b0) & (0xff >> (extra + 1))
+	if extra == 4 {
+		value = uint32(b0) & 0x0f
+	}
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if i == 3 {
+			// The fifth byte only contributes its low 4 bits
+			value = value<<4 | uint32(b&0x0f)
+		} else {
+			value = value<<8 | uint32(b)
+		}
+	}
+	return int32(value), nil
+}
+
+// ltf8 reads a CRAM LTF8 integer: 1 to 9 bytes, the number of leading 1
+// bits in the first saying how many follow
+func ltf8(r io.ByteReader) (int64, error) {
+	b0, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	extra := 0
+	for extra < 8 && b0&(0x80>>extra) != 0 {
+		extra++
+	}
+	var value uint64
+	if extra < 8 {
+		value = uint64(b0) & (0xff >> (extra + 1))
+	}
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint64(b)
+	}
+	return int64(value), nil
+}
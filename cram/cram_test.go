@@ -0,0 +1,166 @@
+package cram
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"genomic-api/bam"
+)
+
+// testdata/small.cram (CRAM 3.0, raw header block) and
+// testdata/small-v21.cram (CRAM 2.1, gzip header block) each hold a padded
+// header container, containers of 3 and 300 records and the EOF container.
+// The data containers' blocks are filler.
+const smallText = "@HD\tVN:1.6\tSO:coordinate\n" +
+	"@SQ\tSN:chr1\tLN:248956422\tM5:6aef897c3d6ff0c78aff06ac189178dd\n" +
+	"@SQ\tSN:chr2\tLN:242193529\n" +
+	"@RG\tID:rg1\tSM:DONOR1\n"
+
+func readFile(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	for _, test := range []struct {
+		file         string
+		major, minor int
+		eof          []byte
+	}{
+		{"small.cram", 3, 0, EOF},
+		{"small-v21.cram", 2, 1, EOF2},
+	} {
+		t.Run(test.file, func(t *testing.T) {
+			data := readFile(t, test.file)
+			if !bytes.HasSuffix(data, test.eof) {
+				t.Fatal("fixture doesn't end with the EOF container")
+			}
+			r, err := NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("NewReader: %v", err)
+			}
+			if r.Major != test.major || r.Minor != test.minor {
+				t.Errorf("version %d.%d, want %d.%d", r.Major, r.Minor, test.major, test.minor)
+			}
+			header := r.Header()
+			if header.Text != smallText {
+				t.Errorf("Text = %q, want %q", header.Text, smallText)
+			}
+			if want := []bam.Reference{{Name: "chr1", Length: 248956422}, {Name: "chr2", Length: 242193529}}; !reflect.DeepEqual(header.Refs, want) {
+				t.Errorf("Refs = %v, want %v", header.Refs, want)
+			}
+			// The EOF container holds no records
+			for _, want := range []int64{3, 300, 0} {
+				records, err := r.NextContainer()
+				if err != nil || records != want {
+					t.Errorf("NextContainer = %d, %v; want %d", records, err, want)
+				}
+			}
+			if _, err := r.NextContainer(); err != io.EOF {
+				t.Errorf("NextContainer at the end = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	small := readFile(t, "small.cram")
+	version := func(major byte) []byte {
+		data := bytes.Clone(small)
+		data[4] = major
+		return data
+	}
+	method := bytes.Clone(small)
+	// The header block's compression method follows the 26-byte file
+	// definition and the 16-byte container header
+	method[26+16] = 4
+	for _, test := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not CRAM", []byte("BAM\x01" + string(make([]byte, 30))), "not a CRAM file"},
+		{"short", small[:20], "not a CRAM file"},
+		{"CRAM 4", version(4), "CRAM 4.0 is not supported"},
+		{"no header container", small[:26], "invalid CRAM container header"},
+		{"truncated header block", small[:26+16+20], "truncated CRAM header block"},
+		{"rANS header block", method, "CRAM header block uses compression method 4, which is not supported"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(test.data))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("NewReader = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	r, err := NewReader(bytes.NewReader(small[:len(small)-len(EOF)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records, err := r.NextContainer(); records != 3 || err != nil {
+		t.Fatalf("NextContainer = %d, %v; want 3", records, err)
+	}
+	if _, err := r.NextContainer(); err == nil || err.Error() != "truncated CRAM container" {
+		t.Errorf("NextContainer on a truncated container = %v", err)
+	}
+}
+
+func TestITF8(t *testing.T) {
+	for _, test := range []struct {
+		data  []byte
+		value int32
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x80, 0x80}, 128},
+		{[]byte{0xbf, 0xff}, 16383},
+		{[]byte{0xc0, 0x40, 0x00}, 16384},
+		{[]byte{0xdf, 0xff, 0xff}, 2097151},
+		{[]byte{0xe0, 0x20, 0x00, 0x00}, 2097152},
+		{[]byte{0xef, 0xff, 0xff, 0xff}, 268435455},
+		{[]byte{0xf1, 0x00, 0x00, 0x00, 0x00}, 268435456},
+		// Only the low 4 bits of the fifth byte count
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff}, -1},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, -1},
+	} {
+		r := bufio.NewReader(bytes.NewReader(test.data))
+		value, err := itf8(r)
+		if err != nil || value != test.value || r.Buffered() != 0 {
+			t.Errorf("itf8(% x) = %d, %v with %d bytes left; want %d", test.data, value, err, r.Buffered(), test.value)
+		}
+	}
+	if _, err := itf8(bytes.NewReader([]byte{0xc0, 0x40})); err != io.EOF {
+		t.Errorf("itf8 of a truncated value = %v, want io.EOF", err)
+	}
+}
+
+func TestLTF8(t *testing.T) {
+	for _, test := range []struct {
+		data  []byte
+		value int64
+	}{
+		{[]byte{0x00}, 0},
+		{[]byte{0x7f}, 127},
+		{[]byte{0x80, 0x80}, 128},
+		{[]byte{0xc0, 0x40, 0x00}, 16384},
+		{[]byte{0xf0, 0x10, 0x00, 0x00, 0x00}, 1 << 28},
+		{[]byte{0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, 1<<56 - 1},
+		{[]byte{0xff, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 1 << 56},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, -1},
+	} {
+		r := bufio.NewReader(bytes.NewReader(test.data))
+		value, err := ltf8(r)
+		if err != nil || value != test.value || r.Buffered() != 0 {
+			t.Errorf("ltf8(% x) = %d, %v with %d bytes left; want %d", test.data, value, err, r.Buffered(), test.value)
+		}
+	}
+}
@@ -15,89 +15,116 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/api/genomes": {
+        "/.well-known/jwks.json": {
             "get": {
-                "description": "Get all genomes",
+                "description": "Public keys other services can use to verify tokens issued by this API. HMAC keys are never published.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "genomes"
+                    "auth"
                 ],
-                "summary": "List genomes",
+                "summary": "JSON Web Key Set",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.Genome"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "array",
+                                "items": {
+                                    "$ref": "#/definitions/middleware.JWK"
+                                }
                             }
                         }
                     }
                 }
-            },
-            "post": {
-                "description": "Add a new genome record",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "genomes"
-                ],
-                "summary": "Create genome",
-                "parameters": [
-                    {
-                        "description": "Genome info",
-                        "name": "genome",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Genome"
-                        }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Created",
-                        "schema": {
-                            "$ref": "#/definitions/models.Genome"
-                        }
-                    }
-                }
             }
         },
-        "/api/genomes/{id}": {
+        "/api/audit": {
             "get": {
-                "description": "Get genome by ID",
+                "description": "Search the audit trail, newest first. The total is returned in X-Total-Count and page links in Link.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "genomes"
+                    "audit"
                 ],
-                "summary": "Get genome",
+                "summary": "List audit log entries",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Genome ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Acting user ID",
+                        "name": "user_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Acting service account ID",
+                        "name": "service_account_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resource type, e.g. sample",
+                        "name": "resource_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Resource ID",
+                        "name": "resource_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Action, e.g. update",
+                        "name": "action",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Start of period (inclusive), RFC 3339 or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "End of period (exclusive), RFC 3339 or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, timestamp; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Genome"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -106,46 +133,59 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update genome by ID",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/api/audit/export": {
+            "get": {
+                "description": "Download every audit entry in a period as CSV or NDJSON, oldest first. Accepts the same filters as the list endpoint; from and to are required.",
                 "produces": [
-                    "application/json"
+                    "text/csv",
+                    "application/x-ndjson"
                 ],
                 "tags": [
-                    "genomes"
+                    "audit"
                 ],
-                "summary": "Update genome",
+                "summary": "Export audit log",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Genome ID",
-                        "name": "id",
-                        "in": "path",
+                        "type": "string",
+                        "description": "Start of period (inclusive), RFC 3339 or YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query",
                         "required": true
                     },
                     {
-                        "description": "Genome info",
-                        "name": "genome",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.Genome"
-                        }
+                        "type": "string",
+                        "description": "End of period (exclusive), RFC 3339 or YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "csv (default) or ndjson",
+                        "name": "format",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Genome"
+                            "type": "file"
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -154,71 +194,99 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Delete genome by ID",
+            }
+        },
+        "/api/audit/verify": {
+            "get": {
+                "description": "Walk the whole audit trail, recomputing each entry's hash and link to its predecessor, and check every checkpoint. Reports the first broken link.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "genomes"
-                ],
-                "summary": "Delete genome",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Genome ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    }
+                    "audit"
                 ],
+                "summary": "Verify audit chain",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
-                        }
-                    },
-                    "404": {
-                        "description": "Not Found",
-                        "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/audit.VerifyResult"
                         }
                     }
                 }
             }
         },
-        "/api/samples": {
+        "/api/cohorts": {
             "get": {
-                "description": "Get all samples",
+                "description": "Get cohorts a page at a time, with their member sample IDs. The total is returned in X-Total-Count and page links in Link.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "samples"
+                    "cohorts"
+                ],
+                "summary": "List cohorts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Cohort name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Creating user ID",
+                        "name": "created_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Cohorts containing this sample",
+                        "name": "sample_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, name, created_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List samples",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Sample"
+                                "$ref": "#/definitions/models.Cohort"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     }
                 }
             },
             "post": {
-                "description": "Add a new sample record",
+                "description": "Add a named group of samples, for scoping variant queries",
                 "consumes": [
                     "application/json"
                 ],
@@ -226,17 +294,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "samples"
+                    "cohorts"
                 ],
-                "summary": "Create sample",
+                "summary": "Create cohort",
                 "parameters": [
                     {
-                        "description": "Sample info",
-                        "name": "sample",
+                        "description": "Cohort info and member samples",
+                        "name": "cohort",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Sample"
+                            "$ref": "#/definitions/handlers.CohortInput"
                         }
                     }
                 ],
@@ -244,26 +312,35 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.Sample"
+                            "$ref": "#/definitions/models.Cohort"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
         },
-        "/api/samples/{id}": {
+        "/api/cohorts/{id}": {
             "get": {
-                "description": "Get sample by ID",
+                "description": "Get cohort by ID, with its member sample IDs",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "samples"
+                    "cohorts"
                 ],
-                "summary": "Get sample",
+                "summary": "Get cohort",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sample ID",
+                        "description": "Cohort ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -273,7 +350,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Sample"
+                            "$ref": "#/definitions/models.Cohort"
                         }
                     },
                     "404": {
@@ -288,7 +365,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Update sample by ID",
+                "description": "Rename a cohort or replace its members",
                 "consumes": [
                     "application/json"
                 ],
@@ -296,24 +373,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "samples"
+                    "cohorts"
                 ],
-                "summary": "Update sample",
+                "summary": "Update cohort",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sample ID",
+                        "description": "Cohort ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Sample info",
-                        "name": "sample",
+                        "description": "Cohort info and member samples",
+                        "name": "cohort",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.Sample"
+                            "$ref": "#/definitions/handlers.CohortInput"
                         }
                     }
                 ],
@@ -321,7 +398,16 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.Sample"
+                            "$ref": "#/definitions/models.Cohort"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "404": {
@@ -336,18 +422,18 @@ const docTemplate = `{
                 }
             },
             "delete": {
-                "description": "Delete sample by ID",
+                "description": "Delete cohort by ID; its samples are kept",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "samples"
+                    "cohorts"
                 ],
-                "summary": "Delete sample",
+                "summary": "Delete cohort",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sample ID",
+                        "description": "Cohort ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -375,20 +461,20 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/samples/{id}/variants": {
+        "/api/cohorts/{id}/history": {
             "get": {
-                "description": "Get all variant files for a sample",
+                "description": "Every recorded change to a cohort, including its membership, oldest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "variants"
+                    "audit"
                 ],
-                "summary": "Get sample variants",
+                "summary": "Cohort history",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sample ID",
+                        "description": "Cohort ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -400,37 +486,117 @@ const docTemplate = `{
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.VariantFile"
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     }
                 }
             }
         },
-        "/api/sequence": {
+        "/api/genomes": {
             "get": {
-                "description": "Get all sequence files",
+                "description": "Get genomes a page at a time. The total is returned in X-Total-Count and page links in Link.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sequence"
+                    "genomes"
+                ],
+                "summary": "List genomes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Species",
+                        "name": "species",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Genome name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference version, e.g. GRCh38",
+                        "name": "reference_version",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Creating user ID",
+                        "name": "created_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Contig indexing status: queued, running, succeeded or failed",
+                        "name": "reference_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, name, species, reference_version, created_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List sequence files",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.SequenceFile"
+                                "$ref": "#/definitions/models.Genome"
                             }
                         }
-                    }
-                }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
             },
             "post": {
-                "description": "Add a new sequence file record",
+                "description": "Add a new genome record. A genome with a fasta_path has its reference FASTA queued for indexing into contigs.",
                 "consumes": [
                     "application/json"
                 ],
@@ -438,17 +604,17 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sequence"
+                    "genomes"
                 ],
-                "summary": "Create sequence file",
+                "summary": "Create genome",
                 "parameters": [
                     {
-                        "description": "Sequence file info",
-                        "name": "sequence_file",
+                        "description": "Genome info",
+                        "name": "genome",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.SequenceFile"
+                            "$ref": "#/definitions/models.Genome"
                         }
                     }
                 ],
@@ -456,26 +622,26 @@ const docTemplate = `{
                     "201": {
                         "description": "Created",
                         "schema": {
-                            "$ref": "#/definitions/models.SequenceFile"
+                            "$ref": "#/definitions/models.Genome"
                         }
                     }
                 }
             }
         },
-        "/api/sequence/{id}": {
+        "/api/genomes/{id}": {
             "get": {
-                "description": "Get sequence file by ID",
+                "description": "Get genome by ID",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sequence"
+                    "genomes"
                 ],
-                "summary": "Get sequence file",
+                "summary": "Get genome",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sequence file ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -485,7 +651,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.SequenceFile"
+                            "$ref": "#/definitions/models.Genome"
                         }
                     },
                     "404": {
@@ -500,7 +666,7 @@ const docTemplate = `{
                 }
             },
             "put": {
-                "description": "Update sequence file by ID",
+                "description": "Update genome by ID. Changing fasta_path or fai_path queues the reference for indexing again; clearing fasta_path removes the genome's contigs.",
                 "consumes": [
                     "application/json"
                 ],
@@ -508,24 +674,24 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "sequence"
+                    "genomes"
                 ],
-                "summary": "Update sequence file",
+                "summary": "Update genome",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sequence file ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Sequence file info",
-                        "name": "sequence_file",
+                        "description": "Genome info",
+                        "name": "genome",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/models.SequenceFile"
+                            "$ref": "#/definitions/models.Genome"
                         }
                     }
                 ],
@@ -533,7 +699,7 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.SequenceFile"
+                            "$ref": "#/definitions/models.Genome"
                         }
                     },
                     "404": {
@@ -544,22 +710,31 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             },
             "delete": {
-                "description": "Delete sequence file by ID",
+                "description": "Delete genome by ID",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "sequence"
+                    "genomes"
                 ],
-                "summary": "Delete sequence file",
+                "summary": "Delete genome",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "Sequence file ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -587,75 +762,106 @@ const docTemplate = `{
                 }
             }
         },
-        "/api/users": {
+        "/api/genomes/{id}/contigs": {
             "get": {
-                "description": "Get all users",
+                "description": "Get the sequences of a genome's reference FASTA a page at a time, in FASTA order by default, with their lengths and refget digests. Contigs only appear once the whole FASTA has been indexed successfully.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "genomes"
+                ],
+                "summary": "List genome contigs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Genome ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Contig name, e.g. chr17",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "MD5 of the sequence",
+                        "name": "md5",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Contigs at least this long",
+                        "name": "min_length",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, name, length; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
                 ],
-                "summary": "List users",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.User"
+                                "$ref": "#/definitions/models.Contig"
                             }
                         }
-                    }
-                }
-            },
-            "post": {
-                "description": "Add a new user",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
-                "tags": [
-                    "users"
-                ],
-                "summary": "Create user",
-                "parameters": [
-                    {
-                        "description": "User info",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
-                    }
-                ],
-                "responses": {
-                    "201": {
-                        "description": "Created",
+                    },
+                    "404": {
+                        "description": "Not Found",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
         },
-        "/api/users/{id}": {
+        "/api/genomes/{id}/history": {
             "get": {
-                "description": "Get user by ID",
+                "description": "Every recorded change to a genome, oldest first",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "audit"
                 ],
-                "summary": "Get user",
+                "summary": "Genome history",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
@@ -665,11 +871,14 @@ const docTemplate = `{
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -678,42 +887,32 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update user by ID",
-                "consumes": [
-                    "application/json"
-                ],
+            }
+        },
+        "/api/genomes/{id}/reference": {
+            "get": {
+                "description": "Get the latest indexing job for a genome's reference FASTA: its status, how many sequences have been read, and the first problems found, such as disagreements with the .fai",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "genomes"
                 ],
-                "summary": "Update user",
+                "summary": "Get genome reference indexing status",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "User info",
-                        "name": "user",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/models.User"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.User"
+                            "$ref": "#/definitions/models.IngestJob"
                         }
                     },
                     "404": {
@@ -727,27 +926,33 @@ const docTemplate = `{
                     }
                 }
             },
-            "delete": {
-                "description": "Delete user by ID",
+            "post": {
+                "description": "Queue indexing of a genome's reference FASTA into contigs, replacing any indexed before, and checking it against the genome's .fai when it has one. Setting fasta_path queues this automatically; use it to retry a failed run.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "users"
+                    "genomes"
                 ],
-                "summary": "Delete user",
+                "summary": "Index genome reference",
                 "parameters": [
                     {
                         "type": "integer",
-                        "description": "User ID",
+                        "description": "Genome ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "OK",
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -763,82 +968,116 @@ const docTemplate = `{
                                 "type": "string"
                             }
                         }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
                     }
                 }
             }
         },
-        "/api/variants": {
+        "/api/integrity": {
             "get": {
-                "description": "Get all variant files",
+                "description": "Count sequence and variant files by the result of their last checksum verification (ok, mismatch, missing, no_checksum, error or unverified)",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "variants"
+                    "integrity"
                 ],
-                "summary": "List variant files",
+                "summary": "File verification summary",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
-                            "type": "array",
-                            "items": {
-                                "$ref": "#/definitions/models.VariantFile"
-                            }
+                            "$ref": "#/definitions/integrity.Summary"
                         }
                     }
                 }
-            },
+            }
+        },
+        "/api/integrity/scrub": {
             "post": {
-                "description": "Add a new variant file record",
-                "consumes": [
-                    "application/json"
-                ],
+                "description": "Queue a background pass that re-hashes every stored file, however recently it was checked. Progress shows in GET /api/integrity and the Prometheus metrics.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "variants"
+                    "integrity"
                 ],
-                "summary": "Create variant file",
-                "parameters": [
-                    {
-                        "description": "Variant file info",
-                        "name": "variant_file",
-                        "in": "body",
-                        "required": true,
+                "summary": "Verify all files",
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
                         "schema": {
-                            "$ref": "#/definitions/models.VariantFile"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
+                }
+            }
+        },
+        "/api/logout": {
+            "post": {
+                "description": "Revoke the current session: its refresh token and every access token issued for it",
+                "produces": [
+                    "application/json"
                 ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Log out",
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/models.VariantFile"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     }
                 }
             }
         },
-        "/api/variants/{id}": {
-            "delete": {
-                "description": "Delete variant file by ID",
+        "/api/me/password": {
+            "put": {
+                "description": "Change the password of the logged-in user; requires the current password. Every other session of the user is logged out.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "variants"
+                    "users"
                 ],
-                "summary": "Delete variant file",
+                "summary": "Change own password",
                 "parameters": [
                     {
-                        "type": "integer",
-                        "description": "Variant file ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Current and new password",
+                        "name": "password",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ChangePasswordInput"
+                        }
                     }
                 ],
                 "responses": {
@@ -851,8 +1090,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "404": {
-                        "description": "Not Found",
+                    "401": {
+                        "description": "Unauthorized",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -862,24 +1101,5897 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/api/samples": {
+            "get": {
+                "description": "Get samples a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "samples"
+                ],
+                "summary": "List samples",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Reference genome ID",
+                        "name": "genome_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Donor ID",
+                        "name": "donor_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Sample type, e.g. blood",
+                        "name": "sample_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Collecting user ID",
+                        "name": "collected_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Collected on or after (YYYY-MM-DD)",
+                        "name": "collected_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Collected before (YYYY-MM-DD)",
+                        "name": "collected_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Samples with a BAM with at least this fraction of reads mapped, e.g. 0.95",
+                        "name": "min_mapped_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Samples with a BAM with at least this fraction of paired reads properly paired",
+                        "name": "min_properly_paired_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Samples with a BAM with at most this fraction of reads marked duplicate",
+                        "name": "max_duplicate_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, donor_id, sample_type, collection_date, created_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Sample"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Add a new sample record",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "samples"
+                ],
+                "summary": "Create sample",
+                "parameters": [
+                    {
+                        "description": "Sample info",
+                        "name": "sample",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Sample"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Sample"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/samples/{id}": {
+            "get": {
+                "description": "Get sample by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "samples"
+                ],
+                "summary": "Get sample",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Sample"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update sample by ID",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "samples"
+                ],
+                "summary": "Update sample",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Sample info",
+                        "name": "sample",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Sample"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.Sample"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete sample by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "samples"
+                ],
+                "summary": "Delete sample",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/samples/{id}/history": {
+            "get": {
+                "description": "Every recorded change to a sample, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Sample history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/samples/{id}/variants": {
+            "get": {
+                "description": "Get all variant files for a sample",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Get sample variants",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.VariantFile"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence": {
+            "get": {
+                "description": "Get sequence files a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "List sequence files",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "sample_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Reference genome ID of the sample",
+                        "name": "genome_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "File type, e.g. BAM",
+                        "name": "file_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Uploading user ID",
+                        "name": "uploaded_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Uploaded at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "uploaded_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Uploaded before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "uploaded_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Result of the last checksum verification: ok, mismatch, missing, no_checksum or error",
+                        "name": "verification_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Result of the BAM header check: ok, mismatch or unchecked",
+                        "name": "header_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Status of the latest QC job: queued, running, succeeded or failed",
+                        "name": "qc_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "BAMs with at least this fraction of reads mapped, e.g. 0.95",
+                        "name": "min_mapped_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "BAMs with at least this fraction of paired reads properly paired",
+                        "name": "min_properly_paired_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "BAMs with at most this fraction of reads marked duplicate",
+                        "name": "max_duplicate_rate",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, sample_id, file_type, uploaded_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.SequenceFile"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register a file already in storage as a sequence file. file_type must be FASTQ, BAM or CRAM (common spellings such as fq.gz are accepted and normalized); a stored file whose content is something else is refused with 422. A stored BAM's header is checked against the sample's genome and donor ID; mismatches are refused with 422 unless HEADER_VALIDATION=flag. The size is read from storage; checksums are only recorded for uploads.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Create sequence file",
+                "parameters": [
+                    {
+                        "description": "Sequence file info",
+                        "name": "sequence_file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateSequenceFileInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.SequenceFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/upload": {
+            "post": {
+                "description": "Upload a whole file in one multipart request. The sample_id and file_type fields (and optional md5/sha256) must come before the file part. Use the resumable upload routes for large files. Content that isn't the declared file_type is refused with 422. A BAM whose header doesn't match the sample's genome or donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Upload sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "sample_id",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File type: FASTQ, BAM or CRAM",
+                        "name": "file_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected MD5, hex",
+                        "name": "md5",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256, hex",
+                        "name": "sha256",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "File contents",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.SequenceFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/uploads": {
+            "post": {
+                "description": "Start a resumable upload. Send the bytes with PATCH /api/sequence/uploads/{id} in one or more chunks; the sequence file is created when the last byte arrives.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Start sequence file upload",
+                "parameters": [
+                    {
+                        "description": "File info and total size",
+                        "name": "upload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.StartUploadInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/uploads/{id}": {
+            "get": {
+                "description": "Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Get sequence file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Abandon an unfinished upload and discard the bytes received so far",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Cancel sequence file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Get sequence file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Append the request body to an upload. Upload-Offset must equal the bytes received so far (see HEAD); if the transfer drops, ask again and resume from there. Returns 204 while bytes are missing and 201 with the new sequence file after the last chunk. Content that isn't the declared file_type is refused with 422. A BAM whose header doesn't match the sample's genome or donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Upload sequence file chunk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Byte offset of this chunk",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.SequenceFile"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}": {
+            "get": {
+                "description": "Get sequence file by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Get sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SequenceFile"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update sequence file by ID. file_type is validated and, if it or file_path changes, checked against the stored content as on create. Changing file_path clears the checksums and verification result, which belonged to the old object, and releases the old object once nothing refers to it.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Update sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "sequence_file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateSequenceFileInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.SequenceFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete sequence file by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Delete sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/check-header": {
+            "post": {
+                "description": "Compare a BAM's @SQ lines with the contigs of its sample's genome and its @RG SM tags with the sample's donor ID now, and save the result as the file's header_status and header_report. Use it after indexing the genome's reference or correcting the sample. Mismatches are recorded, not refused.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Check sequence file header",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/headercheck.Report"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/content": {
+            "get": {
+                "description": "Stream the bytes of a sequence file. Supports Range requests (so IGV and samtools can read remote BAMs), ETag/If-None-Match and HEAD.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Download sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-65535",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/download": {
+            "get": {
+                "description": "Serve a file to the holder of a URL from /api/sequence/{id}/download-url; no token is needed. Range requests are supported.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Download sequence file with a signed URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry, Unix seconds",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Allowed client IP",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL signature",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/download-url": {
+            "post": {
+                "description": "Mint a short-lived signed URL that downloads the file without a bearer token, for tools such as IGV.js and samtools, and index_url for its index if it has one. The URLs only work from one IP address (the caller's unless ip is given) until they expire. Every URL minted is recorded in the audit trail.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Create sequence file download URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Lifetime and allowed IP",
+                        "name": "input",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DownloadURLInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DownloadURL"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/history": {
+            "get": {
+                "description": "Every recorded change to a sequence file, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Sequence file history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/index": {
+            "get": {
+                "description": "Get the index attached to a sequence file (a .bai or .csi of a BAM, a .crai of a CRAM) with its checksums, and the latest job that generated one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Get sequence file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.FileIndex"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Upload the index of a sequence file as a multipart file part, replacing any it has: a .bai or .csi for a BAM, a .crai for a CRAM. The format is recognised from the content and must fit the file: BAI, TBI and CSI indexes need a bgzip-compressed file with as many references as the index, and no index may point past the end of the file. The server computes the MD5 and SHA-256; optional md5/sha256 fields are checked against them.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Attach sequence file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Index file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected MD5, hex",
+                        "name": "md5",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256, hex",
+                        "name": "sha256",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.IndexFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Detach and delete a sequence file's index",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Delete sequence file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/index/content": {
+            "get": {
+                "description": "Stream the bytes of a sequence file's index. Supports Range requests, ETag/If-None-Match and HEAD.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Download sequence file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-65535",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/index/download": {
+            "get": {
+                "description": "Serve a sequence file's index to the holder of the index_url from /api/sequence/{id}/download-url; no token is needed. Range requests are supported.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Download sequence file index with a signed URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry, Unix seconds",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Allowed client IP",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL signature",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/index/generate": {
+            "post": {
+                "description": "Queue building a BAI index of a coordinate-sorted BAM that has no index. Uploaded BAMs are queued automatically. CRAM indexes can't be generated; attach a .crai.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Generate sequence file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/qc": {
+            "get": {
+                "description": "Get a sequence file's QC metrics. For a FASTQ: read count, total bases, length distribution, mean quality by position, GC content, N rate and an estimated duplicate rate. For a BAM or CRAM: its header's references, read groups and programs, and for BAMs samtools flagstat-style counts and the mapped, properly paired and duplicate rates. Metrics appear once the file's QC job has succeeded; the job shows progress or why it failed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Get sequence file QC metrics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SequenceQC"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Queue reading a FASTQ (plain or gzip), BAM or CRAM sequence file through to compute its QC metrics, replacing any computed before. Uploaded files are queued automatically; use this for files registered with POST /api/sequence or to retry a failed run.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sequence"
+                ],
+                "summary": "Compute sequence file QC metrics",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/sequence/{id}/verify": {
+            "post": {
+                "description": "Re-hash the stored bytes of a sequence file now and record the result",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "integrity"
+                ],
+                "summary": "Verify sequence file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/integrity.Result"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/service-accounts": {
+            "get": {
+                "description": "Get service accounts a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "List service accounts",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Service account name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Creating user ID",
+                        "name": "created_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, name, created_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.ServiceAccount"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Add a service account for an unattended caller such as a pipeline",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Create service account",
+                "parameters": [
+                    {
+                        "description": "Service account info",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ServiceAccountInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceAccount"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/service-accounts/{id}": {
+            "get": {
+                "description": "Get service account by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Get service account",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceAccount"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update service account by ID; disabling it rejects all of its keys",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Update service account",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Service account info",
+                        "name": "account",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ServiceAccountInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.ServiceAccount"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/service-accounts/{id}/keys": {
+            "get": {
+                "description": "Get the API keys of a service account (without the secret part) a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "List API keys",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key name",
+                        "name": "name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key prefix, the public part after gk_",
+                        "name": "prefix",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, name, created_at, expires_at, last_used_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.APIKey"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Issue a scoped API key for a service account. The key is only returned in this response; send it as \"Authorization: Bearer \u003ckey\u003e\".",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Create API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Key name, scopes and optional expiry",
+                        "name": "key",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateAPIKeyInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreatedAPIKey"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/service-accounts/{id}/keys/{key_id}": {
+            "delete": {
+                "description": "Revoke an API key; requests using it are rejected from now on",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "service-accounts"
+                ],
+                "summary": "Revoke API key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Service account ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "API key ID",
+                        "name": "key_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/token/refresh": {
+            "post": {
+                "description": "Exchange a refresh token for a new access token and a new refresh token. Each refresh token works once; presenting a used one revokes the whole session.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "auth"
+                ],
+                "summary": "Refresh tokens",
+                "parameters": [
+                    {
+                        "description": "Refresh token",
+                        "name": "refresh",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/middleware.RefreshInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/middleware.TokenPair"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users": {
+            "get": {
+                "description": "Get users a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "List users",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Email",
+                        "name": "email",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Role",
+                        "name": "role",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Created before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "created_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, email, role, created_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.User"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Add a new user; the password is stored as a salted hash",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Create user",
+                "parameters": [
+                    {
+                        "description": "User info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateUserInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}": {
+            "get": {
+                "description": "Get user by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Get user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update user by ID; a supplied password is re-hashed and logs the user out everywhere",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Update user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "User info",
+                        "name": "user",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateUserInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.User"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete user by ID; their sessions are revoked",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Delete user",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/history": {
+            "get": {
+                "description": "Every recorded change to a user account, including logins and password events, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "User history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/reset-password": {
+            "post": {
+                "description": "Set a new password for a user and require them to change it at next login",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Reset user password",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New password",
+                        "name": "password",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ResetPasswordInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/users/{id}/revoke-sessions": {
+            "post": {
+                "description": "Log a user out everywhere: revoke all refresh tokens and reject all outstanding access tokens",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "users"
+                ],
+                "summary": "Revoke user sessions",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "User ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants": {
+            "get": {
+                "description": "Get variant files a page at a time. The total is returned in X-Total-Count and page links in Link.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "List variant files",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "sample_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Reference genome ID",
+                        "name": "genome_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "File type, e.g. VCF",
+                        "name": "file_type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Uploading user ID",
+                        "name": "uploaded_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Uploaded at or after (RFC 3339 or YYYY-MM-DD)",
+                        "name": "uploaded_after",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Uploaded before (RFC 3339 or YYYY-MM-DD)",
+                        "name": "uploaded_before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Result of the last checksum verification: ok, mismatch, missing, no_checksum or error",
+                        "name": "verification_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "VCF ingest status: queued, running, succeeded or failed",
+                        "name": "ingest_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Result of the VCF header check: ok, mismatch or unchecked",
+                        "name": "header_status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: id, sample_id, genome_id, file_type, uploaded_at; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.VariantFile"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Register a file already in storage as a variant file. file_type must be VCF, JSON or GFF (GFF3; common spellings such as vcf.gz are accepted and normalized); a stored file whose content is something else is refused with 422. A stored VCF's header is checked against the genome and the sample's donor ID; mismatches are refused with 422 unless HEADER_VALIDATION=flag. The size is read from storage; checksums are only recorded for uploads.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Create variant file",
+                "parameters": [
+                    {
+                        "description": "Variant file info",
+                        "name": "variant_file",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.CreateVariantFileInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.VariantFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/query": {
+            "get": {
+                "description": "Stream the ingested variant records overlapping a genomic region, sorted by position, as a JSON array or as VCF. Chromosome names match with or without the chr prefix. Region lookups use a binning index, so they stay fast across many samples.",
+                "produces": [
+                    "application/json",
+                    "text/vcf"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Query variants by region",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Region: chr17, chr17:43044295 or chr17:43044295-43125483 (1-based, inclusive)",
+                        "name": "region",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only this sample",
+                        "name": "sample_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only this reference genome",
+                        "name": "genome_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only samples in this cohort",
+                        "name": "cohort_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Only this variant file",
+                        "name": "variant_file_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "number",
+                        "description": "Minimum QUAL",
+                        "name": "min_qual",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "FILTER value, e.g. PASS",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "GT of the record's sample, e.g. 0/1 (phased and unphased match)",
+                        "name": "genotype",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference allele",
+                        "name": "ref",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "One of the alternate alleles",
+                        "name": "alt",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "VCF ID, e.g. rs80357906",
+                        "name": "vcf_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Return at most this many records",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or vcf",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Variant"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/upload": {
+            "post": {
+                "description": "Upload a whole file in one multipart request. The sample_id, genome_id and file_type fields (and optional md5/sha256) must come before the file part. Content that isn't the declared file_type is refused with 422. A VCF whose header doesn't match the genome or the sample's donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Upload variant file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sample ID",
+                        "name": "sample_id",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Reference genome ID",
+                        "name": "genome_id",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "File type: VCF, JSON or GFF",
+                        "name": "file_type",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected MD5, hex",
+                        "name": "md5",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256, hex",
+                        "name": "sha256",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "File contents",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.VariantFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/uploads": {
+            "post": {
+                "description": "Start a resumable upload; genome_id is required. Send the bytes with PATCH /api/variants/uploads/{id} in one or more chunks; the variant file is created when the last byte arrives.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Start variant file upload",
+                "parameters": [
+                    {
+                        "description": "File info and total size",
+                        "name": "upload",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.StartUploadInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/uploads/{id}": {
+            "get": {
+                "description": "Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Get variant file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Abandon an unfinished upload and discard the bytes received so far",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Cancel variant file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Get variant file upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.UploadSession"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Append the request body to an upload. Upload-Offset must equal the bytes received so far (see HEAD). Returns 204 while bytes are missing and 201 with the new variant file after the last chunk. Content that isn't the declared file_type is refused with 422. A VCF whose header doesn't match the genome or the sample's donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.",
+                "consumes": [
+                    "application/octet-stream"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Upload variant file chunk",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Byte offset of this chunk",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.VariantFile"
+                        }
+                    },
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "410": {
+                        "description": "Gone",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}": {
+            "delete": {
+                "description": "Delete variant file by ID",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Delete variant file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/check-header": {
+            "post": {
+                "description": "Compare a VCF's ##contig lines with the contigs of its genome and its sample columns with the sample's donor ID now, and save the result as the file's header_status and header_report. Use it after indexing the genome's reference or correcting the sample. Mismatches are recorded, not refused.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Check variant file header",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/headercheck.Report"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/content": {
+            "get": {
+                "description": "Stream the bytes of a variant file. Supports Range requests, ETag/If-None-Match and HEAD.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Download variant file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-65535",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/download": {
+            "get": {
+                "description": "Serve a file to the holder of a URL from /api/variants/{id}/download-url; no token is needed. Range requests are supported.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Download variant file with a signed URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry, Unix seconds",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Allowed client IP",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL signature",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/download-url": {
+            "post": {
+                "description": "Mint a short-lived signed URL that downloads the file without a bearer token, and index_url for its index if it has one. The URLs only work from one IP address until they expire. Every URL minted is recorded in the audit trail.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Create variant file download URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Lifetime and allowed IP",
+                        "name": "input",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DownloadURLInput"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DownloadURL"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/history": {
+            "get": {
+                "description": "Every recorded change to a variant file, oldest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "audit"
+                ],
+                "summary": "Variant file history",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.AuditLog"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/index": {
+            "get": {
+                "description": "Get the tabix or CSI index attached to a variant file with its checksums, and the latest job that generated one",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Get variant file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.FileIndex"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Upload the .tbi or .csi index of a bgzip-compressed VCF as a multipart file part, replacing any it has. The format is recognised from the content, and the index may not point past the end of the file. The server computes the MD5 and SHA-256; optional md5/sha256 fields are checked against them.",
+                "consumes": [
+                    "multipart/form-data"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Attach variant file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "file",
+                        "description": "Index file",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected MD5, hex",
+                        "name": "md5",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Expected SHA-256, hex",
+                        "name": "sha256",
+                        "in": "formData"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/models.IndexFile"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "422": {
+                        "description": "Unprocessable Entity",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "503": {
+                        "description": "Service Unavailable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Detach and delete a variant file's index",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Delete variant file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/index/content": {
+            "get": {
+                "description": "Stream the bytes of a variant file's index. Supports Range requests, ETag/If-None-Match and HEAD.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Download variant file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range, e.g. bytes=0-65535",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "304": {
+                        "description": "Not Modified"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/index/download": {
+            "get": {
+                "description": "Serve a variant file's index to the holder of the index_url from /api/variants/{id}/download-url; no token is needed. Range requests are supported.",
+                "produces": [
+                    "application/octet-stream"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Download variant file index with a signed URL",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Expiry, Unix seconds",
+                        "name": "expires",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Allowed client IP",
+                        "name": "ip",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "URL signature",
+                        "name": "signature",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/index/generate": {
+            "post": {
+                "description": "Queue building a tabix index of a sorted, bgzip-compressed VCF that has no index. Uploaded bgzipped VCFs are queued automatically.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Generate variant file index",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/ingest": {
+            "get": {
+                "description": "Get the latest ingest job for a variant file: its status, how many records have been read, and the first errors found with their line numbers",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Get variant file ingest status",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Queue parsing of a variant file's VCF (plain or bgzip) into variant records, replacing any ingested before. Uploaded VCFs are queued automatically; use this for files registered with POST /api/variants or to retry a failed ingest.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "Ingest variant file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/records": {
+            "get": {
+                "description": "Get the records ingested from a variant file's VCF a page at a time, in file order by default. Records only appear once the whole file has been ingested successfully.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "variants"
+                ],
+                "summary": "List variant records",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chromosome, as written in the VCF",
+                        "name": "chrom",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Records ending at or after this position",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Records starting at or before this position",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "FILTER value, e.g. PASS",
+                        "name": "filter",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "VCF ID, e.g. rs80357906",
+                        "name": "vcf_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "GT of the file's sample, e.g. 0/1",
+                        "name": "genotype",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated keys: line, chrom, pos, qual; prefix - for descending",
+                        "name": "sort",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page number, from 1",
+                        "name": "page",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 500)",
+                        "name": "per_page",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Variant"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/api/variants/{id}/verify": {
+            "post": {
+                "description": "Re-hash the stored bytes of a variant file now and record the result",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "integrity"
+                ],
+                "summary": "Verify variant file",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/integrity.Result"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/beacon": {
+            "get": {
+                "description": "GA4GH Beacon v2 information about this beacon: who runs it, the assemblies it holds variants for, and the most detailed response the caller can get",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "beacon"
+                ],
+                "summary": "Beacon info",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconInfoResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/beacon/g_variants": {
+            "get": {
+                "description": "GA4GH Beacon v2: does any sample carry a variant? Sequence queries give start, referenceBases and alternateBases; range queries give start and end; bracket queries give two-value start and end. Coordinates are 0-based. Anonymous callers and authenticated partners get the granularity configured for them; a match found in fewer samples than BEACON_MIN_COUNT is reported as no match at all.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "beacon"
+                ],
+                "summary": "Beacon genomic variants query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Assembly, matched against genomes' reference_version, e.g. GRCh38",
+                        "name": "assemblyId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chromosome, e.g. 17 or chr17",
+                        "name": "referenceName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "0-based start, or two comma-separated values for a bracket query",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "0-based exclusive end, or two comma-separated values",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference allele; N for any",
+                        "name": "referenceBases",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Alternate allele; N for any",
+                        "name": "alternateBases",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "boolean or count",
+                        "name": "requestedGranularity",
+                        "in": "query"
+                    },
+                    {
+                        "description": "The same query as a POST body",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconErrorResponse"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "GA4GH Beacon v2: does any sample carry a variant? Sequence queries give start, referenceBases and alternateBases; range queries give start and end; bracket queries give two-value start and end. Coordinates are 0-based. Anonymous callers and authenticated partners get the granularity configured for them; a match found in fewer samples than BEACON_MIN_COUNT is reported as no match at all.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "beacon"
+                ],
+                "summary": "Beacon genomic variants query",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Assembly, matched against genomes' reference_version, e.g. GRCh38",
+                        "name": "assemblyId",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chromosome, e.g. 17 or chr17",
+                        "name": "referenceName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "0-based start, or two comma-separated values for a bracket query",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "0-based exclusive end, or two comma-separated values",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference allele; N for any",
+                        "name": "referenceBases",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Alternate allele; N for any",
+                        "name": "alternateBases",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "boolean or count",
+                        "name": "requestedGranularity",
+                        "in": "query"
+                    },
+                    {
+                        "description": "The same query as a POST body",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconErrorResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/beacon/info": {
+            "get": {
+                "description": "GA4GH Beacon v2 information about this beacon: who runs it, the assemblies it holds variants for, and the most detailed response the caller can get",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "beacon"
+                ],
+                "summary": "Beacon info",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.BeaconInfoResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/drs/v1/objects/{object_id}": {
+            "get": {
+                "description": "GA4GH DRS 1.2: describe a sequence file (sequence-{id}), variant file (variant-{id}) or sample (sample-{id}) by its DRS ID. Files are blobs with their size, checksums and access methods: the token-authenticated content endpoint, plus a signed download URL (access_id signed) when DOWNLOAD_URL_SECRET is set. A sample is a bundle of all its files.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "drs"
+                ],
+                "summary": "Get DRS object",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "DRS object ID, e.g. sequence-12",
+                        "name": "object_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DrsObject"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DrsError"
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/drs/v1/objects/{object_id}/access/{access_id}": {
+            "get": {
+                "description": "GA4GH DRS 1.2: resolve a file's access_id to a URL. The signed access ID mints a short-lived signed download URL for the caller's IP, recorded in the audit trail.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "drs"
+                ],
+                "summary": "Get DRS access URL",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "DRS object ID, e.g. sequence-12",
+                        "name": "object_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Access ID from the object's access_methods",
+                        "name": "access_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DrsAccessURL"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.DrsError"
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/drs/v1/service-info": {
+            "get": {
+                "description": "GA4GH service-info for the DRS API",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "drs"
+                ],
+                "summary": "DRS service info",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/refget/sequence/service-info": {
+            "get": {
+                "description": "GA4GH service-info for the refget API",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "refget"
+                ],
+                "summary": "Refget service info",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/refget/sequence/{id}": {
+            "get": {
+                "description": "GA4GH refget 2.0: get the bases of a contig of an indexed reference genome by its MD5 or GA4GH (SQ.) digest, in uppercase. Ask for part of it with start and end (0-based, end exclusive) or a single-range Range header. Circular sequences aren't supported, so start after end is answered with 501.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "refget"
+                ],
+                "summary": "Get reference sequence",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "MD5 or GA4GH digest of the sequence",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "First base, 0-based",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Base after the last, 0-based",
+                        "name": "end",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Byte range of the sequence, e.g. bytes=0-99",
+                        "name": "Range",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "206": {
+                        "description": "Partial Content",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "416": {
+                        "description": "Requested Range Not Satisfiable",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/ga4gh/refget/sequence/{id}/metadata": {
+            "get": {
+                "description": "GA4GH refget 2.0: get a sequence's digests and length, and the contig names it has in each indexed genome",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "refget"
+                ],
+                "summary": "Get reference sequence metadata",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "MD5 or GA4GH digest of the sequence",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.RefgetMetadataResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/htsget/reads/{id}": {
+            "get": {
+                "description": "GA4GH htsget 1.3: get a ticket of URLs that together make up the reads of a BAM file overlapping a region. With an index (a .bai or .csi, see /api/sequence/{id}/index) only the blocks holding those reads are included; otherwise the whole file is. Partial blocks are sent inline as data: URLs. A CRAM with a .crai is cut down to whole containers; one without is served whole. Range URLs are signed download URLs when DOWNLOAD_URL_SECRET is set, and otherwise the content endpoint with the caller's Authorization header.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "htsget"
+                ],
+                "summary": "htsget reads ticket",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sequence file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "BAM or CRAM; defaults to the file's format",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "header for the header alone",
+                        "name": "class",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Reference sequence, or * for unplaced unmapped reads",
+                        "name": "referenceName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Start, 0-based inclusive",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "End, 0-based exclusive",
+                        "name": "end",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HtsgetResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
+        },
+        "/htsget/variants/{id}": {
+            "get": {
+                "description": "GA4GH htsget 1.3: get a ticket of URLs that together make up the records of a VCF overlapping a region. A bgzipped VCF with a tabix or CSI index (see /api/variants/{id}/index) is cut down to the blocks holding those records; otherwise the whole file is served.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "htsget"
+                ],
+                "summary": "htsget variants ticket",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Variant file ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "VCF",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "header for the header alone",
+                        "name": "class",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Chromosome",
+                        "name": "referenceName",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Start, 0-based inclusive",
+                        "name": "start",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "End, 0-based exclusive",
+                        "name": "end",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.HtsgetResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": true
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
+        "audit.BrokenLink": {
+            "type": "object",
+            "properties": {
+                "audit_log_id": {
+                    "type": "integer"
+                },
+                "checkpoint_id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "audit.VerifyResult": {
+            "type": "object",
+            "properties": {
+                "checkpoints_checked": {
+                    "type": "integer"
+                },
+                "entries_checked": {
+                    "type": "integer"
+                },
+                "first_broken": {
+                    "$ref": "#/definitions/audit.BrokenLink"
+                },
+                "unchained_entries": {
+                    "description": "rows written before hash chaining was enabled",
+                    "type": "integer"
+                },
+                "valid": {
+                    "type": "boolean"
+                }
+            }
+        },
+        "handlers.BeaconError": {
+            "type": "object",
+            "properties": {
+                "errorCode": {
+                    "type": "integer"
+                },
+                "errorMessage": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BeaconErrorResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "$ref": "#/definitions/handlers.BeaconError"
+                },
+                "meta": {
+                    "$ref": "#/definitions/handlers.BeaconMeta"
+                }
+            }
+        },
+        "handlers.BeaconInfo": {
+            "type": "object",
+            "properties": {
+                "apiVersion": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "info": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "name": {
+                    "type": "string"
+                },
+                "organization": {
+                    "$ref": "#/definitions/handlers.BeaconOrganization"
+                }
+            }
+        },
+        "handlers.BeaconInfoResponse": {
+            "type": "object",
+            "properties": {
+                "meta": {
+                    "$ref": "#/definitions/handlers.BeaconMeta"
+                },
+                "response": {
+                    "$ref": "#/definitions/handlers.BeaconInfo"
+                }
+            }
+        },
+        "handlers.BeaconMeta": {
+            "type": "object",
+            "properties": {
+                "apiVersion": {
+                    "type": "string"
+                },
+                "beaconId": {
+                    "type": "string"
+                },
+                "receivedRequestSummary": {
+                    "$ref": "#/definitions/handlers.BeaconRequestSummary"
+                },
+                "returnedGranularity": {
+                    "type": "string"
+                },
+                "returnedSchemas": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.BeaconSchema"
+                    }
+                }
+            }
+        },
+        "handlers.BeaconOrganization": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BeaconPagination": {
+            "type": "object",
+            "properties": {
+                "limit": {
+                    "type": "integer"
+                },
+                "skip": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.BeaconRequest": {
+            "type": "object",
+            "properties": {
+                "meta": {
+                    "type": "object",
+                    "properties": {
+                        "apiVersion": {
+                            "type": "string"
+                        }
+                    }
+                },
+                "query": {
+                    "type": "object",
+                    "properties": {
+                        "requestParameters": {
+                            "$ref": "#/definitions/handlers.BeaconRequestParameters"
+                        },
+                        "requestedGranularity": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "handlers.BeaconRequestParameters": {
+            "type": "object",
+            "properties": {
+                "alternateBases": {
+                    "type": "string"
+                },
+                "assemblyId": {
+                    "type": "string"
+                },
+                "end": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "geneId": {
+                    "description": "not supported",
+                    "type": "string"
+                },
+                "referenceBases": {
+                    "type": "string"
+                },
+                "referenceName": {
+                    "type": "string"
+                },
+                "start": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "variantType": {
+                    "description": "not supported",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.BeaconRequestSummary": {
+            "type": "object",
+            "properties": {
+                "apiVersion": {
+                    "type": "string"
+                },
+                "pagination": {
+                    "$ref": "#/definitions/handlers.BeaconPagination"
+                },
+                "requestParameters": {
+                    "$ref": "#/definitions/handlers.BeaconRequestParameters"
+                },
+                "requestedGranularity": {
+                    "type": "string"
+                },
+                "requestedSchemas": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.BeaconSchema"
+                    }
+                }
+            }
+        },
+        "handlers.BeaconResponse": {
+            "type": "object",
+            "properties": {
+                "meta": {
+                    "$ref": "#/definitions/handlers.BeaconMeta"
+                },
+                "responseSummary": {
+                    "$ref": "#/definitions/handlers.BeaconResponseSummary"
+                }
+            }
+        },
+        "handlers.BeaconResponseSummary": {
+            "type": "object",
+            "properties": {
+                "exists": {
+                    "type": "boolean"
+                },
+                "numTotalResults": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.BeaconSchema": {
+            "type": "object",
+            "properties": {
+                "entityType": {
+                    "type": "string"
+                },
+                "schema": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ChangePasswordInput": {
+            "type": "object",
+            "required": [
+                "current_password",
+                "new_password"
+            ],
+            "properties": {
+                "current_password": {
+                    "type": "string"
+                },
+                "new_password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 8
+                }
+            }
+        },
+        "handlers.CohortInput": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "sample_ids": {
+                    "description": "every member; on update, omit to keep the current members",
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "handlers.CreateAPIKeyInput": {
+            "type": "object",
+            "required": [
+                "name",
+                "scopes"
+            ],
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "minItems": 1,
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handlers.CreateSequenceFileInput": {
+            "type": "object",
+            "required": [
+                "file_path",
+                "file_type",
+                "sample_id"
+            ],
+            "properties": {
+                "file_name": {
+                    "type": "string"
+                },
+                "file_path": {
+                    "description": "storage key",
+                    "type": "string"
+                },
+                "file_type": {
+                    "description": "FASTQ, BAM or CRAM",
+                    "type": "string"
+                },
+                "sample_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.CreateUserInput": {
+            "type": "object",
+            "required": [
+                "email",
+                "password"
+            ],
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 8
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "admin",
+                        "researcher",
+                        "lab_technician",
+                        "guest"
+                    ]
+                }
+            }
+        },
+        "handlers.CreateVariantFileInput": {
+            "type": "object",
+            "required": [
+                "file_path",
+                "file_type",
+                "genome_id",
+                "sample_id"
+            ],
+            "properties": {
+                "file_name": {
+                    "type": "string"
+                },
+                "file_path": {
+                    "description": "storage key",
+                    "type": "string"
+                },
+                "file_type": {
+                    "description": "VCF, JSON or GFF",
+                    "type": "string"
+                },
+                "genome_id": {
+                    "type": "integer"
+                },
+                "sample_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.CreatedAPIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "description": "space-separated, e.g. \"read:samples write:variants\"",
+                    "type": "string"
+                },
+                "service_account_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.DownloadURL": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "index_url": {
+                    "description": "downloads the file's index, on the same terms",
+                    "type": "string"
+                },
+                "ip": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DownloadURLInput": {
+            "type": "object",
+            "properties": {
+                "expires_in": {
+                    "description": "seconds, default 900, at most 86400",
+                    "type": "integer"
+                },
+                "ip": {
+                    "description": "address allowed to use the URL; defaults to the caller's",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DrsAccessMethod": {
+            "type": "object",
+            "properties": {
+                "access_id": {
+                    "type": "string"
+                },
+                "access_url": {
+                    "$ref": "#/definitions/handlers.DrsAccessURL"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DrsAccessURL": {
+            "type": "object",
+            "properties": {
+                "headers": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DrsChecksum": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "type": "string"
+                },
+                "type": {
+                    "description": "sha-256 or md5",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DrsContentsObject": {
+            "type": "object",
+            "properties": {
+                "drs_uri": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.DrsError": {
+            "type": "object",
+            "properties": {
+                "msg": {
+                    "type": "string"
+                },
+                "status_code": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.DrsObject": {
+            "type": "object",
+            "properties": {
+                "access_methods": {
+                    "description": "blobs only",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.DrsAccessMethod"
+                    }
+                },
+                "checksums": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.DrsChecksum"
+                    }
+                },
+                "contents": {
+                    "description": "bundles only",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.DrsContentsObject"
+                    }
+                },
+                "created_time": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "self_uri": {
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.FileIndex": {
+            "type": "object",
+            "properties": {
+                "index": {
+                    "description": "nil while the file has none",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.IndexFile"
+                        }
+                    ]
+                },
+                "job": {
+                    "description": "the latest index generation job, with any problems found",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    ]
+                }
+            }
+        },
+        "handlers.HtsgetResponse": {
+            "type": "object",
+            "properties": {
+                "htsget": {
+                    "$ref": "#/definitions/handlers.HtsgetTicket"
+                }
+            }
+        },
+        "handlers.HtsgetTicket": {
+            "type": "object",
+            "properties": {
+                "format": {
+                    "type": "string"
+                },
+                "urls": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.HtsgetURL"
+                    }
+                }
+            }
+        },
+        "handlers.HtsgetURL": {
+            "type": "object",
+            "properties": {
+                "class": {
+                    "description": "header or body",
+                    "type": "string"
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.RefgetAlias": {
+            "type": "object",
+            "properties": {
+                "alias": {
+                    "description": "contig name, e.g. chr17",
+                    "type": "string"
+                },
+                "naming_authority": {
+                    "description": "the genome's reference version, or its name",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.RefgetMetadata": {
+            "type": "object",
+            "properties": {
+                "aliases": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.RefgetAlias"
+                    }
+                },
+                "ga4gh": {
+                    "description": "SQ.\u003csha512t24u\u003e",
+                    "type": "string"
+                },
+                "length": {
+                    "type": "integer"
+                },
+                "md5": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.RefgetMetadataResponse": {
+            "type": "object",
+            "properties": {
+                "metadata": {
+                    "$ref": "#/definitions/handlers.RefgetMetadata"
+                }
+            }
+        },
+        "handlers.ResetPasswordInput": {
+            "type": "object",
+            "required": [
+                "new_password"
+            ],
+            "properties": {
+                "new_password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 8
+                }
+            }
+        },
+        "handlers.SequenceQC": {
+            "type": "object",
+            "properties": {
+                "alignment": {
+                    "description": "for BAM and CRAM",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.AlignmentMetrics"
+                        }
+                    ]
+                },
+                "fastq": {
+                    "$ref": "#/definitions/models.FastqMetrics"
+                },
+                "job": {
+                    "description": "the latest QC job, with any problems found",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.IngestJob"
+                        }
+                    ]
+                },
+                "sequence_file_id": {
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "of the latest QC job",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ServiceAccountInput": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.StartUploadInput": {
+            "type": "object",
+            "required": [
+                "file_name",
+                "file_type",
+                "sample_id",
+                "size"
+            ],
+            "properties": {
+                "file_name": {
+                    "type": "string"
+                },
+                "file_type": {
+                    "description": "FASTQ, BAM or CRAM; VCF, JSON or GFF for variant files",
+                    "type": "string"
+                },
+                "genome_id": {
+                    "description": "required for variant files",
+                    "type": "integer"
+                },
+                "md5": {
+                    "description": "optional; the upload is rejected if it doesn't match",
+                    "type": "string"
+                },
+                "sample_id": {
+                    "type": "integer"
+                },
+                "sha256": {
+                    "description": "optional; the upload is rejected if it doesn't match",
+                    "type": "string"
+                },
+                "size": {
+                    "type": "integer",
+                    "minimum": 1
+                }
+            }
+        },
+        "handlers.UpdateSequenceFileInput": {
+            "type": "object",
+            "properties": {
+                "file_name": {
+                    "type": "string"
+                },
+                "file_path": {
+                    "type": "string"
+                },
+                "file_type": {
+                    "type": "string"
+                },
+                "sample_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.UpdateUserInput": {
+            "type": "object",
+            "properties": {
+                "email": {
+                    "type": "string"
+                },
+                "password": {
+                    "type": "string",
+                    "maxLength": 72,
+                    "minLength": 8
+                },
+                "role": {
+                    "type": "string",
+                    "enum": [
+                        "admin",
+                        "researcher",
+                        "lab_technician",
+                        "guest"
+                    ]
+                }
+            }
+        },
+        "headercheck.Issue": {
+            "type": "object",
+            "properties": {
+                "check": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "headercheck.Report": {
+            "type": "object",
+            "properties": {
+                "contigs": {
+                    "description": "contigs the header declares",
+                    "type": "integer"
+                },
+                "format": {
+                    "description": "BAM or VCF",
+                    "type": "string"
+                },
+                "genome": {
+                    "type": "string"
+                },
+                "issue_count": {
+                    "type": "integer"
+                },
+                "issues": {
+                    "description": "the first mismatches found",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/headercheck.Issue"
+                    }
+                },
+                "samples": {
+                    "description": "VCF sample columns or @RG SM values",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
+                "warnings": {
+                    "description": "what couldn't be checked, and why",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "integrity.Result": {
+            "type": "object",
+            "properties": {
+                "detail": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "verified_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "integrity.Summary": {
+            "type": "object",
+            "properties": {
+                "counts": {
+                    "description": "kind -\u003e status -\u003e files",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "object",
+                        "additionalProperties": {
+                            "type": "integer"
+                        }
+                    }
+                },
+                "last_scrub_completed_at": {
+                    "type": "string"
+                },
+                "scrub_requested": {
+                    "description": "an on-demand scrub is waiting to start",
+                    "type": "boolean"
+                }
+            }
+        },
+        "middleware.JWK": {
+            "type": "object",
+            "properties": {
+                "alg": {
+                    "type": "string"
+                },
+                "crv": {
+                    "type": "string"
+                },
+                "e": {
+                    "type": "string"
+                },
+                "kid": {
+                    "type": "string"
+                },
+                "kty": {
+                    "type": "string"
+                },
+                "n": {
+                    "type": "string"
+                },
+                "use": {
+                    "type": "string"
+                },
+                "x": {
+                    "type": "string"
+                },
+                "y": {
+                    "type": "string"
+                }
+            }
+        },
+        "middleware.RefreshInput": {
+            "type": "object",
+            "required": [
+                "refresh_token"
+            ],
+            "properties": {
+                "refresh_token": {
+                    "type": "string"
+                }
+            }
+        },
+        "middleware.TokenPair": {
+            "type": "object",
+            "properties": {
+                "expires_in": {
+                    "description": "access token lifetime in seconds",
+                    "type": "integer"
+                },
+                "refresh_token": {
+                    "type": "string"
+                },
+                "token": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "description": "space-separated, e.g. \"read:samples write:variants\"",
+                    "type": "string"
+                },
+                "service_account_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.AlignmentMetrics": {
+            "type": "object",
+            "properties": {
+                "assembly": {
+                    "description": "@SQ AS, if the header names one",
+                    "type": "string"
+                },
+                "computed_at": {
+                    "type": "string"
+                },
+                "duplicate_rate": {
+                    "description": "of total_reads",
+                    "type": "number"
+                },
+                "duplicates": {
+                    "type": "integer"
+                },
+                "format": {
+                    "description": "BAM or CRAM",
+                    "type": "string"
+                },
+                "mapped": {
+                    "type": "integer"
+                },
+                "mapped_rate": {
+                    "description": "of total_reads",
+                    "type": "number"
+                },
+                "mate_other_chrom": {
+                    "description": "mate mapped to a different reference",
+                    "type": "integer"
+                },
+                "paired": {
+                    "description": "primary alignments of paired reads",
+                    "type": "integer"
+                },
+                "programs": {
+                    "description": "@PG tag -\u003e value",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "properly_paired": {
+                    "type": "integer"
+                },
+                "properly_paired_rate": {
+                    "description": "of paired",
+                    "type": "number"
+                },
+                "qc_failed": {
+                    "type": "integer"
+                },
+                "read_groups": {
+                    "description": "@RG tag -\u003e value",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "reference_count": {
+                    "type": "integer"
+                },
+                "reference_sequences": {
+                    "description": "[{name, length}], from @SQ",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "secondary": {
+                    "type": "integer"
+                },
+                "sequence_file_id": {
+                    "type": "integer"
+                },
+                "singletons": {
+                    "description": "mapped, with the mate unmapped",
+                    "type": "integer"
+                },
+                "sort_order": {
+                    "description": "@HD SO",
+                    "type": "string"
+                },
+                "supplementary": {
+                    "type": "integer"
+                },
+                "total_reads": {
+                    "description": "alignments, secondary and supplementary included",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.AuditLog": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "details": {
+                    "description": "JSON: created/deleted state or per-field changes",
+                    "type": "string"
+                },
+                "hash": {
+                    "description": "SHA-256 over this entry's contents and PrevHash",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "prev_hash": {
+                    "description": "Hash of the previous entry",
+                    "type": "string"
+                },
+                "resource_id": {
+                    "type": "integer"
+                },
+                "resource_type": {
+                    "type": "string"
+                },
+                "service_account_id": {
+                    "description": "set when the actor used an API key",
+                    "type": "integer"
+                },
+                "timestamp": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "description": "null for failed logins of unknown users",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.Cohort": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "integer"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "sample_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                }
+            }
+        },
+        "models.Contig": {
+            "type": "object",
+            "properties": {
+                "fasta_offset": {
+                    "description": "where its first base is in the FASTA",
+                    "type": "integer"
+                },
+                "genome_id": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "length": {
+                    "type": "integer"
+                },
+                "line_bases": {
+                    "type": "integer"
+                },
+                "line_width": {
+                    "description": "bytes per line, with the line ending",
+                    "type": "integer"
+                },
+                "md5": {
+                    "description": "of the uppercase sequence, as refget computes it",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "sha512t24u": {
+                    "description": "GA4GH digest; the refget ID is SQ.\u003csha512t24u\u003e",
+                    "type": "string"
+                }
+            }
+        },
+        "models.FastqMetrics": {
+            "type": "object",
+            "properties": {
+                "bases": {
+                    "type": "integer"
+                },
+                "computed_at": {
+                    "type": "string"
+                },
+                "duplicate_rate": {
+                    "description": "estimated fraction of reads repeating an earlier one",
+                    "type": "number"
+                },
+                "gc_content": {
+                    "description": "fraction of A, C, G and T bases that are G or C",
+                    "type": "number"
+                },
+                "length_distribution": {
+                    "description": "[{min, max, reads}]",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "max_length": {
+                    "type": "integer"
+                },
+                "mean_length": {
+                    "type": "number"
+                },
+                "mean_quality": {
+                    "description": "Phred, over all bases",
+                    "type": "number"
+                },
+                "min_length": {
+                    "type": "integer"
+                },
+                "n_rate": {
+                    "description": "fraction of bases that are N",
+                    "type": "number"
+                },
+                "position_quality": {
+                    "description": "[{start, end, mean_quality}], 1-based",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "q30_rate": {
+                    "description": "fraction of bases with quality 30 or more",
+                    "type": "number"
+                },
+                "reads": {
+                    "type": "integer"
+                },
+                "sequence_file_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.Genome": {
             "type": "object",
             "properties": {
+                "contig_count": {
+                    "type": "integer"
+                },
                 "created_at": {
                     "type": "string"
                 },
                 "created_by": {
                     "type": "integer"
                 },
+                "fai_path": {
+                    "description": "storage key of its .fai index, if any",
+                    "type": "string"
+                },
+                "fasta_path": {
+                    "description": "storage key of the reference FASTA, uncompressed",
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
                 "name": {
                     "type": "string"
                 },
+                "reference_status": {
+                    "description": "contig indexing: queued, running, succeeded or failed; empty without a FASTA",
+                    "type": "string"
+                },
                 "reference_version": {
                     "type": "string"
                 },
@@ -888,6 +7000,104 @@ const docTemplate = `{
                 }
             }
         },
+        "models.IndexFile": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "description": "SHA-256, hex",
+                    "type": "string"
+                },
+                "file_name": {
+                    "description": "used for downloads",
+                    "type": "string"
+                },
+                "file_path": {
+                    "type": "string"
+                },
+                "format": {
+                    "description": "BAI, CSI, TBI or CRAI",
+                    "type": "string"
+                },
+                "generated": {
+                    "description": "built by the server rather than uploaded",
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "md5": {
+                    "type": "string"
+                },
+                "sequence_file_id": {
+                    "type": "integer"
+                },
+                "size_bytes": {
+                    "type": "integer"
+                },
+                "uploaded_at": {
+                    "type": "string"
+                },
+                "uploaded_by": {
+                    "description": "nil when generated or uploaded by a service account",
+                    "type": "integer"
+                },
+                "variant_file_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "models.IngestJob": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "error_count": {
+                    "type": "integer"
+                },
+                "errors": {
+                    "description": "the first IngestError values found",
+                    "type": "array",
+                    "items": {
+                        "type": "object"
+                    }
+                },
+                "finished_at": {
+                    "type": "string"
+                },
+                "genome_id": {
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "records": {
+                    "description": "records processed so far",
+                    "type": "integer"
+                },
+                "sequence_file_id": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "variant_file_id": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.Sample": {
             "type": "object",
             "properties": {
@@ -922,24 +7132,146 @@ const docTemplate = `{
             "type": "object",
             "properties": {
                 "checksum": {
+                    "description": "SHA-256, hex",
+                    "type": "string"
+                },
+                "file_name": {
+                    "description": "original name, used for downloads",
                     "type": "string"
                 },
                 "file_path": {
                     "type": "string"
                 },
                 "file_type": {
+                    "description": "FASTQ, BAM or CRAM",
+                    "type": "string"
+                },
+                "header_report": {
+                    "description": "headercheck.Report",
+                    "type": "object"
+                },
+                "header_status": {
+                    "description": "see headercheck.Status*; empty until checked",
                     "type": "string"
                 },
                 "id": {
                     "type": "integer"
                 },
+                "index_path": {
+                    "description": "storage key of the .bai, .csi or .crai index, if any",
+                    "type": "string"
+                },
+                "index_status": {
+                    "description": "latest index generation job: queued, running, succeeded or failed; empty if never run",
+                    "type": "string"
+                },
+                "last_verified_at": {
+                    "type": "string"
+                },
+                "md5": {
+                    "type": "string"
+                },
+                "qc_status": {
+                    "description": "latest QC job: queued, running, succeeded or failed; empty if never run",
+                    "type": "string"
+                },
                 "sample_id": {
                     "type": "integer"
                 },
+                "size_bytes": {
+                    "type": "integer"
+                },
                 "uploaded_at": {
                     "type": "string"
                 },
                 "uploaded_by": {
+                    "description": "nil for service account uploads",
+                    "type": "integer"
+                },
+                "verification_status": {
+                    "description": "see integrity.Status*; empty until first checked",
+                    "type": "string"
+                }
+            }
+        },
+        "models.ServiceAccount": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "created_by": {
+                    "type": "integer"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "disabled": {
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.UploadSession": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expected_md5": {
+                    "type": "string"
+                },
+                "expected_sha256": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "file_name": {
+                    "type": "string"
+                },
+                "file_type": {
+                    "type": "string"
+                },
+                "genome_id": {
+                    "description": "variant files only",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "kind": {
+                    "type": "string"
+                },
+                "received": {
+                    "type": "integer"
+                },
+                "sample_id": {
+                    "type": "integer"
+                },
+                "sequence_file_id": {
+                    "description": "set once a sequence file upload is complete",
+                    "type": "integer"
+                },
+                "service_account_id": {
+                    "type": "integer"
+                },
+                "size": {
+                    "type": "integer"
+                },
+                "updated_at": {
+                    "type": "string"
+                },
+                "user_id": {
+                    "type": "integer"
+                },
+                "variant_file_id": {
+                    "description": "set once a variant file upload is complete",
                     "type": "integer"
                 }
             }
@@ -956,38 +7288,144 @@ const docTemplate = `{
                 "id": {
                     "type": "integer"
                 },
+                "must_change_password": {
+                    "type": "boolean"
+                },
                 "role": {
                     "description": "admin, researcher, guest, lab_technician",
                     "type": "string"
                 }
             }
         },
+        "models.Variant": {
+            "type": "object",
+            "properties": {
+                "alt": {
+                    "type": "string"
+                },
+                "chrom": {
+                    "type": "string"
+                },
+                "end_pos": {
+                    "description": "last reference base covered",
+                    "type": "integer"
+                },
+                "filter": {
+                    "type": "string"
+                },
+                "genome_id": {
+                    "type": "integer"
+                },
+                "genotype": {
+                    "description": "GT of the file's sample",
+                    "type": "string"
+                },
+                "genotypes": {
+                    "description": "sample name -\u003e FORMAT key -\u003e value",
+                    "type": "object"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "info": {
+                    "description": "key -\u003e value; flags are true",
+                    "type": "object"
+                },
+                "line": {
+                    "description": "line number in the VCF",
+                    "type": "integer"
+                },
+                "pos": {
+                    "description": "1-based",
+                    "type": "integer"
+                },
+                "qual": {
+                    "type": "number"
+                },
+                "ref": {
+                    "type": "string"
+                },
+                "sample_id": {
+                    "type": "integer"
+                },
+                "variant_file_id": {
+                    "type": "integer"
+                },
+                "vcf_id": {
+                    "type": "string"
+                }
+            }
+        },
         "models.VariantFile": {
             "type": "object",
             "properties": {
                 "checksum": {
+                    "description": "SHA-256, hex",
+                    "type": "string"
+                },
+                "file_name": {
+                    "description": "original name, used for downloads",
                     "type": "string"
                 },
                 "file_path": {
                     "type": "string"
                 },
                 "file_type": {
+                    "description": "VCF, JSON or GFF",
                     "type": "string"
                 },
                 "genome_id": {
                     "type": "integer"
                 },
+                "header_report": {
+                    "description": "headercheck.Report",
+                    "type": "object"
+                },
+                "header_status": {
+                    "description": "see headercheck.Status*; empty until checked",
+                    "type": "string"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "index_path": {
+                    "description": "storage key of the .tbi or .csi index, if any",
+                    "type": "string"
+                },
+                "index_status": {
+                    "description": "latest index generation job: queued, running, succeeded or failed; empty if never run",
+                    "type": "string"
+                },
+                "ingest_status": {
+                    "description": "queued, running, succeeded or failed; empty if never ingested",
+                    "type": "string"
+                },
+                "last_verified_at": {
+                    "type": "string"
+                },
+                "md5": {
+                    "type": "string"
+                },
                 "sample_id": {
                     "type": "integer"
                 },
+                "size_bytes": {
+                    "type": "integer"
+                },
                 "uploaded_at": {
                     "type": "string"
                 },
                 "uploaded_by": {
+                    "description": "nil for service account uploads",
                     "type": "integer"
+                },
+                "variant_count": {
+                    "description": "records ingested into variants",
+                    "type": "integer"
+                },
+                "verification_status": {
+                    "description": "see integrity.Status*; empty until first checked",
+                    "type": "string"
                 }
             }
         }
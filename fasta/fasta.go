@@ -0,0 +1,281 @@
+// Package fasta reads reference FASTA files and their .fai indexes. A
+// Scanner goes through a FASTA one sequence at a time without holding the
+// bases in memory, working out the layout a .fai records and the digests
+// refget identifies sequences by.
+package fasta
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxHeaderLength bounds a > line, descriptions included
+const maxHeaderLength = 1 << 20
+
+// ParseError is a problem with one line of the file
+type ParseError struct {
+	Line int64
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Sequence is one sequence of a FASTA and where its bases are, as in a .fai
+type Sequence struct {
+	Name      string
+	Length    int64
+	Offset    int64 // file offset of the first base
+	LineBases int   // bases per line
+	LineWidth int   // bytes per line, with the line ending
+	Line      int64 // line number of the > header, or of the .fai entry
+
+	// Digests of the uppercase sequence, as refget computes them; empty for
+	// sequences read from a .fai
+	MD5        string // hex
+	SHA512t24u string // base64url of the first 24 bytes of the SHA-512
+}
+
+// Position is the file offset of the base at pos, 0-based
+func (s *Sequence) Position(pos int64) int64 {
+	if s.LineBases == 0 {
+		return s.Offset
+	}
+	return s.Offset + pos/int64(s.LineBases)*int64(s.LineWidth) + pos%int64(s.LineBases)
+}
+
+// Scanner reads the sequences of a FASTA in file order
+type Scanner struct {
+	r       *bufio.Reader
+	offset  int64 // file offset of the next byte
+	line    int64 // lines read
+	started bool  // the first header has been reached
+	scratch []byte
+	err     error
+}
+
+// NewScanner reads the uncompressed FASTA r
+func NewScanner(r io.Reader) *Scanner {
+	return &Scanner{r: bufio.NewReaderSize(r, 1<<16)}
+}
+
+// Next returns the next sequence, io.EOF after the last, or a *ParseError
+// for a file that can't be indexed. Once it fails it keeps failing.
+func (s *Scanner) Next() (*Sequence, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	seq, err := s.next()
+	if err != nil {
+		s.err = err
+	}
+	return seq, err
+}
+
+func (s *Scanner) next() (*Sequence, error) {
+	if !s.started {
+		magic, err := s.r.Peek(2)
+		if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+			return nil, &ParseError{Line: 1, Msg: "compressed FASTA; store it uncompressed so sequences can be read by offset"}
+		}
+		if err := s.skipToHeader(); err != nil {
+			return nil, err
+		}
+		s.started = true
+	}
+	if _, err := s.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	header, err := s.header()
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(header[1:]))
+	if len(fields) == 0 {
+		return nil, &ParseError{Line: s.line, Msg: "sequence has no name"}
+	}
+	seq := &Sequence{Name: fields[0], Offset: s.offset, Line: s.line}
+	md5sum, sha := md5.New(), sha512.New()
+
+	// Every line but the last must hold the same number of bases for the
+	// offsets of a .fai to work
+	last := false
+	for {
+		next, err := s.r.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next[0] == '>' {
+			break
+		}
+		bases, width, terminated, err := s.sequenceLine(md5sum, sha)
+		if err != nil {
+			return nil, err
+		}
+		if bases == 0 {
+			last = true // blank lines may only end the sequence
+			continue
+		}
+		if !terminated {
+			width = bases + 1
+		}
+		switch {
+		case last:
+			return nil, &ParseError{Line: s.line, Msg: fmt.Sprintf("%s has lines of different lengths", seq.Name)}
+		case seq.LineBases == 0:
+			seq.LineBases, seq.LineWidth = bases, width
+		case bases > seq.LineBases || (terminated && width-bases != seq.LineWidth-seq.LineBases):
+			return nil, &ParseError{Line: s.line, Msg: fmt.Sprintf("%s has lines of different lengths", seq.Name)}
+		case bases < seq.LineBases:
+			last = true
+		}
+		seq.Length += int64(bases)
+	}
+	seq.MD5 = hex.EncodeToString(md5sum.Sum(nil))
+	seq.SHA512t24u = base64.RawURLEncoding.EncodeToString(sha.Sum(nil)[:24])
+	return seq, nil
+}
+
+// skipToHeader skips blank lines before the first sequence
+func (s *Scanner) skipToHeader() error {
+	for {
+		next, err := s.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if next[0] == '>' {
+			return nil
+		}
+		line, err := s.header()
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			return &ParseError{Line: s.line, Msg: "expected a > header line"}
+		}
+	}
+}
+
+// piece reads the rest of the current line, or as much of it as the buffer
+// holds; complete reports whether the line ended
+func (s *Scanner) piece() ([]byte, bool, error) {
+	data, err := s.r.ReadSlice('\n')
+	s.offset += int64(len(data))
+	switch {
+	case err == bufio.ErrBufferFull:
+		return data, false, nil
+	case err == io.EOF && len(data) > 0:
+		s.line++
+		return data, true, nil
+	case err != nil:
+		return nil, false, err
+	}
+	s.line++
+	return data, true, nil
+}
+
+// header reads a whole line, which mustn't be longer than maxHeaderLength
+func (s *Scanner) header() ([]byte, error) {
+	var line []byte
+	number := s.line + 1
+	for {
+		data, complete, err := s.piece()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, data...)
+		if len(line) > maxHeaderLength {
+			return nil, &ParseError{Line: number, Msg: "header line too long"}
+		}
+		if complete {
+			return line, nil
+		}
+	}
+}
+
+// sequenceLine reads a line of bases into the digests, returning how many
+// bases and bytes it has and whether it ended with a newline
+func (s *Scanner) sequenceLine(digests ...hash.Hash) (bases, width int, terminated bool, err error) {
+	for {
+		data, complete, err := s.piece()
+		if err != nil {
+			return 0, 0, false, err
+		}
+		width += len(data)
+		if complete && bytes.HasSuffix(data, []byte{'\n'}) {
+			terminated = true
+		}
+		s.scratch = s.scratch[:0]
+		for _, b := range data {
+			switch {
+			case b == '\n' || b == '\r':
+			case 'a' <= b && b <= 'z':
+				s.scratch = append(s.scratch, b-'a'+'A')
+			case 'A' <= b && b <= 'Z', b == '*', b == '-':
+				s.scratch = append(s.scratch, b)
+			default:
+				line := s.line
+				if !complete {
+					line++
+				}
+				return 0, 0, false, &ParseError{Line: line, Msg: fmt.Sprintf("invalid base %q", b)}
+			}
+		}
+		for _, digest := range digests {
+			digest.Write(s.scratch)
+		}
+		bases += len(s.scratch)
+		if complete {
+			return bases, width, terminated, nil
+		}
+	}
+}
+
+// ReadIndex parses a .fai index
+func ReadIndex(r io.Reader) ([]Sequence, error) {
+	var seqs []Sequence
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxHeaderLength)
+	var line int64
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) < 5 {
+			return nil, &ParseError{Line: line, Msg: fmt.Sprintf("expected 5 tab-separated columns, got %d", len(fields))}
+		}
+		var numbers [4]int64
+		for i := range numbers {
+			n, err := strconv.ParseInt(fields[i+1], 10, 64)
+			if err != nil || n < 0 {
+				return nil, &ParseError{Line: line, Msg: fmt.Sprintf("invalid number %q", fields[i+1])}
+			}
+			numbers[i] = n
+		}
+		seqs = append(seqs, Sequence{
+			Name: fields[0], Length: numbers[0], Offset: numbers[1],
+			LineBases: int(numbers[2]), LineWidth: int(numbers[3]), Line: line,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return seqs, nil
+}
@@ -0,0 +1,193 @@
+package fasta
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/ref.fa.fai indexes testdata/ref.fa as samtools faidx does, and
+// these are the refget digests of its uppercase sequences
+var refDigests = map[string][2]string{
+	"chr1": {"231fe57c9ac9ce3e38a4b2700ed47334", "KE6GdHKPwaBO77h0XJ0NIeUwtVwwJ3Zo"},
+	"chr2": {"fb55466e3511e87858975c79efe5fe64", "ThaqCfUW65rXuwyht9pbQon3KoAZlR5o"},
+}
+
+// refBases are the bases of testdata/ref.fa, uppercase
+var refBases = map[string]string{
+	"chr1": "ACGTACGTACGTACGTNNNNACG",
+	"chr2": "GGGGCCCCTTAA",
+}
+
+func scanAll(t *testing.T, r io.Reader) ([]Sequence, error) {
+	t.Helper()
+	var seqs []Sequence
+	s := NewScanner(r)
+	for {
+		seq, err := s.Next()
+		if err == io.EOF {
+			return seqs, nil
+		}
+		if err != nil {
+			if again, _ := s.Next(); again != nil {
+				t.Error("Next succeeded after failing")
+			}
+			return seqs, err
+		}
+		seqs = append(seqs, *seq)
+	}
+}
+
+func TestScanner(t *testing.T) {
+	file, err := os.ReadFile("testdata/ref.fa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fai, err := os.Open("testdata/ref.fa.fai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fai.Close()
+	want, err := ReadIndex(fai)
+	if err != nil {
+		t.Fatalf("ReadIndex: %v", err)
+	}
+
+	seqs, err := scanAll(t, bytes.NewReader(file))
+	if err != nil {
+		t.Fatalf("Next: %v", err)
+	}
+	if len(seqs) != len(want) {
+		t.Fatalf("got %d sequences, want %d", len(seqs), len(want))
+	}
+	for i, seq := range seqs {
+		digests := refDigests[seq.Name]
+		if seq.MD5 != digests[0] || seq.SHA512t24u != digests[1] {
+			t.Errorf("%s digests = %s, %s; want %s, %s", seq.Name, seq.MD5, seq.SHA512t24u, digests[0], digests[1])
+		}
+		indexed := want[i]
+		seq.MD5, seq.SHA512t24u, seq.Line, indexed.Line = "", "", 0, 0
+		if seq != indexed {
+			t.Errorf("sequence %d = %+v, want %+v as in the .fai", i, seq, indexed)
+		}
+		bases := refBases[seq.Name]
+		for pos := range bases {
+			if b := file[seq.Position(int64(pos))]; b&^0x20 != bases[pos] {
+				t.Errorf("%s base %d at %d is %q, want %q", seq.Name, pos, seq.Position(int64(pos)), b, bases[pos])
+			}
+		}
+	}
+	if seqs[0].Line != 1 || seqs[1].Line != 5 {
+		t.Errorf("header lines = %d, %d; want 1, 5", seqs[0].Line, seqs[1].Line)
+	}
+}
+
+func TestScannerLayouts(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		fasta string
+		want  []Sequence
+	}{
+		{
+			name:  "CRLF",
+			fasta: ">s1\r\nACGT\r\nAC\r\n",
+			want:  []Sequence{{Name: "s1", Length: 6, Offset: 5, LineBases: 4, LineWidth: 6}},
+		},
+		{
+			name:  "no final newline",
+			fasta: ">s1\nACGT\nAC",
+			want:  []Sequence{{Name: "s1", Length: 6, Offset: 4, LineBases: 4, LineWidth: 5}},
+		},
+		{
+			name:  "blank lines before the first header and after a sequence",
+			fasta: "\n\n>s1\nACGT\n\n>s2\nA\n",
+			want: []Sequence{
+				{Name: "s1", Length: 4, Offset: 6, LineBases: 4, LineWidth: 5},
+				{Name: "s2", Length: 1, Offset: 16, LineBases: 1, LineWidth: 2},
+			},
+		},
+		{
+			name:  "empty sequence",
+			fasta: ">s1\n>s2\nAC\n",
+			want: []Sequence{
+				{Name: "s1", Offset: 4},
+				{Name: "s2", Length: 2, Offset: 8, LineBases: 2, LineWidth: 3},
+			},
+		},
+		{
+			name:  "gaps and stops",
+			fasta: ">p1 protein\nMK*-\n",
+			want:  []Sequence{{Name: "p1", Length: 4, Offset: 12, LineBases: 4, LineWidth: 5}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			seqs, err := scanAll(t, strings.NewReader(test.fasta))
+			if err != nil {
+				t.Fatalf("Next: %v", err)
+			}
+			for i := range seqs {
+				seqs[i].Line, seqs[i].MD5, seqs[i].SHA512t24u = 0, "", ""
+			}
+			if !reflect.DeepEqual(seqs, test.want) {
+				t.Errorf("got %+v, want %+v", seqs, test.want)
+			}
+		})
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte(">s1\nACGT\n"))
+	gz.Close()
+	for _, test := range []struct {
+		name  string
+		fasta string
+		line  int64
+		msg   string
+	}{
+		{"gzip", compressed.String(), 1, "compressed FASTA; store it uncompressed so sequences can be read by offset"},
+		{"text before the header", "\nACGT\n>s1\nACGT\n", 2, "expected a > header line"},
+		{"no name", ">s1\nACGT\n> \nACGT\n", 3, "sequence has no name"},
+		{"longer line", ">s1\nACG\nACGT\n", 3, "s1 has lines of different lengths"},
+		{"line after a shorter one", ">s1\nACGT\nAC\nACGT\n", 4, "s1 has lines of different lengths"},
+		{"line after a blank one", ">s1\nACGT\n\nACGT\n", 4, "s1 has lines of different lengths"},
+		{"mixed line endings", ">s1\nACGT\r\nACGT\nAC\n", 3, "s1 has lines of different lengths"},
+		{"invalid base", ">s1\nACGT\nAC1T\n", 3, `invalid base '1'`},
+		{"long header", ">" + strings.Repeat("s", maxHeaderLength) + "\nACGT\n", 1, "header line too long"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := scanAll(t, strings.NewReader(test.fasta))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != test.line || parseErr.Msg != test.msg {
+				t.Errorf("Next = %v, want line %d: %s", err, test.line, test.msg)
+			}
+		})
+	}
+}
+
+func TestReadIndexErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		fai  string
+		line int64
+		msg  string
+	}{
+		{"too few columns", "chr1\t23\t20\t10\n", 1, "expected 5 tab-separated columns, got 4"},
+		{"negative number", "chr1\t23\t20\t10\t11\nchr2\t-1\t52\t8\t9\n", 2, `invalid number "-1"`},
+		{"not a number", "chr1\t23\tx\t10\t11\n", 1, `invalid number "x"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadIndex(strings.NewReader(test.fai))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != test.line || parseErr.Msg != test.msg {
+				t.Errorf("ReadIndex = %v, want line %d: %s", err, test.line, test.msg)
+			}
+		})
+	}
+}
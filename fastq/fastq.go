@@ -0,0 +1,162 @@
+// Package fastq reads FASTQ files, plain or gzip-compressed, one read at a
+// time, and works out the quality metrics a sequencing run is judged by.
+package fastq
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// ParseError is a problem with one line of the file. The reads after it
+// can't be found reliably, so reading stops there.
+type ParseError struct {
+	Line int64
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Record is one read. Its slices are only valid until the next Read.
+type Record struct {
+	Line int64  // line number of the @ header
+	Name []byte // header without the @
+	Seq  []byte
+	Qual []byte // Phred+33
+}
+
+// Reader reads the records of a FASTQ in file order. Each record is four
+// lines; sequences wrapped over several lines aren't supported.
+type Reader struct {
+	r    *bufio.Reader
+	line int64
+	rec  Record
+	err  error
+}
+
+// NewReader reads r, decompressing it first if it is gzip or bgzip
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReaderSize(r, 1<<16)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// bgzip and concatenated gzip are series of members, which gzip reads
+		// as one stream
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		buffered = bufio.NewReaderSize(gz, 1<<16)
+	}
+	return &Reader{r: buffered}, nil
+}
+
+// Line is the number of the last line read
+func (r *Reader) Line() int64 {
+	return r.line
+}
+
+// Read returns the next record, io.EOF after the last one, or a
+// *ParseError. Once it fails it keeps failing.
+func (r *Reader) Read() (*Record, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	rec, err := r.read()
+	if err != nil {
+		r.err = err
+	}
+	return rec, err
+}
+
+func (r *Reader) read() (*Record, error) {
+	var err error
+	rec := &r.rec
+	// Blank lines between records, such as a trailing one, are allowed
+	for {
+		if rec.Name, err = r.readLine(rec.Name[:0]); err != nil {
+			return nil, err
+		}
+		if len(rec.Name) > 0 {
+			break
+		}
+	}
+	rec.Line = r.line
+	if rec.Name[0] != '@' {
+		return nil, r.errorf("expected a read header starting with @")
+	}
+	rec.Name = rec.Name[1:]
+
+	if rec.Seq, err = r.readLine(rec.Seq[:0]); err != nil {
+		return nil, r.truncated(err)
+	}
+	for _, b := range rec.Seq {
+		if !isBase(b) {
+			return nil, r.errorf("invalid base %q in sequence", b)
+		}
+	}
+	// The separator, which may repeat the name
+	var plus []byte
+	if plus, err = r.readLine(nil); err != nil {
+		return nil, r.truncated(err)
+	}
+	if len(plus) == 0 || plus[0] != '+' {
+		return nil, r.errorf("expected a + line after the sequence")
+	}
+	if rec.Qual, err = r.readLine(rec.Qual[:0]); err != nil {
+		return nil, r.truncated(err)
+	}
+	if len(rec.Qual) != len(rec.Seq) {
+		return nil, r.errorf("%d quality scores for %d bases", len(rec.Qual), len(rec.Seq))
+	}
+	for _, q := range rec.Qual {
+		if q < '!' || q > '~' {
+			return nil, r.errorf("invalid quality character %q", q)
+		}
+	}
+	return rec, nil
+}
+
+// readLine appends the next line to buf without its line ending. Lines can
+// be longer than the buffer, as long reads are.
+func (r *Reader) readLine(buf []byte) ([]byte, error) {
+	start := len(buf)
+	for {
+		piece, err := r.r.ReadSlice('\n')
+		buf = append(buf, piece...)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && len(buf) > start {
+			err = nil
+		}
+		if err != nil {
+			return buf, err
+		}
+		r.line++
+		for len(buf) > start && (buf[len(buf)-1] == '\n' || buf[len(buf)-1] == '\r') {
+			buf = buf[:len(buf)-1]
+		}
+		return buf, nil
+	}
+}
+
+func (r *Reader) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{Line: r.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// truncated turns the end of the file part way through a record into a
+// *ParseError
+func (r *Reader) truncated(err error) error {
+	if err == io.EOF {
+		return &ParseError{Line: r.line + 1, Msg: "file ends part way through a read"}
+	}
+	return err
+}
+
+// isBase reports whether b can appear in a read: an IUPAC code or '.'
+func isBase(b byte) bool {
+	return (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || b == '.'
+}
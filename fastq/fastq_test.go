@@ -0,0 +1,204 @@
+package fastq
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+// read is what Read gave for one record
+type read struct {
+	line            int64
+	name, seq, qual string
+}
+
+// readsFastq is testdata/reads.fastq, which has a blank line between its
+// second and third reads
+var readsFastq = []read{
+	{1, "r1 first read", "ACGTN", "IIII#"},
+	{5, "r2", "GGCC", "????"},
+	{10, "r3", "ACGTN", "!!!!!"},
+}
+
+func readAll(t *testing.T, r io.Reader) ([]read, error) {
+	t.Helper()
+	reader, err := NewReader(r)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	var reads []read
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			return reads, nil
+		}
+		if err != nil {
+			if again, _ := reader.Read(); again != nil {
+				t.Error("Read succeeded after failing")
+			}
+			return reads, err
+		}
+		reads = append(reads, read{rec.Line, string(rec.Name), string(rec.Seq), string(rec.Qual)})
+	}
+}
+
+func TestRead(t *testing.T) {
+	plain, err := os.ReadFile("testdata/reads.fastq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(plain)
+	gz.Close()
+	// bgzip output is a series of gzip members, here split mid-read
+	bgzipped := append(bgzf.Compress(plain[:20]), bgzf.Compress(plain[20:])...)
+	bgzipped = append(bgzipped, bgzf.EOF...)
+	crlf := bytes.ReplaceAll(plain, []byte("\n"), []byte("\r\n"))
+	noFinalNewline := bytes.TrimSuffix(plain, []byte("\n"))
+
+	for name, data := range map[string][]byte{
+		"plain": plain, "gzip": gzipped.Bytes(), "bgzip": bgzipped, "CRLF": crlf, "no final newline": noFinalNewline,
+	} {
+		t.Run(name, func(t *testing.T) {
+			reads, err := readAll(t, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(reads, readsFastq) {
+				t.Errorf("got %v, want %v", reads, readsFastq)
+			}
+		})
+	}
+}
+
+func TestReadLongRead(t *testing.T) {
+	// Longer than the reader's buffer
+	seq := strings.Repeat("ACGT", 1<<15)
+	qual := strings.Repeat("I", len(seq))
+	reads, err := readAll(t, strings.NewReader("@long\n"+seq+"\n+\n"+qual+"\n"))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if len(reads) != 1 || reads[0].seq != seq || reads[0].qual != qual {
+		t.Errorf("long read not read whole")
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		fastq string
+		reads int
+		line  int64
+		msg   string
+	}{
+		{"no header", "r1\nACGT\n+\nIIII\n", 0, 1, "expected a read header starting with @"},
+		{"FASTA", ">r1\nACGT\n", 0, 1, "expected a read header starting with @"},
+		{"invalid base", "@r1\nACGT\n+\nIIII\n@r2\nAC-T\n+\nIIII\n", 1, 6, `invalid base '-' in sequence`},
+		{"no separator", "@r1\nACGT\nIIII\n", 0, 3, "expected a + line after the sequence"},
+		{"short qualities", "@r1\nACGT\n+\nIII\n", 0, 4, "3 quality scores for 4 bases"},
+		{"invalid quality", "@r1\nACGT\n+\nII I\n", 0, 4, `invalid quality character ' '`},
+		{"wrapped sequence", "@r1\nACGT\nACGT\n+\nIIIIIIII\n", 0, 3, "expected a + line after the sequence"},
+		{"truncated", "@r1\nACGT\n+\nIIII\n@r2\nACGT\n", 1, 7, "file ends part way through a read"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			reads, err := readAll(t, strings.NewReader(test.fastq))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != test.line || parseErr.Msg != test.msg {
+				t.Errorf("Read = %v, want line %d: %s", err, test.line, test.msg)
+			}
+			if len(reads) != test.reads {
+				t.Errorf("%d reads before the error, want %d", len(reads), test.reads)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	f, err := os.Open("testdata/reads.fastq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := NewStats()
+	for {
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		stats.Add(rec)
+	}
+
+	// 14 bases: qualities 40, 40, 40, 40, 2; 30 x 4; 0 x 5. r3 repeats r1.
+	want := Metrics{
+		Reads: 3, Bases: 14, MinLength: 4, MaxLength: 5, MeanLength: 4.6667,
+		MeanQuality: 20.1429, Q30Rate: 0.5714, GCContent: 0.6667, NRate: 0.1429, DuplicateRate: 0.3333,
+		LengthDistribution: []LengthBin{{4, 4, 1}, {5, 5, 2}},
+		PositionQuality: []PositionBin{
+			{1, 1, 23.3333}, {2, 2, 23.3333}, {3, 3, 23.3333}, {4, 4, 23.3333},
+			// Only the two 5-base reads reach position 5
+			{5, 5, 1},
+		},
+	}
+	if got := stats.Metrics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Metrics = %+v\nwant %+v", got, want)
+	}
+	if stats.Reads() != 3 {
+		t.Errorf("Reads = %d, want 3", stats.Reads())
+	}
+}
+
+func TestMetricsBinsLongReads(t *testing.T) {
+	stats := NewStats()
+	for _, length := range []int{1000, 1001} {
+		stats.Add(&Record{Seq: []byte(strings.Repeat("A", length)), Qual: []byte(strings.Repeat("5", length))})
+	}
+	m := stats.Metrics()
+	// 1001 bases over 500 bins makes bins 3 wide
+	if want := []LengthBin{{1000, 1001, 2}}; !reflect.DeepEqual(m.LengthDistribution, want) {
+		t.Errorf("LengthDistribution = %v, want %v", m.LengthDistribution, want)
+	}
+	if len(m.PositionQuality) != 334 {
+		t.Fatalf("%d position bins, want 334", len(m.PositionQuality))
+	}
+	if first, last := m.PositionQuality[0], m.PositionQuality[333]; first != (PositionBin{1, 3, 20}) || last != (PositionBin{1000, 1001, 20}) {
+		t.Errorf("position bins run %+v to %+v", first, last)
+	}
+}
+
+func TestMetricsDuplicates(t *testing.T) {
+	stats := NewStats()
+	prefix := strings.Repeat("ACGT", 13)[:dupKeyLength]
+	for _, seq := range []string{
+		// Long reads are told apart by their first 50 bases only
+		prefix + strings.Repeat("A", 30),
+		prefix + strings.Repeat("C", 30),
+		// Short reads by all of them
+		"ACGTACGTAA",
+		"ACGTACGTAC",
+		"ACGTACGTAC",
+	} {
+		stats.Add(&Record{Seq: []byte(seq), Qual: bytes.Repeat([]byte("I"), len(seq))})
+	}
+	if rate := stats.Metrics().DuplicateRate; rate != 0.4 {
+		t.Errorf("DuplicateRate = %v, want 0.4", rate)
+	}
+	if m := NewStats().Metrics(); m.Reads != 0 || m.LengthDistribution == nil || m.PositionQuality == nil {
+		t.Errorf("empty Metrics = %+v", m)
+	}
+}
@@ -0,0 +1,183 @@
+package fastq
+
+import "math"
+
+const (
+	// maxBins is how many points the length distribution and per-position
+	// quality are reported at; longer reads are grouped into wider bins
+	maxBins = 500
+	// dupTracked is how many distinct sequences the duplicate estimate
+	// follows, as FastQC does
+	dupTracked = 100000
+	// dupKeyLength is how much of a read over dupLongRead bases identifies it
+	// for the duplicate estimate, since errors make long reads look unique
+	dupKeyLength = 50
+	dupLongRead  = 75
+)
+
+// 64-bit FNV-1a, inlined to avoid allocating a hash per read
+const (
+	fnvOffset uint64 = 14695981039346656037
+	fnvPrime  uint64 = 1099511628211
+)
+
+// Stats accumulates the metrics of a file's reads
+type Stats struct {
+	reads, bases   int64
+	gc, acgt, n    int64
+	minLength      int
+	maxLength      int
+	lengths        map[int]int64 // read length -> reads
+	qualSum        []int64       // summed quality by position
+	qualTotal, q30 int64
+	dupCounts      map[uint64]int64 // hash of a tracked sequence -> reads
+	dupReads       int64            // reads with a tracked sequence
+}
+
+// NewStats returns empty Stats
+func NewStats() *Stats {
+	return &Stats{lengths: map[int]int64{}, dupCounts: map[uint64]int64{}}
+}
+
+// Add counts one read
+func (s *Stats) Add(rec *Record) {
+	length := len(rec.Seq)
+	s.reads++
+	s.bases += int64(length)
+	if s.reads == 1 || length < s.minLength {
+		s.minLength = length
+	}
+	if length > s.maxLength {
+		s.maxLength = length
+	}
+	s.lengths[length]++
+
+	for _, b := range rec.Seq {
+		switch b {
+		case 'G', 'C', 'g', 'c':
+			s.gc++
+			s.acgt++
+		case 'A', 'T', 'a', 't':
+			s.acgt++
+		case 'N', 'n', '.':
+			s.n++
+		}
+	}
+	if len(s.qualSum) < length {
+		s.qualSum = append(s.qualSum, make([]int64, length-len(s.qualSum))...)
+	}
+	for i, q := range rec.Qual {
+		phred := int64(q - '!')
+		s.qualSum[i] += phred
+		s.qualTotal += phred
+		if phred >= 30 {
+			s.q30++
+		}
+	}
+
+	key := rec.Seq
+	if len(key) > dupLongRead {
+		key = key[:dupKeyLength]
+	}
+	sum := fnvOffset
+	for _, b := range key {
+		sum = (sum ^ uint64(b)) * fnvPrime
+	}
+	if _, ok := s.dupCounts[sum]; ok || len(s.dupCounts) < dupTracked {
+		s.dupCounts[sum]++
+		s.dupReads++
+	}
+}
+
+// Reads is how many reads have been added
+func (s *Stats) Reads() int64 {
+	return s.reads
+}
+
+// LengthBin is how many reads are Min to Max bases long
+type LengthBin struct {
+	Min   int   `json:"min"`
+	Max   int   `json:"max"`
+	Reads int64 `json:"reads"`
+}
+
+// PositionBin is the mean quality of the bases at positions Start to End,
+// 1-based, over the reads long enough to have them
+type PositionBin struct {
+	Start       int     `json:"start"`
+	End         int     `json:"end"`
+	MeanQuality float64 `json:"mean_quality"`
+}
+
+// Metrics summarise a file's reads
+type Metrics struct {
+	Reads         int64
+	Bases         int64
+	MinLength     int
+	MaxLength     int
+	MeanLength    float64
+	MeanQuality   float64 // Phred, over all bases
+	Q30Rate       float64 // fraction of bases with quality 30 or more
+	GCContent     float64 // fraction of A, C, G and T bases that are G or C
+	NRate         float64 // fraction of bases that are N
+	DuplicateRate float64 // estimated fraction of reads that repeat an earlier one
+
+	LengthDistribution []LengthBin
+	PositionQuality    []PositionBin
+}
+
+// Metrics works out the metrics of the reads added so far. The duplicate
+// rate is estimated from the reads of the first 100,000 distinct sequences
+// seen, so it undercounts duplicates of sequences that first appear later.
+func (s *Stats) Metrics() Metrics {
+	m := Metrics{
+		Reads: s.reads, Bases: s.bases, MinLength: s.minLength, MaxLength: s.maxLength,
+		MeanLength: ratio(s.bases, s.reads), MeanQuality: ratio(s.qualTotal, s.bases),
+		Q30Rate: ratio(s.q30, s.bases), GCContent: ratio(s.gc, s.acgt), NRate: ratio(s.n, s.bases),
+		LengthDistribution: []LengthBin{}, PositionQuality: []PositionBin{},
+	}
+	if s.dupReads > 0 {
+		m.DuplicateRate = ratio(s.dupReads-int64(len(s.dupCounts)), s.dupReads)
+	}
+	if s.reads == 0 {
+		return m
+	}
+
+	width := (s.maxLength + maxBins - 1) / maxBins
+	if width == 0 {
+		width = 1
+	}
+	for start := s.minLength; start <= s.maxLength; start += width {
+		bin := LengthBin{Min: start, Max: min(start+width-1, s.maxLength)}
+		for length := bin.Min; length <= bin.Max; length++ {
+			bin.Reads += s.lengths[length]
+		}
+		m.LengthDistribution = append(m.LengthDistribution, bin)
+	}
+
+	// covering[i] is how many reads have a base at position i
+	covering := make([]int64, s.maxLength)
+	remaining := s.reads
+	for i := range covering {
+		remaining -= s.lengths[i]
+		covering[i] = remaining
+	}
+	for start := 0; start < s.maxLength; start += width {
+		end := min(start+width, s.maxLength)
+		var sum, bases int64
+		for i := start; i < end; i++ {
+			sum += s.qualSum[i]
+			bases += covering[i]
+		}
+		m.PositionQuality = append(m.PositionQuality, PositionBin{Start: start + 1, End: end, MeanQuality: ratio(sum, bases)})
+	}
+	return m
+}
+
+// ratio is a/b rounded to 4 decimal places, or 0 when b is 0
+func ratio(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(float64(a)/float64(b)*1e4) / 1e4
+}
@@ -0,0 +1,158 @@
+// Package filetype validates the types declared for sequence and variant
+// files and recognises file formats by their first bytes, so a file can't
+// be registered as something it isn't.
+package filetype
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+
+	"genomic-api/bgzf"
+)
+
+// File types
+const (
+	FASTQ = "FASTQ"
+	BAM   = "BAM"
+	CRAM  = "CRAM"
+	VCF   = "VCF"
+	JSON  = "JSON"
+	GFF   = "GFF" // GFF3
+)
+
+// The types each kind of file can have
+var (
+	Sequence = []string{FASTQ, BAM, CRAM}
+	Variant  = []string{VCF, JSON, GFF}
+)
+
+// aliases are other spellings people use for a type, after trimming space
+// and dots and uppercasing
+var aliases = map[string]string{
+	"FQ": FASTQ, "FASTQ.GZ": FASTQ, "FQ.GZ": FASTQ,
+	"VCF.GZ": VCF, "VCF.BGZ": VCF,
+	"GFF3": GFF, "GFF.GZ": GFF, "GFF3.GZ": GFF,
+	"JSON.GZ": JSON,
+}
+
+// Normalize returns the type in allowed that declared names, ignoring case,
+// surrounding space and a leading dot, or an error listing the allowed types
+func Normalize(declared string, allowed []string) (string, error) {
+	name := strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(declared), "."))
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	for _, t := range allowed {
+		if name == t {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("invalid file_type %q: must be one of %s", declared, strings.Join(allowed, ", "))
+}
+
+// Compression of a file's content
+const (
+	Plain = "plain"
+	Gzip  = "gzip"
+	BGZF  = "bgzip"
+)
+
+// SniffLength is how much of the start of a file Sniff needs
+const SniffLength = 64 << 10
+
+// Content is what a file's first bytes show it to be
+type Content struct {
+	Type        string `json:"type"` // "" when not recognised
+	Compression string `json:"compression"`
+}
+
+func (c Content) String() string {
+	if c.Type == "" {
+		return "unrecognised"
+	}
+	if c.Compression == Plain {
+		return c.Type
+	}
+	return c.Compression + "-compressed " + c.Type
+}
+
+// Sniff recognises the format of a file from its first SniffLength bytes,
+// or all of it if shorter: BAM, CRAM, VCF, GFF3, FASTQ or JSON, plain or
+// gzip- or bgzip-compressed
+func Sniff(head []byte) Content {
+	content := Content{Compression: Plain}
+	if bytes.HasPrefix(head, []byte("CRAM")) {
+		content.Type = CRAM
+		return content
+	}
+	if len(head) >= 2 && head[0] == 0x1f && head[1] == 0x8b {
+		content.Compression = Gzip
+		if bgzf.IsBGZF(head) {
+			content.Compression = BGZF
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(head))
+		if err != nil {
+			return content
+		}
+		// head usually ends part way through the stream, so take what
+		// decompresses before it runs out
+		inflated, _ := io.ReadAll(io.LimitReader(gz, SniffLength))
+		head = inflated
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("BAM\x01")):
+		content.Type = BAM
+	case bytes.HasPrefix(head, []byte("##fileformat=VCF")):
+		content.Type = VCF
+	case bytes.HasPrefix(head, []byte("##gff-version 3")):
+		content.Type = GFF
+	case isFASTQ(head):
+		content.Type = FASTQ
+	case isJSON(head):
+		content.Type = JSON
+	}
+	return content
+}
+
+// isFASTQ reports whether head starts like a FASTQ: an @ header, then a
+// sequence line and a + line, unless the first read is longer than head
+func isFASTQ(head []byte) bool {
+	if len(head) == 0 || head[0] != '@' || bytes.HasPrefix(head, []byte("@HD\t")) {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(head))
+	scanner.Buffer(make([]byte, 0, len(head)), len(head)+1)
+	for line := 1; line <= 3; line++ {
+		if !scanner.Scan() {
+			return true
+		}
+		if line == 3 && !bytes.HasPrefix(scanner.Bytes(), []byte("+")) {
+			return false
+		}
+	}
+	return true
+}
+
+// isJSON reports whether head starts with an object or array
+func isJSON(head []byte) bool {
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return len(head) > 0 && (head[0] == '{' || head[0] == '[')
+}
+
+// Check returns an error describing how content disagrees with the declared
+// type, or nil if it agrees
+func Check(declared string, content Content) error {
+	switch {
+	case content.Type == "":
+		return fmt.Errorf("file_type is %s but the content is not recognisable as %s", declared, declared)
+	case content.Type != declared:
+		return fmt.Errorf("file_type is %s but the content is %s", declared, content)
+	case content.Type == BAM && content.Compression != BGZF:
+		return fmt.Errorf("file_type is BAM but the content is %s, not bgzip-compressed", content.Compression)
+	}
+	return nil
+}
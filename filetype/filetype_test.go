@@ -0,0 +1,141 @@
+package filetype
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func gzipped(data []byte) []byte {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	gz.Write(data)
+	gz.Close()
+	return b.Bytes()
+}
+
+func TestNormalize(t *testing.T) {
+	for _, test := range []struct {
+		declared string
+		allowed  []string
+		want     string
+	}{
+		{"bam", Sequence, BAM},
+		{" .cram ", Sequence, CRAM},
+		{"fq.gz", Sequence, FASTQ},
+		{"vcf.bgz", Variant, VCF},
+		{"GFF3", Variant, GFF},
+		{"json.gz", Variant, JSON},
+		{"vcf", Sequence, ""},
+		{"sam", Sequence, ""},
+	} {
+		got, err := Normalize(test.declared, test.allowed)
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("Normalize(%q) = %q, %v; want %q", test.declared, got, err, test.want)
+		}
+	}
+	_, err := Normalize("sam", Sequence)
+	if want := `invalid file_type "sam": must be one of FASTQ, BAM, CRAM`; err == nil || err.Error() != want {
+		t.Errorf("Normalize(sam) = %v, want %q", err, want)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	bam := readFile(t, "../bam/testdata/small.bam")
+	rawBAM, err := io.ReadAll(bgzf.NewReader(bytes.NewReader(bam)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastq := readFile(t, "../fastq/testdata/reads.fastq")
+	vcf := []byte("##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n")
+	// A read too long for the head still counts
+	longRead := []byte("@r1\n" + strings.Repeat("ACGT", SniffLength/4))
+	// Gzip of more than the head holds, cut off part way through
+	bigFASTQ := gzipped(bytes.Repeat(fastq, SniffLength))[:4096]
+	badGzip := append([]byte{0x1f, 0x8b, 0x09}, fastq...)
+
+	for _, test := range []struct {
+		name string
+		head []byte
+		want Content
+	}{
+		{"BAM", bam, Content{BAM, BGZF}},
+		{"gzip BAM", gzipped(rawBAM), Content{BAM, Gzip}},
+		{"uncompressed BAM", rawBAM, Content{BAM, Plain}},
+		{"CRAM", readFile(t, "../cram/testdata/small.cram"), Content{CRAM, Plain}},
+		{"VCF", vcf, Content{VCF, Plain}},
+		{"gzip VCF", gzipped(vcf), Content{VCF, Gzip}},
+		{"bgzip VCF", append(bgzf.Compress(vcf), bgzf.EOF...), Content{VCF, BGZF}},
+		{"GFF3", []byte("##gff-version 3\nchr1\t.\tgene\t1\t100\t.\t+\t.\tID=g1\n"), Content{GFF, Plain}},
+		{"FASTQ", fastq, Content{FASTQ, Plain}},
+		{"gzip FASTQ, cut short", bigFASTQ, Content{FASTQ, Gzip}},
+		{"long read", longRead, Content{FASTQ, Plain}},
+		{"JSON", []byte("\n  {\"variants\": []}"), Content{JSON, Plain}},
+		{"JSON array", []byte("[1, 2]"), Content{JSON, Plain}},
+		{"SAM", []byte("@HD\tVN:1.6\n@SQ\tSN:chr1\tLN:1000\n"), Content{"", Plain}},
+		{"FASTA", []byte(">chr1\nACGT\n"), Content{"", Plain}},
+		{"@ without a + line", []byte("@r1\nACGT\nIIII\n"), Content{"", Plain}},
+		{"broken gzip", badGzip, Content{"", Gzip}},
+		{"empty", nil, Content{"", Plain}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Sniff(test.head); got != test.want {
+				t.Errorf("Sniff = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range []struct {
+		declared string
+		content  Content
+		want     string
+	}{
+		{BAM, Content{BAM, BGZF}, ""},
+		{VCF, Content{VCF, Gzip}, ""},
+		{FASTQ, Content{FASTQ, Plain}, ""},
+		// BAM has to be BGZF for its index to point into it
+		{BAM, Content{BAM, Gzip}, "file_type is BAM but the content is gzip, not bgzip-compressed"},
+		{BAM, Content{BAM, Plain}, "file_type is BAM but the content is plain, not bgzip-compressed"},
+		{VCF, Content{BAM, BGZF}, "file_type is VCF but the content is bgzip-compressed BAM"},
+		{BAM, Content{CRAM, Plain}, "file_type is BAM but the content is CRAM"},
+		{FASTQ, Content{"", Gzip}, "file_type is FASTQ but the content is not recognisable as FASTQ"},
+	} {
+		err := Check(test.declared, test.content)
+		if (err == nil && test.want != "") || (err != nil && err.Error() != test.want) {
+			t.Errorf("Check(%s, %s) = %v, want %q", test.declared, test.content, err, test.want)
+		}
+	}
+	if got := (Content{}).String(); got != "unrecognised" {
+		t.Errorf("empty Content is %q, want unrecognised", got)
+	}
+}
+
+func TestCheckRejectsGzipBAM(t *testing.T) {
+	rawBAM, err := io.ReadAll(bgzf.NewReader(bytes.NewReader(readFile(t, "../bam/testdata/small.bam"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Recompressed with plain gzip, the file can't be indexed or sliced
+	if err := Check(BAM, Sniff(gzipped(rawBAM))); err == nil {
+		t.Error("Check accepted a BAM compressed with plain gzip")
+	}
+	if err := Check(BAM, Sniff(readFile(t, "../bam/testdata/small.bam"))); err != nil {
+		t.Errorf("Check rejected a BAM: %v", err)
+	}
+}
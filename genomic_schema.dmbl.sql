@@ -3,6 +3,7 @@ CREATE TABLE "users" (
   "email" varchar UNIQUE NOT NULL,
   "password_hash" varchar NOT NULL,
   "role" varchar,
+  "must_change_password" boolean NOT NULL DEFAULT false,
   "created_at" timestamp
 );
 
@@ -12,7 +13,23 @@ CREATE TABLE "genomes" (
   "species" varchar,
   "reference_version" varchar,
   "created_by" int,
-  "created_at" timestamp
+  "created_at" timestamp,
+  "fasta_path" varchar,
+  "fai_path" varchar,
+  "reference_status" varchar,
+  "contig_count" bigint NOT NULL DEFAULT 0
+);
+
+CREATE TABLE "contigs" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "genome_id" int NOT NULL,
+  "name" varchar NOT NULL,
+  "length" bigint NOT NULL,
+  "md5" varchar NOT NULL,
+  "sha512t24u" varchar NOT NULL,
+  "fasta_offset" bigint NOT NULL,
+  "line_bases" int NOT NULL,
+  "line_width" int NOT NULL
 );
 
 CREATE TABLE "samples" (
@@ -26,14 +43,80 @@ CREATE TABLE "samples" (
   "created_at" timestamp
 );
 
+CREATE TABLE "cohorts" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "name" varchar UNIQUE NOT NULL,
+  "description" varchar,
+  "created_by" int,
+  "created_at" timestamp
+);
+
+CREATE TABLE "cohort_samples" (
+  "cohort_id" int NOT NULL,
+  "sample_id" int NOT NULL,
+  PRIMARY KEY ("cohort_id", "sample_id")
+);
+
 CREATE TABLE "sequence_files" (
   "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
   "sample_id" int,
   "file_path" varchar,
+  "file_name" varchar,
   "file_type" varchar,
   "checksum" varchar,
+  "md5" varchar,
+  "size_bytes" bigint,
   "uploaded_by" int,
-  "uploaded_at" timestamp
+  "uploaded_at" timestamp,
+  "last_verified_at" timestamp,
+  "verification_status" varchar,
+  "index_path" varchar,
+  "header_status" varchar,
+  "header_report" jsonb,
+  "qc_status" varchar,
+  "index_status" varchar
+);
+
+CREATE TABLE "fastq_metrics" (
+  "sequence_file_id" int PRIMARY KEY,
+  "reads" bigint NOT NULL,
+  "bases" bigint NOT NULL,
+  "min_length" int NOT NULL,
+  "max_length" int NOT NULL,
+  "mean_length" double precision NOT NULL,
+  "mean_quality" double precision NOT NULL,
+  "q30_rate" double precision NOT NULL,
+  "gc_content" double precision NOT NULL,
+  "n_rate" double precision NOT NULL,
+  "duplicate_rate" double precision NOT NULL,
+  "length_distribution" jsonb,
+  "position_quality" jsonb,
+  "computed_at" timestamp
+);
+
+CREATE TABLE "alignment_metrics" (
+  "sequence_file_id" int PRIMARY KEY,
+  "format" varchar NOT NULL,
+  "sort_order" varchar,
+  "assembly" varchar,
+  "reference_count" int NOT NULL,
+  "reference_sequences" jsonb,
+  "read_groups" jsonb,
+  "programs" jsonb,
+  "total_reads" bigint NOT NULL,
+  "mapped" bigint,
+  "mapped_rate" double precision,
+  "paired" bigint,
+  "properly_paired" bigint,
+  "properly_paired_rate" double precision,
+  "duplicates" bigint,
+  "duplicate_rate" double precision,
+  "secondary" bigint,
+  "supplementary" bigint,
+  "qc_failed" bigint,
+  "singletons" bigint,
+  "mate_other_chrom" bigint,
+  "computed_at" timestamp
 );
 
 CREATE TABLE "variant_files" (
@@ -41,8 +124,34 @@ CREATE TABLE "variant_files" (
   "sample_id" int,
   "genome_id" int,
   "file_path" varchar,
+  "file_name" varchar,
   "file_type" varchar,
   "checksum" varchar,
+  "md5" varchar,
+  "size_bytes" bigint,
+  "uploaded_by" int,
+  "uploaded_at" timestamp,
+  "last_verified_at" timestamp,
+  "verification_status" varchar,
+  "ingest_status" varchar,
+  "variant_count" bigint NOT NULL DEFAULT 0,
+  "index_path" varchar,
+  "header_status" varchar,
+  "header_report" jsonb,
+  "index_status" varchar
+);
+
+CREATE TABLE "index_files" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "sequence_file_id" int UNIQUE,
+  "variant_file_id" int UNIQUE,
+  "format" varchar NOT NULL,
+  "file_path" varchar NOT NULL,
+  "file_name" varchar,
+  "checksum" varchar,
+  "md5" varchar,
+  "size_bytes" bigint,
+  "generated" boolean NOT NULL DEFAULT false,
   "uploaded_by" int,
   "uploaded_at" timestamp
 );
@@ -50,14 +159,240 @@ CREATE TABLE "variant_files" (
 CREATE TABLE "audit_logs" (
   "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
   "user_id" int,
+  "service_account_id" int,
   "action" varchar,
   "resource_type" varchar,
   "resource_id" int,
   "timestamp" timestamp,
-  "details" text
+  "details" text,
+  "prev_hash" varchar NOT NULL DEFAULT '',
+  "hash" varchar NOT NULL DEFAULT ''
+);
+
+CREATE TABLE "audit_checkpoints" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "audit_log_id" int NOT NULL,
+  "hash" varchar NOT NULL,
+  "signature" varchar,
+  "created_at" timestamp
+);
+
+CREATE TABLE "refresh_tokens" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "user_id" int NOT NULL,
+  "family_id" varchar NOT NULL,
+  "token_hash" varchar UNIQUE NOT NULL,
+  "access_jti" varchar NOT NULL,
+  "expires_at" timestamp NOT NULL,
+  "revoked_at" timestamp,
+  "created_at" timestamp
+);
+
+CREATE TABLE "revoked_tokens" (
+  "jti" varchar PRIMARY KEY,
+  "user_id" int,
+  "expires_at" timestamp NOT NULL,
+  "revoked_at" timestamp
+);
+
+CREATE TABLE "service_accounts" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "name" varchar UNIQUE NOT NULL,
+  "description" varchar,
+  "disabled" boolean NOT NULL DEFAULT false,
+  "created_by" int,
+  "created_at" timestamp
+);
+
+CREATE TABLE "api_keys" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "service_account_id" int NOT NULL,
+  "name" varchar,
+  "prefix" varchar UNIQUE NOT NULL,
+  "key_hash" varchar NOT NULL,
+  "scopes" varchar NOT NULL,
+  "expires_at" timestamp,
+  "last_used_at" timestamp,
+  "revoked_at" timestamp,
+  "created_at" timestamp
+);
+
+CREATE TABLE "upload_sessions" (
+  "id" varchar PRIMARY KEY,
+  "kind" varchar NOT NULL,
+  "sample_id" int,
+  "genome_id" int,
+  "file_type" varchar,
+  "file_name" varchar,
+  "size" bigint NOT NULL,
+  "received" bigint NOT NULL DEFAULT 0,
+  "expected_md5" varchar,
+  "expected_sha256" varchar,
+  "md5_state" bytea,
+  "sha256_state" bytea,
+  "user_id" int,
+  "service_account_id" int,
+  "sequence_file_id" int,
+  "variant_file_id" int,
+  "lock_token" varchar,
+  "locked_until" timestamp,
+  "expires_at" timestamp,
+  "created_at" timestamp,
+  "updated_at" timestamp
 );
 
-COMMENT ON COLUMN "users"."role" IS 'admin, researcher, guest';
+CREATE TABLE "variants" (
+  "id" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "variant_file_id" int NOT NULL,
+  "sample_id" int,
+  "genome_id" int,
+  "line" bigint,
+  "chrom" varchar NOT NULL,
+  "pos" bigint NOT NULL,
+  "end_pos" bigint NOT NULL,
+  "bin" int NOT NULL,
+  "vcf_id" varchar,
+  "ref" varchar NOT NULL,
+  "alt" varchar NOT NULL,
+  "qual" double precision,
+  "filter" varchar,
+  "info" jsonb,
+  "genotype" varchar,
+  "genotypes" jsonb
+);
+
+CREATE TABLE "ingest_jobs" (
+  "id" INT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+  "kind" varchar NOT NULL,
+  "variant_file_id" int,
+  "genome_id" int,
+  "sequence_file_id" int,
+  "status" varchar NOT NULL,
+  "records" bigint NOT NULL DEFAULT 0,
+  "error_count" int NOT NULL DEFAULT 0,
+  "errors" jsonb,
+  "attempts" int NOT NULL DEFAULT 0,
+  "created_at" timestamp,
+  "started_at" timestamp,
+  "finished_at" timestamp,
+  "updated_at" timestamp
+);
+
+CREATE INDEX ON "sequence_files" ("file_path");
+
+CREATE INDEX ON "sequence_files" ("last_verified_at");
+
+CREATE INDEX ON "variant_files" ("file_path");
+
+CREATE INDEX ON "variant_files" ("last_verified_at");
+
+CREATE INDEX ON "sequence_files" ("header_status");
+
+CREATE INDEX ON "sequence_files" ("qc_status");
+
+CREATE INDEX ON "variant_files" ("header_status");
+
+CREATE INDEX ON "index_files" ("file_path");
+
+CREATE INDEX ON "variants" ("variant_file_id");
+
+CREATE INDEX ON "variants" ("chrom", "bin", "pos");
+
+CREATE INDEX ON "variants" ("sample_id");
+
+CREATE INDEX ON "cohort_samples" ("sample_id");
+
+CREATE INDEX ON "ingest_jobs" ("status", "id");
+
+CREATE INDEX ON "ingest_jobs" ("variant_file_id");
+
+CREATE INDEX ON "ingest_jobs" ("genome_id");
+
+CREATE INDEX ON "ingest_jobs" ("sequence_file_id");
+
+CREATE INDEX ON "alignment_metrics" ("mapped_rate");
+
+CREATE INDEX ON "alignment_metrics" ("properly_paired_rate");
+
+CREATE INDEX ON "alignment_metrics" ("duplicate_rate");
+
+CREATE INDEX ON "contigs" ("genome_id", "name");
+
+CREATE INDEX ON "contigs" ("md5");
+
+CREATE INDEX ON "contigs" ("sha512t24u");
+
+CREATE INDEX ON "audit_logs" ("resource_type", "resource_id");
+
+CREATE INDEX ON "audit_logs" ("user_id");
+
+CREATE INDEX ON "audit_logs" ("timestamp");
+
+CREATE INDEX ON "refresh_tokens" ("user_id");
+
+CREATE INDEX ON "refresh_tokens" ("family_id");
+
+COMMENT ON COLUMN "users"."role" IS 'admin, researcher, lab_technician, guest';
+
+COMMENT ON COLUMN "genomes"."fasta_path" IS 'Storage key of the reference FASTA, uncompressed';
+
+COMMENT ON COLUMN "genomes"."fai_path" IS 'Storage key of its .fai index, checked against the FASTA';
+
+COMMENT ON COLUMN "genomes"."reference_status" IS 'Contig indexing: queued, running, succeeded or failed';
+
+COMMENT ON COLUMN "contigs"."md5" IS 'MD5 of the uppercase sequence, hex';
+
+COMMENT ON COLUMN "contigs"."sha512t24u" IS 'GA4GH digest; the refget ID is SQ.<sha512t24u>';
+
+COMMENT ON COLUMN "contigs"."fasta_offset" IS 'File offset of the first base, as in a .fai';
+
+COMMENT ON COLUMN "contigs"."line_width" IS 'Bytes per line, with the line ending';
+
+COMMENT ON COLUMN "sequence_files"."header_status" IS 'BAM header check: ok, mismatch or unchecked';
+
+COMMENT ON COLUMN "sequence_files"."header_report" IS '@SQ and @RG SM compared with the genome and donor';
+
+COMMENT ON COLUMN "sequence_files"."qc_status" IS 'Latest QC job: queued, running, succeeded or failed';
+
+COMMENT ON COLUMN "fastq_metrics"."mean_quality" IS 'Phred, over all bases';
+
+COMMENT ON COLUMN "fastq_metrics"."q30_rate" IS 'Fraction of bases with quality 30 or more';
+
+COMMENT ON COLUMN "fastq_metrics"."gc_content" IS 'Fraction of A, C, G and T bases that are G or C';
+
+COMMENT ON COLUMN "fastq_metrics"."duplicate_rate" IS 'Estimated from the first 100,000 distinct sequences';
+
+COMMENT ON COLUMN "fastq_metrics"."length_distribution" IS '[{min, max, reads}]';
+
+COMMENT ON COLUMN "fastq_metrics"."position_quality" IS '[{start, end, mean_quality}], 1-based positions';
+
+COMMENT ON COLUMN "alignment_metrics"."format" IS 'BAM or CRAM';
+
+COMMENT ON COLUMN "alignment_metrics"."sort_order" IS '@HD SO';
+
+COMMENT ON COLUMN "alignment_metrics"."assembly" IS '@SQ AS';
+
+COMMENT ON COLUMN "alignment_metrics"."reference_sequences" IS '[{name, length}] from @SQ';
+
+COMMENT ON COLUMN "alignment_metrics"."read_groups" IS '@RG lines as tag -> value';
+
+COMMENT ON COLUMN "alignment_metrics"."programs" IS '@PG lines as tag -> value';
+
+COMMENT ON COLUMN "alignment_metrics"."total_reads" IS 'Alignments, secondary and supplementary included';
+
+COMMENT ON COLUMN "alignment_metrics"."mapped" IS 'Flag counts as samtools flagstat gives them; null for CRAM';
+
+COMMENT ON COLUMN "alignment_metrics"."mapped_rate" IS 'Fraction of total_reads';
+
+COMMENT ON COLUMN "alignment_metrics"."paired" IS 'Primary alignments of paired reads';
+
+COMMENT ON COLUMN "alignment_metrics"."properly_paired_rate" IS 'Fraction of paired';
+
+COMMENT ON COLUMN "alignment_metrics"."duplicate_rate" IS 'Fraction of total_reads';
+
+COMMENT ON COLUMN "variant_files"."header_status" IS 'VCF header check: ok, mismatch or unchecked';
+
+COMMENT ON COLUMN "variant_files"."header_report" IS '##contig lines and sample columns compared with the genome and donor';
 
 COMMENT ON COLUMN "samples"."genome_id" IS 'Reference genome used for alignment';
 
@@ -69,10 +404,130 @@ COMMENT ON COLUMN "samples"."collected_by" IS 'User who collected or registered
 
 COMMENT ON COLUMN "sequence_files"."file_type" IS 'FASTQ, BAM, CRAM';
 
+COMMENT ON COLUMN "sequence_files"."file_path" IS 'Storage key; sha256/<prefix>/<sha256> for uploaded files';
+
+COMMENT ON COLUMN "sequence_files"."file_name" IS 'Original name, used for downloads';
+
+COMMENT ON COLUMN "sequence_files"."last_verified_at" IS 'When the scrubber last re-hashed the stored payload';
+
+COMMENT ON COLUMN "sequence_files"."verification_status" IS 'ok, mismatch, missing, no_checksum or error';
+
+COMMENT ON COLUMN "sequence_files"."checksum" IS 'SHA-256, hex';
+
+COMMENT ON COLUMN "sequence_files"."uploaded_by" IS 'Null for service account uploads';
+
+COMMENT ON COLUMN "sequence_files"."index_path" IS 'Storage key of the attached .bai, .csi or .crai index, used by htsget';
+
+COMMENT ON COLUMN "sequence_files"."index_status" IS 'Latest index generation job: queued, running, succeeded or failed';
+
+COMMENT ON COLUMN "upload_sessions"."kind" IS 'sequence_file or variant_file';
+
+COMMENT ON COLUMN "upload_sessions"."genome_id" IS 'Variant files only';
+
+COMMENT ON COLUMN "upload_sessions"."size" IS 'Total bytes announced when the upload was started';
+
+COMMENT ON COLUMN "upload_sessions"."received" IS 'Bytes received so far';
+
+COMMENT ON COLUMN "upload_sessions"."md5_state" IS 'Marshalled hash state after the last chunk';
+
+COMMENT ON COLUMN "upload_sessions"."sha256_state" IS 'Marshalled hash state after the last chunk';
+
+COMMENT ON COLUMN "upload_sessions"."sequence_file_id" IS 'Set once a sequence file upload is complete';
+
+COMMENT ON COLUMN "upload_sessions"."variant_file_id" IS 'Set once a variant file upload is complete';
+
+COMMENT ON COLUMN "upload_sessions"."lock_token" IS 'Lease of the request receiving a chunk';
+
+COMMENT ON COLUMN "upload_sessions"."locked_until" IS 'When that lease lapses unless renewed';
+
 COMMENT ON COLUMN "variant_files"."genome_id" IS 'Compared against this reference genome';
 
+COMMENT ON COLUMN "variant_files"."file_path" IS 'Storage key; sha256/<prefix>/<sha256> for uploaded files';
+
+COMMENT ON COLUMN "variant_files"."file_name" IS 'Original name, used for downloads';
+
+COMMENT ON COLUMN "variant_files"."last_verified_at" IS 'When the scrubber last re-hashed the stored payload';
+
+COMMENT ON COLUMN "variant_files"."verification_status" IS 'ok, mismatch, missing, no_checksum or error';
+
+COMMENT ON COLUMN "variant_files"."checksum" IS 'SHA-256, hex';
+
+COMMENT ON COLUMN "variant_files"."uploaded_by" IS 'Null for service account uploads';
+
 COMMENT ON COLUMN "variant_files"."file_type" IS 'VCF, JSON, GFF';
 
+COMMENT ON COLUMN "variant_files"."ingest_status" IS 'queued, running, succeeded or failed; null if never ingested';
+
+COMMENT ON COLUMN "variant_files"."variant_count" IS 'Records ingested into variants';
+
+COMMENT ON COLUMN "variant_files"."index_path" IS 'Storage key of the attached .tbi or .csi index, used by htsget';
+
+COMMENT ON COLUMN "variant_files"."index_status" IS 'Latest index generation job: queued, running, succeeded or failed';
+
+COMMENT ON COLUMN "index_files"."sequence_file_id" IS 'Set for a sequence file index; deleted with the file';
+
+COMMENT ON COLUMN "index_files"."variant_file_id" IS 'Set for a variant file index; deleted with the file';
+
+COMMENT ON COLUMN "index_files"."format" IS 'BAI, CSI, TBI or CRAI';
+
+COMMENT ON COLUMN "index_files"."file_path" IS 'Storage key; sha256/<prefix>/<sha256>';
+
+COMMENT ON COLUMN "index_files"."file_name" IS 'Used for downloads';
+
+COMMENT ON COLUMN "index_files"."checksum" IS 'SHA-256, hex';
+
+COMMENT ON COLUMN "index_files"."generated" IS 'Built by the server rather than uploaded';
+
+COMMENT ON COLUMN "index_files"."uploaded_by" IS 'Null when generated or uploaded by a service account';
+
+COMMENT ON COLUMN "variants"."line" IS 'Line number in the VCF';
+
+COMMENT ON COLUMN "variants"."pos" IS '1-based';
+
+COMMENT ON COLUMN "variants"."end_pos" IS 'Last reference base covered: INFO END or the end of ref';
+
+COMMENT ON COLUMN "variants"."bin" IS 'SAM binning scheme bin of [pos - 1, end_pos), for region queries';
+
+COMMENT ON COLUMN "variants"."alt" IS 'Comma-separated, as in the VCF';
+
+COMMENT ON COLUMN "variants"."filter" IS 'PASS, or semicolon-separated filters; empty when missing';
+
+COMMENT ON COLUMN "variants"."info" IS 'INFO key -> value; flags are true';
+
+COMMENT ON COLUMN "variants"."genotype" IS 'GT of the variant file sample';
+
+COMMENT ON COLUMN "variants"."genotypes" IS 'Sample name -> FORMAT key -> value, for every sample column';
+
+COMMENT ON COLUMN "ingest_jobs"."kind" IS 'variants, reference, qc, sequence_index or variant_index';
+
+COMMENT ON COLUMN "ingest_jobs"."status" IS 'queued, running, succeeded or failed';
+
+COMMENT ON COLUMN "ingest_jobs"."records" IS 'Records processed so far';
+
+COMMENT ON COLUMN "ingest_jobs"."errors" IS 'First errors found: [{line, message}]';
+
+COMMENT ON COLUMN "ingest_jobs"."updated_at" IS 'Heartbeat while running';
+
+COMMENT ON COLUMN "audit_logs"."user_id" IS 'Acting user; no foreign key so audit rows outlive deleted users';
+
+COMMENT ON COLUMN "audit_logs"."service_account_id" IS 'Acting service account for API key callers';
+
+COMMENT ON COLUMN "audit_logs"."details" IS 'JSON: created/deleted state or per-field before/after changes';
+
+COMMENT ON COLUMN "audit_logs"."hash" IS 'SHA-256 over the entry contents and prev_hash';
+
+COMMENT ON COLUMN "audit_checkpoints"."signature" IS 'HMAC-SHA256 of audit_log_id and hash with AUDIT_CHECKPOINT_KEY';
+
+COMMENT ON COLUMN "api_keys"."prefix" IS 'Public part of the key used for lookup';
+
+COMMENT ON COLUMN "api_keys"."scopes" IS 'Space-separated, e.g. read:samples write:variants';
+
+COMMENT ON COLUMN "refresh_tokens"."family_id" IS 'Shared by every rotation of one login session';
+
+COMMENT ON COLUMN "refresh_tokens"."access_jti" IS 'Access token issued together with this refresh token';
+
+COMMENT ON COLUMN "revoked_tokens"."user_id" IS 'No foreign key: a revocation must outlive a deleted user until the token expires';
+
 ALTER TABLE "genomes" ADD FOREIGN KEY ("created_by") REFERENCES "users" ("id");
 
 ALTER TABLE "samples" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" ("id");
@@ -89,7 +544,50 @@ ALTER TABLE "variant_files" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" (
 
 ALTER TABLE "variant_files" ADD FOREIGN KEY ("uploaded_by") REFERENCES "users" ("id");
 
-ALTER TABLE "audit_logs" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");
+ALTER TABLE "upload_sessions" ADD FOREIGN KEY ("sample_id") REFERENCES "samples" ("id");
+
+ALTER TABLE "upload_sessions" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" ("id");
+
+ALTER TABLE "upload_sessions" ADD FOREIGN KEY ("sequence_file_id") REFERENCES "sequence_files" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "upload_sessions" ADD FOREIGN KEY ("variant_file_id") REFERENCES "variant_files" ("id") ON DELETE SET NULL;
+
+ALTER TABLE "variants" ADD FOREIGN KEY ("variant_file_id") REFERENCES "variant_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "variants" ADD FOREIGN KEY ("sample_id") REFERENCES "samples" ("id");
+
+ALTER TABLE "variants" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" ("id");
+
+ALTER TABLE "cohorts" ADD FOREIGN KEY ("created_by") REFERENCES "users" ("id");
+
+ALTER TABLE "cohort_samples" ADD FOREIGN KEY ("cohort_id") REFERENCES "cohorts" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "cohort_samples" ADD FOREIGN KEY ("sample_id") REFERENCES "samples" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "ingest_jobs" ADD FOREIGN KEY ("variant_file_id") REFERENCES "variant_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "ingest_jobs" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "ingest_jobs" ADD FOREIGN KEY ("sequence_file_id") REFERENCES "sequence_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "fastq_metrics" ADD FOREIGN KEY ("sequence_file_id") REFERENCES "sequence_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "alignment_metrics" ADD FOREIGN KEY ("sequence_file_id") REFERENCES "sequence_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "index_files" ADD FOREIGN KEY ("sequence_file_id") REFERENCES "sequence_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "index_files" ADD FOREIGN KEY ("variant_file_id") REFERENCES "variant_files" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "index_files" ADD FOREIGN KEY ("uploaded_by") REFERENCES "users" ("id");
+
+ALTER TABLE "contigs" ADD FOREIGN KEY ("genome_id") REFERENCES "genomes" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "service_accounts" ADD FOREIGN KEY ("created_by") REFERENCES "users" ("id");
+
+ALTER TABLE "api_keys" ADD FOREIGN KEY ("service_account_id") REFERENCES "service_accounts" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "refresh_tokens" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
 
-INSERT INTO "users" (email, password_hash, role, created_at)
-VALUES ('admin@example.com', 'admin', 'admin', NOW());
+-- Seeded with a plaintext password; it is re-hashed with bcrypt on first successful login
+INSERT INTO "users" (email, password_hash, role, must_change_password, created_at)
+VALUES ('admin@example.com', 'admin', 'admin', true, NOW());
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/middleware"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recordAudit writes an audit entry attributed to the calling user or
+// service account. Call it inside the transaction making the change.
+func recordAudit(tx *gorm.DB, c *gin.Context, action, resourceType string, resourceID int, before, after interface{}) error {
+	return audit.Record(tx, auditEntry(c, action, resourceType, resourceID, before, after, nil))
+}
+
+// auditEntry builds an entry for the caller of c with optional extra details
+func auditEntry(c *gin.Context, action, resourceType string, resourceID int, before, after interface{}, extra map[string]interface{}) audit.Entry {
+	userID, _ := middleware.CurrentUserID(c)
+	accountID, _ := middleware.CurrentServiceAccountID(c)
+	return audit.Entry{
+		UserID:           userID,
+		ServiceAccountID: accountID,
+		Action:           action,
+		ResourceType:     resourceType,
+		ResourceID:       resourceID,
+		Before:           before,
+		After:            after,
+		Extra:            extra,
+	}
+}
+
+// auditLogList is what the audit list and export endpoints can filter and sort on
+var auditLogList = listSpec{
+	filters: map[string]filter{
+		"user_id":            {expr: "user_id = ?", kind: intParam},
+		"service_account_id": {expr: "service_account_id = ?", kind: intParam},
+		"resource_type":      {expr: "resource_type = ?"},
+		"resource_id":        {expr: "resource_id = ?", kind: intParam},
+		"action":             {expr: "action = ?"},
+		"from":               {expr: "timestamp >= ?", kind: timeParam},
+		"to":                 {expr: "timestamp < ?", kind: timeParam},
+	},
+	sorts:       map[string]string{"id": "id", "timestamp": "timestamp"},
+	defaultSort: "-timestamp,-id",
+}
+
+// ListAuditLogs godoc
+// @Summary      List audit log entries
+// @Description  Search the audit trail, newest first. The total is returned in X-Total-Count and page links in Link.
+// @Tags         audit
+// @Produce      json
+// @Param        user_id             query     int     false  "Acting user ID"
+// @Param        service_account_id  query     int     false  "Acting service account ID"
+// @Param        resource_type       query     string  false  "Resource type, e.g. sample"
+// @Param        resource_id         query     int     false  "Resource ID"
+// @Param        action              query     string  false  "Action, e.g. update"
+// @Param        from                query     string  false  "Start of period (inclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        to                  query     string  false  "End of period (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        sort                query     string  false  "Comma-separated keys: id, timestamp; prefix - for descending"
+// @Param        page                query     int     false  "Page number, from 1"
+// @Param        per_page            query     int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/audit [get]
+func ListAuditLogs(c *gin.Context) {
+	var logs []models.AuditLog
+	listPage(c, config.DB.Model(&models.AuditLog{}), auditLogList, &logs)
+}
+
+// ExportAuditLogs godoc
+// @Summary      Export audit log
+// @Description  Download every audit entry in a period as CSV or NDJSON, oldest first. Accepts the same filters as the list endpoint; from and to are required.
+// @Tags         audit
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Param        from    query     string  true   "Start of period (inclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        to      query     string  true   "End of period (exclusive), RFC 3339 or YYYY-MM-DD"
+// @Param        format  query     string  false  "csv (default) or ndjson"
+// @Success      200  {file}    file
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /api/audit/export [get]
+func ExportAuditLogs(c *gin.Context) {
+	if c.Query("from") == "" || c.Query("to") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from and to are required"})
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "ndjson" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or ndjson"})
+		return
+	}
+	query, err := auditLogList.applyFilters(c, config.DB.Model(&models.AuditLog{}))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Stream rows straight to the client so a long period isn't held in
+	// memory, and stop if the client goes away
+	rows, err := query.WithContext(c.Request.Context()).Order("timestamp, id").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("audit-%s-%s.%s", c.Query("from"), c.Query("to"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if format == "ndjson" {
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		for rows.Next() {
+			var entry models.AuditLog
+			if err := config.DB.ScanRows(rows, &entry); err != nil {
+				abortStream(c, err)
+				return
+			}
+			if err := encoder.Encode(entry); err != nil {
+				abortStream(c, err)
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			abortStream(c, err)
+		}
+		return
+	}
+
+	c.Header("Content-Type", "text/csv")
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "timestamp", "user_id", "service_account_id", "action", "resource_type", "resource_id", "details"})
+	for rows.Next() {
+		var entry models.AuditLog
+		if err := config.DB.ScanRows(rows, &entry); err != nil {
+			abortStream(c, err)
+			return
+		}
+		if err := writer.Write([]string{
+			strconv.Itoa(entry.ID),
+			entry.Timestamp.UTC().Format(time.RFC3339Nano),
+			optionalID(entry.UserID),
+			optionalID(entry.ServiceAccountID),
+			entry.Action,
+			entry.ResourceType,
+			strconv.Itoa(entry.ResourceID),
+			entry.Details,
+		}); err != nil {
+			abortStream(c, err)
+			return
+		}
+	}
+	if err := rows.Err(); err != nil {
+		abortStream(c, err)
+		return
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		abortStream(c, err)
+	}
+}
+
+// abortStream gives up on a streamed response. If nothing has been sent yet
+// the client gets a 500; otherwise the status has gone, so the connection is
+// closed before the body ends and the client sees a truncated transfer
+// rather than a complete but partial export.
+func abortStream(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var w http.ResponseWriter = c.Writer
+	for {
+		unwrapper, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = unwrapper.Unwrap()
+	}
+	if hijacker, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
+
+func optionalID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// resourceHistory returns a handler listing every audit entry for the
+// resource identified by the :id path parameter, oldest first.
+func resourceHistory(resourceType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+		var logs []models.AuditLog
+		if err := config.DB.Where("resource_type = ? AND resource_id = ?", resourceType, id).
+			Order("timestamp, id").Find(&logs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, logs)
+	}
+}
+
+// GetSampleHistory godoc
+// @Summary      Sample history
+// @Description  Every recorded change to a sample, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "Sample ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/samples/{id}/history [get]
+func GetSampleHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceSample)(c)
+}
+
+// GetCohortHistory godoc
+// @Summary      Cohort history
+// @Description  Every recorded change to a cohort, including its membership, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "Cohort ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/cohorts/{id}/history [get]
+func GetCohortHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceCohort)(c)
+}
+
+// GetGenomeHistory godoc
+// @Summary      Genome history
+// @Description  Every recorded change to a genome, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "Genome ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/genomes/{id}/history [get]
+func GetGenomeHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceGenome)(c)
+}
+
+// GetSequenceFileHistory godoc
+// @Summary      Sequence file history
+// @Description  Every recorded change to a sequence file, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "Sequence file ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/sequence/{id}/history [get]
+func GetSequenceFileHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceSequenceFile)(c)
+}
+
+// GetVariantFileHistory godoc
+// @Summary      Variant file history
+// @Description  Every recorded change to a variant file, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "Variant file ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/variants/{id}/history [get]
+func GetVariantFileHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceVariantFile)(c)
+}
+
+// GetUserHistory godoc
+// @Summary      User history
+// @Description  Every recorded change to a user account, including logins and password events, oldest first
+// @Tags         audit
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {array}   models.AuditLog
+// @Failure      400  {object}  map[string]string
+// @Router       /api/users/{id}/history [get]
+func GetUserHistory(c *gin.Context) {
+	resourceHistory(audit.ResourceUser)(c)
+}
+
+// VerifyAuditLog godoc
+// @Summary      Verify audit chain
+// @Description  Walk the whole audit trail, recomputing each entry's hash and link to its predecessor, and check every checkpoint. Reports the first broken link.
+// @Tags         audit
+// @Produce      json
+// @Success      200  {object}  audit.VerifyResult
+// @Router       /api/audit/verify [get]
+func VerifyAuditLog(c *gin.Context) {
+	result, err := audit.Verify(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
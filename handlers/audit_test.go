@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func auditRouter() http.Handler {
+	r := testRouter()
+	r.GET("/api/audit/export", ExportAuditLogs)
+	r.GET("/api/samples/:id/history", GetSampleHistory)
+	return r
+}
+
+// recordTestEntries audits a create and an update of two samples each,
+// and a login
+func recordTestEntries(t *testing.T) {
+	t.Helper()
+	for _, e := range []audit.Entry{
+		{UserID: testAdminID, Action: audit.ActionCreate, ResourceType: audit.ResourceSample, ResourceID: 1, After: map[string]string{"donor_id": "D1"}},
+		{UserID: testAdminID, Action: audit.ActionCreate, ResourceType: audit.ResourceSample, ResourceID: 2, After: map[string]string{"donor_id": "D2"}},
+		{UserID: testAdminID, Action: audit.ActionUpdate, ResourceType: audit.ResourceSample, ResourceID: 1,
+			Before: map[string]string{"donor_id": "D1"}, After: map[string]string{"donor_id": "D1b"}},
+		{UserID: testAdminID, Action: audit.ActionUpdate, ResourceType: audit.ResourceSample, ResourceID: 2,
+			Before: map[string]string{"donor_id": "D2"}, After: map[string]string{"donor_id": "D2b"}},
+		{UserID: testAdminID, Action: audit.ActionLogin, ResourceType: audit.ResourceUser, ResourceID: testAdminID},
+	} {
+		if err := audit.Record(config.DB, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// exportQuery selects today's sample entries
+func exportQuery(extra string) string {
+	today := time.Now().UTC()
+	return "/api/audit/export?resource_type=sample&from=" + today.AddDate(0, 0, -1).Format(time.DateOnly) +
+		"&to=" + today.AddDate(0, 0, 1).Format(time.DateOnly) + extra
+}
+
+func TestExportAuditLogs(t *testing.T) {
+	useTestDB(t)
+	recordTestEntries(t)
+	r := auditRouter()
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, exportQuery(""), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("CSV export: %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV export: %v", err)
+	}
+	if len(records) != 5 || records[0][0] != "id" || records[0][7] != "details" {
+		t.Fatalf("CSV export: %q", records)
+	}
+	for i, want := range []struct{ action, id string }{{"create", "1"}, {"create", "2"}, {"update", "1"}, {"update", "2"}} {
+		row := records[i+1]
+		if row[2] != strconv.Itoa(testAdminID) || row[3] != "" || row[4] != want.action || row[5] != audit.ResourceSample || row[6] != want.id {
+			t.Errorf("CSV row %d: %q, want %s of sample %s", i+1, row, want.action, want.id)
+		}
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, exportQuery("&format=ndjson&resource_id=2"), nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("NDJSON export: %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+	}
+	var actions []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("NDJSON line %q: %v", scanner.Text(), err)
+		}
+		if entry.ResourceID != 2 || entry.Hash == "" {
+			t.Errorf("NDJSON entry %+v", entry)
+		}
+		actions = append(actions, entry.Action)
+	}
+	if len(actions) != 2 || actions[0] != "create" || actions[1] != "update" {
+		t.Errorf("NDJSON actions %v, want create then update", actions)
+	}
+
+	// The period is half-open
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/api/audit/export?from=2000-01-01&to=2000-01-02", nil))
+	if records, _ := csv.NewReader(w.Body).ReadAll(); w.Code != http.StatusOK || len(records) != 1 {
+		t.Errorf("export of an empty period: %d %q", w.Code, records)
+	}
+}
+
+func TestExportAuditLogsBadRequests(t *testing.T) {
+	oldDB := config.DB
+	config.DB = dryRunDB(t)
+	t.Cleanup(func() { config.DB = oldDB })
+	r := auditRouter()
+
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"", "from and to are required"},
+		{"from=2025-01-01", "from and to are required"},
+		{"to=2025-01-01", "from and to are required"},
+		{"from=2025-01-01&to=2025-02-01&format=xml", "format must be csv or ndjson"},
+		{"from=2025-01-01&to=next-week", "invalid to: use RFC 3339 or YYYY-MM-DD"},
+		{"from=2025-01-01&to=2025-02-01&user_id=admin", "invalid user_id: must be an integer"},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			w := serve(r, httptest.NewRequest(http.MethodGet, "/api/audit/export?"+test.query, nil))
+			var body map[string]string
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusBadRequest || body["error"] != test.want {
+				t.Errorf("%d %q, want 400 %q", w.Code, body["error"], test.want)
+			}
+		})
+	}
+}
+
+func TestAbortStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/early", func(c *gin.Context) {
+		c.Header("Content-Disposition", "attachment")
+		abortStream(c, errors.New("query failed"))
+	})
+	r.GET("/late", func(c *gin.Context) {
+		c.Writer.WriteString("id,action\n1,create\n")
+		c.Writer.Flush()
+		abortStream(c, errors.New("connection to database lost"))
+	})
+
+	// Before anything is sent there's still a status to fail with
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/early", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("failure before streaming: %d %v %s", w.Code, w.Header(), w.Body)
+	}
+
+	// Afterwards the client has to see the body break off
+	server := httptest.NewServer(r)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/late")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("reading a broken-off body = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if !bytes.Equal(body, []byte("id,action\n1,create\n")) {
+		t.Errorf("body %q", body)
+	}
+}
+
+func TestResourceHistory(t *testing.T) {
+	useTestDB(t)
+	recordTestEntries(t)
+	r := auditRouter()
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/api/samples/1/history", nil))
+	var logs []models.AuditLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if w.Code != http.StatusOK || len(logs) != 2 || logs[0].Action != "create" || logs[1].Action != "update" {
+		t.Fatalf("history: %d %s", w.Code, w.Body)
+	}
+	for _, entry := range logs {
+		if entry.ResourceType != audit.ResourceSample || entry.ResourceID != 1 {
+			t.Errorf("history of sample 1 has %+v", entry)
+		}
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodGet, "/api/samples/99/history", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "[]" {
+		t.Errorf("history of a sample with none: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestResourceHistoryInvalidID(t *testing.T) {
+	r := auditRouter()
+	for _, id := range []string{"abc", "1x", "1.5", "99999999999999999999"} {
+		w := serve(r, httptest.NewRequest(http.MethodGet, "/api/samples/"+id+"/history", nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("history of sample %s: %d %s", id, w.Code, w.Body)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"genomic-api/config"
+	"genomic-api/middleware"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// beaconAPIVersion is the Beacon specification implemented
+const beaconAPIVersion = "v2.0.0"
+
+// Response granularities, from least to most revealing. Record-level
+// responses aren't offered: they would expose the raw data.
+const (
+	granularityNone    = "none"
+	granularityBoolean = "boolean"
+	granularityCount   = "count"
+)
+
+var granularityRank = map[string]int{granularityNone: 0, granularityBoolean: 1, granularityCount: 2}
+
+// basesPattern is a valid referenceBases or alternateBases value
+var basesPattern = regexp.MustCompile(`^[ACGTN]+$`)
+
+// variantSchema is the only entry type this beacon returns
+var variantSchema = BeaconSchema{EntityType: "genomicVariant", Schema: "beacon-g_variant-v2.0.0"}
+
+// BeaconSchema names the schema of returned entries
+type BeaconSchema struct {
+	EntityType string `json:"entityType"`
+	Schema     string `json:"schema"`
+}
+
+// BeaconPagination is the paging a request asked for; counts aren't paged
+type BeaconPagination struct {
+	Skip  int `json:"skip"`
+	Limit int `json:"limit"`
+}
+
+// BeaconRequestParameters are the supported genomic variant query parameters.
+// Coordinates are 0-based; start and end hold one value, or two for a
+// bracket query.
+type BeaconRequestParameters struct {
+	AssemblyID     string  `json:"assemblyId,omitempty"`
+	ReferenceName  string  `json:"referenceName,omitempty"`
+	Start          []int64 `json:"start,omitempty"`
+	End            []int64 `json:"end,omitempty"`
+	ReferenceBases string  `json:"referenceBases,omitempty"`
+	AlternateBases string  `json:"alternateBases,omitempty"`
+	VariantType    string  `json:"variantType,omitempty"` // not supported
+	GeneID         string  `json:"geneId,omitempty"`      // not supported
+}
+
+// BeaconRequest is the body of a POST query
+type BeaconRequest struct {
+	Meta struct {
+		APIVersion string `json:"apiVersion"`
+	} `json:"meta"`
+	Query struct {
+		RequestParameters    BeaconRequestParameters `json:"requestParameters"`
+		RequestedGranularity string                  `json:"requestedGranularity"`
+	} `json:"query"`
+}
+
+// BeaconRequestSummary echoes what was asked
+type BeaconRequestSummary struct {
+	APIVersion           string                  `json:"apiVersion"`
+	RequestedSchemas     []BeaconSchema          `json:"requestedSchemas"`
+	Pagination           BeaconPagination        `json:"pagination"`
+	RequestedGranularity string                  `json:"requestedGranularity"`
+	RequestParameters    BeaconRequestParameters `json:"requestParameters"`
+}
+
+// BeaconMeta describes the beacon and the response
+type BeaconMeta struct {
+	BeaconID               string                `json:"beaconId"`
+	APIVersion             string                `json:"apiVersion"`
+	ReturnedGranularity    string                `json:"returnedGranularity"`
+	ReceivedRequestSummary *BeaconRequestSummary `json:"receivedRequestSummary,omitempty"`
+	ReturnedSchemas        []BeaconSchema        `json:"returnedSchemas"`
+}
+
+// BeaconResponseSummary answers a query; the count is left out of boolean
+// responses
+type BeaconResponseSummary struct {
+	Exists          bool   `json:"exists"`
+	NumTotalResults *int64 `json:"numTotalResults,omitempty"`
+}
+
+// BeaconResponse is a boolean or count response
+type BeaconResponse struct {
+	Meta            BeaconMeta            `json:"meta"`
+	ResponseSummary BeaconResponseSummary `json:"responseSummary"`
+}
+
+// BeaconError is why a query failed
+type BeaconError struct {
+	ErrorCode    int    `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// BeaconErrorResponse is returned for invalid or refused queries
+type BeaconErrorResponse struct {
+	Meta  BeaconMeta  `json:"meta"`
+	Error BeaconError `json:"error"`
+}
+
+// BeaconOrganization runs the beacon
+type BeaconOrganization struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// BeaconInfo describes the beacon
+type BeaconInfo struct {
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	APIVersion   string                 `json:"apiVersion"`
+	Environment  string                 `json:"environment"`
+	Organization BeaconOrganization     `json:"organization"`
+	Info         map[string]interface{} `json:"info"`
+}
+
+// BeaconInfoResponse is the body of /beacon/info
+type BeaconInfoResponse struct {
+	Meta     BeaconMeta `json:"meta"`
+	Response BeaconInfo `json:"response"`
+}
+
+// beaconSetting is a BEACON_* environment variable, or fallback if unset
+func beaconSetting(name, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// beaconGranularity is the most a caller may be told: anonymous callers get
+// BEACON_PUBLIC_GRANULARITY (boolean by default) and authenticated partners
+// BEACON_PARTNER_GRANULARITY (count by default), never less than the public
+// level. Unrecognised settings disable the beacon for those callers.
+func beaconGranularity(c *gin.Context) string {
+	level := func(name, fallback string) string {
+		value := strings.ToLower(beaconSetting(name, fallback))
+		if _, ok := granularityRank[value]; !ok {
+			return granularityNone
+		}
+		return value
+	}
+	public := level("BEACON_PUBLIC_GRANULARITY", granularityBoolean)
+	_, isUser := middleware.CurrentUserID(c)
+	_, isService := middleware.CurrentServiceAccountID(c)
+	if !isUser && !isService {
+		return public
+	}
+	if partner := level("BEACON_PARTNER_GRANULARITY", granularityCount); granularityRank[partner] > granularityRank[public] {
+		return partner
+	}
+	return public
+}
+
+// beaconMinCount is the fewest samples a match may be reported from
+// (BEACON_MIN_COUNT, default 5); rarer matches are reported as none
+func beaconMinCount() int64 {
+	count, err := strconv.ParseInt(beaconSetting("BEACON_MIN_COUNT", "5"), 10, 64)
+	if err != nil || count < 1 {
+		return 5
+	}
+	return count
+}
+
+func beaconMeta(granularity string) BeaconMeta {
+	return BeaconMeta{
+		BeaconID:            beaconSetting("BEACON_ID", "genomic-api"),
+		APIVersion:          beaconAPIVersion,
+		ReturnedGranularity: granularity,
+		ReturnedSchemas:     []BeaconSchema{variantSchema},
+	}
+}
+
+func beaconError(c *gin.Context, status int, message string) {
+	c.JSON(status, BeaconErrorResponse{
+		Meta:  beaconMeta(granularityNone),
+		Error: BeaconError{ErrorCode: status, ErrorMessage: message},
+	})
+}
+
+// GetBeaconInfo godoc
+// @Summary      Beacon info
+// @Description  GA4GH Beacon v2 information about this beacon: who runs it, the assemblies it holds variants for, and the most detailed response the caller can get
+// @Tags         beacon
+// @Produce      json
+// @Success      200  {object}  BeaconInfoResponse
+// @Router       /beacon [get]
+// @Router       /beacon/info [get]
+func GetBeaconInfo(c *gin.Context) {
+	var assemblies []string
+	if err := config.DB.Model(&models.Genome{}).Distinct("reference_version").
+		Where("reference_version <> ''").Order("reference_version").Pluck("reference_version", &assemblies).Error; err != nil {
+		beaconError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	granularity := beaconGranularity(c)
+	c.JSON(http.StatusOK, BeaconInfoResponse{
+		Meta: beaconMeta(granularity),
+		Response: BeaconInfo{
+			ID:          beaconSetting("BEACON_ID", "genomic-api"),
+			Name:        beaconSetting("BEACON_NAME", "Genomic API Beacon"),
+			APIVersion:  beaconAPIVersion,
+			Environment: beaconSetting("BEACON_ENVIRONMENT", "prod"),
+			Organization: BeaconOrganization{
+				ID:   beaconSetting("BEACON_ORGANIZATION_ID", "genomic-api"),
+				Name: beaconSetting("BEACON_ORGANIZATION_NAME", "Genomic API"),
+			},
+			Info: map[string]interface{}{
+				"assemblyIds":      assemblies,
+				"maxGranularity":   granularity,
+				"minCountReported": beaconMinCount(),
+			},
+		},
+	})
+}
+
+// beaconQuery reads a query from the URL (GET) or the JSON body (POST)
+func beaconQuery(c *gin.Context) (BeaconRequestParameters, string, error) {
+	if c.Request.Method == http.MethodPost {
+		var request BeaconRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			return BeaconRequestParameters{}, "", err
+		}
+		return request.Query.RequestParameters, request.Query.RequestedGranularity, nil
+	}
+	params := BeaconRequestParameters{
+		AssemblyID:     c.Query("assemblyId"),
+		ReferenceName:  c.Query("referenceName"),
+		ReferenceBases: c.Query("referenceBases"),
+		AlternateBases: c.Query("alternateBases"),
+		VariantType:    c.Query("variantType"),
+		GeneID:         c.Query("geneId"),
+	}
+	for _, param := range []struct {
+		name   string
+		values *[]int64
+	}{{"start", &params.Start}, {"end", &params.End}} {
+		text := c.Query(param.name)
+		if text == "" {
+			continue
+		}
+		for _, part := range strings.Split(text, ",") {
+			value, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				return params, "", &beaconInputError{"invalid " + param.name + " " + strconv.Quote(part)}
+			}
+			*param.values = append(*param.values, value)
+		}
+	}
+	return params, c.Query("requestedGranularity"), nil
+}
+
+// beaconInputError is a query the beacon can't answer
+type beaconInputError struct {
+	message string
+}
+
+func (e *beaconInputError) Error() string {
+	return e.message
+}
+
+// beaconVariants counts the distinct variants matching params, and the
+// samples carrying them. Only records whose sample carries a non-reference
+// allele count, or that have no genotype at all (sites-only VCFs).
+func beaconVariants(params BeaconRequestParameters) (variants, samples int64, err error) {
+	if params.VariantType != "" || params.GeneID != "" {
+		return 0, 0, &beaconInputError{"variantType and geneId queries are not supported"}
+	}
+	if params.ReferenceName == "" {
+		return 0, 0, &beaconInputError{"referenceName is required"}
+	}
+	for _, bases := range []*string{&params.ReferenceBases, &params.AlternateBases} {
+		*bases = strings.ToUpper(*bases)
+		if *bases != "" && !basesPattern.MatchString(*bases) {
+			return 0, 0, &beaconInputError{"referenceBases and alternateBases must be made up of A, C, G, T and N"}
+		}
+	}
+	for _, value := range append(append([]int64{}, params.Start...), params.End...) {
+		if value < 0 {
+			return 0, 0, &beaconInputError{"start and end must not be negative"}
+		}
+	}
+
+	query := ingestedVariants()
+	start, end := params.Start, params.End
+	switch {
+	case len(start) == 1 && len(end) == 0:
+		// Sequence query: an allele at one position
+		if params.AlternateBases == "" {
+			return 0, 0, &beaconInputError{"alternateBases is required without end"}
+		}
+		pos := start[0] + 1
+		query = inRegion(query, region{Chrom: params.ReferenceName, Start: pos, End: pos}).Where("pos = ?", pos)
+	case len(start) == 1 && len(end) == 1:
+		// Range query: anything overlapping [start, end)
+		if end[0] <= start[0] {
+			return 0, 0, &beaconInputError{"end must be greater than start"}
+		}
+		query = inRegion(query, region{Chrom: params.ReferenceName, Start: start[0] + 1, End: end[0]})
+	case len(start) == 2 && len(end) == 2:
+		// Bracket query: starting within one interval and ending within another
+		if start[1] < start[0] || end[1] < end[0] || end[1] <= start[0] {
+			return 0, 0, &beaconInputError{"start and end brackets must be in order"}
+		}
+		query = inRegion(query, region{Chrom: params.ReferenceName, Start: start[0] + 1, End: end[1]}).
+			Where("pos BETWEEN ? AND ? AND end_pos BETWEEN ? AND ?", start[0]+1, start[1]+1, end[0], end[1])
+	default:
+		return 0, 0, &beaconInputError{"give start, start and end, or two-value start and end brackets"}
+	}
+	if params.AssemblyID != "" {
+		query = query.Where("genome_id IN (?)", config.DB.Model(&models.Genome{}).Select("id").
+			Where("lower(reference_version) = lower(?)", params.AssemblyID))
+	}
+	// N stands for any base
+	if params.ReferenceBases != "" && params.ReferenceBases != "N" {
+		query = query.Where("ref = ?", params.ReferenceBases)
+	}
+	if params.AlternateBases != "" && params.AlternateBases != "N" {
+		query = query.Where("? = ANY(string_to_array(alt, ','))", params.AlternateBases)
+	}
+	query = query.Where("(coalesce(genotype, '') = '' OR genotype ~ '[1-9]')")
+
+	var result struct {
+		Variants int64
+		Samples  int64
+	}
+	err = query.Select("count(DISTINCT (regexp_replace(chrom, '^chr', ''), pos, ref, alt)) AS variants, " +
+		"count(DISTINCT sample_id) AS samples").Scan(&result).Error
+	return result.Variants, result.Samples, err
+}
+
+// QueryBeaconVariants godoc
+// @Summary      Beacon genomic variants query
+// @Description  GA4GH Beacon v2: does any sample carry a variant? Sequence queries give start, referenceBases and alternateBases; range queries give start and end; bracket queries give two-value start and end. Coordinates are 0-based. Anonymous callers and authenticated partners get the granularity configured for them; a match found in fewer samples than BEACON_MIN_COUNT is reported as no match at all.
+// @Tags         beacon
+// @Accept       json
+// @Produce      json
+// @Param        assemblyId            query  string         false  "Assembly, matched against genomes' reference_version, e.g. GRCh38"
+// @Param        referenceName         query  string         false  "Chromosome, e.g. 17 or chr17"
+// @Param        start                 query  string         false  "0-based start, or two comma-separated values for a bracket query"
+// @Param        end                   query  string         false  "0-based exclusive end, or two comma-separated values"
+// @Param        referenceBases        query  string         false  "Reference allele; N for any"
+// @Param        alternateBases        query  string         false  "Alternate allele; N for any"
+// @Param        requestedGranularity  query  string         false  "boolean or count"
+// @Param        request               body   BeaconRequest  false  "The same query as a POST body"
+// @Success      200  {object}  BeaconResponse
+// @Failure      400  {object}  BeaconErrorResponse
+// @Failure      401  {object}  BeaconErrorResponse
+// @Router       /beacon/g_variants [get]
+// @Router       /beacon/g_variants [post]
+func QueryBeaconVariants(c *gin.Context) {
+	allowed := beaconGranularity(c)
+	if allowed == granularityNone {
+		beaconError(c, http.StatusUnauthorized, "This beacon only answers authenticated partners")
+		return
+	}
+	params, requested, err := beaconQuery(c)
+	if err != nil {
+		beaconError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if requested == "" {
+		requested = allowed
+	}
+	if requested != granularityBoolean && requested != granularityCount && requested != "record" {
+		beaconError(c, http.StatusBadRequest, "requestedGranularity must be boolean, count or record")
+		return
+	}
+	granularity := requested
+	if granularityRank[requested] > granularityRank[allowed] || requested == "record" {
+		granularity = allowed
+	}
+
+	variants, samples, err := beaconVariants(params)
+	var inputErr *beaconInputError
+	if errors.As(err, &inputErr) {
+		beaconError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		beaconError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	meta := beaconMeta(granularity)
+	meta.ReceivedRequestSummary = &BeaconRequestSummary{
+		APIVersion:           beaconAPIVersion,
+		RequestedSchemas:     []BeaconSchema{variantSchema},
+		Pagination:           BeaconPagination{},
+		RequestedGranularity: requested,
+		RequestParameters:    params,
+	}
+	c.JSON(http.StatusOK, BeaconResponse{Meta: meta, ResponseSummary: beaconSummary(granularity, variants, samples)})
+}
+
+// beaconSummary answers with the number of variants found in samples. A
+// match in fewer than BEACON_MIN_COUNT samples could single them out, and
+// even exists=true says a carrier is there, so it is answered as no match,
+// at the same granularity so that it can't be told apart from one.
+func beaconSummary(granularity string, variants, samples int64) BeaconResponseSummary {
+	if samples < beaconMinCount() {
+		variants = 0
+	}
+	summary := BeaconResponseSummary{Exists: variants > 0}
+	if granularity == granularityCount {
+		summary.NumTotalResults = &variants
+	}
+	return summary
+}
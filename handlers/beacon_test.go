@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"genomic-api/binning"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBeaconSummary(t *testing.T) {
+	t.Setenv("BEACON_MIN_COUNT", "3")
+	for _, test := range []struct {
+		granularity       string
+		variants, samples int64
+		exists            bool
+		count             interface{}
+	}{
+		{granularityBoolean, 0, 0, false, nil},
+		{granularityBoolean, 1, 1, false, nil},
+		{granularityBoolean, 2, 2, false, nil},
+		{granularityBoolean, 1, 3, true, nil},
+		{granularityCount, 0, 0, false, int64(0)},
+		// Too few samples: the same answer as no match
+		{granularityCount, 2, 1, false, int64(0)},
+		{granularityCount, 2, 3, true, int64(2)},
+	} {
+		got := beaconSummary(test.granularity, test.variants, test.samples)
+		if got.Exists != test.exists || deref(got.NumTotalResults) != test.count {
+			t.Errorf("beaconSummary(%s, %d variants, %d samples) = %v, %v; want %v, %v", test.granularity, test.variants, test.samples,
+				got.Exists, deref(got.NumTotalResults), test.exists, test.count)
+		}
+	}
+}
+
+// deref is what p points at, or nil
+func deref(p *int64) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestBeaconWithholdsRareVariants(t *testing.T) {
+	db := useTestDB(t)
+	t.Setenv("BEACON_PUBLIC_GRANULARITY", granularityBoolean)
+	t.Setenv("BEACON_PARTNER_GRANULARITY", granularityCount)
+	t.Setenv("BEACON_MIN_COUNT", "5")
+
+	// chr17:100 A>G is carried by one sample, chr17:200 A>G by five
+	first := createTestSample(t, db)
+	for i := 0; i < 5; i++ {
+		sample := first
+		if i > 0 {
+			sample = models.Sample{GenomeID: first.GenomeID, DonorID: fmt.Sprintf("DONOR%d", i+1), CollectionDate: "2024-01-01",
+				SampleType: "blood", Metadata: "{}", CollectedBy: testAdminID}
+			if err := db.Create(&sample).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+		var fileID int
+		if err := db.Raw(`INSERT INTO variant_files (sample_id, genome_id, file_path, file_type, ingest_status)
+			VALUES (?, ?, 'variants.vcf', 'VCF', ?) RETURNING id`, sample.ID, sample.GenomeID, models.IngestSucceeded).Scan(&fileID).Error; err != nil {
+			t.Fatal(err)
+		}
+		positions := []int64{200}
+		if i == 0 {
+			positions = append(positions, 100)
+		}
+		for _, pos := range positions {
+			variant := models.Variant{VariantFileID: fileID, SampleID: sample.ID, GenomeID: sample.GenomeID, Chrom: "chr17",
+				Pos: pos, EndPos: pos, Bin: binning.For(pos-1, pos), Ref: "A", Alt: "G", Genotype: "0/1"}
+			if err := db.Create(&variant).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	partner := testRouter()
+	partner.GET("/beacon/g_variants", QueryBeaconVariants)
+	anonymous := gin.New()
+	anonymous.GET("/beacon/g_variants", QueryBeaconVariants)
+	for _, test := range []struct {
+		name        string
+		router      *gin.Engine
+		start       int
+		granularity string
+		exists      bool
+		count       interface{}
+	}{
+		{"rare, counted", partner, 99, granularityCount, false, int64(0)},
+		{"rare, boolean", anonymous, 99, granularityBoolean, false, nil},
+		{"common, counted", partner, 199, granularityCount, true, int64(1)},
+		{"common, boolean", anonymous, 199, granularityBoolean, true, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			url := fmt.Sprintf("/beacon/g_variants?referenceName=17&start=%d&referenceBases=A&alternateBases=G", test.start)
+			w := serve(test.router, httptest.NewRequest(http.MethodGet, url, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+			var response BeaconResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			summary := response.ResponseSummary
+			if response.Meta.ReturnedGranularity != test.granularity || summary.Exists != test.exists ||
+				deref(summary.NumTotalResults) != test.count {
+				t.Errorf("got %s: exists %v, count %v; want %s: exists %v, count %v", response.Meta.ReturnedGranularity,
+					summary.Exists, deref(summary.NumTotalResults), test.granularity, test.exists, test.count)
+			}
+		})
+	}
+}
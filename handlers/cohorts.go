@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/middleware"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CohortInput is the request body for creating or updating a cohort
+type CohortInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	SampleIDs   []int  `json:"sample_ids"` // every member; on update, omit to keep the current members
+}
+
+// cohortList is what ListCohorts can filter and sort on
+var cohortList = listSpec{
+	filters: map[string]filter{
+		"name":       {expr: "name = ?"},
+		"created_by": {expr: "created_by = ?", kind: intParam},
+		"sample_id":  {expr: "id IN (SELECT cohort_id FROM cohort_samples WHERE sample_id = ?)", kind: intParam},
+	},
+	sorts:       map[string]string{"id": "id", "name": "name", "created_at": "created_at"},
+	defaultSort: "id",
+	load: func(db *gorm.DB, dest interface{}) error {
+		return loadCohortMembers(db, *dest.(*[]models.Cohort))
+	},
+}
+
+// loadCohortMembers fills in SampleIDs for each cohort
+func loadCohortMembers(db *gorm.DB, cohorts []models.Cohort) error {
+	if len(cohorts) == 0 {
+		return nil
+	}
+	index := make(map[int]int, len(cohorts))
+	ids := make([]int, len(cohorts))
+	for i, cohort := range cohorts {
+		index[cohort.ID] = i
+		ids[i] = cohort.ID
+		cohorts[i].SampleIDs = []int{}
+	}
+	var members []models.CohortSample
+	if err := db.Where("cohort_id IN ?", ids).Order("sample_id").Find(&members).Error; err != nil {
+		return err
+	}
+	for _, member := range members {
+		cohort := &cohorts[index[member.CohortID]]
+		cohort.SampleIDs = append(cohort.SampleIDs, member.SampleID)
+	}
+	return nil
+}
+
+// findCohort loads a cohort with its members
+func findCohort(id int) (models.Cohort, error) {
+	var cohort models.Cohort
+	if err := config.DB.First(&cohort, id).Error; err != nil {
+		return cohort, err
+	}
+	cohorts := []models.Cohort{cohort}
+	err := loadCohortMembers(config.DB, cohorts)
+	return cohorts[0], err
+}
+
+// setCohortMembers replaces a cohort's samples
+func setCohortMembers(tx *gorm.DB, cohort *models.Cohort, sampleIDs []int) error {
+	unique := make([]int, 0, len(sampleIDs))
+	seen := make(map[int]bool, len(sampleIDs))
+	for _, id := range sampleIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	var found int64
+	if err := tx.Model(&models.Sample{}).Where("id IN ?", unique).Count(&found).Error; err != nil {
+		return err
+	}
+	if int(found) != len(unique) {
+		return errUnknownSample
+	}
+	if err := tx.Where("cohort_id = ?", cohort.ID).Delete(&models.CohortSample{}).Error; err != nil {
+		return err
+	}
+	members := make([]models.CohortSample, len(unique))
+	for i, id := range unique {
+		members[i] = models.CohortSample{CohortID: cohort.ID, SampleID: id}
+	}
+	if len(members) > 0 {
+		if err := tx.Create(&members).Error; err != nil {
+			return err
+		}
+	}
+	cohort.SampleIDs = unique
+	return nil
+}
+
+// errUnknownSample means a cohort's sample_ids named a sample that doesn't exist
+var errUnknownSample = errors.New("sample_ids contains an unknown sample")
+
+// ListCohorts godoc
+// @Summary      List cohorts
+// @Description  Get cohorts a page at a time, with their member sample IDs. The total is returned in X-Total-Count and page links in Link.
+// @Tags         cohorts
+// @Produce      json
+// @Param        name        query  string  false  "Cohort name"
+// @Param        created_by  query  int     false  "Creating user ID"
+// @Param        sample_id   query  int     false  "Cohorts containing this sample"
+// @Param        sort        query  string  false  "Comma-separated keys: id, name, created_at; prefix - for descending"
+// @Param        page        query  int     false  "Page number, from 1"
+// @Param        per_page    query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.Cohort
+// @Failure      400  {object}  map[string]string
+// @Router       /api/cohorts [get]
+func ListCohorts(c *gin.Context) {
+	var cohorts []models.Cohort
+	listPage(c, config.DB.Model(&models.Cohort{}), cohortList, &cohorts)
+}
+
+// CreateCohort godoc
+// @Summary      Create cohort
+// @Description  Add a named group of samples, for scoping variant queries
+// @Tags         cohorts
+// @Accept       json
+// @Produce      json
+// @Param        cohort  body  CohortInput  true  "Cohort info and member samples"
+// @Success      201  {object}  models.Cohort
+// @Failure      400  {object}  map[string]string
+// @Router       /api/cohorts [post]
+func CreateCohort(c *gin.Context) {
+	var input CohortInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, _ := middleware.CurrentUserID(c)
+	cohort := models.Cohort{Name: input.Name, Description: input.Description, CreatedBy: userID}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cohort).Error; err != nil {
+			return err
+		}
+		if err := setCohortMembers(tx, &cohort, input.SampleIDs); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceCohort, cohort.ID, nil, cohort)
+	})
+	if errors.Is(err, errUnknownSample) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, cohort)
+}
+
+// GetCohort godoc
+// @Summary      Get cohort
+// @Description  Get cohort by ID, with its member sample IDs
+// @Tags         cohorts
+// @Produce      json
+// @Param        id   path      int  true  "Cohort ID"
+// @Success      200  {object}  models.Cohort
+// @Failure      404  {object}  map[string]string
+// @Router       /api/cohorts/{id} [get]
+func GetCohort(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	cohort, err := findCohort(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cohort not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cohort)
+}
+
+// UpdateCohort godoc
+// @Summary      Update cohort
+// @Description  Rename a cohort or replace its members
+// @Tags         cohorts
+// @Accept       json
+// @Produce      json
+// @Param        id      path      int          true  "Cohort ID"
+// @Param        cohort  body      CohortInput  true  "Cohort info and member samples"
+// @Success      200     {object}  models.Cohort
+// @Failure      400     {object}  map[string]string
+// @Failure      404     {object}  map[string]string
+// @Router       /api/cohorts/{id} [put]
+func UpdateCohort(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	cohort, err := findCohort(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cohort not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	before := cohort
+	var input CohortInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	cohort.Name, cohort.Description = input.Name, input.Description
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&cohort).Select("name", "description").Updates(&cohort).Error; err != nil {
+			return err
+		}
+		if input.SampleIDs != nil {
+			if err := setCohortMembers(tx, &cohort, input.SampleIDs); err != nil {
+				return err
+			}
+		}
+		return recordAudit(tx, c, audit.ActionUpdate, audit.ResourceCohort, cohort.ID, before, cohort)
+	})
+	if errors.Is(err, errUnknownSample) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, cohort)
+}
+
+// DeleteCohort godoc
+// @Summary      Delete cohort
+// @Description  Delete cohort by ID; its samples are kept
+// @Tags         cohorts
+// @Produce      json
+// @Param        id   path      int  true  "Cohort ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/cohorts/{id} [delete]
+func DeleteCohort(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	cohort, err := findCohort(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cohort not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&cohort).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceCohort, cohort.ID, cohort, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cohort deleted"})
+}
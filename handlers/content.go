@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// downloadName picks the file name offered to clients. Content keys say
+// nothing about the file, so fall back to the kind, ID and type.
+func downloadName(fileName, filePath, prefix string, id int, fileType string) string {
+	if fileName != "" {
+		return path.Base(fileName)
+	}
+	if filePath != "" && !storage.IsContentKey(filePath) {
+		return path.Base(filePath)
+	}
+	return fmt.Sprintf("%s-%d.%s", prefix, id, strings.ToLower(strings.TrimSpace(fileType)))
+}
+
+// serveContent streams a stored payload with support for Range, If-Range,
+// If-None-Match and If-Modified-Since. Bytes are read from storage as they
+// are written to the client, only for the ranges requested.
+func serveContent(c *gin.Context, key, name, checksum string, modTime time.Time) {
+	info, err := storage.Default.Stat(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File content not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The SHA-256 identifies the bytes exactly; records without one get a
+	// weaker tag from what storage reports
+	etag := `"` + checksum + `"`
+	if checksum == "" {
+		etag = fmt.Sprintf(`W/"%x-%x"`, info.Size, info.ModTime.UnixNano())
+	}
+	c.Header("ETag", etag)
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	c.Header("Cache-Control", "private, no-cache")
+	if modTime.IsZero() {
+		modTime = info.ModTime
+	}
+
+	reader := storage.NewObjectReader(c.Request.Context(), storage.Default, key, info.Size)
+	defer reader.Close()
+	http.ServeContent(c.Writer, c.Request, name, modTime, reader)
+}
+
+// serveFile streams the content of the sequence or variant file with the
+// given ID; kind is audit.ResourceSequenceFile or audit.ResourceVariantFile,
+// or one of indexDownloads for the file's index
+func serveFile(c *gin.Context, kind string, id int) {
+	for fileKind, indexKind := range indexDownloads {
+		if kind == indexKind {
+			serveIndex(c, fileKind, id)
+			return
+		}
+	}
+	if kind == audit.ResourceVariantFile {
+		var file models.VariantFile
+		if err := config.DB.First(&file, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant file not found"})
+			return
+		}
+		name := downloadName(file.FileName, file.FilePath, "variants", file.ID, file.FileType)
+		serveContent(c, file.FilePath, name, file.Checksum, file.UploadedAt)
+		return
+	}
+	var file models.SequenceFile
+	if err := config.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file not found"})
+		return
+	}
+	name := downloadName(file.FileName, file.FilePath, "sequence", file.ID, file.FileType)
+	serveContent(c, file.FilePath, name, file.Checksum, file.UploadedAt)
+}
+
+// GetSequenceFileContent godoc
+// @Summary      Download sequence file
+// @Description  Stream the bytes of a sequence file. Supports Range requests (so IGV and samtools can read remote BAMs), ETag/If-None-Match and HEAD.
+// @Tags         sequence
+// @Produce      octet-stream
+// @Param        id     path      int     true   "Sequence file ID"
+// @Param        Range  header    string  false  "Byte range, e.g. bytes=0-65535"
+// @Success      200    {file}    binary
+// @Success      206    {file}    binary
+// @Success      304
+// @Failure      404    {object}  map[string]string
+// @Failure      416    {string}  string
+// @Router       /api/sequence/{id}/content [get]
+func GetSequenceFileContent(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	serveFile(c, audit.ResourceSequenceFile, id)
+}
+
+// GetVariantFileContent godoc
+// @Summary      Download variant file
+// @Description  Stream the bytes of a variant file. Supports Range requests, ETag/If-None-Match and HEAD.
+// @Tags         variants
+// @Produce      octet-stream
+// @Param        id     path      int     true   "Variant file ID"
+// @Param        Range  header    string  false  "Byte range, e.g. bytes=0-65535"
+// @Success      200    {file}    binary
+// @Success      206    {file}    binary
+// @Success      304
+// @Failure      404    {object}  map[string]string
+// @Failure      416    {string}  string
+// @Router       /api/variants/{id}/content [get]
+func GetVariantFileContent(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	serveFile(c, audit.ResourceVariantFile, id)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServeContent(t *testing.T) {
+	useTestStorage(t)
+	content := []byte("0123456789abcdefghij")
+	key := putTestObject(t, content)
+	uploaded := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	r := testRouter()
+	r.GET("/content", func(c *gin.Context) { serveContent(c, key, "reads.fastq", "c0ffee", uploaded) })
+	r.GET("/unchecked", func(c *gin.Context) { serveContent(c, key, "reads.fastq", "", time.Time{}) })
+	r.GET("/missing", func(c *gin.Context) {
+		serveContent(c, storage.ContentKey(strings.Repeat("0", 64)), "x", "", time.Time{})
+	})
+
+	for _, test := range []struct {
+		name    string
+		path    string
+		header  map[string]string
+		status  int
+		body    string
+		headers map[string]string
+	}{
+		{"whole file", "/content", nil, http.StatusOK, string(content), map[string]string{
+			"ETag":                `"c0ffee"`,
+			"Accept-Ranges":       "bytes",
+			"Content-Length":      "20",
+			"Content-Disposition": "attachment; filename=reads.fastq",
+			"Last-Modified":       "Sat, 01 Mar 2025 12:00:00 GMT",
+		}},
+		{"range", "/content", map[string]string{"Range": "bytes=5-9"}, http.StatusPartialContent, "56789", map[string]string{
+			"Content-Range":  "bytes 5-9/20",
+			"Content-Length": "5",
+		}},
+		{"open range", "/content", map[string]string{"Range": "bytes=15-"}, http.StatusPartialContent, "fghij", map[string]string{
+			"Content-Range": "bytes 15-19/20",
+		}},
+		{"suffix range", "/content", map[string]string{"Range": "bytes=-3"}, http.StatusPartialContent, "hij", map[string]string{
+			"Content-Range": "bytes 17-19/20",
+		}},
+		{"range past the end", "/content", map[string]string{"Range": "bytes=18-100"}, http.StatusPartialContent, "ij", map[string]string{
+			"Content-Range": "bytes 18-19/20",
+		}},
+		{"unsatisfiable range", "/content", map[string]string{"Range": "bytes=20-30"}, http.StatusRequestedRangeNotSatisfiable, "", map[string]string{
+			"Content-Range": "bytes */20",
+		}},
+		{"matching If-None-Match", "/content", map[string]string{"If-None-Match": `"c0ffee"`}, http.StatusNotModified, "", map[string]string{
+			"ETag": `"c0ffee"`,
+		}},
+		{"stale If-None-Match", "/content", map[string]string{"If-None-Match": `"decaf"`}, http.StatusOK, string(content), nil},
+		{"matching If-Range", "/content", map[string]string{"Range": "bytes=0-1", "If-Range": `"c0ffee"`}, http.StatusPartialContent, "01", nil},
+		// The file changed since the client's copy, so it gets all of it
+		{"stale If-Range", "/content", map[string]string{"Range": "bytes=0-1", "If-Range": `"decaf"`}, http.StatusOK, string(content), nil},
+		{"missing", "/missing", nil, http.StatusNotFound, `{"error":"File content not found"}`, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, test.path, nil)
+			for name, value := range test.header {
+				req.Header.Set(name, value)
+			}
+			w := serve(r, req)
+			if w.Code != test.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+			if test.body != "" && w.Body.String() != test.body {
+				t.Errorf("body %q, want %q", w.Body, test.body)
+			}
+			for name, want := range test.headers {
+				if got := w.Header().Get(name); got != want {
+					t.Errorf("%s: %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+
+	// Without a checksum the tag is weak, from the size and storage's
+	// modification time, and still answers conditional requests
+	info, err := storage.Default.Stat(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weak := fmt.Sprintf(`W/"%x-%x"`, info.Size, info.ModTime.UnixNano())
+	w := serve(r, httptest.NewRequest(http.MethodGet, "/unchecked", nil))
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != weak {
+		t.Fatalf("without a checksum: %d ETag %q, want %q", w.Code, w.Header().Get("ETag"), weak)
+	}
+	if w.Header().Get("Last-Modified") != info.ModTime.UTC().Format(http.TimeFormat) {
+		t.Errorf("Last-Modified %q, want storage's %s", w.Header().Get("Last-Modified"), info.ModTime)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/unchecked", nil)
+	req.Header.Set("If-None-Match", weak)
+	if w := serve(r, req); w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match with the weak tag: %d", w.Code)
+	}
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDownloadURLTTL = 15 * time.Minute
+	maxDownloadURLTTL     = 24 * time.Hour
+)
+
+// downloadPaths is where signed downloads of each kind of file are served
+var downloadPaths = map[string]string{
+	audit.ResourceSequenceFile:                 "/api/sequence/%d/download",
+	audit.ResourceVariantFile:                  "/api/variants/%d/download",
+	indexDownloads[audit.ResourceSequenceFile]: "/api/sequence/%d/index/download",
+	indexDownloads[audit.ResourceVariantFile]:  "/api/variants/%d/index/download",
+}
+
+// DownloadURLInput is the optional request body for minting a download URL
+type DownloadURLInput struct {
+	ExpiresIn int    `json:"expires_in"` // seconds, default 900, at most 86400
+	IP        string `json:"ip"`         // address allowed to use the URL; defaults to the caller's
+}
+
+// DownloadURL is a signed link that downloads one file without a token
+type DownloadURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	IP        string    `json:"ip"`
+	IndexURL  string    `json:"index_url,omitempty"` // downloads the file's index, on the same terms
+}
+
+// downloadURLSecret signs download URLs; it must be the same on every instance
+func downloadURLSecret() []byte {
+	return []byte(os.Getenv("DOWNLOAD_URL_SECRET"))
+}
+
+// downloadSignature binds the file, expiry and client address together, so
+// none of them can be changed without invalidating the URL
+func downloadSignature(kind string, id int, expires int64, ip string) string {
+	mac := hmac.New(sha256.New, downloadURLSecret())
+	fmt.Fprintf(mac, "%s\n%d\n%d\n%s", kind, id, expires, ip)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// publicBaseURL is the scheme and host clients reach the API on.
+// PUBLIC_BASE_URL overrides what is inferred from the request.
+func publicBaseURL(c *gin.Context) string {
+	if base := os.Getenv("PUBLIC_BASE_URL"); base != "" {
+		return strings.TrimSuffix(base, "/")
+	}
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
+
+// signedDownloadURL is the URL that downloads a file from ip until expiresAt
+func signedDownloadURL(c *gin.Context, kind string, id int, expiresAt time.Time, ip string) string {
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expiresAt.Unix(), 10)},
+		"ip":        {ip},
+		"signature": {downloadSignature(kind, id, expiresAt.Unix(), ip)},
+	}
+	return publicBaseURL(c) + fmt.Sprintf(downloadPaths[kind], id) + "?" + query.Encode()
+}
+
+func mintDownloadURL(c *gin.Context, kind string) {
+	if len(downloadURLSecret()) == 0 {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Download URLs are not configured (DOWNLOAD_URL_SECRET)"})
+		return
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	var err error
+	if kind == audit.ResourceVariantFile {
+		err = config.DB.First(&models.VariantFile{}, id).Error
+	} else {
+		err = config.DB.First(&models.SequenceFile{}, id).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	var input DownloadURLInput
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ttl := defaultDownloadURLTTL
+	if input.ExpiresIn != 0 {
+		ttl = time.Duration(input.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > maxDownloadURLTTL {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("expires_in must be between 1 and %d seconds", int(maxDownloadURLTTL.Seconds()))})
+		return
+	}
+	ip := c.ClientIP()
+	if input.IP != "" {
+		parsed := net.ParseIP(input.IP)
+		if parsed == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ip"})
+			return
+		}
+		ip = parsed.String()
+	}
+
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	link := DownloadURL{
+		URL:       signedDownloadURL(c, kind, id, expiresAt, ip),
+		ExpiresAt: expiresAt.UTC(),
+		IP:        ip,
+	}
+	extra := map[string]interface{}{"expires_at": link.ExpiresAt, "ip": ip}
+	index, err := findIndex(config.DB, indexColumn(kind), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if index != nil {
+		link.IndexURL = signedDownloadURL(c, indexDownloads[kind], id, expiresAt, ip)
+		extra["index"] = true
+	}
+	if err := audit.Record(config.DB, auditEntry(c, audit.ActionPresign, kind, id, nil, nil, extra)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, link)
+}
+
+// signedDownload serves a file to anyone holding a valid, unexpired URL from
+// the address it was minted for
+func signedDownload(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	secret := downloadURLSecret()
+	if err != nil || len(secret) == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download URL"})
+		return
+	}
+	ip := c.Query("ip")
+	expected := downloadSignature(kind, id, expires, ip)
+	if !hmac.Equal([]byte(c.Query("signature")), []byte(expected)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid download URL"})
+		return
+	}
+	if time.Now().Unix() > expires {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download URL has expired"})
+		return
+	}
+	if !net.ParseIP(c.ClientIP()).Equal(net.ParseIP(ip)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Download URL is not valid from this address"})
+		return
+	}
+	serveFile(c, kind, id)
+}
+
+// CreateSequenceDownloadURL godoc
+// @Summary      Create sequence file download URL
+// @Description  Mint a short-lived signed URL that downloads the file without a bearer token, for tools such as IGV.js and samtools, and index_url for its index if it has one. The URLs only work from one IP address (the caller's unless ip is given) until they expire. Every URL minted is recorded in the audit trail.
+// @Tags         sequence
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int               true   "Sequence file ID"
+// @Param        input  body      DownloadURLInput  false  "Lifetime and allowed IP"
+// @Success      201    {object}  DownloadURL
+// @Failure      400    {object}  map[string]string
+// @Failure      404    {object}  map[string]string
+// @Failure      503    {object}  map[string]string
+// @Router       /api/sequence/{id}/download-url [post]
+func CreateSequenceDownloadURL(c *gin.Context) {
+	mintDownloadURL(c, audit.ResourceSequenceFile)
+}
+
+// CreateVariantDownloadURL godoc
+// @Summary      Create variant file download URL
+// @Description  Mint a short-lived signed URL that downloads the file without a bearer token, and index_url for its index if it has one. The URLs only work from one IP address until they expire. Every URL minted is recorded in the audit trail.
+// @Tags         variants
+// @Accept       json
+// @Produce      json
+// @Param        id     path      int               true   "Variant file ID"
+// @Param        input  body      DownloadURLInput  false  "Lifetime and allowed IP"
+// @Success      201    {object}  DownloadURL
+// @Failure      400    {object}  map[string]string
+// @Failure      404    {object}  map[string]string
+// @Failure      503    {object}  map[string]string
+// @Router       /api/variants/{id}/download-url [post]
+func CreateVariantDownloadURL(c *gin.Context) {
+	mintDownloadURL(c, audit.ResourceVariantFile)
+}
+
+// DownloadSequenceFile godoc
+// @Summary      Download sequence file with a signed URL
+// @Description  Serve a file to the holder of a URL from /api/sequence/{id}/download-url; no token is needed. Range requests are supported.
+// @Tags         sequence
+// @Produce      octet-stream
+// @Param        id         path   int     true  "Sequence file ID"
+// @Param        expires    query  int     true  "Expiry, Unix seconds"
+// @Param        ip         query  string  true  "Allowed client IP"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200  {file}    binary
+// @Success      206  {file}    binary
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/download [get]
+func DownloadSequenceFile(c *gin.Context) {
+	signedDownload(c, audit.ResourceSequenceFile)
+}
+
+// DownloadVariantFile godoc
+// @Summary      Download variant file with a signed URL
+// @Description  Serve a file to the holder of a URL from /api/variants/{id}/download-url; no token is needed. Range requests are supported.
+// @Tags         variants
+// @Produce      octet-stream
+// @Param        id         path   int     true  "Variant file ID"
+// @Param        expires    query  int     true  "Expiry, Unix seconds"
+// @Param        ip         query  string  true  "Allowed client IP"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200  {file}    binary
+// @Success      206  {file}    binary
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/download [get]
+func DownloadVariantFile(c *gin.Context) {
+	signedDownload(c, audit.ResourceVariantFile)
+}
+
+// DownloadSequenceIndex godoc
+// @Summary      Download sequence file index with a signed URL
+// @Description  Serve a sequence file's index to the holder of the index_url from /api/sequence/{id}/download-url; no token is needed. Range requests are supported.
+// @Tags         sequence
+// @Produce      octet-stream
+// @Param        id         path   int     true  "Sequence file ID"
+// @Param        expires    query  int     true  "Expiry, Unix seconds"
+// @Param        ip         query  string  true  "Allowed client IP"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200  {file}    binary
+// @Success      206  {file}    binary
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/index/download [get]
+func DownloadSequenceIndex(c *gin.Context) {
+	signedDownload(c, indexDownloads[audit.ResourceSequenceFile])
+}
+
+// DownloadVariantIndex godoc
+// @Summary      Download variant file index with a signed URL
+// @Description  Serve a variant file's index to the holder of the index_url from /api/variants/{id}/download-url; no token is needed. Range requests are supported.
+// @Tags         variants
+// @Produce      octet-stream
+// @Param        id         path   int     true  "Variant file ID"
+// @Param        expires    query  int     true  "Expiry, Unix seconds"
+// @Param        ip         query  string  true  "Allowed client IP"
+// @Param        signature  query  string  true  "URL signature"
+// @Success      200  {file}    binary
+// @Success      206  {file}    binary
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/index/download [get]
+func DownloadVariantIndex(c *gin.Context) {
+	signedDownload(c, indexDownloads[audit.ResourceVariantFile])
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/models"
+)
+
+const testDownloadSecret = "download-url-test-secret"
+
+// testClientIP is where httptest requests come from
+const testClientIP = "192.0.2.1"
+
+func downloadRouter() http.Handler {
+	r := testRouter()
+	r.POST("/api/sequence/:id/download-url", CreateSequenceDownloadURL)
+	r.GET("/api/sequence/:id/download", DownloadSequenceFile)
+	r.GET("/api/sequence/:id/index/download", DownloadSequenceIndex)
+	return r
+}
+
+func TestDownloadSignature(t *testing.T) {
+	t.Setenv("DOWNLOAD_URL_SECRET", testDownloadSecret)
+	kind := audit.ResourceSequenceFile
+	signature := downloadSignature(kind, 7, 1700000000, testClientIP)
+	if again := downloadSignature(kind, 7, 1700000000, testClientIP); again != signature {
+		t.Fatalf("signature changed from %s to %s", signature, again)
+	}
+	for name, other := range map[string]string{
+		"kind":    downloadSignature(indexDownloads[kind], 7, 1700000000, testClientIP),
+		"id":      downloadSignature(kind, 8, 1700000000, testClientIP),
+		"expires": downloadSignature(kind, 7, 1700000001, testClientIP),
+		"ip":      downloadSignature(kind, 7, 1700000000, "192.0.2.2"),
+	} {
+		if other == signature {
+			t.Errorf("signature doesn't depend on %s", name)
+		}
+	}
+	t.Setenv("DOWNLOAD_URL_SECRET", "another-secret")
+	if downloadSignature(kind, 7, 1700000000, testClientIP) == signature {
+		t.Error("signature doesn't depend on the secret")
+	}
+}
+
+func TestSignedDownloadRefuses(t *testing.T) {
+	useTestStorage(t)
+	r := downloadRouter()
+	kind := audit.ResourceSequenceFile
+	expires := time.Now().Add(time.Hour).Unix()
+	valid := func() url.Values {
+		return url.Values{
+			"expires":   {strconv.FormatInt(expires, 10)},
+			"ip":        {testClientIP},
+			"signature": {downloadSignature(kind, 7, expires, testClientIP)},
+		}
+	}
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		change func(q url.Values)
+		secret string
+		want   string
+	}{
+		{"tampered signature", "/api/sequence/7/download", func(q url.Values) {
+			q.Set("signature", strings.ToUpper(q.Get("signature")))
+		}, testDownloadSecret, "Invalid download URL"},
+		{"no signature", "/api/sequence/7/download", func(q url.Values) { q.Del("signature") }, testDownloadSecret, "Invalid download URL"},
+		{"tampered expires", "/api/sequence/7/download", func(q url.Values) {
+			q.Set("expires", strconv.FormatInt(expires+3600, 10))
+		}, testDownloadSecret, "Invalid download URL"},
+		{"tampered ip", "/api/sequence/7/download", func(q url.Values) { q.Set("ip", "192.0.2.2") }, testDownloadSecret, "Invalid download URL"},
+		{"other file", "/api/sequence/8/download", nil, testDownloadSecret, "Invalid download URL"},
+		// A file's URL doesn't download its index, or the other way round
+		{"index", "/api/sequence/7/index/download", nil, testDownloadSecret, "Invalid download URL"},
+		{"non-numeric expires", "/api/sequence/7/download", func(q url.Values) { q.Set("expires", "soon") }, testDownloadSecret, "Invalid download URL"},
+		{"expired", "/api/sequence/7/download", func(q url.Values) {
+			past := time.Now().Add(-time.Minute).Unix()
+			q.Set("expires", strconv.FormatInt(past, 10))
+			q.Set("signature", downloadSignature(kind, 7, past, testClientIP))
+		}, testDownloadSecret, "Download URL has expired"},
+		{"other address", "/api/sequence/7/download", func(q url.Values) {
+			q.Set("ip", "198.51.100.7")
+			q.Set("signature", downloadSignature(kind, 7, expires, "198.51.100.7"))
+		}, testDownloadSecret, "Download URL is not valid from this address"},
+		{"no address", "/api/sequence/7/download", func(q url.Values) {
+			q.Del("ip")
+			q.Set("signature", downloadSignature(kind, 7, expires, ""))
+		}, testDownloadSecret, "Download URL is not valid from this address"},
+		// Without a secret anyone could sign URLs, so none are accepted
+		{"no secret", "/api/sequence/7/download", func(q url.Values) {
+			q.Set("signature", downloadSignature(kind, 7, expires, testClientIP))
+		}, "", "Invalid download URL"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("DOWNLOAD_URL_SECRET", testDownloadSecret)
+			query := valid()
+			t.Setenv("DOWNLOAD_URL_SECRET", test.secret)
+			if test.change != nil {
+				test.change(query)
+			}
+			w := serve(r, httptest.NewRequest(http.MethodGet, test.path+"?"+query.Encode(), nil))
+			var body map[string]string
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusForbidden || body["error"] != test.want {
+				t.Errorf("status %d %q, want 403 %q", w.Code, body["error"], test.want)
+			}
+		})
+	}
+}
+
+func TestMintDownloadURL(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	content := []byte("@read1\nACGT\n+\nIIII\n")
+	file := models.SequenceFile{SampleID: sample.ID, FilePath: putTestObject(t, content), FileType: "FASTQ", SizeBytes: int64(len(content))}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := downloadRouter()
+	mint := "/api/sequence/" + strconv.Itoa(file.ID) + "/download-url"
+
+	t.Setenv("DOWNLOAD_URL_SECRET", "")
+	if w := serve(r, httptest.NewRequest(http.MethodPost, mint, nil)); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("mint without a secret: %d %s", w.Code, w.Body)
+	}
+
+	t.Setenv("DOWNLOAD_URL_SECRET", testDownloadSecret)
+	w := serve(r, httptest.NewRequest(http.MethodPost, mint, strings.NewReader(`{"expires_in": 60}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("mint: %d %s", w.Code, w.Body)
+	}
+	var link DownloadURL
+	json.Unmarshal(w.Body.Bytes(), &link)
+	if link.IP != testClientIP || link.IndexURL != "" || time.Until(link.ExpiresAt) > time.Minute {
+		t.Fatalf("minted %+v", link)
+	}
+	var entries []models.AuditLog
+	db.Where("action = ? AND resource_type = ? AND resource_id = ?", audit.ActionPresign, audit.ResourceSequenceFile, file.ID).Find(&entries)
+	if len(entries) != 1 || entries[0].UserID == nil || *entries[0].UserID != testAdminID || !strings.Contains(entries[0].Details, testClientIP) {
+		t.Errorf("presign audit entries: %+v", entries)
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = serve(r, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), content) {
+		t.Errorf("download: %d %q", w.Code, w.Body)
+	}
+
+	if w := serve(r, httptest.NewRequest(http.MethodPost, mint, strings.NewReader(`{"expires_in": 86401}`))); w.Code != http.StatusBadRequest {
+		t.Errorf("mint for too long: %d %s", w.Code, w.Body)
+	}
+	if w := serve(r, httptest.NewRequest(http.MethodPost, mint, strings.NewReader(`{"ip": "nowhere"}`))); w.Code != http.StatusBadRequest {
+		t.Errorf("mint for a bad ip: %d %s", w.Code, w.Body)
+	}
+}
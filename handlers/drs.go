@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DRS object IDs say what kind of record they are: sequence-12 and
+// variant-7 are files, sample-3 is the bundle of a sample's files
+const (
+	drsSequencePrefix = "sequence-"
+	drsVariantPrefix  = "variant-"
+	drsSamplePrefix   = "sample-"
+)
+
+// drsSignedAccess is the access ID that resolves to a signed download URL
+const drsSignedAccess = "signed"
+
+// DrsChecksum is a digest of an object's bytes
+type DrsChecksum struct {
+	Checksum string `json:"checksum"`
+	Type     string `json:"type"` // sha-256 or md5
+}
+
+// DrsAccessURL is where an object's bytes can be fetched
+type DrsAccessURL struct {
+	URL     string   `json:"url"`
+	Headers []string `json:"headers,omitempty"`
+}
+
+// DrsAccessMethod is one way to fetch an object: directly from access_url,
+// or from the URL that access_id resolves to
+type DrsAccessMethod struct {
+	Type      string        `json:"type"`
+	AccessURL *DrsAccessURL `json:"access_url,omitempty"`
+	AccessID  string        `json:"access_id,omitempty"`
+}
+
+// DrsContentsObject is a member of a bundle
+type DrsContentsObject struct {
+	Name   string   `json:"name"`
+	ID     string   `json:"id"`
+	DrsURI []string `json:"drs_uri"`
+}
+
+// DrsObject is a file (blob) or a sample's files (bundle)
+type DrsObject struct {
+	ID            string              `json:"id"`
+	Name          string              `json:"name,omitempty"`
+	SelfURI       string              `json:"self_uri"`
+	Size          int64               `json:"size"`
+	CreatedTime   time.Time           `json:"created_time"`
+	Checksums     []DrsChecksum       `json:"checksums"`
+	AccessMethods []DrsAccessMethod   `json:"access_methods,omitempty"` // blobs only
+	Contents      []DrsContentsObject `json:"contents,omitempty"`       // bundles only
+	Description   string              `json:"description,omitempty"`
+}
+
+// DrsError is the error body DRS clients expect
+type DrsError struct {
+	Msg        string `json:"msg"`
+	StatusCode int    `json:"status_code"`
+}
+
+func drsError(c *gin.Context, status int, msg string) {
+	c.JSON(status, DrsError{Msg: msg, StatusCode: status})
+}
+
+// DRSScope is the API key scope needed to read the DRS object in the path
+func DRSScope(c *gin.Context) string {
+	id := c.Param("object_id")
+	switch {
+	case strings.HasPrefix(id, drsSequencePrefix):
+		return "read:sequence"
+	case strings.HasPrefix(id, drsVariantPrefix):
+		return "read:variants"
+	case strings.HasPrefix(id, drsSamplePrefix):
+		return "read:samples"
+	}
+	return ""
+}
+
+// drsURI is the drs:// URI of an object served by this API
+func drsURI(c *gin.Context, id string) string {
+	base := publicBaseURL(c)
+	u, err := url.Parse(base)
+	if err != nil || u.Host == "" {
+		// PUBLIC_BASE_URL given as a bare host, e.g. genomics.example.org:8443
+		u, err = url.Parse("//" + base)
+	}
+	host := ""
+	if err == nil {
+		host = u.Host
+	}
+	return "drs://" + host + "/" + id
+}
+
+// parseDRSID splits an object ID into its prefix and record ID
+func parseDRSID(objectID string) (string, int, bool) {
+	for _, prefix := range []string{drsSequencePrefix, drsVariantPrefix, drsSamplePrefix} {
+		if rest := strings.TrimPrefix(objectID, prefix); rest != objectID {
+			id, err := strconv.Atoi(rest)
+			return prefix, id, err == nil && id > 0
+		}
+	}
+	return "", 0, false
+}
+
+// drsChecksums lists the digests a file was stored with
+func drsChecksums(sha256Hex, md5Hex string) []DrsChecksum {
+	checksums := []DrsChecksum{}
+	if sha256Hex != "" {
+		checksums = append(checksums, DrsChecksum{Checksum: sha256Hex, Type: "sha-256"})
+	}
+	if md5Hex != "" {
+		checksums = append(checksums, DrsChecksum{Checksum: md5Hex, Type: "md5"})
+	}
+	return checksums
+}
+
+// drsBlob describes a stored file; kind is audit.ResourceSequenceFile or
+// audit.ResourceVariantFile
+func drsBlob(c *gin.Context, kind, objectID, name, description string, id int, size int64, created time.Time, sha256Hex, md5Hex string) DrsObject {
+	methods := []DrsAccessMethod{{
+		Type:      "https",
+		AccessURL: &DrsAccessURL{URL: publicBaseURL(c) + fmt.Sprintf(contentPaths[kind], id)},
+	}}
+	if len(downloadURLSecret()) > 0 {
+		methods = append(methods, DrsAccessMethod{Type: "https", AccessID: drsSignedAccess})
+	}
+	return DrsObject{
+		ID:            objectID,
+		Name:          name,
+		SelfURI:       drsURI(c, objectID),
+		Size:          size,
+		CreatedTime:   created.UTC(),
+		Checksums:     drsChecksums(sha256Hex, md5Hex),
+		AccessMethods: methods,
+		Description:   description,
+	}
+}
+
+// drsSequenceFile is a sequence file as a DRS object
+func drsSequenceFile(c *gin.Context, file models.SequenceFile) DrsObject {
+	return drsBlob(c, audit.ResourceSequenceFile, drsSequencePrefix+strconv.Itoa(file.ID),
+		downloadName(file.FileName, file.FilePath, "sequence", file.ID, file.FileType),
+		fmt.Sprintf("%s sequence file of sample %d", strings.TrimSpace(file.FileType), file.SampleID),
+		file.ID, file.SizeBytes, file.UploadedAt, file.Checksum, file.MD5)
+}
+
+// drsVariantFile is a variant file as a DRS object
+func drsVariantFile(c *gin.Context, file models.VariantFile) DrsObject {
+	return drsBlob(c, audit.ResourceVariantFile, drsVariantPrefix+strconv.Itoa(file.ID),
+		downloadName(file.FileName, file.FilePath, "variants", file.ID, file.FileType),
+		fmt.Sprintf("%s variant file of sample %d", strings.TrimSpace(file.FileType), file.SampleID),
+		file.ID, file.SizeBytes, file.UploadedAt, file.Checksum, file.MD5)
+}
+
+// drsSampleBundle is a bundle of every sequence and variant file of a sample
+func drsSampleBundle(c *gin.Context, sample models.Sample) (DrsObject, error) {
+	var sequenceFiles []models.SequenceFile
+	if err := config.DB.Where("sample_id = ?", sample.ID).Order("id").Find(&sequenceFiles).Error; err != nil {
+		return DrsObject{}, err
+	}
+	var variantFiles []models.VariantFile
+	if err := config.DB.Where("sample_id = ?", sample.ID).Order("id").Find(&variantFiles).Error; err != nil {
+		return DrsObject{}, err
+	}
+	var members []DrsObject
+	for _, file := range sequenceFiles {
+		members = append(members, drsSequenceFile(c, file))
+	}
+	for _, file := range variantFiles {
+		members = append(members, drsVariantFile(c, file))
+	}
+
+	objectID := drsSamplePrefix + strconv.Itoa(sample.ID)
+	name := sample.DonorID
+	if name == "" {
+		name = objectID
+	}
+	bundle := DrsObject{
+		ID:          objectID,
+		Name:        name,
+		SelfURI:     drsURI(c, objectID),
+		CreatedTime: sample.CreatedAt.UTC(),
+		Checksums:   []DrsChecksum{},
+		Contents:    []DrsContentsObject{},
+		Description: fmt.Sprintf("Sequence and variant files of sample %d", sample.ID),
+	}
+	// The bundle's checksum is the SHA-256 of its members' SHA-256s, sorted
+	// and concatenated, so it changes whenever a member does
+	var digests []string
+	for _, member := range members {
+		bundle.Size += member.Size
+		bundle.Contents = append(bundle.Contents, DrsContentsObject{Name: member.Name, ID: member.ID, DrsURI: []string{member.SelfURI}})
+		for _, checksum := range member.Checksums {
+			if checksum.Type == "sha-256" {
+				digests = append(digests, checksum.Checksum)
+			}
+		}
+	}
+	if len(digests) == len(members) {
+		sort.Strings(digests)
+		sum := sha256.Sum256([]byte(strings.Join(digests, "")))
+		bundle.Checksums = append(bundle.Checksums, DrsChecksum{Checksum: hex.EncodeToString(sum[:]), Type: "sha-256"})
+	}
+	return bundle, nil
+}
+
+// GetDRSObject godoc
+// @Summary      Get DRS object
+// @Description  GA4GH DRS 1.2: describe a sequence file (sequence-{id}), variant file (variant-{id}) or sample (sample-{id}) by its DRS ID. Files are blobs with their size, checksums and access methods: the token-authenticated content endpoint, plus a signed download URL (access_id signed) when DOWNLOAD_URL_SECRET is set. A sample is a bundle of all its files.
+// @Tags         drs
+// @Produce      json
+// @Param        object_id  path      string  true  "DRS object ID, e.g. sequence-12"
+// @Success      200        {object}  DrsObject
+// @Failure      404        {object}  DrsError
+// @Router       /ga4gh/drs/v1/objects/{object_id} [get]
+func GetDRSObject(c *gin.Context) {
+	prefix, id, ok := parseDRSID(c.Param("object_id"))
+	if !ok {
+		drsError(c, http.StatusNotFound, "Object not found")
+		return
+	}
+	switch prefix {
+	case drsSequencePrefix:
+		var file models.SequenceFile
+		if err := config.DB.First(&file, id).Error; err != nil {
+			drsError(c, http.StatusNotFound, "Object not found")
+			return
+		}
+		c.JSON(http.StatusOK, drsSequenceFile(c, file))
+	case drsVariantPrefix:
+		var file models.VariantFile
+		if err := config.DB.First(&file, id).Error; err != nil {
+			drsError(c, http.StatusNotFound, "Object not found")
+			return
+		}
+		c.JSON(http.StatusOK, drsVariantFile(c, file))
+	default:
+		var sample models.Sample
+		if err := config.DB.First(&sample, id).Error; err != nil {
+			drsError(c, http.StatusNotFound, "Object not found")
+			return
+		}
+		bundle, err := drsSampleBundle(c, sample)
+		if err != nil {
+			drsError(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, bundle)
+	}
+}
+
+// GetDRSAccessURL godoc
+// @Summary      Get DRS access URL
+// @Description  GA4GH DRS 1.2: resolve a file's access_id to a URL. The signed access ID mints a short-lived signed download URL for the caller's IP, recorded in the audit trail.
+// @Tags         drs
+// @Produce      json
+// @Param        object_id  path      string  true  "DRS object ID, e.g. sequence-12"
+// @Param        access_id  path      string  true  "Access ID from the object's access_methods"
+// @Success      200        {object}  DrsAccessURL
+// @Failure      404        {object}  DrsError
+// @Router       /ga4gh/drs/v1/objects/{object_id}/access/{access_id} [get]
+func GetDRSAccessURL(c *gin.Context) {
+	prefix, id, ok := parseDRSID(c.Param("object_id"))
+	if !ok || prefix == drsSamplePrefix {
+		drsError(c, http.StatusNotFound, "Object not found")
+		return
+	}
+	kind := audit.ResourceSequenceFile
+	var err error
+	if prefix == drsVariantPrefix {
+		kind = audit.ResourceVariantFile
+		err = config.DB.First(&models.VariantFile{}, id).Error
+	} else {
+		err = config.DB.First(&models.SequenceFile{}, id).Error
+	}
+	if err != nil {
+		drsError(c, http.StatusNotFound, "Object not found")
+		return
+	}
+	if c.Param("access_id") != drsSignedAccess || len(downloadURLSecret()) == 0 {
+		drsError(c, http.StatusNotFound, "Access ID not found")
+		return
+	}
+
+	expiresAt := time.Now().Add(defaultDownloadURLTTL).Truncate(time.Second)
+	ip := c.ClientIP()
+	extra := map[string]interface{}{"expires_at": expiresAt.UTC(), "ip": ip, "drs": true}
+	if err := audit.Record(config.DB, auditEntry(c, audit.ActionPresign, kind, id, nil, nil, extra)); err != nil {
+		drsError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, DrsAccessURL{URL: signedDownloadURL(c, kind, id, expiresAt, ip)})
+}
+
+// GetDRSServiceInfo godoc
+// @Summary      DRS service info
+// @Description  GA4GH service-info for the DRS API
+// @Tags         drs
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /ga4gh/drs/v1/service-info [get]
+func GetDRSServiceInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"id":           "genomic-api.drs",
+		"name":         "Genomic API DRS",
+		"type":         gin.H{"group": "org.ga4gh", "artifact": "drs", "version": "1.2.0"},
+		"organization": gin.H{"name": "Genomic API", "url": publicBaseURL(c)},
+		"version":      "1.0.0",
+	})
+}
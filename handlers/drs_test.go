@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/models"
+)
+
+func TestParseDRSID(t *testing.T) {
+	for _, test := range []struct {
+		objectID string
+		prefix   string
+		id       int
+		ok       bool
+	}{
+		{"sequence-12", drsSequencePrefix, 12, true},
+		{"variant-7", drsVariantPrefix, 7, true},
+		{"sample-3", drsSamplePrefix, 3, true},
+		{"sequence-0", drsSequencePrefix, 0, false},
+		{"sequence--1", drsSequencePrefix, -1, false},
+		{"sequence-", drsSequencePrefix, 0, false},
+		{"sequence-1x", drsSequencePrefix, 0, false},
+		{"sequence-1-2", drsSequencePrefix, 0, false},
+		{"12", "", 0, false},
+		{"cohort-1", "", 0, false},
+		{"Sequence-1", "", 0, false},
+		{"", "", 0, false},
+	} {
+		prefix, id, ok := parseDRSID(test.objectID)
+		if prefix != test.prefix || ok != test.ok || (ok && id != test.id) {
+			t.Errorf("parseDRSID(%q) = %q, %d, %t, want %q, %d, %t", test.objectID, prefix, id, ok, test.prefix, test.id, test.ok)
+		}
+	}
+}
+
+func TestDRSURI(t *testing.T) {
+	for _, test := range []struct {
+		base string
+		want string
+	}{
+		// Without PUBLIC_BASE_URL the request's host is used
+		{"", "drs://example.com/sequence-1"},
+		{"https://genomics.example.org", "drs://genomics.example.org/sequence-1"},
+		{"https://genomics.example.org/", "drs://genomics.example.org/sequence-1"},
+		{"http://localhost:8080", "drs://localhost:8080/sequence-1"},
+		{"https://genomics.example.org/api", "drs://genomics.example.org/sequence-1"},
+		{"genomics.example.org", "drs://genomics.example.org/sequence-1"},
+		{"genomics.example.org:8443", "drs://genomics.example.org:8443/sequence-1"},
+		{"genomics.example.org/api", "drs://genomics.example.org/sequence-1"},
+	} {
+		t.Run(test.base, func(t *testing.T) {
+			t.Setenv("PUBLIC_BASE_URL", test.base)
+			c, _ := testContext("/ga4gh/drs/v1/objects/sequence-1")
+			if got := drsURI(c, "sequence-1"); got != test.want {
+				t.Errorf("drsURI = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDRSBlobAccessMethods(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "https://genomics.example.org")
+	c, _ := testContext("/ga4gh/drs/v1/objects/variant-4")
+	file := models.VariantFile{ID: 4, SampleID: 2, FileName: "calls.vcf.gz", FileType: "VCF", SizeBytes: 10, Checksum: "abc", MD5: "def"}
+	content := DrsAccessMethod{Type: "https", AccessURL: &DrsAccessURL{URL: "https://genomics.example.org/api/variants/4/content"}}
+
+	t.Setenv("DOWNLOAD_URL_SECRET", "")
+	object := drsVariantFile(c, file)
+	if !reflect.DeepEqual(object.AccessMethods, []DrsAccessMethod{content}) {
+		t.Errorf("access methods without a download URL secret: %+v", object.AccessMethods)
+	}
+	if want := []DrsChecksum{{"abc", "sha-256"}, {"def", "md5"}}; !reflect.DeepEqual(object.Checksums, want) {
+		t.Errorf("checksums %v, want %v", object.Checksums, want)
+	}
+	if object.SelfURI != "drs://genomics.example.org/variant-4" || object.Name != "calls.vcf.gz" {
+		t.Errorf("object %+v", object)
+	}
+
+	t.Setenv("DOWNLOAD_URL_SECRET", testDownloadSecret)
+	object = drsVariantFile(c, file)
+	if want := []DrsAccessMethod{content, {Type: "https", AccessID: drsSignedAccess}}; !reflect.DeepEqual(object.AccessMethods, want) {
+		t.Errorf("access methods with a download URL secret: %+v", object.AccessMethods)
+	}
+}
+
+func drsRouter() http.Handler {
+	r := testRouter()
+	r.GET("/ga4gh/drs/v1/objects/:object_id", GetDRSObject)
+	r.GET("/ga4gh/drs/v1/objects/:object_id/access/:access_id", GetDRSAccessURL)
+	return r
+}
+
+func TestDRSSampleBundle(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	sequence := []models.SequenceFile{
+		{SampleID: sample.ID, FilePath: "reads_1.fastq", FileType: "FASTQ", SizeBytes: 100, Checksum: strings.Repeat("b", 64)},
+		{SampleID: sample.ID, FilePath: "reads_2.fastq", FileType: "FASTQ", SizeBytes: 200, Checksum: strings.Repeat("c", 64)},
+	}
+	variant := models.VariantFile{SampleID: sample.ID, GenomeID: sample.GenomeID, FilePath: "calls.vcf", FileType: "VCF", SizeBytes: 30, Checksum: strings.Repeat("a", 64)}
+	if err := db.Create(&sequence).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&variant).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := drsRouter()
+	path := "/ga4gh/drs/v1/objects/sample-" + strconv.Itoa(sample.ID)
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+	var bundle DrsObject
+	json.Unmarshal(w.Body.Bytes(), &bundle)
+	if w.Code != http.StatusOK || bundle.Size != 330 || len(bundle.Contents) != 3 || bundle.Name != "DONOR1" {
+		t.Fatalf("bundle: %d %s", w.Code, w.Body)
+	}
+	// The members' SHA-256s sorted, so aaa… first though it's listed last
+	sum := sha256.Sum256([]byte(strings.Repeat("a", 64) + strings.Repeat("b", 64) + strings.Repeat("c", 64)))
+	if want := []DrsChecksum{{hex.EncodeToString(sum[:]), "sha-256"}}; !reflect.DeepEqual(bundle.Checksums, want) {
+		t.Errorf("bundle checksums %v, want %v", bundle.Checksums, want)
+	}
+	ids := []string{bundle.Contents[0].ID, bundle.Contents[1].ID, bundle.Contents[2].ID}
+	want := []string{"sequence-" + strconv.Itoa(sequence[0].ID), "sequence-" + strconv.Itoa(sequence[1].ID), "variant-" + strconv.Itoa(variant.ID)}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("bundle contents %v, want %v", ids, want)
+	}
+
+	// A member without a SHA-256 leaves nothing to derive one from
+	if err := db.Model(&variant).Update("checksum", "").Error; err != nil {
+		t.Fatal(err)
+	}
+	w = serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+	json.Unmarshal(w.Body.Bytes(), &bundle)
+	if w.Code != http.StatusOK || len(bundle.Checksums) != 0 {
+		t.Errorf("bundle with an unchecked member: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestDRSAccessURL(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	file := models.SequenceFile{SampleID: sample.ID, FilePath: "reads.fastq", FileType: "FASTQ", SizeBytes: 4, UploadedAt: time.Now()}
+	if err := db.Create(&file).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := drsRouter()
+	objectID := "sequence-" + strconv.Itoa(file.ID)
+	access := func(objectID, accessID string) (int, string) {
+		w := serve(r, httptest.NewRequest(http.MethodGet, "/ga4gh/drs/v1/objects/"+objectID+"/access/"+accessID, nil))
+		var body struct {
+			URL string `json:"url"`
+			Msg string `json:"msg"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w.Code, body.URL + body.Msg
+	}
+
+	// Without a secret no signed URLs can be made, so the ID resolves to nothing
+	t.Setenv("DOWNLOAD_URL_SECRET", "")
+	if code, msg := access(objectID, drsSignedAccess); code != http.StatusNotFound || msg != "Access ID not found" {
+		t.Errorf("signed access without a secret: %d %s", code, msg)
+	}
+
+	t.Setenv("DOWNLOAD_URL_SECRET", testDownloadSecret)
+	code, signed := access(objectID, drsSignedAccess)
+	if code != http.StatusOK || !strings.Contains(signed, "/api/sequence/"+strconv.Itoa(file.ID)+"/download?") {
+		t.Fatalf("signed access: %d %s", code, signed)
+	}
+	var presigns int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", audit.ActionPresign, file.ID).Count(&presigns)
+	if presigns != 1 {
+		t.Errorf("%d presign audit entries, want 1", presigns)
+	}
+
+	for _, test := range []struct{ objectID, accessID, want string }{
+		{objectID, "s3", "Access ID not found"},
+		{"sample-" + strconv.Itoa(sample.ID), drsSignedAccess, "Object not found"},
+		{"sequence-999999", drsSignedAccess, "Object not found"},
+		{"sequence-x", drsSignedAccess, "Object not found"},
+	} {
+		if code, msg := access(test.objectID, test.accessID); code != http.StatusNotFound || msg != test.want {
+			t.Errorf("access %s of %s: %d %s, want 404 %s", test.accessID, test.objectID, code, msg, test.want)
+		}
+	}
+}
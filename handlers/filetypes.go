@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"genomic-api/filetype"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fileTypes are the types each kind of file can be declared as
+var fileTypes = map[string][]string{
+	models.UploadSequenceFile: filetype.Sequence,
+	models.UploadVariantFile:  filetype.Variant,
+}
+
+// normalizeFileType rewrites fileType to the allowed type it names, or
+// responds with 400 and returns false if it names none
+func normalizeFileType(c *gin.Context, fileType *string, allowed []string) bool {
+	normalized, err := filetype.Normalize(*fileType, allowed)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	*fileType = normalized
+	return true
+}
+
+// sniff recognises the format of the file r starts
+func sniff(r io.Reader) (filetype.Content, error) {
+	head := make([]byte, filetype.SniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return filetype.Content{}, err
+	}
+	return filetype.Sniff(head[:n]), nil
+}
+
+// checkContent compares the content of a stored file with its declared type
+// and responds with 422 if they disagree. Files that can't be read from
+// storage, such as ones registered before they are copied in, are let
+// through.
+func checkContent(c *gin.Context, key, fileType string) bool {
+	body, err := storage.Default.GetRange(c.Request.Context(), key, 0, filetype.SniffLength)
+	if err != nil {
+		return true
+	}
+	defer body.Close()
+	content, err := sniff(body)
+	if err != nil {
+		return true
+	}
+	return contentMatches(c, fileType, content)
+}
+
+// contentMatches responds with 422 and returns false if content isn't what
+// fileType declares
+func contentMatches(c *gin.Context, fileType string, content filetype.Content) bool {
+	if err := filetype.Check(fileType, content); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "content": content})
+		return false
+	}
+	return true
+}
@@ -1,34 +1,64 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"genomic-api/audit"
 	"genomic-api/config"
+	"genomic-api/ingest"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// genomeList is what ListGenomes can filter and sort on
+var genomeList = listSpec{
+	filters: map[string]filter{
+		"name":              {expr: "name = ?"},
+		"species":           {expr: "species = ?"},
+		"reference_version": {expr: "reference_version = ?"},
+		"created_by":        {expr: "created_by = ?", kind: intParam},
+		"reference_status":  {expr: "reference_status = ?"},
+		"created_after":     {expr: "created_at >= ?", kind: timeParam},
+		"created_before":    {expr: "created_at < ?", kind: timeParam},
+	},
+	sorts: map[string]string{
+		"id": "id", "name": "name", "species": "species",
+		"reference_version": "reference_version", "created_at": "created_at",
+	},
+	defaultSort: "id",
+}
+
 // ListGenomes godoc
 // @Summary      List genomes
-// @Description  Get all genomes
+// @Description  Get genomes a page at a time. The total is returned in X-Total-Count and page links in Link.
 // @Tags         genomes
 // @Produce      json
-// @Success      200  {array}  models.Genome
+// @Param        species            query  string  false  "Species"
+// @Param        name               query  string  false  "Genome name"
+// @Param        reference_version  query  string  false  "Reference version, e.g. GRCh38"
+// @Param        created_by         query  int     false  "Creating user ID"
+// @Param        reference_status   query  string  false  "Contig indexing status: queued, running, succeeded or failed"
+// @Param        created_after      query  string  false  "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        created_before     query  string  false  "Created before (RFC 3339 or YYYY-MM-DD)"
+// @Param        sort               query  string  false  "Comma-separated keys: id, name, species, reference_version, created_at; prefix - for descending"
+// @Param        page               query  int     false  "Page number, from 1"
+// @Param        per_page           query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.Genome
+// @Failure      400  {object}  map[string]string
 // @Router       /api/genomes [get]
 func ListGenomes(c *gin.Context) {
 	var genomes []models.Genome
-	if err := config.DB.Find(&genomes).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, genomes)
+	listPage(c, config.DB.Model(&models.Genome{}), genomeList, &genomes)
 }
 
 // CreateGenome godoc
 // @Summary      Create genome
-// @Description  Add a new genome record
+// @Description  Add a new genome record. A genome with a fasta_path has its reference FASTA queued for indexing into contigs.
 // @Tags         genomes
 // @Accept       json
 // @Produce      json
@@ -41,10 +71,25 @@ func CreateGenome(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Create(&genome).Error; err != nil {
+	genome.ReferenceStatus, genome.ContigCount = "", 0 // set by indexing, not by callers
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&genome).Error; err != nil {
+			return err
+		}
+		if genome.FastaPath != "" {
+			if _, err := ingest.Enqueue(tx, models.IngestReference, genome.ID); err != nil {
+				return err
+			}
+			genome.ReferenceStatus = models.IngestQueued
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceGenome, genome.ID, nil, genome)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if genome.ReferenceStatus == models.IngestQueued {
+		ingest.Notify()
+	}
 	c.JSON(http.StatusCreated, genome)
 }
 
@@ -69,7 +114,7 @@ func GetGenome(c *gin.Context) {
 
 // UpdateGenome godoc
 // @Summary      Update genome
-// @Description  Update genome by ID
+// @Description  Update genome by ID. Changing fasta_path or fai_path queues the reference for indexing again; clearing fasta_path removes the genome's contigs.
 // @Tags         genomes
 // @Accept       json
 // @Produce      json
@@ -77,6 +122,7 @@ func GetGenome(c *gin.Context) {
 // @Param        genome  body      models.Genome true  "Genome info"
 // @Success      200     {object}  models.Genome
 // @Failure      404     {object}  map[string]string
+// @Failure      409     {object}  map[string]string
 // @Router       /api/genomes/{id} [put]
 func UpdateGenome(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
@@ -85,14 +131,56 @@ func UpdateGenome(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Genome not found"})
 		return
 	}
+	before := genome
 	if err := c.ShouldBindJSON(&genome); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Save(&genome).Error; err != nil {
+	genome.ID = before.ID // the path decides which record is updated, not the body
+	genome.ReferenceStatus, genome.ContigCount = before.ReferenceStatus, before.ContigCount
+	reindex := genome.FastaPath != before.FastaPath || genome.FaiPath != before.FaiPath
+	var active models.IngestJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if reindex {
+			// Lock the genome so concurrent requests can't both queue a job
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Genome{}, genome.ID).Error
+			if err != nil {
+				return err
+			}
+			if active, err = ingest.Active(tx, models.IngestReference, genome.ID); err == nil {
+				return errIngestActive
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if genome.FastaPath == "" {
+				if err := tx.Where("genome_id = ?", genome.ID).Delete(&models.Contig{}).Error; err != nil {
+					return err
+				}
+				genome.ReferenceStatus, genome.ContigCount = "", 0
+			}
+		}
+		if err := tx.Save(&genome).Error; err != nil {
+			return err
+		}
+		if reindex && genome.FastaPath != "" {
+			if _, err := ingest.Enqueue(tx, models.IngestReference, genome.ID); err != nil {
+				return err
+			}
+			genome.ReferenceStatus = models.IngestQueued
+		}
+		return recordAudit(tx, c, audit.ActionUpdate, audit.ResourceGenome, genome.ID, before, genome)
+	})
+	if errors.Is(err, errIngestActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Genome reference is still being indexed", "job_id": active.ID})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if reindex && genome.FastaPath != "" {
+		ingest.Notify()
+	}
 	c.JSON(http.StatusOK, genome)
 }
 
@@ -107,7 +195,17 @@ func UpdateGenome(c *gin.Context) {
 // @Router       /api/genomes/{id} [delete]
 func DeleteGenome(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := config.DB.Delete(&models.Genome{}, id).Error; err != nil {
+	var genome models.Genome
+	if err := config.DB.First(&genome, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Genome not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&genome).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceGenome, genome.ID, genome, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
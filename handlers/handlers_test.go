@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"genomic-api/config"
+	"genomic-api/middleware"
+	"genomic-api/models"
+	"genomic-api/storage"
+	"genomic-api/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// testAdminID is the admin seeded by genomic_schema.dmbl.sql
+const testAdminID = 1
+
+// useTestDB points config.DB at a throwaway database and storage at
+// temporary directories for the rest of the test
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t)
+	oldDB := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = oldDB })
+	useTestStorage(t)
+	return db
+}
+
+// useTestStorage points storage at temporary directories for the rest of
+// the test
+func useTestStorage(t *testing.T) {
+	t.Helper()
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBackend, oldStaging := storage.Default, storage.StagingDir
+	storage.Default, storage.StagingDir = local, t.TempDir()
+	t.Cleanup(func() { storage.Default, storage.StagingDir = oldBackend, oldStaging })
+}
+
+// createTestSample inserts a genome and a sample of it
+func createTestSample(t *testing.T, db *gorm.DB) models.Sample {
+	t.Helper()
+	genome := models.Genome{Name: "GRCh38", Species: "Homo sapiens", ReferenceVersion: "GRCh38", CreatedBy: testAdminID}
+	if err := db.Create(&genome).Error; err != nil {
+		t.Fatalf("create genome: %v", err)
+	}
+	sample := models.Sample{GenomeID: genome.ID, DonorID: "DONOR1", CollectionDate: "2024-01-01", SampleType: "blood", Metadata: "{}", CollectedBy: testAdminID}
+	if err := db.Create(&sample).Error; err != nil {
+		t.Fatalf("create sample: %v", err)
+	}
+	return sample
+}
+
+// testRouter is a router whose every request is made by the seeded admin
+func testRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultErrorWriter = io.Discard
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		middleware.SetUser(c, testAdminID, models.RoleAdmin)
+		c.Next()
+	})
+	return r
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"genomic-api/config"
+	"genomic-api/headercheck"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// headerValidationRejects reports whether files whose headers don't match
+// their sample or genome are refused (HEADER_VALIDATION=reject, the default)
+// rather than registered and flagged (HEADER_VALIDATION=flag)
+func headerValidationRejects() bool {
+	return !strings.EqualFold(strings.TrimSpace(os.Getenv("HEADER_VALIDATION")), "flag")
+}
+
+// headerFormat is the header format of a file, going by its name or, for
+// files registered without one, its storage key
+func headerFormat(fileType, fileName, filePath string) string {
+	if fileName == "" {
+		fileName = filePath
+	}
+	return headercheck.Format(fileType, fileName)
+}
+
+// applyHeaderCheck stores report in a file's header fields. If the header
+// doesn't match and mismatches are refused, it responds with the report
+// instead and returns false.
+func applyHeaderCheck(c *gin.Context, report headercheck.Report, status *string, data *models.JSON) bool {
+	if report.Status == headercheck.StatusMismatch && headerValidationRejects() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "File header does not match its sample or genome", "header_report": report})
+		return false
+	}
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	*status, *data = report.Status, models.JSON(encoded)
+	return true
+}
+
+// recordHeaderCheck saves a re-check of a stored file and responds with it
+func recordHeaderCheck(c *gin.Context, model interface{}, id int, report headercheck.Report) {
+	encoded, err := json.Marshal(report)
+	if err == nil {
+		err = config.DB.Model(model).Where("id = ?", id).Updates(map[string]interface{}{
+			"header_status": report.Status,
+			"header_report": models.JSON(encoded),
+		}).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// CheckSequenceFileHeader godoc
+// @Summary      Check sequence file header
+// @Description  Compare a BAM's @SQ lines with the contigs of its sample's genome and its @RG SM tags with the sample's donor ID now, and save the result as the file's header_status and header_report. Use it after indexing the genome's reference or correcting the sample. Mismatches are recorded, not refused.
+// @Tags         sequence
+// @Produce      json
+// @Param        id   path      int  true  "Sequence file ID"
+// @Success      200  {object}  headercheck.Report
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/check-header [post]
+func CheckSequenceFileHeader(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var file models.SequenceFile
+	if err := config.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file not found"})
+		return
+	}
+	report, err := headercheck.CheckStored(c.Request.Context(), config.DB, file.FilePath,
+		headerFormat(file.FileType, file.FileName, file.FilePath), file.SampleID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordHeaderCheck(c, &models.SequenceFile{}, file.ID, report)
+}
+
+// CheckVariantFileHeader godoc
+// @Summary      Check variant file header
+// @Description  Compare a VCF's ##contig lines with the contigs of its genome and its sample columns with the sample's donor ID now, and save the result as the file's header_status and header_report. Use it after indexing the genome's reference or correcting the sample. Mismatches are recorded, not refused.
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      int  true  "Variant file ID"
+// @Success      200  {object}  headercheck.Report
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/check-header [post]
+func CheckVariantFileHeader(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var file models.VariantFile
+	if err := config.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant file not found"})
+		return
+	}
+	report, err := headercheck.CheckStored(c.Request.Context(), config.DB, file.FilePath,
+		headerFormat(file.FileType, file.FileName, file.FilePath), file.SampleID, file.GenomeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	recordHeaderCheck(c, &models.VariantFile{}, file.ID, report)
+}
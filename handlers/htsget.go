@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+	"genomic-api/config"
+	"genomic-api/cram"
+	"genomic-api/htsindex"
+	"genomic-api/ingest"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// htsgetContentType is the media type of htsget responses, errors included
+const htsgetContentType = "application/vnd.ga4gh.htsget.v1.3.0+json; charset=utf-8"
+
+// contentPaths is where each kind of file is downloaded with a token
+var contentPaths = map[string]string{
+	audit.ResourceSequenceFile: "/api/sequence/%d/content",
+	audit.ResourceVariantFile:  "/api/variants/%d/content",
+}
+
+// HtsgetURL is one piece of a ticket. Fetching every piece in order and
+// concatenating them gives a valid file holding the requested records.
+type HtsgetURL struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Class   string            `json:"class,omitempty"` // header or body
+}
+
+// HtsgetTicket says where to fetch the data of an htsget request
+type HtsgetTicket struct {
+	Format string      `json:"format"`
+	URLs   []HtsgetURL `json:"urls"`
+}
+
+// HtsgetResponse is the body of a successful htsget request
+type HtsgetResponse struct {
+	Htsget HtsgetTicket `json:"htsget"`
+}
+
+// htsgetError is an error in the form htsget clients expect
+type htsgetError struct {
+	status  int
+	code    string // InvalidInput, InvalidRange, NotFound, UnsupportedFormat...
+	message string
+}
+
+func (e *htsgetError) Error() string {
+	return e.message
+}
+
+func invalidInput(format string, args ...interface{}) error {
+	return &htsgetError{http.StatusBadRequest, "InvalidInput", fmt.Sprintf(format, args...)}
+}
+
+func htsgetNotFound(format string, args ...interface{}) error {
+	return &htsgetError{http.StatusNotFound, "NotFound", fmt.Sprintf(format, args...)}
+}
+
+func unsupportedFormat(format string, args ...interface{}) error {
+	return &htsgetError{http.StatusBadRequest, "UnsupportedFormat", fmt.Sprintf(format, args...)}
+}
+
+// htsgetJSON writes an htsget response or error
+func htsgetJSON(c *gin.Context, status int, body interface{}) {
+	data, _ := json.Marshal(body)
+	c.Data(status, htsgetContentType, data)
+}
+
+// htsgetFail writes err as an htsget error
+func htsgetFail(c *gin.Context, err error) {
+	var e *htsgetError
+	if !errors.As(err, &e) {
+		e = &htsgetError{http.StatusInternalServerError, "InternalError", err.Error()}
+	}
+	htsgetJSON(c, e.status, gin.H{"htsget": gin.H{"error": e.code, "message": e.message}})
+}
+
+// htsgetRequest is the part of a file an htsget client asked for
+type htsgetRequest struct {
+	class     string // "header" for the header alone, otherwise empty
+	reference string // empty for the whole file, "*" for unplaced unmapped reads
+	start     int64  // 0-based
+	end       int64  // exclusive; 0 for the end of the reference
+}
+
+// parseHtsgetRequest reads and checks the htsget query parameters. Fields
+// and tags selection isn't supported, so those parameters are ignored and
+// whole records are returned, as the protocol allows.
+func parseHtsgetRequest(c *gin.Context) (htsgetRequest, error) {
+	req := htsgetRequest{class: c.Query("class"), reference: c.Query("referenceName")}
+	if req.class != "" && req.class != "header" {
+		return req, invalidInput("class must be header")
+	}
+	var hasStart, hasEnd bool
+	for _, param := range []struct {
+		name  string
+		value *int64
+		set   *bool
+	}{{"start", &req.start, &hasStart}, {"end", &req.end, &hasEnd}} {
+		text, ok := c.GetQuery(param.name)
+		if !ok {
+			continue
+		}
+		value, err := strconv.ParseInt(text, 10, 64)
+		if err != nil || value < 0 {
+			return req, invalidInput("%s must be a non-negative integer", param.name)
+		}
+		*param.value, *param.set = value, true
+	}
+	switch {
+	case req.class == "header" && (req.reference != "" || hasStart || hasEnd):
+		return req, invalidInput("class=header can't be combined with referenceName, start or end")
+	case req.reference == "" && (hasStart || hasEnd):
+		return req, invalidInput("start and end need a referenceName")
+	case req.reference == "*" && (hasStart || hasEnd):
+		return req, invalidInput("start and end can't be used with referenceName=*")
+	case hasEnd && req.end <= req.start:
+		return req, &htsgetError{http.StatusBadRequest, "InvalidRange", "end must be greater than start"}
+	}
+	return req, nil
+}
+
+// htsgetFile is a stored file and what it is served as
+type htsgetFile struct {
+	key      string
+	indexKey string
+	format   string // BAM, CRAM or VCF; empty if it can't be served
+}
+
+// loadHtsgetFile loads the sequence or variant file with the given ID
+func loadHtsgetFile(kind string, id int) (htsgetFile, error) {
+	if kind == audit.ResourceVariantFile {
+		var file models.VariantFile
+		if err := config.DB.First(&file, id).Error; err != nil {
+			return htsgetFile{}, err
+		}
+		served := htsgetFile{key: file.FilePath, indexKey: file.IndexPath}
+		if ingest.IsVCF(file) {
+			served.format = "VCF"
+		}
+		return served, nil
+	}
+	var file models.SequenceFile
+	if err := config.DB.First(&file, id).Error; err != nil {
+		return htsgetFile{}, err
+	}
+	served := htsgetFile{key: file.FilePath, indexKey: file.IndexPath}
+	fileType := strings.ToUpper(strings.TrimSpace(file.FileType))
+	switch ext := strings.ToLower(path.Ext(file.FileName)); {
+	case fileType == "BAM" || ext == ".bam":
+		served.format = "BAM"
+	case fileType == "CRAM" || ext == ".cram":
+		served.format = "CRAM"
+	}
+	return served, nil
+}
+
+// ticketPiece is a byte range of the stored file, or data given inline
+type ticketPiece struct {
+	class    string
+	from, to int64 // to exclusive
+	data     []byte
+}
+
+// ticketBuilder assembles the pieces of a ticket for one file
+type ticketBuilder struct {
+	ctx    context.Context
+	key    string
+	pieces []ticketPiece
+}
+
+// byteRange adds bytes [from, to) of the file, extending the last piece
+// where they follow on from it
+func (t *ticketBuilder) byteRange(class string, from, to int64) {
+	if from >= to {
+		return
+	}
+	if n := len(t.pieces); n > 0 {
+		last := &t.pieces[n-1]
+		if last.data == nil && last.class == class && last.to == from {
+			last.to = to
+			return
+		}
+	}
+	t.pieces = append(t.pieces, ticketPiece{class: class, from: from, to: to})
+}
+
+// inline adds data that isn't in the file as it stands
+func (t *ticketBuilder) inline(class string, data []byte) {
+	t.pieces = append(t.pieces, ticketPiece{class: class, data: data})
+}
+
+// block reads and decompresses the BGZF block at offset
+func (t *ticketBuilder) block(offset int64) ([]byte, int, error) {
+	body, err := storage.Default.GetRange(t.ctx, t.key, offset, bgzf.MaxBlockSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer body.Close()
+	return bgzf.ReadBlock(body)
+}
+
+// chunk adds the records between two virtual offsets. Whole blocks are
+// served from the file; where the chunk starts or ends part way through a
+// block, that part is recompressed and sent inline, so no stray bytes of a
+// neighbouring record end up in the stream.
+func (t *ticketBuilder) chunk(class string, chunk htsindex.Chunk) error {
+	beg, end := chunk.Beg, chunk.End
+	if beg >= end {
+		return nil
+	}
+	from := beg.Block()
+	if beg.Within() > 0 {
+		data, size, err := t.block(from)
+		if err != nil {
+			return err
+		}
+		if beg.Block() == end.Block() {
+			t.inline(class, bgzf.Compress(slice(data, beg.Within(), end.Within())))
+			return nil
+		}
+		t.inline(class, bgzf.Compress(slice(data, beg.Within(), len(data))))
+		from += int64(size)
+	}
+	t.byteRange(class, from, end.Block())
+	if end.Within() > 0 {
+		data, _, err := t.block(end.Block())
+		if err != nil {
+			return err
+		}
+		t.inline(class, bgzf.Compress(slice(data, 0, end.Within())))
+	}
+	return nil
+}
+
+// slice is data[from:to], clamped to data
+func slice(data []byte, from, to int) []byte {
+	if to > len(data) {
+		to = len(data)
+	}
+	if from > to {
+		from = to
+	}
+	return data[from:to]
+}
+
+// urls turns the pieces into ticket URLs, fetching ranges from source with
+// the given headers
+func (t *ticketBuilder) urls(source string, headers map[string]string) []HtsgetURL {
+	urls := make([]HtsgetURL, 0, len(t.pieces))
+	for _, piece := range t.pieces {
+		if piece.data != nil {
+			urls = append(urls, HtsgetURL{URL: "data:;base64," + base64.StdEncoding.EncodeToString(piece.data), Class: piece.class})
+			continue
+		}
+		pieceHeaders := map[string]string{"Range": fmt.Sprintf("bytes=%d-%d", piece.from, piece.to-1)}
+		for name, value := range headers {
+			pieceHeaders[name] = value
+		}
+		urls = append(urls, HtsgetURL{URL: source, Headers: pieceHeaders, Class: piece.class})
+	}
+	return urls
+}
+
+// skipVCFHeader reads a VCF's header lines, leaving r at the first record,
+// and returns the header's length
+func skipVCFHeader(r io.ByteScanner) (int64, error) {
+	var n int64
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if b != '#' {
+			return n, r.UnreadByte()
+		}
+		for n++; b != '\n'; n++ {
+			if b, err = r.ReadByte(); err == io.EOF {
+				return n, nil
+			} else if err != nil {
+				return 0, err
+			}
+		}
+	}
+}
+
+// findReference is the index of name in names, also trying the name with
+// or without a "chr" prefix
+func findReference(names []string, name string) (int, bool) {
+	for _, candidate := range chromNames(name) {
+		for i, n := range names {
+			if n == candidate {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// buildTicket works out the pieces of file that answer req
+func buildTicket(t *ticketBuilder, file htsgetFile, req htsgetRequest) error {
+	info, err := storage.Default.Stat(t.ctx, file.key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return htsgetNotFound("File content not found")
+	}
+	if err != nil {
+		return err
+	}
+	start, err := storage.Default.GetRange(t.ctx, file.key, 0, 18)
+	if err != nil {
+		return err
+	}
+	magic, _ := io.ReadAll(start)
+	start.Close()
+
+	// Without block structure the file can't be cut up by region. An
+	// uncompressed VCF is split into header and body; a CRAM is cut into
+	// containers with its .crai; CRAM without one and plain gzip are served
+	// whole.
+	switch {
+	case file.format == "CRAM" && file.indexKey != "":
+		return cramTicket(t, file, req, info.Size)
+	case file.format == "VCF" && !bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		body, err := storage.Default.Get(t.ctx, file.key)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		headerEnd, err := skipVCFHeader(bufio.NewReader(body))
+		if err != nil {
+			return err
+		}
+		t.byteRange("header", 0, headerEnd)
+		if req.class != "header" {
+			t.byteRange("body", headerEnd, info.Size)
+		}
+		return nil
+	case file.format == "CRAM" || !bgzf.IsBGZF(magic):
+		if req.class == "header" {
+			return invalidInput("class=header is not supported for this file")
+		}
+		t.byteRange("", 0, info.Size)
+		return nil
+	}
+
+	body, err := storage.Default.Get(t.ctx, file.key)
+	if err != nil {
+		return err
+	}
+	reader := bgzf.NewReader(body)
+	var names []string
+	if file.format == "BAM" {
+		var header *bam.Header
+		if header, err = bam.ReadHeader(reader); err == nil {
+			names = header.Names()
+		}
+	} else {
+		_, err = skipVCFHeader(reader)
+	}
+	headerEnd := reader.Offset()
+	body.Close()
+	if err != nil {
+		return fmt.Errorf("read %s header: %w", file.format, err)
+	}
+	if err := t.chunk("header", htsindex.Chunk{End: headerEnd}); err != nil {
+		return err
+	}
+	if req.class == "header" {
+		return nil
+	}
+
+	// Leave out the file's own EOF block; one is added at the end
+	dataEnd := info.Size
+	if info.Size >= int64(len(bgzf.EOF)) {
+		tail, err := storage.Default.GetRange(t.ctx, file.key, info.Size-int64(len(bgzf.EOF)), int64(len(bgzf.EOF)))
+		if err != nil {
+			return err
+		}
+		last, _ := io.ReadAll(tail)
+		tail.Close()
+		if bytes.Equal(last, bgzf.EOF) {
+			dataEnd -= int64(len(bgzf.EOF))
+		}
+	}
+	whole := htsindex.Chunk{Beg: headerEnd, End: bgzf.MakeOffset(dataEnd, 0)}
+
+	chunks := []htsindex.Chunk{whole}
+	if req.reference != "" && req.reference != "*" && file.format == "BAM" {
+		if _, ok := findReference(names, req.reference); !ok {
+			return htsgetNotFound("Reference %s is not in the file", req.reference)
+		}
+	}
+	// Without an index the whole body is served; clients drop what they
+	// didn't ask for
+	if req.reference != "" && file.indexKey != "" {
+		index, err := loadIndex(t.ctx, file.indexKey)
+		if err != nil {
+			return err
+		}
+		switch {
+		case req.reference == "*":
+			if end := index.End(); end > whole.Beg {
+				whole.Beg = end
+			}
+			chunks = []htsindex.Chunk{whole}
+		default:
+			if index.Names != nil {
+				names = index.Names
+			}
+			ref, ok := findReference(names, req.reference)
+			if !ok {
+				return htsgetNotFound("Reference %s is not in the file", req.reference)
+			}
+			chunks = index.Query(ref, req.start, req.end)
+		}
+	}
+	for _, chunk := range chunks {
+		if chunk.Beg < headerEnd {
+			chunk.Beg = headerEnd
+		}
+		if err := t.chunk("body", chunk); err != nil {
+			return err
+		}
+	}
+	t.inline("body", bgzf.EOF)
+	return nil
+}
+
+// cramTicket works out the pieces of a CRAM with a .crai index that answer
+// req: the file definition and header container, the containers holding the
+// requested records, whole, and the EOF container
+func cramTicket(t *ticketBuilder, file htsgetFile, req htsgetRequest, size int64) error {
+	body, err := storage.Default.Get(t.ctx, file.indexKey)
+	if err != nil {
+		return fmt.Errorf("read index %s: %w", file.indexKey, err)
+	}
+	index, err := htsindex.ReadCRAI(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	offsets := index.Offsets()
+	if len(offsets) == 0 || offsets[0] >= size {
+		if req.class == "header" {
+			return invalidInput("class=header is not supported for this file")
+		}
+		t.byteRange("", 0, size)
+		return nil
+	}
+	t.byteRange("header", 0, offsets[0])
+	if req.class == "header" {
+		return nil
+	}
+
+	// Leave out the file's own EOF container; it is added back at the end
+	dataEnd := size
+	var eof []byte
+	for _, candidate := range [][]byte{cram.EOF, cram.EOF2} {
+		if size-int64(len(candidate)) < offsets[0] {
+			continue
+		}
+		tail, err := storage.Default.GetRange(t.ctx, file.key, size-int64(len(candidate)), int64(len(candidate)))
+		if err != nil {
+			return err
+		}
+		last, _ := io.ReadAll(tail)
+		tail.Close()
+		if bytes.Equal(last, candidate) {
+			dataEnd, eof = size-int64(len(candidate)), candidate
+			break
+		}
+	}
+
+	containers := offsets
+	switch req.reference {
+	case "":
+	case "*":
+		containers = index.Containers(-1, 0, 0)
+	default:
+		body, err := storage.Default.Get(t.ctx, file.key)
+		if err != nil {
+			return err
+		}
+		reader, err := cram.NewReader(body)
+		body.Close()
+		if err != nil {
+			return fmt.Errorf("read CRAM header: %w", err)
+		}
+		ref, ok := findReference(reader.Header().Names(), req.reference)
+		if !ok {
+			return htsgetNotFound("Reference %s is not in the file", req.reference)
+		}
+		containers = index.Containers(ref, req.start, req.end)
+	}
+	// A container runs up to the next one, or the end of the data
+	for _, offset := range containers {
+		end := dataEnd
+		if next := sort.Search(len(offsets), func(i int) bool { return offsets[i] > offset }); next < len(offsets) && offsets[next] < dataEnd {
+			end = offsets[next]
+		}
+		t.byteRange("body", offset, end)
+	}
+	if eof != nil {
+		t.inline("body", eof)
+	}
+	return nil
+}
+
+// loadIndex reads a .bai, .csi or .tbi index from storage
+func loadIndex(ctx context.Context, key string) (*htsindex.Index, error) {
+	body, err := storage.Default.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("read index %s: %w", key, err)
+	}
+	defer body.Close()
+	return htsindex.Read(body)
+}
+
+// htsget answers an htsget request for the sequence or variant file in the
+// path with a ticket
+func htsget(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	file, err := loadHtsgetFile(kind, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		htsgetFail(c, htsgetNotFound("File not found"))
+		return
+	}
+	if err != nil {
+		htsgetFail(c, err)
+		return
+	}
+	if file.format == "" {
+		htsgetFail(c, unsupportedFormat("Only BAM, CRAM and VCF files can be served over htsget"))
+		return
+	}
+	if format := strings.ToUpper(c.Query("format")); format != "" && format != file.format {
+		htsgetFail(c, unsupportedFormat("The file is only available as %s", file.format))
+		return
+	}
+	req, err := parseHtsgetRequest(c)
+	if err != nil {
+		htsgetFail(c, err)
+		return
+	}
+	if req.reference == "*" && file.format == "VCF" {
+		htsgetFail(c, invalidInput("referenceName=* is only supported for BAM and CRAM"))
+		return
+	}
+
+	t := &ticketBuilder{ctx: c.Request.Context(), key: file.key}
+	if err := buildTicket(t, file, req); err != nil {
+		htsgetFail(c, err)
+		return
+	}
+
+	// Ranges are fetched with a signed download URL when those are set up,
+	// otherwise from the content endpoint with the caller's own credentials
+	var source string
+	headers := map[string]string{}
+	if len(downloadURLSecret()) > 0 {
+		expiresAt := time.Now().Add(defaultDownloadURLTTL).Truncate(time.Second)
+		ip := c.ClientIP()
+		source = signedDownloadURL(c, kind, id, expiresAt, ip)
+		extra := map[string]interface{}{"expires_at": expiresAt.UTC(), "ip": ip, "htsget": true}
+		if err := audit.Record(config.DB, auditEntry(c, audit.ActionPresign, kind, id, nil, nil, extra)); err != nil {
+			htsgetFail(c, err)
+			return
+		}
+	} else {
+		source = publicBaseURL(c) + fmt.Sprintf(contentPaths[kind], id)
+		if authorization := c.GetHeader("Authorization"); authorization != "" {
+			headers["Authorization"] = authorization
+		}
+	}
+	htsgetJSON(c, http.StatusOK, HtsgetResponse{Htsget: HtsgetTicket{Format: file.format, URLs: t.urls(source, headers)}})
+}
+
+// HtsgetReads godoc
+// @Summary      htsget reads ticket
+// @Description  GA4GH htsget 1.3: get a ticket of URLs that together make up the reads of a BAM file overlapping a region. With an index (a .bai or .csi, see /api/sequence/{id}/index) only the blocks holding those reads are included; otherwise the whole file is. Partial blocks are sent inline as data: URLs. A CRAM with a .crai is cut down to whole containers; one without is served whole. Range URLs are signed download URLs when DOWNLOAD_URL_SECRET is set, and otherwise the content endpoint with the caller's Authorization header.
+// @Tags         htsget
+// @Produce      json
+// @Param        id             path   int     true   "Sequence file ID"
+// @Param        format         query  string  false  "BAM or CRAM; defaults to the file's format"
+// @Param        class          query  string  false  "header for the header alone"
+// @Param        referenceName  query  string  false  "Reference sequence, or * for unplaced unmapped reads"
+// @Param        start          query  int     false  "Start, 0-based inclusive"
+// @Param        end            query  int     false  "End, 0-based exclusive"
+// @Success      200  {object}  HtsgetResponse
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /htsget/reads/{id} [get]
+func HtsgetReads(c *gin.Context) {
+	htsget(c, audit.ResourceSequenceFile)
+}
+
+// HtsgetVariants godoc
+// @Summary      htsget variants ticket
+// @Description  GA4GH htsget 1.3: get a ticket of URLs that together make up the records of a VCF overlapping a region. A bgzipped VCF with a tabix or CSI index (see /api/variants/{id}/index) is cut down to the blocks holding those records; otherwise the whole file is served.
+// @Tags         htsget
+// @Produce      json
+// @Param        id             path   int     true   "Variant file ID"
+// @Param        format         query  string  false  "VCF"
+// @Param        class          query  string  false  "header for the header alone"
+// @Param        referenceName  query  string  false  "Chromosome"
+// @Param        start          query  int     false  "Start, 0-based inclusive"
+// @Param        end            query  int     false  "End, 0-based exclusive"
+// @Success      200  {object}  HtsgetResponse
+// @Failure      400  {object}  map[string]interface{}
+// @Failure      404  {object}  map[string]interface{}
+// @Router       /htsget/variants/{id} [get]
+func HtsgetVariants(c *gin.Context) {
+	htsget(c, audit.ResourceVariantFile)
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+// testdata/regions.vcf.gz is bgzipped in three blocks and an EOF block:
+//
+//	offset   0, 130 bytes: the 98-byte header and chr1:100
+//	offset 130,  57 bytes: chr1:20000 and chr1:20500
+//	offset 187,  50 bytes: chr2:100
+//	offset 237,  28 bytes: EOF
+//
+// and testdata/regions.vcf.gz.tbi indexes it.
+const regionsHeader = "##fileformat=VCFv4.2\n##contig=<ID=chr1>\n##contig=<ID=chr2>\n" +
+	"#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"
+
+func regionsRecord(chrom, pos string) string {
+	return chrom + "\t" + pos + "\t.\tA\tG\t.\tPASS\t.\n"
+}
+
+func putTestFile(t *testing.T, name string) (string, []byte) {
+	t.Helper()
+	content, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return putTestObject(t, content), content
+}
+
+// fetchTicket does what a client does with a ticket's pieces: fetches each
+// range of file or decodes it inline, and joins them
+func fetchTicket(t *testing.T, file []byte, tb *ticketBuilder) []byte {
+	t.Helper()
+	var out []byte
+	for _, piece := range tb.pieces {
+		if piece.data != nil {
+			out = append(out, piece.data...)
+			continue
+		}
+		if piece.from < 0 || piece.to > int64(len(file)) {
+			t.Fatalf("range %d-%d of a %d-byte file", piece.from, piece.to, len(file))
+		}
+		out = append(out, file[piece.from:piece.to]...)
+	}
+	return out
+}
+
+func pieceClasses(tb *ticketBuilder) []string {
+	var classes []string
+	for _, piece := range tb.pieces {
+		classes = append(classes, piece.class)
+	}
+	return classes
+}
+
+func TestBuildTicketBGZF(t *testing.T) {
+	useTestStorage(t)
+	key, content := putTestFile(t, "regions.vcf.gz")
+	indexKey, _ := putTestFile(t, "regions.vcf.gz.tbi")
+	chr1 := regionsRecord("chr1", "100") + regionsRecord("chr1", "20000") + regionsRecord("chr1", "20500")
+	chr2 := regionsRecord("chr2", "100")
+
+	for _, test := range []struct {
+		name     string
+		req      htsgetRequest
+		noIndex  bool
+		want     string
+		classes  []string
+		fromFile [][2]int64 // the ranges served from the file as it stands
+	}{
+		{
+			name:     "whole file",
+			want:     regionsHeader + chr1 + chr2,
+			classes:  []string{"header", "body", "body", "body"},
+			fromFile: [][2]int64{{130, 237}},
+		},
+		{
+			name:    "header",
+			req:     htsgetRequest{class: "header"},
+			want:    regionsHeader,
+			classes: []string{"header"},
+		},
+		{
+			// The first record shares a block with the header, so it is
+			// recompressed rather than served from the file
+			name:    "start of chr1",
+			req:     htsgetRequest{reference: "chr1", start: 0, end: 200},
+			want:    regionsHeader + regionsRecord("chr1", "100"),
+			classes: []string{"header", "body", "body"},
+		},
+		{
+			// Whole blocks are served from the file; the client drops the
+			// record outside the range
+			name:     "second window of chr1",
+			req:      htsgetRequest{reference: "chr1", start: 19999, end: 20000},
+			want:     regionsHeader + regionsRecord("chr1", "20000") + regionsRecord("chr1", "20500"),
+			classes:  []string{"header", "body", "body"},
+			fromFile: [][2]int64{{130, 187}},
+		},
+		{
+			name:     "name without chr",
+			req:      htsgetRequest{reference: "1"},
+			want:     regionsHeader + chr1,
+			fromFile: [][2]int64{{130, 187}},
+		},
+		{
+			name:     "chr2",
+			req:      htsgetRequest{reference: "chr2"},
+			want:     regionsHeader + chr2,
+			fromFile: [][2]int64{{187, 237}},
+		},
+		{
+			name: "unplaced",
+			req:  htsgetRequest{reference: "*"},
+			want: regionsHeader,
+		},
+		{
+			name:     "without an index",
+			req:      htsgetRequest{reference: "chr2"},
+			noIndex:  true,
+			want:     regionsHeader + chr1 + chr2,
+			fromFile: [][2]int64{{130, 237}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			file := htsgetFile{key: key, indexKey: indexKey, format: "VCF"}
+			if test.noIndex {
+				file.indexKey = ""
+			}
+			tb := &ticketBuilder{ctx: context.Background(), key: key}
+			if err := buildTicket(tb, file, test.req); err != nil {
+				t.Fatalf("buildTicket: %v", err)
+			}
+			got, err := io.ReadAll(bgzf.NewReader(bytes.NewReader(fetchTicket(t, content, tb))))
+			if err != nil {
+				t.Fatalf("read ticket data: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("ticket data = %q, want %q", got, test.want)
+			}
+			if test.classes != nil && !reflect.DeepEqual(pieceClasses(tb), test.classes) {
+				t.Errorf("classes = %q, want %q", pieceClasses(tb), test.classes)
+			}
+			var fromFile [][2]int64
+			for _, piece := range tb.pieces {
+				if piece.data == nil {
+					fromFile = append(fromFile, [2]int64{piece.from, piece.to})
+				}
+			}
+			if !reflect.DeepEqual(fromFile, test.fromFile) {
+				t.Errorf("ranges from the file = %v, want %v", fromFile, test.fromFile)
+			}
+		})
+	}
+}
+
+func TestBuildTicketUnknownReference(t *testing.T) {
+	useTestStorage(t)
+	key, _ := putTestFile(t, "regions.vcf.gz")
+	indexKey, _ := putTestFile(t, "regions.vcf.gz.tbi")
+	tb := &ticketBuilder{ctx: context.Background(), key: key}
+	err := buildTicket(tb, htsgetFile{key: key, indexKey: indexKey, format: "VCF"}, htsgetRequest{reference: "chr3"})
+	var htsErr *htsgetError
+	if !errors.As(err, &htsErr) || htsErr.status != http.StatusNotFound {
+		t.Errorf("buildTicket = %v, want not found", err)
+	}
+}
+
+func TestBuildTicketPlainVCF(t *testing.T) {
+	useTestStorage(t)
+	body := regionsRecord("chr1", "100") + regionsRecord("chr2", "100")
+	key := putTestObject(t, []byte(regionsHeader+body))
+	file := htsgetFile{key: key, format: "VCF"}
+
+	tb := &ticketBuilder{ctx: context.Background(), key: key}
+	if err := buildTicket(tb, file, htsgetRequest{reference: "chr2"}); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(regionsHeader) + len(body))
+	want := []ticketPiece{
+		{class: "header", from: 0, to: int64(len(regionsHeader))},
+		{class: "body", from: int64(len(regionsHeader)), to: size},
+	}
+	if !reflect.DeepEqual(tb.pieces, want) {
+		t.Errorf("pieces = %+v, want %+v", tb.pieces, want)
+	}
+
+	tb = &ticketBuilder{ctx: context.Background(), key: key}
+	if err := buildTicket(tb, file, htsgetRequest{class: "header"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tb.pieces, want[:1]) {
+		t.Errorf("header pieces = %+v, want %+v", tb.pieces, want[:1])
+	}
+}
+
+func TestTicketURLs(t *testing.T) {
+	var tb ticketBuilder
+	tb.byteRange("header", 0, 10)
+	tb.byteRange("body", 10, 20)
+	// Follows on from the last piece, so extends it
+	tb.byteRange("body", 20, 30)
+	tb.byteRange("body", 30, 30)
+	tb.inline("body", []byte("eof"))
+	tb.byteRange("body", 40, 50)
+
+	got := tb.urls("https://example.org/file", map[string]string{"Authorization": "Bearer token"})
+	auth := func(r string) map[string]string {
+		return map[string]string{"Range": r, "Authorization": "Bearer token"}
+	}
+	want := []HtsgetURL{
+		{URL: "https://example.org/file", Headers: auth("bytes=0-9"), Class: "header"},
+		{URL: "https://example.org/file", Headers: auth("bytes=10-29"), Class: "body"},
+		{URL: "data:;base64," + base64.StdEncoding.EncodeToString([]byte("eof")), Class: "body"},
+		{URL: "https://example.org/file", Headers: auth("bytes=40-49"), Class: "body"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("urls = %+v, want %+v", got, want)
+	}
+}
+
+func TestFindReference(t *testing.T) {
+	names := []string{"chr1", "2", "chrM"}
+	for _, test := range []struct {
+		name string
+		want int
+	}{
+		{"chr1", 0},
+		{"1", 0},
+		{"chr2", 1},
+		{"2", 1},
+		{"chrM", 2},
+		{"3", -1},
+	} {
+		if got, ok := findReference(names, test.name); got != test.want || ok != (test.want >= 0) {
+			t.Errorf("findReference(%q) = %d, %v; want %d", test.name, got, ok, test.want)
+		}
+	}
+}
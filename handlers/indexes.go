@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+	"genomic-api/config"
+	"genomic-api/htsindex"
+	"genomic-api/ingest"
+	"genomic-api/middleware"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxIndexSize bounds an attached index, which is read into memory
+const maxIndexSize = 256 << 20
+
+// errIndexExists means a file already has an index, so none is generated
+var errIndexExists = errors.New("file already has an index")
+
+// errFileUnreadable means a file couldn't be read from storage to check an
+// index against it
+var errFileUnreadable = errors.New("can't read the file to check the index")
+
+// indexFormats are the index formats each format of file can have
+var indexFormats = map[string][]string{
+	"BAM":  {models.IndexBAI, models.IndexCSI},
+	"CRAM": {models.IndexCRAI},
+	"VCF":  {models.IndexTBI, models.IndexCSI},
+}
+
+// Signed index downloads are told apart from downloads of the files they
+// index by their kind
+var indexDownloads = map[string]string{
+	audit.ResourceSequenceFile: audit.ResourceSequenceFile + "_index",
+	audit.ResourceVariantFile:  audit.ResourceVariantFile + "_index",
+}
+
+// indexColumn is the index_files column referring to files of a kind
+func indexColumn(kind string) string {
+	if kind == audit.ResourceVariantFile {
+		return "variant_file_id"
+	}
+	return "sequence_file_id"
+}
+
+// FileIndex is a file's index and the latest job that generated one
+type FileIndex struct {
+	Index *models.IndexFile `json:"index"`         // nil while the file has none
+	Job   *models.IngestJob `json:"job,omitempty"` // the latest index generation job, with any problems found
+}
+
+// indexedFile is a sequence or variant file as far as its index goes
+type indexedFile struct {
+	kind     string // audit.ResourceSequenceFile or audit.ResourceVariantFile
+	id       int
+	record   interface{} // the loaded models.SequenceFile or models.VariantFile
+	key      string      // storage key of the file
+	name     string      // download name of the file
+	format   string      // BAM, CRAM or VCF; empty for files without indexes
+	column   string      // index_files column referring to the file
+	jobKind  string      // ingest job kind generating its index
+	notFound string      // error when the file doesn't exist
+}
+
+// loadIndexedFile loads the sequence or variant file with the given ID,
+// locking it when tx is in a transaction and lock is set
+func loadIndexedFile(tx *gorm.DB, kind string, id int, lock bool) (indexedFile, error) {
+	if lock {
+		tx = tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if kind == audit.ResourceVariantFile {
+		var file models.VariantFile
+		if err := tx.First(&file, id).Error; err != nil {
+			return indexedFile{notFound: "Variant file not found"}, err
+		}
+		indexed := indexedFile{
+			kind: kind, id: id, record: file, key: file.FilePath,
+			name:   downloadName(file.FileName, file.FilePath, "variants", file.ID, file.FileType),
+			column: indexColumn(kind), jobKind: models.IngestVariantIndex,
+		}
+		if ingest.IsVCF(file) {
+			indexed.format = "VCF"
+		}
+		return indexed, nil
+	}
+	var file models.SequenceFile
+	if err := tx.First(&file, id).Error; err != nil {
+		return indexedFile{notFound: "Sequence file not found"}, err
+	}
+	indexed := indexedFile{
+		kind: kind, id: id, record: file, key: file.FilePath,
+		name:   downloadName(file.FileName, file.FilePath, "sequence", file.ID, file.FileType),
+		column: indexColumn(kind), jobKind: models.IngestSequenceIndex,
+	}
+	if format := ingest.QCFormat(file); format != "FASTQ" {
+		indexed.format = format
+	}
+	return indexed, nil
+}
+
+// model is an empty model of the file's table
+func (f indexedFile) model() interface{} {
+	if f.kind == audit.ResourceVariantFile {
+		return &models.VariantFile{}
+	}
+	return &models.SequenceFile{}
+}
+
+// reload is the file's record as it is now, for the audit trail
+func (f indexedFile) reload(tx *gorm.DB) (interface{}, error) {
+	record := f.model()
+	err := tx.First(record, f.id).Error
+	return record, err
+}
+
+// findIndex returns the index of the file in column with the given ID, or
+// nil if it has none
+func findIndex(tx *gorm.DB, column string, id int) (*models.IndexFile, error) {
+	var indexes []models.IndexFile
+	if err := tx.Where(column+" = ?", id).Limit(1).Find(&indexes).Error; err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return nil, nil
+	}
+	return &indexes[0], nil
+}
+
+// detectIndex works out the format of an index from its content
+func detectIndex(data []byte) (string, error) {
+	if index, err := htsindex.Read(bytes.NewReader(data)); err == nil {
+		return index.Format, nil
+	}
+	if entries, err := htsindex.ReadCRAI(bytes.NewReader(data)); err == nil && len(entries) > 0 {
+		return models.IndexCRAI, nil
+	}
+	return "", errors.New("not a BAI, CSI, TBI or CRAI index")
+}
+
+// checkIndexFits makes sure an index can belong to the stored file: BGZF
+// indexes need a BGZF file, no index can point past the end of the file,
+// and a BAI needs the BAM's number of references. Errors reading the file
+// from storage wrap errFileUnreadable.
+func checkIndexFits(c *gin.Context, file indexedFile, format string, data []byte) error {
+	ctx := c.Request.Context()
+	info, err := storage.Default.Stat(ctx, file.key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errFileUnreadable, err)
+	}
+	if format == models.IndexCRAI {
+		entries, err := htsindex.ReadCRAI(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.Container >= info.Size {
+				return fmt.Errorf("the index points to offset %d, past the end of the %d-byte file", entry.Container, info.Size)
+			}
+		}
+		return nil
+	}
+
+	index, err := htsindex.Read(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if end := index.End().Block(); end > info.Size {
+		return fmt.Errorf("the index points to offset %d, past the end of the %d-byte file", end, info.Size)
+	}
+	body, err := storage.Default.GetRange(ctx, file.key, 0, info.Size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errFileUnreadable, err)
+	}
+	defer body.Close()
+	head := make([]byte, 18)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", errFileUnreadable, err)
+	}
+	if !bgzf.IsBGZF(head[:n]) {
+		return fmt.Errorf("the %s isn't bgzip-compressed, so it can't have a %s index", file.format, format)
+	}
+	if format == models.IndexBAI {
+		header, err := bam.ReadHeader(bgzf.NewReader(io.MultiReader(bytes.NewReader(head[:n]), body)))
+		if err == nil && len(header.Refs) != index.Refs() {
+			return fmt.Errorf("the index has %d references but the BAM has %d", index.Refs(), len(header.Refs))
+		}
+	}
+	return nil
+}
+
+// getIndex responds with the index of the file in the path and its latest
+// generation job
+func getIndex(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	file, err := loadIndexedFile(config.DB, kind, id, false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+		return
+	}
+	var result FileIndex
+	if result.Index, err = findIndex(config.DB, file.column, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if job, err := ingest.Latest(config.DB, file.jobKind, id); err == nil {
+		result.Job = &job
+	}
+	if result.Index == nil && result.Job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File has no index"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// attachIndex stores the index in the request and attaches it to the file
+// in the path, replacing any it had
+func attachIndex(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	file, err := loadIndexedFile(config.DB, kind, id, false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+		return
+	}
+	if file.format == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only BAM, CRAM and VCF files have indexes"})
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIndexSize+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required: " + err.Error()})
+		return
+	}
+	if header.Size > maxIndexSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Indexes can be at most %d bytes", maxIndexSize)})
+		return
+	}
+	part, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	data, err := io.ReadAll(part)
+	part.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is empty"})
+		return
+	}
+
+	sha := sha256.Sum256(data)
+	md5Sum := md5.Sum(data)
+	index := models.IndexFile{
+		FileName: path.Base(header.Filename), Checksum: hex.EncodeToString(sha[:]), MD5: hex.EncodeToString(md5Sum[:]),
+		SizeBytes: int64(len(data)), UploadedAt: time.Now(),
+	}
+	if expected := strings.ToLower(c.PostForm("md5")); expected != "" && expected != index.MD5 {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Checksum mismatch", "md5": index.MD5, "sha256": index.Checksum})
+		return
+	}
+	if expected := strings.ToLower(c.PostForm("sha256")); expected != "" && expected != index.Checksum {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Checksum mismatch", "md5": index.MD5, "sha256": index.Checksum})
+		return
+	}
+	if index.Format, err = detectIndex(data); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	allowed := indexFormats[file.format]
+	if !containsString(allowed, index.Format) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": fmt.Sprintf("A %s can't index a %s; expected %s", index.Format, file.format, strings.Join(allowed, " or "))})
+		return
+	}
+	if err := checkIndexFits(c, file, index.Format, data); errors.Is(err, errFileUnreadable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if userID, _ := middleware.CurrentUserID(c); userID != 0 {
+		index.UploadedBy = &userID
+	}
+	if kind == audit.ResourceVariantFile {
+		index.VariantFileID = &id
+	} else {
+		index.SequenceFileID = &id
+	}
+
+	index.FilePath = storage.ContentKey(index.Checksum)
+	stage := func() error {
+		info, err := storage.Default.Stat(c.Request.Context(), index.FilePath)
+		if err == nil && info.Size == index.SizeBytes {
+			return nil
+		}
+		return storage.Default.Put(c.Request.Context(), index.FilePath, bytes.NewReader(data), index.SizeBytes)
+	}
+	if err := stage(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("store index: %v", err)})
+		return
+	}
+	var replaced *models.IndexFile
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, index.FilePath); err != nil {
+			return err
+		}
+		// A concurrent delete may have removed the object since it was stored
+		if err := stage(); err != nil {
+			return err
+		}
+		locked, err := loadIndexedFile(tx, kind, id, true)
+		if err != nil {
+			return err
+		}
+		if replaced, err = findIndex(tx, file.column, id); err != nil {
+			return err
+		}
+		if replaced != nil {
+			if err := tx.Delete(replaced).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&index).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(file.model()).Where("id = ?", id).Update("index_path", index.FilePath).Error; err != nil {
+			return err
+		}
+		after, err := file.reload(tx)
+		if err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(c, audit.ActionUpdate, kind, id, locked.record, after, map[string]interface{}{"index": index}))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if replaced != nil && replaced.FilePath != index.FilePath {
+		releasePayload(c.Request.Context(), replaced.FilePath)
+	}
+	c.JSON(http.StatusCreated, index)
+}
+
+// deleteIndex detaches the index of the file in the path
+func deleteIndex(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var file indexedFile
+	var index *models.IndexFile
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if file, err = loadIndexedFile(tx, kind, id, true); err != nil {
+			return err
+		}
+		if index, err = findIndex(tx, file.column, id); err != nil || index == nil {
+			return err
+		}
+		if err := tx.Delete(index).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(file.model()).Where("id = ?", id).Update("index_path", "").Error; err != nil {
+			return err
+		}
+		after, err := file.reload(tx)
+		if err != nil {
+			return err
+		}
+		return audit.Record(tx, auditEntry(c, audit.ActionUpdate, kind, id, file.record, after, map[string]interface{}{"deleted_index": index}))
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if index == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File has no index"})
+		return
+	}
+	releasePayload(c.Request.Context(), index.FilePath)
+	c.JSON(http.StatusOK, gin.H{"message": "Index deleted"})
+}
+
+// generateIndex queues building an index for the file in the path
+func generateIndex(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var file indexedFile
+	var job models.IngestJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the file so concurrent requests can't both queue a job
+		var err error
+		if file, err = loadIndexedFile(tx, kind, id, true); err != nil || !canGenerateIndex(file.format) {
+			return err
+		}
+		if index, err := findIndex(tx, file.column, id); err != nil {
+			return err
+		} else if index != nil {
+			return errIndexExists
+		}
+		if job, err = ingest.Active(tx, file.jobKind, id); err == nil {
+			return errIngestActive
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		job, err = ingest.Enqueue(tx, file.jobKind, id)
+		return err
+	})
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+	case errors.Is(err, errIndexExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "File already has an index; delete it to generate a new one"})
+	case errors.Is(err, errIngestActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "An index is already being generated", "job_id": job.ID})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	case !canGenerateIndex(file.format):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Indexes are only generated for BAM and VCF files"})
+	default:
+		ingest.Notify()
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// canGenerateIndex reports whether indexes of files of a format can be
+// built, rather than only attached
+func canGenerateIndex(format string) bool {
+	return format == "BAM" || format == "VCF"
+}
+
+// serveIndex streams the index of the file with the given ID
+func serveIndex(c *gin.Context, kind string, id int) {
+	file, err := loadIndexedFile(config.DB, kind, id, false)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": file.notFound})
+		return
+	}
+	index, err := findIndex(config.DB, file.column, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if index == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File has no index"})
+		return
+	}
+	name := index.FileName
+	if name == "" {
+		name = file.name + "." + strings.ToLower(index.Format)
+	}
+	serveContent(c, index.FilePath, name, index.Checksum, index.UploadedAt)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetSequenceIndex godoc
+// @Summary      Get sequence file index
+// @Description  Get the index attached to a sequence file (a .bai or .csi of a BAM, a .crai of a CRAM) with its checksums, and the latest job that generated one
+// @Tags         sequence
+// @Produce      json
+// @Param        id  path  int  true  "Sequence file ID"
+// @Success      200  {object}  FileIndex
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/index [get]
+func GetSequenceIndex(c *gin.Context) {
+	getIndex(c, audit.ResourceSequenceFile)
+}
+
+// AttachSequenceIndex godoc
+// @Summary      Attach sequence file index
+// @Description  Upload the index of a sequence file as a multipart file part, replacing any it has: a .bai or .csi for a BAM, a .crai for a CRAM. The format is recognised from the content and must fit the file: BAI, TBI and CSI indexes need a bgzip-compressed file with as many references as the index, and no index may point past the end of the file. The server computes the MD5 and SHA-256; optional md5/sha256 fields are checked against them.
+// @Tags         sequence
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id      path      int     true   "Sequence file ID"
+// @Param        file    formData  file    true   "Index file"
+// @Param        md5     formData  string  false  "Expected MD5, hex"
+// @Param        sha256  formData  string  false  "Expected SHA-256, hex"
+// @Success      201     {object}  models.IndexFile
+// @Failure      400     {object}  map[string]string
+// @Failure      404     {object}  map[string]string
+// @Failure      413     {object}  map[string]string
+// @Failure      422     {object}  map[string]string
+// @Failure      503     {object}  map[string]string
+// @Router       /api/sequence/{id}/index [put]
+func AttachSequenceIndex(c *gin.Context) {
+	attachIndex(c, audit.ResourceSequenceFile)
+}
+
+// DeleteSequenceIndex godoc
+// @Summary      Delete sequence file index
+// @Description  Detach and delete a sequence file's index
+// @Tags         sequence
+// @Produce      json
+// @Param        id  path  int  true  "Sequence file ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/index [delete]
+func DeleteSequenceIndex(c *gin.Context) {
+	deleteIndex(c, audit.ResourceSequenceFile)
+}
+
+// GenerateSequenceIndex godoc
+// @Summary      Generate sequence file index
+// @Description  Queue building a BAI index of a coordinate-sorted BAM that has no index. Uploaded BAMs are queued automatically. CRAM indexes can't be generated; attach a .crai.
+// @Tags         sequence
+// @Produce      json
+// @Param        id  path  int  true  "Sequence file ID"
+// @Success      202  {object}  models.IngestJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/sequence/{id}/index/generate [post]
+func GenerateSequenceIndex(c *gin.Context) {
+	generateIndex(c, audit.ResourceSequenceFile)
+}
+
+// GetSequenceIndexContent godoc
+// @Summary      Download sequence file index
+// @Description  Stream the bytes of a sequence file's index. Supports Range requests, ETag/If-None-Match and HEAD.
+// @Tags         sequence
+// @Produce      octet-stream
+// @Param        id     path    int     true   "Sequence file ID"
+// @Param        Range  header  string  false  "Byte range, e.g. bytes=0-65535"
+// @Success      200    {file}    binary
+// @Success      206    {file}    binary
+// @Success      304
+// @Failure      404    {object}  map[string]string
+// @Router       /api/sequence/{id}/index/content [get]
+func GetSequenceIndexContent(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	serveIndex(c, audit.ResourceSequenceFile, id)
+}
+
+// GetVariantIndex godoc
+// @Summary      Get variant file index
+// @Description  Get the tabix or CSI index attached to a variant file with its checksums, and the latest job that generated one
+// @Tags         variants
+// @Produce      json
+// @Param        id  path  int  true  "Variant file ID"
+// @Success      200  {object}  FileIndex
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/index [get]
+func GetVariantIndex(c *gin.Context) {
+	getIndex(c, audit.ResourceVariantFile)
+}
+
+// AttachVariantIndex godoc
+// @Summary      Attach variant file index
+// @Description  Upload the .tbi or .csi index of a bgzip-compressed VCF as a multipart file part, replacing any it has. The format is recognised from the content, and the index may not point past the end of the file. The server computes the MD5 and SHA-256; optional md5/sha256 fields are checked against them.
+// @Tags         variants
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        id      path      int     true   "Variant file ID"
+// @Param        file    formData  file    true   "Index file"
+// @Param        md5     formData  string  false  "Expected MD5, hex"
+// @Param        sha256  formData  string  false  "Expected SHA-256, hex"
+// @Success      201     {object}  models.IndexFile
+// @Failure      400     {object}  map[string]string
+// @Failure      404     {object}  map[string]string
+// @Failure      413     {object}  map[string]string
+// @Failure      422     {object}  map[string]string
+// @Failure      503     {object}  map[string]string
+// @Router       /api/variants/{id}/index [put]
+func AttachVariantIndex(c *gin.Context) {
+	attachIndex(c, audit.ResourceVariantFile)
+}
+
+// DeleteVariantIndex godoc
+// @Summary      Delete variant file index
+// @Description  Detach and delete a variant file's index
+// @Tags         variants
+// @Produce      json
+// @Param        id  path  int  true  "Variant file ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/index [delete]
+func DeleteVariantIndex(c *gin.Context) {
+	deleteIndex(c, audit.ResourceVariantFile)
+}
+
+// GenerateVariantIndex godoc
+// @Summary      Generate variant file index
+// @Description  Queue building a tabix index of a sorted, bgzip-compressed VCF that has no index. Uploaded bgzipped VCFs are queued automatically.
+// @Tags         variants
+// @Produce      json
+// @Param        id  path  int  true  "Variant file ID"
+// @Success      202  {object}  models.IngestJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/variants/{id}/index/generate [post]
+func GenerateVariantIndex(c *gin.Context) {
+	generateIndex(c, audit.ResourceVariantFile)
+}
+
+// GetVariantIndexContent godoc
+// @Summary      Download variant file index
+// @Description  Stream the bytes of a variant file's index. Supports Range requests, ETag/If-None-Match and HEAD.
+// @Tags         variants
+// @Produce      octet-stream
+// @Param        id     path    int     true   "Variant file ID"
+// @Param        Range  header  string  false  "Byte range, e.g. bytes=0-65535"
+// @Success      200    {file}    binary
+// @Success      206    {file}    binary
+// @Success      304
+// @Failure      404    {object}  map[string]string
+// @Router       /api/variants/{id}/index/content [get]
+func GetVariantIndexContent(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	serveIndex(c, audit.ResourceVariantFile, id)
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"genomic-api/audit"
+	"genomic-api/bgzf"
+	"genomic-api/htsindex"
+	"genomic-api/models"
+)
+
+// testBAI is a BAI of a file with refs references holding one record at the
+// start of the block after small.bam's 177-byte header block
+func testBAI(t *testing.T, refs int) []byte {
+	t.Helper()
+	b := htsindex.NewBuilder(refs)
+	if err := b.Add(0, 0, 10, true, bgzf.MakeOffset(177, 0), bgzf.MakeOffset(177, 40)); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := b.WriteBAI(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+func readTestFile(t *testing.T, name string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestCheckIndexFits(t *testing.T) {
+	useTestStorage(t)
+	vcf, content := putTestFile(t, "regions.vcf.gz")
+	tbi := readTestFile(t, "testdata/regions.vcf.gz.tbi")
+	truncated := putTestObject(t, content[:130])
+	plain := putTestObject(t, bytes.Repeat([]byte(regionsRecord("chr1", "100")), 20))
+	// The CRAI is only checked against the file's size, so the BAM stands in
+	// for a CRAM
+	bam := putTestObject(t, readTestFile(t, "../bam/testdata/small.bam"))
+	crai := readTestFile(t, "../htsindex/testdata/small.cram.crai")
+
+	for _, test := range []struct {
+		name   string
+		file   indexedFile
+		format string
+		data   []byte
+		want   string
+	}{
+		{"TBI of its VCF", indexedFile{key: vcf, format: "VCF"}, models.IndexTBI, tbi, ""},
+		{"BAI of its BAM", indexedFile{key: bam, format: "BAM"}, models.IndexBAI, testBAI(t, 2), ""},
+		{"BAI of a BAM with more references", indexedFile{key: bam, format: "BAM"}, models.IndexBAI, testBAI(t, 1),
+			"the index has 1 references but the BAM has 2"},
+		{"TBI of a truncated VCF", indexedFile{key: truncated, format: "VCF"}, models.IndexTBI, tbi,
+			"the index points to offset 237, past the end of the 130-byte file"},
+		{"TBI of an uncompressed VCF", indexedFile{key: plain, format: "VCF"}, models.IndexTBI, tbi,
+			"the VCF isn't bgzip-compressed, so it can't have a TBI index"},
+		{"CRAI of its CRAM", indexedFile{key: bam, format: "CRAM"}, models.IndexCRAI, crai, ""},
+		{"CRAI of a truncated CRAM", indexedFile{key: truncated, format: "CRAM"}, models.IndexCRAI, crai,
+			"the index points to offset 241, past the end of the 130-byte file"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c, _ := testContext("/")
+			err := checkIndexFits(c, test.file, test.format, test.data)
+			if (err == nil && test.want != "") || (err != nil && err.Error() != test.want) {
+				t.Errorf("checkIndexFits = %v, want %q", err, test.want)
+			}
+		})
+	}
+
+	// Without the file there's nothing to check the index against
+	c, _ := testContext("/")
+	err := checkIndexFits(c, indexedFile{key: "sha256/00/missing", format: "VCF"}, models.IndexTBI, tbi)
+	if !errors.Is(err, errFileUnreadable) || err.Error() != "can't read the file to check the index: object not found" {
+		t.Errorf("checkIndexFits of a missing file = %v, want it to wrap %v", err, errFileUnreadable)
+	}
+}
+
+func indexRouter() http.Handler {
+	r := testRouter()
+	r.GET("/api/sequence/:id/index", GetSequenceIndex)
+	r.PUT("/api/sequence/:id/index", AttachSequenceIndex)
+	r.POST("/api/sequence/:id/index/generate", GenerateSequenceIndex)
+	r.GET("/api/variants/:id/index", GetVariantIndex)
+	r.PUT("/api/variants/:id/index", AttachVariantIndex)
+	r.DELETE("/api/variants/:id/index", DeleteVariantIndex)
+	r.POST("/api/variants/:id/index/generate", GenerateVariantIndex)
+	r.GET("/api/variants/:id/index/content", GetVariantIndexContent)
+	return r
+}
+
+// attachRequest uploads data as the index of the file at path, with the
+// given extra form fields
+func attachRequest(t *testing.T, path string, data []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	part, err := form.CreateFormFile("file", "regions.vcf.gz.tbi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPut, path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return req
+}
+
+func errorMessage(w *httptest.ResponseRecorder) string {
+	var body struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return body.Error
+}
+
+func TestAttachIndex(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	key, _ := putTestFile(t, "regions.vcf.gz")
+	tbi := readTestFile(t, "testdata/regions.vcf.gz.tbi")
+	variant := models.VariantFile{SampleID: sample.ID, GenomeID: sample.GenomeID, FilePath: key, FileName: "regions.vcf.gz", FileType: "VCF"}
+	// A file whose payload has gone missing from storage
+	lost := models.VariantFile{SampleID: sample.ID, GenomeID: sample.GenomeID, FilePath: "sha256/00/lost", FileName: "lost.vcf.gz", FileType: "VCF"}
+	fastq := models.SequenceFile{SampleID: sample.ID, FilePath: key, FileName: "reads.fastq", FileType: "FASTQ"}
+	for _, record := range []interface{}{&variant, &lost, &fastq} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := indexRouter()
+	path := "/api/variants/" + strconv.Itoa(variant.ID) + "/index"
+
+	for _, test := range []struct {
+		name   string
+		path   string
+		data   []byte
+		fields map[string]string
+		status int
+		want   string
+	}{
+		{"empty", path, nil, nil, http.StatusBadRequest, "file is empty"},
+		{"not an index", path, []byte("not an index"), nil, http.StatusUnprocessableEntity, "not a BAI, CSI, TBI or CRAI index"},
+		{"wrong format", path, testBAI(t, 2), nil, http.StatusUnprocessableEntity, "A BAI can't index a VCF; expected TBI or CSI"},
+		{"MD5 mismatch", path, tbi, map[string]string{"md5": strings.Repeat("0", 32)}, http.StatusUnprocessableEntity, "Checksum mismatch"},
+		{"SHA-256 mismatch", path, tbi, map[string]string{"sha256": strings.Repeat("0", 64)}, http.StatusUnprocessableEntity, "Checksum mismatch"},
+		{"missing file", "/api/variants/999999/index", tbi, nil, http.StatusNotFound, "Variant file not found"},
+		{"file without indexes", "/api/sequence/" + strconv.Itoa(fastq.ID) + "/index", tbi, nil, http.StatusBadRequest, "Only BAM, CRAM and VCF files have indexes"},
+		{"file missing from storage", "/api/variants/" + strconv.Itoa(lost.ID) + "/index", tbi, nil, http.StatusServiceUnavailable,
+			"can't read the file to check the index: object not found"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			w := serve(r, attachRequest(t, test.path, test.data, test.fields))
+			if w.Code != test.status || errorMessage(w) != test.want {
+				t.Errorf("%d %s, want %d %q", w.Code, w.Body, test.status, test.want)
+			}
+		})
+	}
+
+	w := serve(r, attachRequest(t, path, tbi, map[string]string{"md5": "", "sha256": ""}))
+	var index models.IndexFile
+	json.Unmarshal(w.Body.Bytes(), &index)
+	if w.Code != http.StatusCreated || index.Format != models.IndexTBI || index.SizeBytes != int64(len(tbi)) ||
+		index.VariantFileID == nil || *index.VariantFileID != variant.ID || index.UploadedBy == nil || *index.UploadedBy != testAdminID {
+		t.Fatalf("attach: %d %s", w.Code, w.Body)
+	}
+	db.First(&variant, variant.ID)
+	if variant.IndexPath != index.FilePath {
+		t.Errorf("index_path %q, want %q", variant.IndexPath, index.FilePath)
+	}
+	var updates int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_type = ? AND resource_id = ?", audit.ActionUpdate, audit.ResourceVariantFile, variant.ID).Count(&updates)
+	if updates != 1 {
+		t.Errorf("%d update audit entries, want 1", updates)
+	}
+
+	// Attaching again replaces the index rather than adding a second
+	w = serve(r, attachRequest(t, path, tbi, map[string]string{"md5": index.MD5}))
+	var count int64
+	db.Model(&models.IndexFile{}).Where("variant_file_id = ?", variant.ID).Count(&count)
+	if w.Code != http.StatusCreated || count != 1 {
+		t.Errorf("reattach: %d %s, %d indexes", w.Code, w.Body, count)
+	}
+	w = serve(r, httptest.NewRequest(http.MethodGet, path, nil))
+	var result FileIndex
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Index == nil || result.Index.Checksum != index.Checksum || result.Job != nil {
+		t.Errorf("get index: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestServeAndDeleteIndex(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	key, _ := putTestFile(t, "regions.vcf.gz")
+	tbi := readTestFile(t, "testdata/regions.vcf.gz.tbi")
+	variant := models.VariantFile{SampleID: sample.ID, GenomeID: sample.GenomeID, FilePath: key, FileName: "regions.vcf.gz", FileType: "VCF"}
+	if err := db.Create(&variant).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := indexRouter()
+	path := "/api/variants/" + strconv.Itoa(variant.ID) + "/index"
+	if w := serve(r, attachRequest(t, path, tbi, nil)); w.Code != http.StatusCreated {
+		t.Fatalf("attach: %d %s", w.Code, w.Body)
+	}
+
+	w := serve(r, httptest.NewRequest(http.MethodGet, path+"/content", nil))
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), tbi) || !strings.Contains(w.Header().Get("Content-Disposition"), "regions.vcf.gz.tbi") {
+		t.Fatalf("serve: %d %v", w.Code, w.Header())
+	}
+	req := httptest.NewRequest(http.MethodGet, path+"/content", nil)
+	req.Header.Set("Range", "bytes=0-3")
+	if w := serve(r, req); w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), tbi[:4]) {
+		t.Errorf("serve a range: %d %q", w.Code, w.Body)
+	}
+
+	w = serve(r, httptest.NewRequest(http.MethodDelete, path, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	db.First(&variant, variant.ID)
+	if variant.IndexPath != "" {
+		t.Errorf("index_path %q after delete", variant.IndexPath)
+	}
+	for _, test := range []struct{ method, path, want string }{
+		{http.MethodDelete, path, "File has no index"},
+		{http.MethodGet, path, "File has no index"},
+		{http.MethodGet, path + "/content", "File has no index"},
+		{http.MethodDelete, "/api/variants/999999/index", "Variant file not found"},
+		{http.MethodGet, "/api/variants/999999/index/content", "Variant file not found"},
+	} {
+		if w := serve(r, httptest.NewRequest(test.method, test.path, nil)); w.Code != http.StatusNotFound || errorMessage(w) != test.want {
+			t.Errorf("%s %s: %d %s, want 404 %q", test.method, test.path, w.Code, w.Body, test.want)
+		}
+	}
+}
+
+func TestGenerateIndex(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	key, _ := putTestFile(t, "regions.vcf.gz")
+	tbi := readTestFile(t, "testdata/regions.vcf.gz.tbi")
+	variant := models.VariantFile{SampleID: sample.ID, GenomeID: sample.GenomeID, FilePath: key, FileName: "regions.vcf.gz", FileType: "VCF"}
+	indexed := variant
+	cram := models.SequenceFile{SampleID: sample.ID, FilePath: key, FileName: "reads.cram", FileType: "CRAM"}
+	for _, record := range []interface{}{&variant, &indexed, &cram} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := indexRouter()
+	if w := serve(r, attachRequest(t, "/api/variants/"+strconv.Itoa(indexed.ID)+"/index", tbi, nil)); w.Code != http.StatusCreated {
+		t.Fatalf("attach: %d %s", w.Code, w.Body)
+	}
+	generate := func(path string) *httptest.ResponseRecorder {
+		return serve(r, httptest.NewRequest(http.MethodPost, path+"/index/generate", nil))
+	}
+	path := "/api/variants/" + strconv.Itoa(variant.ID)
+
+	w := generate(path)
+	var job models.IngestJob
+	json.Unmarshal(w.Body.Bytes(), &job)
+	if w.Code != http.StatusAccepted || job.Kind != models.IngestVariantIndex || job.Status != models.IngestQueued ||
+		job.VariantFileID == nil || *job.VariantFileID != variant.ID {
+		t.Fatalf("generate: %d %s", w.Code, w.Body)
+	}
+	// The queued job is reported while the file has no index yet
+	w = serve(r, httptest.NewRequest(http.MethodGet, path+"/index", nil))
+	var result FileIndex
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || result.Index != nil || result.Job == nil || result.Job.ID != job.ID {
+		t.Errorf("get index while generating: %d %s", w.Code, w.Body)
+	}
+
+	w = generate(path)
+	var conflict struct {
+		Error string `json:"error"`
+		JobID int    `json:"job_id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &conflict)
+	if w.Code != http.StatusConflict || conflict.Error != "An index is already being generated" || conflict.JobID != job.ID {
+		t.Errorf("generate while queued: %d %s", w.Code, w.Body)
+	}
+
+	for _, test := range []struct {
+		path   string
+		status int
+		want   string
+	}{
+		{"/api/variants/" + strconv.Itoa(indexed.ID), http.StatusConflict, "File already has an index; delete it to generate a new one"},
+		{"/api/sequence/" + strconv.Itoa(cram.ID), http.StatusBadRequest, "Indexes are only generated for BAM and VCF files"},
+		{"/api/sequence/999999", http.StatusNotFound, "Sequence file not found"},
+	} {
+		if w := generate(test.path); w.Code != test.status || errorMessage(w) != test.want {
+			t.Errorf("generate %s: %d %s, want %d %q", test.path, w.Code, w.Body, test.status, test.want)
+		}
+	}
+}
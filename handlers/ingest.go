@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"genomic-api/config"
+	"genomic-api/ingest"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errIngestActive means a record already has an ingest job queued or running
+var errIngestActive = errors.New("ingest already queued or running")
+
+// variantRecordList is what ListVariantRecords can filter and sort on
+var variantRecordList = listSpec{
+	filters: map[string]filter{
+		"chrom":    {expr: "chrom = ?"},
+		"start":    {expr: "end_pos >= ?", kind: intParam},
+		"end":      {expr: "pos <= ?", kind: intParam},
+		"filter":   {expr: "filter = ?"},
+		"vcf_id":   {expr: "vcf_id = ?"},
+		"genotype": {expr: "genotype = ?"},
+	},
+	sorts: map[string]string{
+		"line": "line", "chrom": "chrom", "pos": "pos", "qual": "qual",
+	},
+	defaultSort: "line",
+}
+
+// ListVariantRecords godoc
+// @Summary      List variant records
+// @Description  Get the records ingested from a variant file's VCF a page at a time, in file order by default. Records only appear once the whole file has been ingested successfully.
+// @Tags         variants
+// @Produce      json
+// @Param        id        path   int     true   "Variant file ID"
+// @Param        chrom     query  string  false  "Chromosome, as written in the VCF"
+// @Param        start     query  int     false  "Records ending at or after this position"
+// @Param        end       query  int     false  "Records starting at or before this position"
+// @Param        filter    query  string  false  "FILTER value, e.g. PASS"
+// @Param        vcf_id    query  string  false  "VCF ID, e.g. rs80357906"
+// @Param        genotype  query  string  false  "GT of the file's sample, e.g. 0/1"
+// @Param        sort      query  string  false  "Comma-separated keys: line, chrom, pos, qual; prefix - for descending"
+// @Param        page      query  int     false  "Page number, from 1"
+// @Param        per_page  query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.Variant
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/records [get]
+func ListVariantRecords(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := config.DB.First(&models.VariantFile{}, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant file not found"})
+		return
+	}
+	var records []models.Variant
+	listPage(c, ingestedVariants().Where("variant_file_id = ?", id), variantRecordList, &records)
+}
+
+// IngestVariantFile godoc
+// @Summary      Ingest variant file
+// @Description  Queue parsing of a variant file's VCF (plain or bgzip) into variant records, replacing any ingested before. Uploaded VCFs are queued automatically; use this for files registered with POST /api/variants or to retry a failed ingest.
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      int  true  "Variant file ID"
+// @Success      202  {object}  models.IngestJob
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/variants/{id}/ingest [post]
+func IngestVariantFile(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var job models.IngestJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the file so concurrent requests can't both queue a job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.VariantFile{}, id).Error
+		if err != nil {
+			return err
+		}
+		if job, err = ingest.Active(tx, models.IngestVariants, id); err == nil {
+			return errIngestActive
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		job, err = ingest.Enqueue(tx, models.IngestVariants, id)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant file not found"})
+		return
+	}
+	if errors.Is(err, errIngestActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Variant file is already being ingested", "job_id": job.ID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	ingest.Notify()
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetVariantIngest godoc
+// @Summary      Get variant file ingest status
+// @Description  Get the latest ingest job for a variant file: its status, how many records have been read, and the first errors found with their line numbers
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      int  true  "Variant file ID"
+// @Success      200  {object}  models.IngestJob
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/ingest [get]
+func GetVariantIngest(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	job, err := ingest.Latest(config.DB, models.IngestVariants, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant file has not been ingested"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
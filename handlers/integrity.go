@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"genomic-api/config"
+	"genomic-api/integrity"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetIntegritySummary godoc
+// @Summary      File verification summary
+// @Description  Count sequence and variant files by the result of their last checksum verification (ok, mismatch, missing, no_checksum, error or unverified)
+// @Tags         integrity
+// @Produce      json
+// @Success      200  {object}  integrity.Summary
+// @Router       /api/integrity [get]
+func GetIntegritySummary(c *gin.Context) {
+	summary, err := integrity.Summarize(config.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// RequestScrub godoc
+// @Summary      Verify all files
+// @Description  Queue a background pass that re-hashes every stored file, however recently it was checked. Progress shows in GET /api/integrity and the Prometheus metrics.
+// @Tags         integrity
+// @Produce      json
+// @Success      202  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/integrity/scrub [post]
+func RequestScrub(c *gin.Context) {
+	if !integrity.RequestScrub() {
+		c.JSON(http.StatusConflict, gin.H{"error": "A scrub is already queued"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "Scrub queued"})
+}
+
+func verifyFile(c *gin.Context, kind string) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	result, err := integrity.VerifyFile(c.Request.Context(), config.DB, kind, id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// VerifySequenceFile godoc
+// @Summary      Verify sequence file
+// @Description  Re-hash the stored bytes of a sequence file now and record the result
+// @Tags         integrity
+// @Produce      json
+// @Param        id   path      int  true  "Sequence file ID"
+// @Success      200  {object}  integrity.Result
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/verify [post]
+func VerifySequenceFile(c *gin.Context) {
+	verifyFile(c, integrity.KindSequenceFile)
+}
+
+// VerifyVariantFile godoc
+// @Summary      Verify variant file
+// @Description  Re-hash the stored bytes of a variant file now and record the result
+// @Tags         integrity
+// @Produce      json
+// @Param        id   path      int  true  "Variant file ID"
+// @Success      200  {object}  integrity.Result
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/{id}/verify [post]
+func VerifyVariantFile(c *gin.Context) {
+	verifyFile(c, integrity.KindVariantFile)
+}
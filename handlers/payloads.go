@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"genomic-api/config"
+	"genomic-api/storage"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// storePayload puts the file at path into storage under key, unless an
+// object of the same size is already there. Keys are content hashes, so an
+// existing object is an earlier upload of the same bytes.
+func storePayload(ctx context.Context, key, path string, size int64) error {
+	info, err := storage.Default.Stat(ctx, key)
+	if err == nil && info.Size == size {
+		return nil
+	}
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return storage.Default.Put(ctx, key, f, size)
+}
+
+// storedSize is the size of the object under key, or 0 if it can't be read
+func storedSize(ctx context.Context, key string) int64 {
+	info, err := storage.Default.Stat(ctx, key)
+	if err != nil {
+		return 0
+	}
+	return info.Size
+}
+
+// lockPayload serializes adding and dropping references to one stored
+// object until the surrounding transaction ends
+func lockPayload(tx *gorm.DB, key string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error
+}
+
+// releasePayload deletes a content-addressed object once no sequence file,
+// variant file or index refers to it any more. Failures are only logged; an orphaned
+// object costs space but nothing else.
+func releasePayload(ctx context.Context, key string) {
+	if !storage.IsContentKey(key) {
+		return
+	}
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, key); err != nil {
+			return err
+		}
+		var refs int64
+		err := tx.Raw(`SELECT (SELECT COUNT(*) FROM sequence_files WHERE file_path = ?)
+			+ (SELECT COUNT(*) FROM variant_files WHERE file_path = ?)
+			+ (SELECT COUNT(*) FROM index_files WHERE file_path = ?)`, key, key, key).Scan(&refs).Error
+		if err != nil || refs > 0 {
+			return err
+		}
+		return storage.Default.Delete(ctx, key)
+	})
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("failed to release stored payload")
+	}
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"genomic-api/config"
+	"genomic-api/ingest"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SequenceQC is a sequence file's QC metrics and the job that computed them
+type SequenceQC struct {
+	SequenceFileID int                      `json:"sequence_file_id"`
+	Status         string                   `json:"status"` // of the latest QC job
+	FASTQ          *models.FastqMetrics     `json:"fastq,omitempty"`
+	Alignment      *models.AlignmentMetrics `json:"alignment,omitempty"` // for BAM and CRAM
+	Job            models.IngestJob         `json:"job"`                 // the latest QC job, with any problems found
+}
+
+// GetSequenceQC godoc
+// @Summary      Get sequence file QC metrics
+// @Description  Get a sequence file's QC metrics. For a FASTQ: read count, total bases, length distribution, mean quality by position, GC content, N rate and an estimated duplicate rate. For a BAM or CRAM: its header's references, read groups and programs, and for BAMs samtools flagstat-style counts and the mapped, properly paired and duplicate rates. Metrics appear once the file's QC job has succeeded; the job shows progress or why it failed.
+// @Tags         sequence
+// @Produce      json
+// @Param        id   path      int  true  "Sequence file ID"
+// @Success      200  {object}  SequenceQC
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/{id}/qc [get]
+func GetSequenceQC(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	job, err := ingest.Latest(config.DB, models.IngestQC, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file has no QC metrics"})
+		return
+	}
+	qc := SequenceQC{SequenceFileID: id, Status: job.Status, Job: job}
+	if job.Status == models.IngestSucceeded {
+		var fastq []models.FastqMetrics
+		var alignment []models.AlignmentMetrics
+		err := config.DB.Where("sequence_file_id = ?", id).Limit(1).Find(&fastq).Error
+		if err == nil {
+			err = config.DB.Where("sequence_file_id = ?", id).Limit(1).Find(&alignment).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(fastq) > 0 {
+			qc.FASTQ = &fastq[0]
+		}
+		if len(alignment) > 0 {
+			qc.Alignment = &alignment[0]
+		}
+	}
+	c.JSON(http.StatusOK, qc)
+}
+
+// ComputeSequenceQC godoc
+// @Summary      Compute sequence file QC metrics
+// @Description  Queue reading a FASTQ (plain or gzip), BAM or CRAM sequence file through to compute its QC metrics, replacing any computed before. Uploaded files are queued automatically; use this for files registered with POST /api/sequence or to retry a failed run.
+// @Tags         sequence
+// @Produce      json
+// @Param        id   path      int  true  "Sequence file ID"
+// @Success      202  {object}  models.IngestJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/sequence/{id}/qc [post]
+func ComputeSequenceQC(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var file models.SequenceFile
+	var job models.IngestJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the file so concurrent requests can't both queue a job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&file, id).Error
+		if err != nil || ingest.QCFormat(file) == "" {
+			return err
+		}
+		if job, err = ingest.Active(tx, models.IngestQC, id); err == nil {
+			return errIngestActive
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		job, err = ingest.Enqueue(tx, models.IngestQC, id)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file not found"})
+		return
+	}
+	if errors.Is(err, errIngestActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sequence file QC is already queued or running", "job_id": job.ID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if ingest.QCFormat(file) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "QC metrics are only computed for FASTQ, BAM and CRAM files"})
+		return
+	}
+	ingest.Notify()
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+// paramKind is how a filter's query parameter is parsed
+type paramKind int
+
+const (
+	stringParam paramKind = iota
+	intParam
+	floatParam
+	timeParam
+)
+
+// filter maps a query parameter to a SQL condition with a single placeholder
+type filter struct {
+	expr string
+	kind paramKind
+}
+
+// listSpec declares what a list endpoint lets callers filter and sort on.
+// Only the parameters and sort keys listed here reach the SQL query.
+type listSpec struct {
+	filters     map[string]filter
+	sorts       map[string]string // sort key -> column
+	defaultSort string            // e.g. "-created_at"
+	// load, if set, fills in fields of the page's records that aren't
+	// columns of the table, such as a cohort's members
+	load func(db *gorm.DB, dest interface{}) error
+}
+
+// parseTime accepts RFC 3339 timestamps or plain YYYY-MM-DD dates
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// pageParams are the query parameters listPage reads besides filters
+var pageParams = map[string]bool{"page": true, "per_page": true, "sort": true}
+
+// checkParams rejects query parameters that are neither filters nor
+// pageParams, so a misspelt filter doesn't silently return everything
+func (s listSpec) checkParams(c *gin.Context) error {
+	params := make([]string, 0, len(c.Request.URL.Query()))
+	for param := range c.Request.URL.Query() {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	for _, param := range params {
+		if _, ok := s.filters[param]; !ok && !pageParams[param] {
+			return fmt.Errorf("cannot filter by %s", param)
+		}
+	}
+	return nil
+}
+
+// applyFilters adds a condition for every filter parameter present in the request
+func (s listSpec) applyFilters(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	for param, f := range s.filters {
+		value, ok := c.GetQuery(param)
+		if !ok || value == "" {
+			continue
+		}
+		var arg interface{}
+		switch f.kind {
+		case intParam:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: must be an integer", param)
+			}
+			arg = n
+		case floatParam:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: must be a number", param)
+			}
+			arg = f
+		case timeParam:
+			t, err := parseTime(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: use RFC 3339 or YYYY-MM-DD", param)
+			}
+			arg = t.UTC()
+		default:
+			arg = value
+		}
+		query = query.Where(f.expr, arg)
+	}
+	return query, nil
+}
+
+// applySort orders by the comma-separated ?sort= keys, each optionally
+// prefixed with "-" for descending. id is always the final tiebreaker so
+// pages are stable.
+func (s listSpec) applySort(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	order := c.DefaultQuery("sort", s.defaultSort)
+	hasID := false
+	for _, key := range strings.Split(order, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		direction := "ASC"
+		if strings.HasPrefix(key, "-") {
+			direction = "DESC"
+			key = key[1:]
+		}
+		column, ok := s.sorts[key]
+		if !ok {
+			return nil, fmt.Errorf("cannot sort by %s", key)
+		}
+		if column == "id" {
+			hasID = true
+		}
+		query = query.Order(column + " " + direction)
+	}
+	if !hasID {
+		query = query.Order("id ASC")
+	}
+	return query, nil
+}
+
+// listPage filters, sorts and paginates query into dest (a pointer to a
+// slice) and writes it as the response. The total number of matches is sent
+// in X-Total-Count and first/prev/next/last page URLs in the Link header.
+// Pages are selected with ?page= (from 1) and ?per_page= (at most
+// maxPerPage). Unknown parameters are rejected.
+func listPage(c *gin.Context, query *gorm.DB, spec listSpec, dest interface{}) {
+	if err := spec.checkParams(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	query, err := spec.applyFilters(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", strconv.Itoa(defaultPerPage)))
+	if perPage < 1 {
+		perPage = defaultPerPage
+	}
+	perPage = min(perPage, maxPerPage)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err = spec.applySort(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := query.Limit(perPage).Offset((page - 1) * perPage).Find(dest).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if spec.load != nil {
+		if err := spec.load(query.Session(&gorm.Session{NewDB: true}), dest); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	if link := linkHeader(c, page, perPage, total); link != "" {
+		c.Header("Link", link)
+	}
+	c.JSON(http.StatusOK, dest)
+}
+
+// linkHeader builds an RFC 8288 Link header pointing at neighbouring pages
+func linkHeader(c *gin.Context, page, perPage int, total int64) string {
+	lastPage := int(math.Ceil(float64(total) / float64(perPage)))
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	pageURL := func(p int) string {
+		u := *c.Request.URL
+		q := u.Query()
+		q.Set("page", strconv.Itoa(p))
+		q.Set("per_page", strconv.Itoa(perPage))
+		u.RawQuery = q.Encode()
+		return u.RequestURI()
+	}
+
+	var links []string
+	add := func(p int, rel string) {
+		links = append(links, fmt.Sprintf("<%s>; rel=%q", pageURL(p), rel))
+	}
+	add(1, "first")
+	if page > 1 {
+		add(min(page-1, lastPage), "prev")
+	}
+	if page < lastPage {
+		add(page+1, "next")
+	}
+	add(lastPage, "last")
+	return strings.Join(links, ", ")
+}
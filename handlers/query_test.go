@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// testList lists cohorts, with a filter of each kind
+var testList = listSpec{
+	filters: map[string]filter{
+		"name":          {expr: "name = ?"},
+		"created_by":    {expr: "created_by = ?", kind: intParam},
+		"min_id":        {expr: "id >= ?", kind: floatParam},
+		"created_after": {expr: "created_at >= ?", kind: timeParam},
+	},
+	sorts:       map[string]string{"id": "id", "name": "name", "created": "created_at"},
+	defaultSort: "-created",
+}
+
+// dryRunDB builds SQL without a database to run it on
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost"}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testContext is a request context for a list URL
+func testContext(target string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	return c, w
+}
+
+func TestApplyFilters(t *testing.T) {
+	db := dryRunDB(t)
+	for _, test := range []struct {
+		query string
+		where string
+		vars  []interface{}
+		err   string
+	}{
+		{"", "", []interface{}{}, ""},
+		{"name=", "", []interface{}{}, ""},
+		{"name=trio", "name = $1", []interface{}{"trio"}, ""},
+		{"created_by=7", "created_by = $1", []interface{}{7}, ""},
+		{"min_id=2.5", "id >= $1", []interface{}{2.5}, ""},
+		{"created_after=2025-01-02", "created_at >= $1", []interface{}{time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC)}, ""},
+		{"created_after=2025-01-02T03:04:05%2B02:00", "created_at >= $1", []interface{}{time.Date(2025, 1, 2, 1, 4, 5, 0, time.UTC)}, ""},
+		// Parameters that aren't filters are left alone
+		{"sort=name&page=2", "", []interface{}{}, ""},
+		{"created_by=me", "", nil, "invalid created_by: must be an integer"},
+		{"created_by=1.5", "", nil, "invalid created_by: must be an integer"},
+		{"min_id=lots", "", nil, "invalid min_id: must be a number"},
+		{"created_after=yesterday", "", nil, "invalid created_after: use RFC 3339 or YYYY-MM-DD"},
+		{"created_after=2025-13-01", "", nil, "invalid created_after: use RFC 3339 or YYYY-MM-DD"},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			c, _ := testContext("/api/cohorts?" + test.query)
+			query, err := testList.applyFilters(c, db.Model(&models.Cohort{}))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("applyFilters = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyFilters: %v", err)
+			}
+			stmt := query.Find(&[]models.Cohort{}).Statement
+			sql := stmt.SQL.String()
+			_, where, _ := strings.Cut(sql, " WHERE ")
+			if where != test.where || !reflect.DeepEqual(stmt.Vars, test.vars) {
+				t.Errorf("%s %v, want WHERE %s %v", sql, stmt.Vars, test.where, test.vars)
+			}
+		})
+	}
+}
+
+func TestApplySort(t *testing.T) {
+	db := dryRunDB(t)
+	for _, test := range []struct {
+		sort  string
+		order string
+		err   string
+	}{
+		{"", "created_at DESC,id ASC", ""},
+		{"name", "name ASC,id ASC", ""},
+		{"-name,created", "name DESC,created_at ASC,id ASC", ""},
+		{" name , ,", "name ASC,id ASC", ""},
+		{"-id", "id DESC", ""},
+		{"+name", "", "cannot sort by +name"},
+		// Keys are names from the spec, not columns
+		{"created_at", "", "cannot sort by created_at"},
+		{"name;DROP TABLE users", "", "cannot sort by name;DROP TABLE users"},
+	} {
+		t.Run(test.sort, func(t *testing.T) {
+			target := "/api/cohorts"
+			if test.sort != "" {
+				target += "?" + url.Values{"sort": {test.sort}}.Encode()
+			}
+			c, _ := testContext(target)
+			query, err := testList.applySort(c, db.Model(&models.Cohort{}))
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("applySort = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applySort: %v", err)
+			}
+			sql := query.Find(&[]models.Cohort{}).Statement.SQL.String()
+			if _, order, _ := strings.Cut(sql, " ORDER BY "); order != test.order {
+				t.Errorf("%s, want ORDER BY %s", sql, test.order)
+			}
+		})
+	}
+}
+
+func TestListPageBadRequests(t *testing.T) {
+	db := dryRunDB(t)
+	r := testRouter()
+	r.GET("/api/cohorts", func(c *gin.Context) {
+		listPage(c, db.Model(&models.Cohort{}), testList, &[]models.Cohort{})
+	})
+	for _, test := range []struct {
+		query string
+		err   string
+	}{
+		{"nmae=trio", "cannot filter by nmae"},
+		{"name=trio&limit=5", "cannot filter by limit"},
+		{"created_by=me", "invalid created_by: must be an integer"},
+		{"created_after=2025-02-30", "invalid created_after: use RFC 3339 or YYYY-MM-DD"},
+		{"sort=-size", "cannot sort by size"},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			w := serve(r, httptest.NewRequest(http.MethodGet, "/api/cohorts?"+test.query, nil))
+			var body map[string]string
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if w.Code != http.StatusBadRequest || body["error"] != test.err {
+				t.Errorf("%d %q, want 400 %q", w.Code, body["error"], test.err)
+			}
+		})
+	}
+}
+
+func TestListPageSize(t *testing.T) {
+	db := dryRunDB(t)
+	// Dry runs keep the first SQL built on a statement, so record the
+	// page's limit and offset instead
+	var limit clause.Limit
+	db.Callback().Query().Before("gorm:query").Register("test:limit", func(db *gorm.DB) {
+		if c, ok := db.Statement.Clauses["LIMIT"]; ok {
+			limit = c.Expression.(clause.Limit)
+		}
+	})
+	r := testRouter()
+	r.GET("/api/cohorts", func(c *gin.Context) {
+		listPage(c, db.Model(&models.Cohort{}), testList, &[]models.Cohort{})
+	})
+	for _, test := range []struct {
+		query   string
+		perPage int
+		offset  int
+	}{
+		{"", 50, 0},
+		{"per_page=10&page=3", 10, 20},
+		{"per_page=500", 500, 0},
+		{"per_page=501", 500, 0},
+		{"per_page=100000&page=2", 500, 500},
+		{"per_page=0", 50, 0},
+		{"per_page=-5", 50, 0},
+		{"per_page=many", 50, 0},
+		{"page=0", 50, 0},
+		{"page=-1", 50, 0},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			limit = clause.Limit{}
+			w := serve(r, httptest.NewRequest(http.MethodGet, "/api/cohorts?"+test.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%d %s", w.Code, w.Body)
+			}
+			if limit.Limit == nil || *limit.Limit != test.perPage || limit.Offset != test.offset {
+				t.Errorf("limit %v offset %d, want %d offset %d", limit.Limit, limit.Offset, test.perPage, test.offset)
+			}
+			if link := w.Header().Get("Link"); !strings.Contains(link, "per_page="+strconv.Itoa(test.perPage)) {
+				t.Errorf("Link %s, want per_page=%d", link, test.perPage)
+			}
+		})
+	}
+}
+
+func TestLinkHeader(t *testing.T) {
+	for _, test := range []struct {
+		page, perPage int
+		total         int64
+		want          string
+	}{
+		{1, 10, 0, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=1&per_page=10>; rel="last"`},
+		{1, 10, 10, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=1&per_page=10>; rel="last"`},
+		{1, 10, 11, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=2&per_page=10>; rel="next", </api/cohorts?page=2&per_page=10>; rel="last"`},
+		{2, 10, 30, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=1&per_page=10>; rel="prev", </api/cohorts?page=3&per_page=10>; rel="next", </api/cohorts?page=3&per_page=10>; rel="last"`},
+		{3, 10, 30, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=2&per_page=10>; rel="prev", </api/cohorts?page=3&per_page=10>; rel="last"`},
+		// Past the end, prev goes back to the last page rather than an empty one
+		{7, 10, 30, `</api/cohorts?page=1&per_page=10>; rel="first", </api/cohorts?page=3&per_page=10>; rel="prev", </api/cohorts?page=3&per_page=10>; rel="last"`},
+	} {
+		t.Run(strconv.Itoa(test.page)+"/"+strconv.FormatInt(test.total, 10), func(t *testing.T) {
+			c, _ := testContext("/api/cohorts?page=" + strconv.Itoa(test.page))
+			if got := linkHeader(c, test.page, test.perPage, test.total); got != test.want {
+				t.Errorf("linkHeader(%d, %d, %d) =\n%s\nwant\n%s", test.page, test.perPage, test.total, got, test.want)
+			}
+		})
+	}
+
+	// Filters and sorting carry over to every link
+	c, _ := testContext("/api/cohorts?name=trio&sort=-name&page=2")
+	want := `</api/cohorts?name=trio&page=1&per_page=1&sort=-name>; rel="first", </api/cohorts?name=trio&page=1&per_page=1&sort=-name>; rel="prev", </api/cohorts?name=trio&page=2&per_page=1&sort=-name>; rel="last"`
+	if got := linkHeader(c, 2, 1, 2); got != want {
+		t.Errorf("linkHeader with filters =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestListPage(t *testing.T) {
+	db := useTestDB(t)
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := db.Create(&models.Cohort{Name: name, CreatedBy: testAdminID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := testRouter()
+	r.GET("/api/cohorts", func(c *gin.Context) {
+		var cohorts []models.Cohort
+		listPage(c, db.Model(&models.Cohort{}), testList, &cohorts)
+	})
+
+	for _, test := range []struct {
+		query string
+		total string
+		names []string
+		rels  []string
+	}{
+		{"per_page=2&sort=name", "5", []string{"a", "b"}, []string{"first", "next", "last"}},
+		{"per_page=2&sort=name&page=2", "5", []string{"c", "d"}, []string{"first", "prev", "next", "last"}},
+		{"per_page=2&sort=name&page=3", "5", []string{"e"}, []string{"first", "prev", "last"}},
+		{"per_page=2&sort=name&page=4", "5", []string{}, []string{"first", "prev", "last"}},
+		{"per_page=2&sort=-name", "5", []string{"e", "d"}, []string{"first", "next", "last"}},
+		{"name=c", "1", []string{"c"}, []string{"first", "last"}},
+		{"name=z", "0", []string{}, []string{"first", "last"}},
+	} {
+		t.Run(test.query, func(t *testing.T) {
+			w := serve(r, httptest.NewRequest(http.MethodGet, "/api/cohorts?"+test.query, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("%d %s", w.Code, w.Body)
+			}
+			if total := w.Header().Get("X-Total-Count"); total != test.total {
+				t.Errorf("X-Total-Count %s, want %s", total, test.total)
+			}
+			var cohorts []models.Cohort
+			json.Unmarshal(w.Body.Bytes(), &cohorts)
+			names := []string{}
+			for _, cohort := range cohorts {
+				names = append(names, cohort.Name)
+			}
+			if !reflect.DeepEqual(names, test.names) {
+				t.Errorf("names %v, want %v", names, test.names)
+			}
+			var rels []string
+			for _, link := range strings.Split(w.Header().Get("Link"), ", ") {
+				_, rel, _ := strings.Cut(link, "; rel=")
+				rels = append(rels, strings.Trim(rel, `"`))
+			}
+			if !reflect.DeepEqual(rels, test.rels) {
+				t.Errorf("Link rels %v, want %v", rels, test.rels)
+			}
+		})
+	}
+}
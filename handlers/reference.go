@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"genomic-api/config"
+	"genomic-api/ingest"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// contigList is what ListContigs can filter and sort on
+var contigList = listSpec{
+	filters: map[string]filter{
+		"name":       {expr: "name = ?"},
+		"md5":        {expr: "md5 = ?"},
+		"min_length": {expr: "length >= ?", kind: intParam},
+	},
+	sorts: map[string]string{
+		"id": "id", "name": "name", "length": "length",
+	},
+	defaultSort: "id",
+}
+
+// indexedContigs is every contig of a genome whose FASTA was indexed in
+// full; contigs of a FASTA still being indexed are left out
+func indexedContigs() *gorm.DB {
+	return config.DB.Model(&models.Contig{}).Where("genome_id IN (?)",
+		config.DB.Model(&models.Genome{}).Select("id").Where("reference_status = ?", models.IngestSucceeded))
+}
+
+// ListContigs godoc
+// @Summary      List genome contigs
+// @Description  Get the sequences of a genome's reference FASTA a page at a time, in FASTA order by default, with their lengths and refget digests. Contigs only appear once the whole FASTA has been indexed successfully.
+// @Tags         genomes
+// @Produce      json
+// @Param        id          path   int     true   "Genome ID"
+// @Param        name        query  string  false  "Contig name, e.g. chr17"
+// @Param        md5         query  string  false  "MD5 of the sequence"
+// @Param        min_length  query  int     false  "Contigs at least this long"
+// @Param        sort        query  string  false  "Comma-separated keys: id, name, length; prefix - for descending"
+// @Param        page        query  int     false  "Page number, from 1"
+// @Param        per_page    query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.Contig
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/genomes/{id}/contigs [get]
+func ListContigs(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := config.DB.First(&models.Genome{}, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Genome not found"})
+		return
+	}
+	var contigs []models.Contig
+	listPage(c, indexedContigs().Where("genome_id = ?", id), contigList, &contigs)
+}
+
+// IndexGenomeReference godoc
+// @Summary      Index genome reference
+// @Description  Queue indexing of a genome's reference FASTA into contigs, replacing any indexed before, and checking it against the genome's .fai when it has one. Setting fasta_path queues this automatically; use it to retry a failed run.
+// @Tags         genomes
+// @Produce      json
+// @Param        id   path      int  true  "Genome ID"
+// @Success      202  {object}  models.IngestJob
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/genomes/{id}/reference [post]
+func IndexGenomeReference(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var genome models.Genome
+	var job models.IngestJob
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the genome so concurrent requests can't both queue a job
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&genome, id).Error
+		if err != nil || genome.FastaPath == "" {
+			return err
+		}
+		if job, err = ingest.Active(tx, models.IngestReference, id); err == nil {
+			return errIngestActive
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		job, err = ingest.Enqueue(tx, models.IngestReference, id)
+		return err
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Genome not found"})
+		return
+	}
+	if errors.Is(err, errIngestActive) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Genome reference is already being indexed", "job_id": job.ID})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if genome.FastaPath == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Genome has no fasta_path"})
+		return
+	}
+	ingest.Notify()
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetGenomeReference godoc
+// @Summary      Get genome reference indexing status
+// @Description  Get the latest indexing job for a genome's reference FASTA: its status, how many sequences have been read, and the first problems found, such as disagreements with the .fai
+// @Tags         genomes
+// @Produce      json
+// @Param        id   path      int  true  "Genome ID"
+// @Success      200  {object}  models.IngestJob
+// @Failure      404  {object}  map[string]string
+// @Router       /api/genomes/{id}/reference [get]
+func GetGenomeReference(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	job, err := ingest.Latest(config.DB, models.IngestReference, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Genome reference has not been indexed"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
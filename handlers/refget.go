@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"genomic-api/config"
+	"genomic-api/fasta"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// refgetContentType is the media type refget serves sequences as
+const refgetContentType = "text/vnd.ga4gh.refget.v2.0.0+plain; charset=us-ascii"
+
+// refgetRange is a single byte range, e.g. bytes=0-99 or bytes=100-
+var refgetRange = regexp.MustCompile(`^bytes=(\d+)-(\d*)$`)
+
+// RefgetAlias is another name a sequence is known by
+type RefgetAlias struct {
+	Alias           string `json:"alias"`            // contig name, e.g. chr17
+	NamingAuthority string `json:"naming_authority"` // the genome's reference version, or its name
+}
+
+// RefgetMetadata describes a sequence
+type RefgetMetadata struct {
+	MD5     string        `json:"md5"`
+	Ga4gh   string        `json:"ga4gh"` // SQ.<sha512t24u>
+	Length  int64         `json:"length"`
+	Aliases []RefgetAlias `json:"aliases"`
+}
+
+// RefgetMetadataResponse is the body of GET /sequence/{id}/metadata
+type RefgetMetadataResponse struct {
+	Metadata RefgetMetadata `json:"metadata"`
+}
+
+// findRefgetSequence looks up an indexed contig by refget ID: its MD5, with
+// or without an md5: prefix, or its GA4GH digest, SQ.<sha512t24u> with or
+// without a ga4gh: prefix
+func findRefgetSequence(id string) (models.Contig, error) {
+	query := indexedContigs()
+	id = strings.TrimPrefix(id, "ga4gh:")
+	if strings.HasPrefix(id, "SQ.") {
+		query = query.Where("sha512t24u = ?", strings.TrimPrefix(id, "SQ."))
+	} else {
+		query = query.Where("md5 = ?", strings.ToLower(strings.TrimPrefix(id, "md5:")))
+	}
+	var contig models.Contig
+	err := query.Order("id").Take(&contig).Error
+	return contig, err
+}
+
+// refgetError is a request for bases that can't be served, with the status
+// to answer it with
+type refgetError struct {
+	status  int
+	message string
+}
+
+func (e *refgetError) Error() string {
+	return e.message
+}
+
+// refgetInterval is the bases [start, end) of a sequence of length bases
+// asked for with start and end or a Range header; partial is true for a
+// Range, which is answered with 206. Errors are *refgetError.
+func refgetInterval(c *gin.Context, length int64) (start, end int64, partial bool, err error) {
+	end = length
+	startParam, hasStart := c.GetQuery("start")
+	endParam, hasEnd := c.GetQuery("end")
+	rangeHeader := c.GetHeader("Range")
+	switch {
+	case rangeHeader != "" && (hasStart || hasEnd):
+		return 0, 0, false, &refgetError{http.StatusBadRequest, "Use either start and end or a Range header, not both"}
+	case rangeHeader != "":
+		m := refgetRange.FindStringSubmatch(rangeHeader)
+		if m == nil {
+			return 0, 0, false, &refgetError{http.StatusBadRequest, "Range must be a single range, e.g. bytes=0-99"}
+		}
+		start, _ = strconv.ParseInt(m[1], 10, 64)
+		if m[2] != "" {
+			last, _ := strconv.ParseInt(m[2], 10, 64)
+			if last < start {
+				return 0, 0, false, &refgetError{http.StatusBadRequest, "Range ends before it starts"}
+			}
+			if last+1 < end {
+				end = last + 1
+			}
+		}
+		if start >= length {
+			c.Header("Content-Range", fmt.Sprintf("bytes */%d", length))
+			return 0, 0, false, &refgetError{http.StatusRequestedRangeNotSatisfiable, "Range starts after the end of the sequence"}
+		}
+		return start, end, true, nil
+	case hasStart || hasEnd:
+		if hasStart {
+			if start, err = strconv.ParseInt(startParam, 10, 64); err != nil || start < 0 {
+				return 0, 0, false, &refgetError{http.StatusBadRequest, "start must be a non-negative integer"}
+			}
+		}
+		if hasEnd {
+			if end, err = strconv.ParseInt(endParam, 10, 64); err != nil || end < 0 {
+				return 0, 0, false, &refgetError{http.StatusBadRequest, "end must be a non-negative integer"}
+			}
+		}
+		if start > length || end > length {
+			return 0, 0, false, &refgetError{http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("start and end must be at most %d", length)}
+		}
+		if start > end {
+			// Only circular sequences can wrap around from start to end
+			return 0, 0, false, &refgetError{http.StatusNotImplemented, "Circular sequences are not supported, so start must not be after end"}
+		}
+	}
+	return start, end, false, nil
+}
+
+// fastaRange reads the part of a FASTA holding bases [start, end) of
+// contig, line endings included; end must be after start
+func fastaRange(ctx context.Context, fastaPath string, contig models.Contig, start, end int64) (io.ReadCloser, error) {
+	layout := fasta.Sequence{Offset: contig.FastaOffset, LineBases: contig.LineBases, LineWidth: contig.LineWidth}
+	from, to := layout.Position(start), layout.Position(end-1)+1
+	return storage.Default.GetRange(ctx, fastaPath, from, to-from)
+}
+
+// copyBases copies FASTA lines to w as refget serves them, without line
+// endings and in uppercase
+func copyBases(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		bases := buf[:0]
+		for _, b := range buf[:n] {
+			if b == '\n' || b == '\r' {
+				continue
+			}
+			if 'a' <= b && b <= 'z' {
+				b -= 'a' - 'A'
+			}
+			bases = append(bases, b)
+		}
+		if _, werr := w.Write(bases); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// GetRefgetSequence godoc
+// @Summary      Get reference sequence
+// @Description  GA4GH refget 2.0: get the bases of a contig of an indexed reference genome by its MD5 or GA4GH (SQ.) digest, in uppercase. Ask for part of it with start and end (0-based, end exclusive) or a single-range Range header. Circular sequences aren't supported, so start after end is answered with 501.
+// @Tags         refget
+// @Produce      plain
+// @Param        id     path      string  true   "MD5 or GA4GH digest of the sequence"
+// @Param        start  query     int     false  "First base, 0-based"
+// @Param        end    query     int     false  "Base after the last, 0-based"
+// @Param        Range  header    string  false  "Byte range of the sequence, e.g. bytes=0-99"
+// @Success      200    {string}  string
+// @Success      206    {string}  string
+// @Failure      400    {object}  map[string]string
+// @Failure      404    {object}  map[string]string
+// @Failure      416    {object}  map[string]string
+// @Failure      501    {object}  map[string]string
+// @Router       /ga4gh/refget/sequence/{id} [get]
+func GetRefgetSequence(c *gin.Context) {
+	contig, err := findRefgetSequence(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence not found"})
+		return
+	}
+	start, end, partial, err := refgetInterval(c, contig.Length)
+	if err != nil {
+		c.JSON(err.(*refgetError).status, gin.H{"error": err.Error()})
+		return
+	}
+
+	var genome models.Genome
+	if err := config.DB.First(&genome, contig.GenomeID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	var body io.ReadCloser = io.NopCloser(strings.NewReader(""))
+	if end > start {
+		if body, err = fastaRange(c.Request.Context(), genome.FastaPath, contig, start, end); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	defer body.Close()
+
+	c.Header("Content-Type", refgetContentType)
+	c.Header("Content-Length", strconv.FormatInt(end-start, 10))
+	c.Header("Accept-Ranges", "bytes")
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		c.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, contig.Length))
+	}
+	c.Status(status)
+	// The FASTA holds the bases across lines and in either case
+	copyBases(c.Writer, body)
+}
+
+// GetRefgetMetadata godoc
+// @Summary      Get reference sequence metadata
+// @Description  GA4GH refget 2.0: get a sequence's digests and length, and the contig names it has in each indexed genome
+// @Tags         refget
+// @Produce      json
+// @Param        id   path      string  true  "MD5 or GA4GH digest of the sequence"
+// @Success      200  {object}  RefgetMetadataResponse
+// @Failure      404  {object}  map[string]string
+// @Router       /ga4gh/refget/sequence/{id}/metadata [get]
+func GetRefgetMetadata(c *gin.Context) {
+	contig, err := findRefgetSequence(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence not found"})
+		return
+	}
+	aliases := []RefgetAlias{}
+	err = indexedContigs().
+		Select("contigs.name AS alias, COALESCE(NULLIF(genomes.reference_version, ''), genomes.name) AS naming_authority").
+		Joins("JOIN genomes ON genomes.id = contigs.genome_id").
+		Where("contigs.md5 = ?", contig.MD5).
+		Order("contigs.id").
+		Scan(&aliases).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, RefgetMetadataResponse{Metadata: RefgetMetadata{
+		MD5:     contig.MD5,
+		Ga4gh:   "SQ." + contig.SHA512t24u,
+		Length:  contig.Length,
+		Aliases: aliases,
+	}})
+}
+
+// GetRefgetServiceInfo godoc
+// @Summary      Refget service info
+// @Description  GA4GH service-info for the refget API
+// @Tags         refget
+// @Produce      json
+// @Success      200  {object}  map[string]interface{}
+// @Router       /ga4gh/refget/sequence/service-info [get]
+func GetRefgetServiceInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"id":           "genomic-api.refget",
+		"name":         "Genomic API refget",
+		"type":         gin.H{"group": "org.ga4gh", "artifact": "refget", "version": "2.0.0"},
+		"organization": gin.H{"name": "Genomic API", "url": publicBaseURL(c)},
+		"version":      "1.0.0",
+		"refget": gin.H{
+			"circular_supported": false,
+			"algorithms":         []string{"md5", "ga4gh"},
+			"identifier_types":   []string{},
+			"subsequence_limit":  nil,
+		},
+	})
+}
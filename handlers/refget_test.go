@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"genomic-api/models"
+)
+
+func TestRefgetInterval(t *testing.T) {
+	for _, test := range []struct {
+		query      string
+		rangeValue string
+		start, end int64
+		partial    bool
+		status     int
+	}{
+		{"", "", 0, 100, false, http.StatusOK},
+		{"start=10&end=20", "", 10, 20, false, http.StatusOK},
+		{"start=10", "", 10, 100, false, http.StatusOK},
+		{"end=20", "", 0, 20, false, http.StatusOK},
+		{"start=100&end=100", "", 100, 100, false, http.StatusOK},
+		{"start=0&end=100", "", 0, 100, false, http.StatusOK},
+		{"", "bytes=10-19", 10, 20, true, http.StatusPartialContent},
+		{"", "bytes=90-", 90, 100, true, http.StatusPartialContent},
+		{"", "bytes=90-200", 90, 100, true, http.StatusPartialContent},
+		// Only one way of asking for part of the sequence at a time
+		{"start=10", "bytes=10-19", 0, 0, false, http.StatusBadRequest},
+		{"end=20", "bytes=10-19", 0, 0, false, http.StatusBadRequest},
+		{"start=", "bytes=10-19", 0, 0, false, http.StatusBadRequest},
+		{"", "bytes=10-19,30-39", 0, 0, false, http.StatusBadRequest},
+		{"", "bytes=-10", 0, 0, false, http.StatusBadRequest},
+		{"", "lines=1-2", 0, 0, false, http.StatusBadRequest},
+		{"", "bytes=19-10", 0, 0, false, http.StatusBadRequest},
+		{"start=-1", "", 0, 0, false, http.StatusBadRequest},
+		{"end=x", "", 0, 0, false, http.StatusBadRequest},
+		// Out of range
+		{"", "bytes=100-", 0, 0, false, http.StatusRequestedRangeNotSatisfiable},
+		{"start=10&end=101", "", 0, 0, false, http.StatusRequestedRangeNotSatisfiable},
+		{"start=101", "", 0, 0, false, http.StatusRequestedRangeNotSatisfiable},
+		{"start=150&end=120", "", 0, 0, false, http.StatusRequestedRangeNotSatisfiable},
+		// In range but wrapping around, which only circular sequences can
+		{"start=20&end=10", "", 0, 0, false, http.StatusNotImplemented},
+		{"start=100&end=0", "", 0, 0, false, http.StatusNotImplemented},
+	} {
+		t.Run(test.query+" "+test.rangeValue, func(t *testing.T) {
+			c, w := testContext("/ga4gh/refget/sequence/x?" + test.query)
+			if test.rangeValue != "" {
+				c.Request.Header.Set("Range", test.rangeValue)
+			}
+			start, end, partial, err := refgetInterval(c, 100)
+			status := http.StatusOK
+			if partial {
+				status = http.StatusPartialContent
+			}
+			if err != nil {
+				status = err.(*refgetError).status
+			}
+			if status != test.status || (err == nil && (start != test.start || end != test.end)) {
+				t.Errorf("refgetInterval = %d, %d, %v, status %d, want %d, %d, status %d", start, end, err, status, test.start, test.end, test.status)
+			}
+			if range416 := w.Header().Get("Content-Range"); test.rangeValue != "" && test.status == http.StatusRequestedRangeNotSatisfiable && range416 != "bytes */100" {
+				t.Errorf("Content-Range %q, want bytes */100", range416)
+			}
+		})
+	}
+}
+
+// testFASTA has a contig with LF line endings and one with CRLF, both with
+// some lowercase bases
+const testFASTA = ">chr1 first\nACGTacgtAC\nGTTTGGGGCC\nAT\n>chr2\r\nAAAAcccc\r\nGGGGTTTT\r\nAC\r\n"
+
+// testContigs lays out testFASTA's contigs as the FASTA indexer does
+func testContigs() []models.Contig {
+	return []models.Contig{
+		{Name: "chr1", Length: 22, FastaOffset: int64(strings.Index(testFASTA, "ACGTacgt")), LineBases: 10, LineWidth: 11},
+		{Name: "chr2", Length: 18, FastaOffset: int64(strings.Index(testFASTA, "AAAAcccc")), LineBases: 8, LineWidth: 10},
+	}
+}
+
+func TestFastaRangeBases(t *testing.T) {
+	useTestStorage(t)
+	key := putTestObject(t, []byte(testFASTA))
+	sequences := map[string]string{"chr1": "ACGTACGTACGTTTGGGGCCAT", "chr2": "AAAACCCCGGGGTTTTAC"}
+
+	for _, contig := range testContigs() {
+		bases := sequences[contig.Name]
+		for _, r := range [][2]int64{
+			{0, contig.Length},
+			{0, 1},
+			// Up to, across and just after line ends
+			{int64(contig.LineBases) - 1, int64(contig.LineBases)},
+			{int64(contig.LineBases) - 2, int64(contig.LineBases) + 2},
+			{int64(contig.LineBases), int64(contig.LineBases) + 1},
+			{5, contig.Length - 1},
+			{int64(2 * contig.LineBases), contig.Length},
+			{contig.Length - 1, contig.Length},
+		} {
+			t.Run(fmt.Sprintf("%s:%d-%d", contig.Name, r[0], r[1]), func(t *testing.T) {
+				body, err := fastaRange(context.Background(), key, contig, r[0], r[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer body.Close()
+				var out bytes.Buffer
+				if err := copyBases(&out, body); err != nil {
+					t.Fatal(err)
+				}
+				if want := bases[r[0]:r[1]]; out.String() != want {
+					t.Errorf("bases %q, want %q", out.String(), want)
+				}
+			})
+		}
+	}
+}
+
+func TestGetRefgetSequence(t *testing.T) {
+	db := useTestDB(t)
+	genome := models.Genome{Name: "test", Species: "Homo sapiens", CreatedBy: testAdminID,
+		FastaPath: putTestObject(t, []byte(testFASTA)), ReferenceStatus: models.IngestSucceeded}
+	if err := db.Create(&genome).Error; err != nil {
+		t.Fatal(err)
+	}
+	contig := testContigs()[0]
+	contig.GenomeID, contig.MD5, contig.SHA512t24u = genome.ID, strings.Repeat("1", 32), "chr1digest"
+	if err := db.Create(&contig).Error; err != nil {
+		t.Fatal(err)
+	}
+	r := testRouter()
+	r.GET("/ga4gh/refget/sequence/:id", GetRefgetSequence)
+
+	for _, test := range []struct {
+		query, rangeValue string
+		status            int
+		body              string
+	}{
+		{"", "", http.StatusOK, "ACGTACGTACGTTTGGGGCCAT"},
+		{"?start=8&end=13", "", http.StatusOK, "ACGTT"},
+		{"", "bytes=9-11", http.StatusPartialContent, "CGT"},
+		{"?start=13&end=8", "", http.StatusNotImplemented, ""},
+		{"?start=8&end=23", "", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"", "bytes=22-", http.StatusRequestedRangeNotSatisfiable, ""},
+		{"?start=8", "bytes=9-11", http.StatusBadRequest, ""},
+	} {
+		for _, id := range []string{contig.MD5, "SQ." + contig.SHA512t24u} {
+			req := httptest.NewRequest(http.MethodGet, "/ga4gh/refget/sequence/"+id+test.query, nil)
+			if test.rangeValue != "" {
+				req.Header.Set("Range", test.rangeValue)
+			}
+			w := serve(r, req)
+			if w.Code != test.status || (test.body != "" && w.Body.String() != test.body) {
+				t.Errorf("%s%s %s: %d %q, want %d %q", id, test.query, test.rangeValue, w.Code, w.Body, test.status, test.body)
+			}
+		}
+	}
+	if w := serve(r, httptest.NewRequest(http.MethodGet, "/ga4gh/refget/sequence/"+strings.Repeat("2", 32), nil)); w.Code != http.StatusNotFound {
+		t.Errorf("unknown sequence: %d", w.Code)
+	}
+}
@@ -4,26 +4,65 @@ import (
 	"net/http"
 	"strconv"
 
+	"genomic-api/audit"
 	"genomic-api/config"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// alignedSamples selects the samples with a BAM whose alignment metrics meet
+// the condition appended to it
+const alignedSamples = "SELECT f.sample_id FROM sequence_files f JOIN alignment_metrics m ON m.sequence_file_id = f.id WHERE m."
+
+// sampleList is what ListSamples can filter and sort on
+var sampleList = listSpec{
+	filters: map[string]filter{
+		"genome_id":                {expr: "genome_id = ?", kind: intParam},
+		"donor_id":                 {expr: "donor_id = ?"},
+		"sample_type":              {expr: "sample_type = ?"},
+		"collected_by":             {expr: "collected_by = ?", kind: intParam},
+		"collected_after":          {expr: "collection_date >= ?", kind: timeParam},
+		"collected_before":         {expr: "collection_date < ?", kind: timeParam},
+		"created_after":            {expr: "created_at >= ?", kind: timeParam},
+		"created_before":           {expr: "created_at < ?", kind: timeParam},
+		"min_mapped_rate":          {expr: "id IN (" + alignedSamples + "mapped_rate >= ?)", kind: floatParam},
+		"min_properly_paired_rate": {expr: "id IN (" + alignedSamples + "properly_paired_rate >= ?)", kind: floatParam},
+		"max_duplicate_rate":       {expr: "id IN (" + alignedSamples + "duplicate_rate <= ?)", kind: floatParam},
+	},
+	sorts: map[string]string{
+		"id": "id", "donor_id": "donor_id", "sample_type": "sample_type",
+		"collection_date": "collection_date", "created_at": "created_at",
+	},
+	defaultSort: "id",
+}
+
 // ListSamples godoc
 // @Summary      List samples
-// @Description  Get all samples
+// @Description  Get samples a page at a time. The total is returned in X-Total-Count and page links in Link.
 // @Tags         samples
 // @Produce      json
-// @Success      200  {array}  models.Sample
+// @Param        genome_id                 query  int     false  "Reference genome ID"
+// @Param        donor_id                  query  string  false  "Donor ID"
+// @Param        sample_type               query  string  false  "Sample type, e.g. blood"
+// @Param        collected_by              query  int     false  "Collecting user ID"
+// @Param        collected_after           query  string  false  "Collected on or after (YYYY-MM-DD)"
+// @Param        collected_before          query  string  false  "Collected before (YYYY-MM-DD)"
+// @Param        created_after             query  string  false  "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        created_before            query  string  false  "Created before (RFC 3339 or YYYY-MM-DD)"
+// @Param        min_mapped_rate           query  number  false  "Samples with a BAM with at least this fraction of reads mapped, e.g. 0.95"
+// @Param        min_properly_paired_rate  query  number  false  "Samples with a BAM with at least this fraction of paired reads properly paired"
+// @Param        max_duplicate_rate        query  number  false  "Samples with a BAM with at most this fraction of reads marked duplicate"
+// @Param        sort                      query  string  false  "Comma-separated keys: id, donor_id, sample_type, collection_date, created_at; prefix - for descending"
+// @Param        page                      query  int     false  "Page number, from 1"
+// @Param        per_page                  query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.Sample
+// @Failure      400  {object}  map[string]string
 // @Router       /api/samples [get]
 func ListSamples(c *gin.Context) {
 	var samples []models.Sample
-	if err := config.DB.Find(&samples).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, samples)
+	listPage(c, config.DB.Model(&models.Sample{}), sampleList, &samples)
 }
 
 // CreateSample godoc
@@ -41,7 +80,12 @@ func CreateSample(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Create(&sample).Error; err != nil {
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&sample).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceSample, sample.ID, nil, sample)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -85,11 +129,18 @@ func UpdateSample(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sample not found"})
 		return
 	}
+	before := sample
 	if err := c.ShouldBindJSON(&sample); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Save(&sample).Error; err != nil {
+	sample.ID = before.ID // the path decides which record is updated, not the body
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&sample).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionUpdate, audit.ResourceSample, sample.ID, before, sample)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -107,7 +158,17 @@ func UpdateSample(c *gin.Context) {
 // @Router       /api/samples/{id} [delete]
 func DeleteSample(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := config.DB.Delete(&models.Sample{}, id).Error; err != nil {
+	var sample models.Sample
+	if err := config.DB.First(&sample, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sample not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&sample).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceSample, sample.ID, sample, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
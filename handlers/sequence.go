@@ -3,45 +3,133 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
+	"genomic-api/audit"
 	"genomic-api/config"
+	"genomic-api/filetype"
+	"genomic-api/headercheck"
+	"genomic-api/middleware"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// CreateSequenceFileInput is the request body for registering a sequence
+// file already in storage. Checksums, size and verification results are
+// recorded by the server, never taken from the client.
+type CreateSequenceFileInput struct {
+	SampleID int    `json:"sample_id" binding:"required"`
+	FilePath string `json:"file_path" binding:"required"` // storage key
+	FileName string `json:"file_name"`
+	FileType string `json:"file_type" binding:"required"` // FASTQ, BAM or CRAM
+}
+
+// UpdateSequenceFileInput is the request body for updating a sequence file;
+// omitted fields are left unchanged
+type UpdateSequenceFileInput struct {
+	SampleID int    `json:"sample_id"`
+	FilePath string `json:"file_path"`
+	FileName string `json:"file_name"`
+	FileType string `json:"file_type"`
+}
+
+// sequenceFileList is what ListSequenceFiles can filter and sort on
+var sequenceFileList = listSpec{
+	filters: map[string]filter{
+		"sample_id":                {expr: "sample_id = ?", kind: intParam},
+		"genome_id":                {expr: "sample_id IN (SELECT id FROM samples WHERE genome_id = ?)", kind: intParam},
+		"file_type":                {expr: "file_type = ?"},
+		"uploaded_by":              {expr: "uploaded_by = ?", kind: intParam},
+		"uploaded_after":           {expr: "uploaded_at >= ?", kind: timeParam},
+		"uploaded_before":          {expr: "uploaded_at < ?", kind: timeParam},
+		"verification_status":      {expr: "verification_status = ?"},
+		"header_status":            {expr: "header_status = ?"},
+		"qc_status":                {expr: "qc_status = ?"},
+		"min_mapped_rate":          {expr: "id IN (SELECT sequence_file_id FROM alignment_metrics WHERE mapped_rate >= ?)", kind: floatParam},
+		"min_properly_paired_rate": {expr: "id IN (SELECT sequence_file_id FROM alignment_metrics WHERE properly_paired_rate >= ?)", kind: floatParam},
+		"max_duplicate_rate":       {expr: "id IN (SELECT sequence_file_id FROM alignment_metrics WHERE duplicate_rate <= ?)", kind: floatParam},
+	},
+	sorts: map[string]string{
+		"id": "id", "sample_id": "sample_id", "file_type": "file_type", "uploaded_at": "uploaded_at",
+	},
+	defaultSort: "id",
+}
+
 // ListSequenceFiles godoc
 // @Summary      List sequence files
-// @Description  Get all sequence files
+// @Description  Get sequence files a page at a time. The total is returned in X-Total-Count and page links in Link.
 // @Tags         sequence
 // @Produce      json
-// @Success      200  {array}  models.SequenceFile
+// @Param        sample_id                 query  int     false  "Sample ID"
+// @Param        genome_id                 query  int     false  "Reference genome ID of the sample"
+// @Param        file_type                 query  string  false  "File type, e.g. BAM"
+// @Param        uploaded_by               query  int     false  "Uploading user ID"
+// @Param        uploaded_after            query  string  false  "Uploaded at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        uploaded_before           query  string  false  "Uploaded before (RFC 3339 or YYYY-MM-DD)"
+// @Param        verification_status       query  string  false  "Result of the last checksum verification: ok, mismatch, missing, no_checksum or error"
+// @Param        header_status             query  string  false  "Result of the BAM header check: ok, mismatch or unchecked"
+// @Param        qc_status                 query  string  false  "Status of the latest QC job: queued, running, succeeded or failed"
+// @Param        min_mapped_rate           query  number  false  "BAMs with at least this fraction of reads mapped, e.g. 0.95"
+// @Param        min_properly_paired_rate  query  number  false  "BAMs with at least this fraction of paired reads properly paired"
+// @Param        max_duplicate_rate        query  number  false  "BAMs with at most this fraction of reads marked duplicate"
+// @Param        sort                      query  string  false  "Comma-separated keys: id, sample_id, file_type, uploaded_at; prefix - for descending"
+// @Param        page                      query  int     false  "Page number, from 1"
+// @Param        per_page                  query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.SequenceFile
+// @Failure      400  {object}  map[string]string
 // @Router       /api/sequence [get]
 func ListSequenceFiles(c *gin.Context) {
 	var files []models.SequenceFile
-	if err := config.DB.Find(&files).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, files)
+	listPage(c, config.DB.Model(&models.SequenceFile{}), sequenceFileList, &files)
 }
 
 // CreateSequenceFile godoc
 // @Summary      Create sequence file
-// @Description  Add a new sequence file record
+// @Description  Register a file already in storage as a sequence file. file_type must be FASTQ, BAM or CRAM (common spellings such as fq.gz are accepted and normalized); a stored file whose content is something else is refused with 422. A stored BAM's header is checked against the sample's genome and donor ID; mismatches are refused with 422 unless HEADER_VALIDATION=flag. The size is read from storage; checksums are only recorded for uploads.
 // @Tags         sequence
 // @Accept       json
 // @Produce      json
-// @Param        sequence_file  body  models.SequenceFile  true  "Sequence file info"
+// @Param        sequence_file  body  CreateSequenceFileInput  true  "Sequence file info"
 // @Success      201  {object}  models.SequenceFile
+// @Failure      400  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
 // @Router       /api/sequence [post]
 func CreateSequenceFile(c *gin.Context) {
-	var file models.SequenceFile
-	if err := c.ShouldBindJSON(&file); err != nil {
+	var input CreateSequenceFileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Create(&file).Error; err != nil {
+	file := models.SequenceFile{
+		SampleID: input.SampleID, FilePath: input.FilePath, FileName: input.FileName, FileType: input.FileType,
+		SizeBytes: storedSize(c.Request.Context(), input.FilePath), UploadedAt: time.Now(),
+	}
+	if userID, ok := middleware.CurrentUserID(c); ok {
+		file.UploadedBy = &userID
+	}
+	if !normalizeFileType(c, &file.FileType, filetype.Sequence) || !checkContent(c, file.FilePath, file.FileType) {
+		return
+	}
+	report, err := headercheck.CheckStored(c.Request.Context(), config.DB, file.FilePath,
+		headerFormat(file.FileType, file.FileName, file.FilePath), file.SampleID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !applyHeaderCheck(c, report, &file.HeaderStatus, &file.HeaderReport) {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, file.FilePath); err != nil {
+			return err
+		}
+		if err := tx.Create(&file).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceSequenceFile, file.ID, nil, file)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -69,14 +157,16 @@ func GetSequenceFile(c *gin.Context) {
 
 // UpdateSequenceFile godoc
 // @Summary      Update sequence file
-// @Description  Update sequence file by ID
+// @Description  Update sequence file by ID. file_type is validated and, if it or file_path changes, checked against the stored content as on create. Changing file_path clears the checksums and verification result, which belonged to the old object, and releases the old object once nothing refers to it.
 // @Tags         sequence
 // @Accept       json
 // @Produce      json
-// @Param        id             path      int                true  "Sequence file ID"
-// @Param        sequence_file  body      models.SequenceFile true  "Sequence file info"
+// @Param        id             path      int                      true  "Sequence file ID"
+// @Param        sequence_file  body      UpdateSequenceFileInput  true  "Fields to change"
 // @Success      200            {object}  models.SequenceFile
+// @Failure      400            {object}  map[string]string
 // @Failure      404            {object}  map[string]string
+// @Failure      422            {object}  map[string]interface{}
 // @Router       /api/sequence/{id} [put]
 func UpdateSequenceFile(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
@@ -85,14 +175,64 @@ func UpdateSequenceFile(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&file); err != nil {
+	before := file
+	var input UpdateSequenceFileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Save(&file).Error; err != nil {
+	if input.SampleID != 0 {
+		file.SampleID = input.SampleID
+	}
+	if input.FilePath != "" {
+		file.FilePath = input.FilePath
+	}
+	if input.FileName != "" {
+		file.FileName = input.FileName
+	}
+	if input.FileType != "" {
+		file.FileType = input.FileType
+	}
+	if !normalizeFileType(c, &file.FileType, filetype.Sequence) {
+		return
+	}
+	if file.FilePath != before.FilePath || file.FileType != before.FileType {
+		if !checkContent(c, file.FilePath, file.FileType) {
+			return
+		}
+	}
+	if file.FilePath != before.FilePath {
+		file.Checksum, file.MD5 = "", ""
+		file.SizeBytes = storedSize(c.Request.Context(), file.FilePath)
+		file.VerificationStatus, file.LastVerifiedAt = "", nil
+	}
+	if file.FilePath != before.FilePath || file.SampleID != before.SampleID ||
+		file.FileType != before.FileType || file.FileName != before.FileName {
+		report, err := headercheck.CheckStored(c.Request.Context(), config.DB, file.FilePath,
+			headerFormat(file.FileType, file.FileName, file.FilePath), file.SampleID, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !applyHeaderCheck(c, report, &file.HeaderStatus, &file.HeaderReport) {
+			return
+		}
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, file.FilePath); err != nil {
+			return err
+		}
+		if err := tx.Save(&file).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionUpdate, audit.ResourceSequenceFile, file.ID, before, file)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if file.FilePath != before.FilePath {
+		releasePayload(c.Request.Context(), before.FilePath)
+	}
 	c.JSON(http.StatusOK, file)
 }
 
@@ -107,9 +247,21 @@ func UpdateSequenceFile(c *gin.Context) {
 // @Router       /api/sequence/{id} [delete]
 func DeleteSequenceFile(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := config.DB.Delete(&models.SequenceFile{}, id).Error; err != nil {
+	var file models.SequenceFile
+	if err := config.DB.First(&file, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sequence file not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&file).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceSequenceFile, file.ID, file, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	releasePayload(c.Request.Context(), file.FilePath)
+	releasePayload(c.Request.Context(), file.IndexPath)
 	c.JSON(http.StatusOK, gin.H{"message": "Sequence file deleted"})
 }
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"genomic-api/models"
+	"genomic-api/storage"
+)
+
+// putTestObject stores content under its content key
+func putTestObject(t *testing.T, content []byte) string {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	key := storage.ContentKey(hex.EncodeToString(sum[:]))
+	if err := storage.Default.Put(context.Background(), key, bytes.NewReader(content), int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSequenceFileIgnoresServerFields(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	r := testRouter()
+	r.POST("/api/sequence", CreateSequenceFile)
+	r.PUT("/api/sequence/:id", UpdateSequenceFile)
+
+	first := []byte("@read1\nACGT\n+\nIIII\n")
+	firstKey := putTestObject(t, first)
+	body, _ := json.Marshal(map[string]interface{}{
+		"sample_id": sample.ID, "file_path": firstKey, "file_name": "reads.fastq", "file_type": "FASTQ",
+		"checksum": "forged", "md5": "forged", "size_bytes": 999, "verification_status": "ok",
+		"last_verified_at": "2024-01-01T00:00:00Z", "uploaded_by": 42,
+	})
+	w := serve(r, httptest.NewRequest(http.MethodPost, "/api/sequence", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	var file models.SequenceFile
+	json.Unmarshal(w.Body.Bytes(), &file)
+	if file.Checksum != "" || file.MD5 != "" || file.VerificationStatus != "" || file.LastVerifiedAt != nil {
+		t.Fatalf("create took server fields from the request: %+v", file)
+	}
+	if file.SizeBytes != int64(len(first)) || file.UploadedBy == nil || *file.UploadedBy != testAdminID {
+		t.Fatalf("create recorded size %d uploaded_by %v, want %d and the caller", file.SizeBytes, file.UploadedBy, len(first))
+	}
+
+	second := []byte("@read2\nTTGCA\n+\nIIIII\n")
+	secondKey := putTestObject(t, second)
+	body, _ = json.Marshal(map[string]interface{}{"file_path": secondKey, "checksum": "forged"})
+	w = serve(r, httptest.NewRequest(http.MethodPut, "/api/sequence/"+strconv.Itoa(file.ID), bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body)
+	}
+	json.Unmarshal(w.Body.Bytes(), &file)
+	if file.FilePath != secondKey || file.Checksum != "" || file.SizeBytes != int64(len(second)) || file.FileName != "reads.fastq" {
+		t.Fatalf("update: %+v", file)
+	}
+	if _, err := storage.Default.Stat(context.Background(), firstKey); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("old payload not released: %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/middleware"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ServiceAccountInput is the request body for creating or updating a service account
+type ServiceAccountInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Disabled    bool   `json:"disabled"`
+}
+
+// CreateAPIKeyInput is the request body for issuing an API key
+type CreateAPIKeyInput struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKey is returned once when a key is issued; the plaintext key can't be retrieved later
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// serviceAccountList is what ListServiceAccounts can filter and sort on
+var serviceAccountList = listSpec{
+	filters: map[string]filter{
+		"name":       {expr: "name = ?"},
+		"created_by": {expr: "created_by = ?", kind: intParam},
+	},
+	sorts:       map[string]string{"id": "id", "name": "name", "created_at": "created_at"},
+	defaultSort: "id",
+}
+
+// apiKeyList is what ListAPIKeys can filter and sort on
+var apiKeyList = listSpec{
+	filters: map[string]filter{
+		"name":   {expr: "name = ?"},
+		"prefix": {expr: "prefix = ?"},
+	},
+	sorts: map[string]string{
+		"id": "id", "name": "name", "created_at": "created_at",
+		"expires_at": "expires_at", "last_used_at": "last_used_at",
+	},
+	defaultSort: "id",
+}
+
+// ListServiceAccounts godoc
+// @Summary      List service accounts
+// @Description  Get service accounts a page at a time. The total is returned in X-Total-Count and page links in Link.
+// @Tags         service-accounts
+// @Produce      json
+// @Param        name        query  string  false  "Service account name"
+// @Param        created_by  query  int     false  "Creating user ID"
+// @Param        sort        query  string  false  "Comma-separated keys: id, name, created_at; prefix - for descending"
+// @Param        page        query  int     false  "Page number, from 1"
+// @Param        per_page    query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.ServiceAccount
+// @Failure      400  {object}  map[string]string
+// @Router       /api/service-accounts [get]
+func ListServiceAccounts(c *gin.Context) {
+	var accounts []models.ServiceAccount
+	listPage(c, config.DB.Model(&models.ServiceAccount{}), serviceAccountList, &accounts)
+}
+
+// CreateServiceAccount godoc
+// @Summary      Create service account
+// @Description  Add a service account for an unattended caller such as a pipeline
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        account  body  ServiceAccountInput  true  "Service account info"
+// @Success      201  {object}  models.ServiceAccount
+// @Router       /api/service-accounts [post]
+func CreateServiceAccount(c *gin.Context) {
+	var input ServiceAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, _ := middleware.CurrentUserID(c)
+	account := models.ServiceAccount{
+		Name:        input.Name,
+		Description: input.Description,
+		Disabled:    input.Disabled,
+		CreatedBy:   userID,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&account).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceServiceAccount, account.ID, nil, account)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, account)
+}
+
+// GetServiceAccount godoc
+// @Summary      Get service account
+// @Description  Get service account by ID
+// @Tags         service-accounts
+// @Produce      json
+// @Param        id   path      int  true  "Service account ID"
+// @Success      200  {object}  models.ServiceAccount
+// @Failure      404  {object}  map[string]string
+// @Router       /api/service-accounts/{id} [get]
+func GetServiceAccount(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var account models.ServiceAccount
+	if err := config.DB.First(&account, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateServiceAccount godoc
+// @Summary      Update service account
+// @Description  Update service account by ID; disabling it rejects all of its keys
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        id       path      int                  true  "Service account ID"
+// @Param        account  body      ServiceAccountInput  true  "Service account info"
+// @Success      200      {object}  models.ServiceAccount
+// @Failure      404      {object}  map[string]string
+// @Router       /api/service-accounts/{id} [put]
+func UpdateServiceAccount(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var account models.ServiceAccount
+	if err := config.DB.First(&account, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	before := account
+	var input ServiceAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	account.Name = input.Name
+	account.Description = input.Description
+	account.Disabled = input.Disabled
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&account).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionUpdate, audit.ResourceServiceAccount, account.ID, before, account)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, account)
+}
+
+// ListAPIKeys godoc
+// @Summary      List API keys
+// @Description  Get the API keys of a service account (without the secret part) a page at a time. The total is returned in X-Total-Count and page links in Link.
+// @Tags         service-accounts
+// @Produce      json
+// @Param        id        path   int     true   "Service account ID"
+// @Param        name      query  string  false  "Key name"
+// @Param        prefix    query  string  false  "Key prefix, the public part after gk_"
+// @Param        sort      query  string  false  "Comma-separated keys: id, name, created_at, expires_at, last_used_at; prefix - for descending"
+// @Param        page      query  int     false  "Page number, from 1"
+// @Param        per_page  query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.APIKey
+// @Failure      400  {object}  map[string]string
+// @Router       /api/service-accounts/{id}/keys [get]
+func ListAPIKeys(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var keys []models.APIKey
+	listPage(c, config.DB.Model(&models.APIKey{}).Where("service_account_id = ?", id), apiKeyList, &keys)
+}
+
+// CreateAPIKey godoc
+// @Summary      Create API key
+// @Description  Issue a scoped API key for a service account. The key is only returned in this response; send it as "Authorization: Bearer <key>".
+// @Tags         service-accounts
+// @Accept       json
+// @Produce      json
+// @Param        id   path      int                true  "Service account ID"
+// @Param        key  body      CreateAPIKeyInput  true  "Key name, scopes and optional expiry"
+// @Success      201  {object}  CreatedAPIKey
+// @Failure      404  {object}  map[string]string
+// @Router       /api/service-accounts/{id}/keys [post]
+func CreateAPIKey(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var account models.ServiceAccount
+	if err := config.DB.First(&account, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return
+	}
+	var input CreateAPIKeyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !middleware.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope " + scope, "valid_scopes": middleware.Scopes})
+			return
+		}
+	}
+
+	plaintext, prefix, hash := middleware.GenerateAPIKey()
+	key := models.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             input.Name,
+		Prefix:           prefix,
+		KeyHash:          hash,
+		Scopes:           strings.Join(input.Scopes, " "),
+		ExpiresAt:        input.ExpiresAt,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&key).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceAPIKey, key.ID, nil, key)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, CreatedAPIKey{APIKey: key, Key: plaintext})
+}
+
+// RevokeAPIKey godoc
+// @Summary      Revoke API key
+// @Description  Revoke an API key; requests using it are rejected from now on
+// @Tags         service-accounts
+// @Produce      json
+// @Param        id      path      int  true  "Service account ID"
+// @Param        key_id  path      int  true  "API key ID"
+// @Success      200     {object}  map[string]string
+// @Failure      404     {object}  map[string]string
+// @Router       /api/service-accounts/{id}/keys/{key_id} [delete]
+func RevokeAPIKey(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	keyID, _ := strconv.Atoi(c.Param("key_id"))
+	var key models.APIKey
+	if err := config.DB.Where("service_account_id = ?", id).First(&key, keyID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionRevoke, audit.ResourceAPIKey, key.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,843 @@
+package handlers
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/filetype"
+	"genomic-api/headercheck"
+	"genomic-api/ingest"
+	"genomic-api/middleware"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// uploadSessionTTL is how long an unfinished upload can still be resumed
+const uploadSessionTTL = 7 * 24 * time.Hour
+
+// maxFormFieldSize bounds the non-file fields of a multipart upload
+const maxFormFieldSize = 1 << 10
+
+// uploadLease is how long a chunk request holds an upload without renewing
+// its lease, and uploadLeaseRenewal how often it renews while bytes arrive
+const (
+	uploadLease        = 2 * time.Minute
+	uploadLeaseRenewal = 30 * time.Second
+)
+
+var (
+	errUploadBusy     = errors.New("Another chunk of this upload is being received")
+	errUploadComplete = errors.New("Upload is already complete")
+	errUploadExpired  = errors.New("Upload has expired")
+	errUploadOffset   = errors.New("Upload-Offset does not match the bytes received")
+	errChunkTooLong   = errors.New("Chunk extends past the announced upload size")
+)
+
+// claimUpload leases the upload to this request and reloads the session,
+// returning the lease token. The staging directory may be shared by several
+// API instances, so only the lease keeps two requests from truncating or
+// appending to the same staging file at once. Unlike a lock it holds no
+// database connection while a chunk streams in. It doesn't wait:
+// errUploadBusy is returned if another request holds an unexpired lease.
+func claimUpload(session *models.UploadSession) (string, error) {
+	token := newUploadID()
+	now := time.Now()
+	result := config.DB.Model(&models.UploadSession{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until < ?)", session.ID, now).
+		Updates(map[string]interface{}{"lock_token": token, "locked_until": now.Add(uploadLease)})
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		return "", errUploadBusy
+	}
+	return token, config.DB.First(session, "id = ?", session.ID).Error
+}
+
+// renewUpload extends a lease; errUploadBusy means another request has
+// taken the upload over since it expired
+func renewUpload(id, token string) error {
+	result := config.DB.Model(&models.UploadSession{}).Where("id = ? AND lock_token = ?", id, token).
+		Update("locked_until", time.Now().Add(uploadLease))
+	if result.Error == nil && result.RowsAffected == 0 {
+		return errUploadBusy
+	}
+	return result.Error
+}
+
+// releaseUpload ends a lease so the next chunk needn't wait for it to expire
+func releaseUpload(id, token string) {
+	err := config.DB.Model(&models.UploadSession{}).Where("id = ? AND lock_token = ?", id, token).
+		Updates(map[string]interface{}{"lock_token": nil, "locked_until": nil}).Error
+	if err != nil {
+		log.Warn().Err(err).Str("upload_id", id).Msg("failed to release upload lease")
+	}
+}
+
+// leaseReader renews an upload's lease while a chunk streams in. The lease
+// is checked after each read and before its bytes are written, so nothing
+// reaches the staging file once another request may have taken it over.
+type leaseReader struct {
+	r         io.Reader
+	id, token string
+	renewed   time.Time
+}
+
+func (l *leaseReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if time.Since(l.renewed) >= uploadLeaseRenewal {
+		if err := renewUpload(l.id, l.token); err != nil {
+			return 0, err
+		}
+		l.renewed = time.Now()
+	}
+	return n, err
+}
+
+// StartUploadInput is the request body for starting a resumable upload
+type StartUploadInput struct {
+	SampleID int    `json:"sample_id" binding:"required"`
+	GenomeID int    `json:"genome_id"`                    // required for variant files
+	FileType string `json:"file_type" binding:"required"` // FASTQ, BAM or CRAM; VCF, JSON or GFF for variant files
+	FileName string `json:"file_name" binding:"required"`
+	Size     int64  `json:"size" binding:"required,min=1"`
+	MD5      string `json:"md5"`    // optional; the upload is rejected if it doesn't match
+	SHA256   string `json:"sha256"` // optional; the upload is rejected if it doesn't match
+}
+
+func newUploadID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// stagingPath is where the bytes of an unfinished upload are kept
+func stagingPath(id string) string {
+	return filepath.Join(storage.StagingDir, id+".part")
+}
+
+// uploadPaths is where each kind of upload is served
+var uploadPaths = map[string]string{
+	models.UploadSequenceFile: "/api/sequence/uploads/",
+	models.UploadVariantFile:  "/api/variants/uploads/",
+}
+
+// completedFileID is the file created by a finished upload, or nil
+func completedFileID(session models.UploadSession) *int {
+	if session.SequenceFileID != nil {
+		return session.SequenceFileID
+	}
+	return session.VariantFileID
+}
+
+// restoreHashes resumes the MD5 and SHA-256 states saved after the last chunk
+func restoreHashes(session models.UploadSession) (hash.Hash, hash.Hash, error) {
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if len(session.MD5State) > 0 {
+		if err := md5Hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(session.MD5State); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(session.SHA256State) > 0 {
+		if err := sha256Hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(session.SHA256State); err != nil {
+			return nil, nil, err
+		}
+	}
+	return md5Hash, sha256Hash, nil
+}
+
+// saveHashes stores the hash states in session so the next chunk can resume them
+func saveHashes(session *models.UploadSession, md5Hash, sha256Hash hash.Hash) error {
+	var err error
+	if session.MD5State, err = md5Hash.(encoding.BinaryMarshaler).MarshalBinary(); err != nil {
+		return err
+	}
+	session.SHA256State, err = sha256Hash.(encoding.BinaryMarshaler).MarshalBinary()
+	return err
+}
+
+// setUploadHeaders reports progress the same way for HEAD, GET and PATCH
+func setUploadHeaders(c *gin.Context, session models.UploadSession) {
+	c.Header("Upload-Offset", strconv.FormatInt(session.Received, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Size, 10))
+	c.Header("Cache-Control", "no-store")
+}
+
+// loadUpload finds the upload of the given kind named in the path. Only its
+// creator, or an admin, may see or continue it.
+func loadUpload(c *gin.Context, kind string) (models.UploadSession, bool) {
+	var session models.UploadSession
+	if err := config.DB.First(&session, "id = ? AND kind = ?", c.Param("id"), kind).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return session, false
+	}
+	userID, _ := middleware.CurrentUserID(c)
+	accountID, _ := middleware.CurrentServiceAccountID(c)
+	isOwner := session.UserID == userID && session.ServiceAccountID == accountID
+	if !isOwner && middleware.CurrentRole(c) != models.RoleAdmin {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Upload not found"})
+		return session, false
+	}
+	return session, true
+}
+
+// checkUploadTarget makes sure the records the new file will belong to exist
+func checkUploadTarget(kind string, sampleID, genomeID int) error {
+	var sample models.Sample
+	if err := config.DB.First(&sample, sampleID).Error; err != nil {
+		return errors.New("Sample not found")
+	}
+	if kind != models.UploadVariantFile {
+		return nil
+	}
+	var genome models.Genome
+	if genomeID == 0 || config.DB.First(&genome, genomeID).Error != nil {
+		return errors.New("Genome not found")
+	}
+	return nil
+}
+
+func startUpload(c *gin.Context, kind string) {
+	var input StartUploadInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	fileType, err := filetype.Normalize(input.FileType, fileTypes[kind])
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := checkUploadTarget(kind, input.SampleID, input.GenomeID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, _ := middleware.CurrentUserID(c)
+	accountID, _ := middleware.CurrentServiceAccountID(c)
+	session := models.UploadSession{
+		ID:               newUploadID(),
+		Kind:             kind,
+		SampleID:         input.SampleID,
+		FileType:         fileType,
+		FileName:         input.FileName,
+		Size:             input.Size,
+		ExpectedMD5:      strings.ToLower(input.MD5),
+		ExpectedSHA256:   strings.ToLower(input.SHA256),
+		UserID:           userID,
+		ServiceAccountID: accountID,
+		ExpiresAt:        time.Now().Add(uploadSessionTTL),
+	}
+	if kind == models.UploadVariantFile {
+		session.GenomeID = input.GenomeID
+	}
+	if err := config.DB.Create(&session).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Location", uploadPaths[kind]+session.ID)
+	setUploadHeaders(c, session)
+	c.JSON(http.StatusCreated, session)
+}
+
+func getUpload(c *gin.Context, kind string) {
+	session, ok := loadUpload(c, kind)
+	if !ok {
+		return
+	}
+	setUploadHeaders(c, session)
+	c.JSON(http.StatusOK, session)
+}
+
+func appendUpload(c *gin.Context, kind string) {
+	session, ok := loadUpload(c, kind)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		setUploadHeaders(c, session)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header is required"})
+		return
+	}
+
+	// The staging file is truncated, written and its progress saved under
+	// the upload's lease, which is held until the file is registered
+	token, err := claimUpload(&session)
+	var md5Hash, sha256Hash hash.Hash
+	var copyErr error
+	if err == nil {
+		defer releaseUpload(session.ID, token)
+		md5Hash, sha256Hash, copyErr, err = receiveChunk(c, &session, token, offset)
+	}
+	setUploadHeaders(c, session)
+	switch {
+	case errors.Is(err, errUploadBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errUploadComplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "file_id": *completedFileID(session)})
+		return
+	case errors.Is(err, errUploadExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errUploadOffset):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "received": session.Received})
+		return
+	case errors.Is(err, errChunkTooLong):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if copyErr != nil {
+		log.Warn().Err(copyErr).Str("upload_id", session.ID).Int64("received", session.Received).Msg("upload chunk interrupted")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Chunk was interrupted; resume from the received offset", "received": session.Received})
+		return
+	}
+	if session.Received < session.Size {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	finishUpload(c, &session, hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), true)
+}
+
+// receiveChunk appends the request body to the staging file of an upload
+// leased with token, then saves the bytes received and the hash states if
+// the lease is still held. No transaction is open while the body streams
+// in, however long that takes. copyErr reports a body that broke off; what
+// arrived before it is kept.
+func receiveChunk(c *gin.Context, session *models.UploadSession, token string, offset int64) (md5Hash, sha256Hash hash.Hash, copyErr, err error) {
+	switch {
+	case completedFileID(*session) != nil:
+		return nil, nil, nil, errUploadComplete
+	case time.Now().After(session.ExpiresAt):
+		return nil, nil, nil, errUploadExpired
+	case offset != session.Received:
+		return nil, nil, nil, errUploadOffset
+	}
+
+	if md5Hash, sha256Hash, err = restoreHashes(*session); err != nil {
+		return nil, nil, nil, err
+	}
+	f, err := os.OpenFile(stagingPath(session.ID), os.O_CREATE|os.O_WRONLY, 0o640)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	// Drop anything written after the last recorded offset, e.g. by a
+	// request that failed before saving its progress
+	if err := f.Truncate(session.Received); err == nil {
+		_, err = f.Seek(session.Received, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+
+	remaining := session.Size - session.Received
+	body := &leaseReader{r: io.LimitReader(c.Request.Body, remaining), id: session.ID, token: token, renewed: time.Now()}
+	n, copyErr := io.Copy(io.MultiWriter(f, md5Hash, sha256Hash), body)
+	if err := f.Close(); err != nil {
+		return nil, nil, nil, err
+	}
+	if errors.Is(copyErr, errUploadBusy) {
+		return nil, nil, nil, copyErr
+	}
+	if copyErr == nil && n == remaining {
+		if extra, _ := c.Request.Body.Read(make([]byte, 1)); extra > 0 {
+			return nil, nil, nil, errChunkTooLong
+		}
+	}
+
+	// Everything copied was also hashed, so a dropped connection still
+	// leaves a consistent offset to resume from
+	if err := saveHashes(session, md5Hash, sha256Hash); err != nil {
+		return nil, nil, nil, err
+	}
+	result := config.DB.Model(session).Where("lock_token = ?", token).Updates(map[string]interface{}{
+		"received":     session.Received + n,
+		"md5_state":    session.MD5State,
+		"sha256_state": session.SHA256State,
+	})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return nil, nil, nil, errUploadBusy
+	}
+	if result.Error != nil {
+		return nil, nil, nil, result.Error
+	}
+	session.Received += n
+	return md5Hash, sha256Hash, copyErr, nil
+}
+
+func cancelUpload(c *gin.Context, kind string) {
+	session, ok := loadUpload(c, kind)
+	if !ok {
+		return
+	}
+	token, err := claimUpload(&session)
+	if err == nil && completedFileID(session) != nil {
+		releaseUpload(session.ID, token)
+		err = errUploadComplete
+	}
+	if err == nil {
+		if err = config.DB.Delete(&session).Error; err == nil {
+			removeStaged(session.ID)
+		}
+	}
+	switch {
+	case errors.Is(err, errUploadBusy):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errUploadComplete):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "file_id": *completedFileID(session)})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Upload cancelled"})
+}
+
+func uploadWholeFile(c *gin.Context, kind string) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	userID, _ := middleware.CurrentUserID(c)
+	accountID, _ := middleware.CurrentServiceAccountID(c)
+	session := models.UploadSession{ID: newUploadID(), Kind: kind, UserID: userID, ServiceAccountID: accountID}
+
+	var md5Sum, sha256Sum string
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if part.FormName() != "file" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			switch part.FormName() {
+			case "sample_id":
+				session.SampleID, _ = strconv.Atoi(string(value))
+			case "genome_id":
+				session.GenomeID, _ = strconv.Atoi(string(value))
+			case "file_type":
+				session.FileType = string(value)
+			case "md5":
+				session.ExpectedMD5 = strings.ToLower(string(value))
+			case "sha256":
+				session.ExpectedSHA256 = strings.ToLower(string(value))
+			}
+			continue
+		}
+
+		if session.FileType == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "file_type must be sent before the file"})
+			return
+		}
+		if session.FileType, err = filetype.Normalize(session.FileType, fileTypes[kind]); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkUploadTarget(kind, session.SampleID, session.GenomeID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error() + "; form fields must be sent before the file"})
+			return
+		}
+		session.FileName = part.FileName()
+		if md5Sum, sha256Sum, err = stageWholeFile(&session, part); err != nil {
+			removeStaged(session.ID)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		break
+	}
+	if session.Size == 0 {
+		removeStaged(session.ID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A non-empty file part is required"})
+		return
+	}
+	finishUpload(c, &session, md5Sum, sha256Sum, false)
+}
+
+// stageWholeFile copies a single-request upload to the staging area, hashing it on the way
+func stageWholeFile(session *models.UploadSession, r io.Reader) (md5Sum, sha256Sum string, err error) {
+	f, err := os.Create(stagingPath(session.ID))
+	if err != nil {
+		return "", "", err
+	}
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, md5Hash, sha256Hash), r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", "", err
+	}
+	session.Size, session.Received = n, n
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+func removeStaged(id string) {
+	if err := os.Remove(stagingPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Warn().Err(err).Str("upload_id", id).Msg("failed to remove staged upload")
+	}
+}
+
+// finishUpload checks the staged bytes against the expected checksums, moves
+// them to storage under their content key and registers the file with the
+// checksums the server computed. persisted is false for single-request
+// uploads, which have no upload_sessions row.
+func finishUpload(c *gin.Context, session *models.UploadSession, md5Sum, sha256Sum string, persisted bool) {
+	// discard drops an upload whose bytes are refused, so it has to start over
+	discard := func() {
+		if persisted {
+			if err := config.DB.Delete(session).Error; err != nil {
+				log.Warn().Err(err).Str("upload_id", session.ID).Msg("failed to delete upload")
+			}
+		}
+		removeStaged(session.ID)
+	}
+	if (session.ExpectedMD5 != "" && session.ExpectedMD5 != md5Sum) ||
+		(session.ExpectedSHA256 != "" && session.ExpectedSHA256 != sha256Sum) {
+		discard()
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Checksum mismatch", "md5": md5Sum, "sha256": sha256Sum})
+		return
+	}
+
+	// Check the content is what it was declared as, and the header agrees
+	// with the sample and genome, before storing anything
+	want, err := headercheck.Expect(config.DB, session.SampleID, session.GenomeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	staged, err := os.Open(stagingPath(session.ID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	content, err := sniff(staged)
+	if err == nil {
+		_, err = staged.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		staged.Close()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !contentMatches(c, session.FileType, content) {
+		staged.Close()
+		discard()
+		return
+	}
+	report := headercheck.Check(staged, headercheck.Format(session.FileType, session.FileName), want)
+	staged.Close()
+	var headerStatus string
+	var headerReport models.JSON
+	if !applyHeaderCheck(c, report, &headerStatus, &headerReport) {
+		discard()
+		return
+	}
+
+	key := storage.ContentKey(sha256Sum)
+	stage := func(ctx context.Context) error {
+		return storePayload(ctx, key, stagingPath(session.ID), session.Size)
+	}
+	// Store outside the transaction so a long upload doesn't hold a database
+	// connection; storing again under the payload lock is then a cheap check
+	// that a concurrent delete didn't remove the object in between
+	if err := stage(c.Request.Context()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("store upload: %v", err)})
+		return
+	}
+
+	var uploadedBy *int
+	if session.UserID != 0 {
+		uploadedBy = &session.UserID
+	}
+	now := time.Now()
+	var created interface{}
+	queued := false // an ingest job was queued for the new file
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, key); err != nil {
+			return err
+		}
+		if err := stage(c.Request.Context()); err != nil {
+			return err
+		}
+		switch session.Kind {
+		case models.UploadVariantFile:
+			file := models.VariantFile{
+				SampleID: session.SampleID, GenomeID: session.GenomeID, FilePath: key, FileName: session.FileName, FileType: session.FileType,
+				Checksum: sha256Sum, MD5: md5Sum, SizeBytes: session.Size, UploadedBy: uploadedBy, UploadedAt: now,
+				HeaderStatus: headerStatus, HeaderReport: headerReport,
+			}
+			if err := tx.Create(&file).Error; err != nil {
+				return err
+			}
+			session.VariantFileID = &file.ID
+			if err := recordAudit(tx, c, audit.ActionCreate, audit.ResourceVariantFile, file.ID, nil, file); err != nil {
+				return err
+			}
+			if ingest.IsVCF(file) {
+				if _, err := ingest.Enqueue(tx, models.IngestVariants, file.ID); err != nil {
+					return err
+				}
+				file.IngestStatus = models.IngestQueued
+				queued = true
+			}
+			if ingest.IsVCF(file) && content.Compression == filetype.BGZF {
+				if _, err := ingest.Enqueue(tx, models.IngestVariantIndex, file.ID); err != nil {
+					return err
+				}
+				file.IndexStatus = models.IngestQueued
+			}
+			created = file
+		default:
+			file := models.SequenceFile{
+				SampleID: session.SampleID, FilePath: key, FileName: session.FileName, FileType: session.FileType,
+				Checksum: sha256Sum, MD5: md5Sum, SizeBytes: session.Size, UploadedBy: uploadedBy, UploadedAt: now,
+				HeaderStatus: headerStatus, HeaderReport: headerReport,
+			}
+			if err := tx.Create(&file).Error; err != nil {
+				return err
+			}
+			session.SequenceFileID = &file.ID
+			if err := recordAudit(tx, c, audit.ActionCreate, audit.ResourceSequenceFile, file.ID, nil, file); err != nil {
+				return err
+			}
+			if ingest.QCFormat(file) != "" {
+				if _, err := ingest.Enqueue(tx, models.IngestQC, file.ID); err != nil {
+					return err
+				}
+				file.QCStatus = models.IngestQueued
+				queued = true
+			}
+			if ingest.QCFormat(file) == "BAM" && content.Compression == filetype.BGZF {
+				if _, err := ingest.Enqueue(tx, models.IngestSequenceIndex, file.ID); err != nil {
+					return err
+				}
+				file.IndexStatus = models.IngestQueued
+				queued = true
+			}
+			created = file
+		}
+		if !persisted {
+			return nil
+		}
+		// Only one of two requests racing to finish the upload gets to
+		// register its file
+		result := tx.Model(session).Where("sequence_file_id IS NULL AND variant_file_id IS NULL").Updates(map[string]interface{}{
+			"sequence_file_id": session.SequenceFileID,
+			"variant_file_id":  session.VariantFileID,
+		})
+		if result.Error == nil && result.RowsAffected == 0 {
+			return errUploadComplete
+		}
+		return result.Error
+	}); errors.Is(err, errUploadComplete) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	removeStaged(session.ID)
+	if queued {
+		ingest.Notify()
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// StartSequenceUpload godoc
+// @Summary      Start sequence file upload
+// @Description  Start a resumable upload. Send the bytes with PATCH /api/sequence/uploads/{id} in one or more chunks; the sequence file is created when the last byte arrives.
+// @Tags         sequence
+// @Accept       json
+// @Produce      json
+// @Param        upload  body  StartUploadInput  true  "File info and total size"
+// @Success      201  {object}  models.UploadSession
+// @Failure      400  {object}  map[string]string
+// @Router       /api/sequence/uploads [post]
+func StartSequenceUpload(c *gin.Context) {
+	startUpload(c, models.UploadSequenceFile)
+}
+
+// GetSequenceUpload godoc
+// @Summary      Get sequence file upload
+// @Description  Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.
+// @Tags         sequence
+// @Produce      json
+// @Param        id   path      string  true  "Upload ID"
+// @Success      200  {object}  models.UploadSession
+// @Failure      404  {object}  map[string]string
+// @Router       /api/sequence/uploads/{id} [get]
+// @Router       /api/sequence/uploads/{id} [head]
+func GetSequenceUpload(c *gin.Context) {
+	getUpload(c, models.UploadSequenceFile)
+}
+
+// AppendSequenceUpload godoc
+// @Summary      Upload sequence file chunk
+// @Description  Append the request body to an upload. Upload-Offset must equal the bytes received so far (see HEAD); if the transfer drops, ask again and resume from there. Returns 204 while bytes are missing and 201 with the new sequence file after the last chunk. Content that isn't the declared file_type is refused with 422. A BAM whose header doesn't match the sample's genome or donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.
+// @Tags         sequence
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        id             path    string  true  "Upload ID"
+// @Param        Upload-Offset  header  int     true  "Byte offset of this chunk"
+// @Success      201  {object}  models.SequenceFile
+// @Success      204
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      410  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /api/sequence/uploads/{id} [patch]
+func AppendSequenceUpload(c *gin.Context) {
+	appendUpload(c, models.UploadSequenceFile)
+}
+
+// CancelSequenceUpload godoc
+// @Summary      Cancel sequence file upload
+// @Description  Abandon an unfinished upload and discard the bytes received so far
+// @Tags         sequence
+// @Produce      json
+// @Param        id   path      string  true  "Upload ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/sequence/uploads/{id} [delete]
+func CancelSequenceUpload(c *gin.Context) {
+	cancelUpload(c, models.UploadSequenceFile)
+}
+
+// UploadSequenceFile godoc
+// @Summary      Upload sequence file
+// @Description  Upload a whole file in one multipart request. The sample_id and file_type fields (and optional md5/sha256) must come before the file part. Use the resumable upload routes for large files. Content that isn't the declared file_type is refused with 422. A BAM whose header doesn't match the sample's genome or donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.
+// @Tags         sequence
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        sample_id  formData  int     true   "Sample ID"
+// @Param        file_type  formData  string  true   "File type: FASTQ, BAM or CRAM"
+// @Param        md5        formData  string  false  "Expected MD5, hex"
+// @Param        sha256     formData  string  false  "Expected SHA-256, hex"
+// @Param        file       formData  file    true   "File contents"
+// @Success      201  {object}  models.SequenceFile
+// @Failure      400  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /api/sequence/upload [post]
+func UploadSequenceFile(c *gin.Context) {
+	uploadWholeFile(c, models.UploadSequenceFile)
+}
+
+// StartVariantUpload godoc
+// @Summary      Start variant file upload
+// @Description  Start a resumable upload; genome_id is required. Send the bytes with PATCH /api/variants/uploads/{id} in one or more chunks; the variant file is created when the last byte arrives.
+// @Tags         variants
+// @Accept       json
+// @Produce      json
+// @Param        upload  body  StartUploadInput  true  "File info and total size"
+// @Success      201  {object}  models.UploadSession
+// @Failure      400  {object}  map[string]string
+// @Router       /api/variants/uploads [post]
+func StartVariantUpload(c *gin.Context) {
+	startUpload(c, models.UploadVariantFile)
+}
+
+// GetVariantUpload godoc
+// @Summary      Get variant file upload
+// @Description  Get the progress of an upload. The number of bytes received, which is where the next chunk must start, is also sent in the Upload-Offset header, so HEAD works too.
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      string  true  "Upload ID"
+// @Success      200  {object}  models.UploadSession
+// @Failure      404  {object}  map[string]string
+// @Router       /api/variants/uploads/{id} [get]
+// @Router       /api/variants/uploads/{id} [head]
+func GetVariantUpload(c *gin.Context) {
+	getUpload(c, models.UploadVariantFile)
+}
+
+// AppendVariantUpload godoc
+// @Summary      Upload variant file chunk
+// @Description  Append the request body to an upload. Upload-Offset must equal the bytes received so far (see HEAD). Returns 204 while bytes are missing and 201 with the new variant file after the last chunk. Content that isn't the declared file_type is refused with 422. A VCF whose header doesn't match the genome or the sample's donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.
+// @Tags         variants
+// @Accept       application/octet-stream
+// @Produce      json
+// @Param        id             path    string  true  "Upload ID"
+// @Param        Upload-Offset  header  int     true  "Byte offset of this chunk"
+// @Success      201  {object}  models.VariantFile
+// @Success      204
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      410  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /api/variants/uploads/{id} [patch]
+func AppendVariantUpload(c *gin.Context) {
+	appendUpload(c, models.UploadVariantFile)
+}
+
+// CancelVariantUpload godoc
+// @Summary      Cancel variant file upload
+// @Description  Abandon an unfinished upload and discard the bytes received so far
+// @Tags         variants
+// @Produce      json
+// @Param        id   path      string  true  "Upload ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Router       /api/variants/uploads/{id} [delete]
+func CancelVariantUpload(c *gin.Context) {
+	cancelUpload(c, models.UploadVariantFile)
+}
+
+// UploadVariantFile godoc
+// @Summary      Upload variant file
+// @Description  Upload a whole file in one multipart request. The sample_id, genome_id and file_type fields (and optional md5/sha256) must come before the file part. Content that isn't the declared file_type is refused with 422. A VCF whose header doesn't match the genome or the sample's donor ID is refused with 422 and its header_report, unless HEADER_VALIDATION=flag.
+// @Tags         variants
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        sample_id  formData  int     true   "Sample ID"
+// @Param        genome_id  formData  int     true   "Reference genome ID"
+// @Param        file_type  formData  string  true   "File type: VCF, JSON or GFF"
+// @Param        md5        formData  string  false  "Expected MD5, hex"
+// @Param        sha256     formData  string  false  "Expected SHA-256, hex"
+// @Param        file       formData  file    true   "File contents"
+// @Success      201  {object}  models.VariantFile
+// @Failure      400  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
+// @Router       /api/variants/upload [post]
+func UploadVariantFile(c *gin.Context) {
+	uploadWholeFile(c, models.UploadVariantFile)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/models"
+	"genomic-api/storage"
+)
+
+// droppedBody sends some bytes and then fails like a dropped connection
+type droppedBody struct {
+	r io.Reader
+}
+
+func (b *droppedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+func uploadRouter() http.Handler {
+	r := testRouter()
+	r.POST("/api/sequence/uploads", StartSequenceUpload)
+	r.HEAD("/api/sequence/uploads/:id", GetSequenceUpload)
+	r.PATCH("/api/sequence/uploads/:id", AppendSequenceUpload)
+	return r
+}
+
+func startTestUpload(t *testing.T, r http.Handler, sampleID int, content []byte) models.UploadSession {
+	t.Helper()
+	sum := sha256.Sum256(content)
+	body, _ := json.Marshal(StartUploadInput{
+		SampleID: sampleID, FileType: "FASTQ", FileName: "reads.fastq",
+		Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:]),
+	})
+	w := serve(r, httptest.NewRequest(http.MethodPost, "/api/sequence/uploads", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("start upload: %d %s", w.Code, w.Body)
+	}
+	var session models.UploadSession
+	json.Unmarshal(w.Body.Bytes(), &session)
+	return session
+}
+
+func patchChunk(r http.Handler, id string, offset int, body io.Reader) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/sequence/uploads/"+id, body)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	return serve(r, req)
+}
+
+func TestUploadResumesAfterPartialChunk(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	r := uploadRouter()
+	content := []byte(strings.Repeat("@read\nACGTACGTAC\n+\nIIIIIIIIII\n", 20))
+	session := startTestUpload(t, r, sample.ID, content)
+
+	// The connection drops 100 bytes into the first chunk
+	w := patchChunk(r, session.ID, 0, &droppedBody{bytes.NewReader(content[:100])})
+	if w.Code != http.StatusBadRequest || w.Header().Get("Upload-Offset") != "100" {
+		t.Fatalf("interrupted chunk: %d offset %q %s", w.Code, w.Header().Get("Upload-Offset"), w.Body)
+	}
+	// A request that died before saving its progress left bytes behind
+	staged, err := os.OpenFile(stagingPath(session.ID), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staged.WriteString("garbage")
+	staged.Close()
+
+	w = serve(r, httptest.NewRequest(http.MethodHead, "/api/sequence/uploads/"+session.ID, nil))
+	if got := w.Header().Get("Upload-Offset"); got != "100" {
+		t.Fatalf("HEAD Upload-Offset = %q, want 100", got)
+	}
+	if w = patchChunk(r, session.ID, 0, bytes.NewReader(content)); w.Code != http.StatusConflict {
+		t.Fatalf("chunk at a stale offset: %d %s", w.Code, w.Body)
+	}
+	if w = patchChunk(r, session.ID, 100, bytes.NewReader(content[100:200])); w.Code != http.StatusNoContent {
+		t.Fatalf("second chunk: %d %s", w.Code, w.Body)
+	}
+	w = patchChunk(r, session.ID, 200, bytes.NewReader(content[200:]))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("last chunk: %d %s", w.Code, w.Body)
+	}
+
+	var file models.SequenceFile
+	json.Unmarshal(w.Body.Bytes(), &file)
+	sum := sha256.Sum256(content)
+	if file.Checksum != hex.EncodeToString(sum[:]) || file.SizeBytes != int64(len(content)) {
+		t.Fatalf("file checksum %s size %d, want %x size %d", file.Checksum, file.SizeBytes, sum, len(content))
+	}
+	stored, err := storage.Default.Get(context.Background(), file.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stored.Close()
+	if got, _ := io.ReadAll(stored); !bytes.Equal(got, content) {
+		t.Fatal("stored payload differs from the uploaded bytes")
+	}
+	if _, err := os.Stat(stagingPath(session.ID)); !os.IsNotExist(err) {
+		t.Fatalf("staging file left behind: %v", err)
+	}
+}
+
+func TestUploadChunkRefusedWhileLeased(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	r := uploadRouter()
+	content := []byte("@read\nACGT\n+\nIIII\n")
+	session := startTestUpload(t, r, sample.ID, content)
+
+	// Another instance is receiving a chunk of the same upload
+	leased := models.UploadSession{ID: session.ID}
+	token, err := claimUpload(&leased)
+	if err != nil {
+		t.Fatalf("claim upload: %v", err)
+	}
+	if w := patchChunk(r, session.ID, 0, bytes.NewReader(content)); w.Code != http.StatusConflict {
+		t.Fatalf("chunk while leased: %d %s", w.Code, w.Body)
+	}
+	// A lease that lapsed without being renewed can be taken over
+	db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Update("locked_until", time.Now().Add(-time.Second))
+	if w := patchChunk(r, session.ID, 0, bytes.NewReader(content)); w.Code != http.StatusCreated {
+		t.Fatalf("chunk after the lease lapsed: %d %s", w.Code, w.Body)
+	}
+	if err := renewUpload(session.ID, token); !errors.Is(err, errUploadBusy) {
+		t.Fatalf("renewing a lease taken over = %v, want errUploadBusy", err)
+	}
+}
+
+func TestUploadChunkStreamsOutsideTransaction(t *testing.T) {
+	db := useTestDB(t)
+	sample := createTestSample(t, db)
+	r := uploadRouter()
+	content := []byte(strings.Repeat("@read\nACGTACGTAC\n+\nIIIIIIIIII\n", 20))
+	session := startTestUpload(t, r, sample.ID, content)
+
+	// The client sends 100 bytes and then stalls
+	body, client := io.Pipe()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- patchChunk(r, session.ID, 0, body) }()
+	client.Write(content[:100])
+
+	// Nothing waits on the stalled request: other requests go ahead, and
+	// the session row isn't locked
+	if w := serve(r, httptest.NewRequest(http.MethodHead, "/api/sequence/uploads/"+session.ID, nil)); w.Code != http.StatusOK {
+		t.Fatalf("HEAD during a chunk: %d", w.Code)
+	}
+	var idle int64
+	db.Raw("SELECT count(*) FROM pg_stat_activity WHERE datname = current_database() AND state = 'idle in transaction' AND query LIKE '%upload_sessions%'").Scan(&idle)
+	if idle != 0 {
+		t.Errorf("%d connections idle in transaction during a chunk", idle)
+	}
+	if w := patchChunk(r, session.ID, 0, bytes.NewReader(content)); w.Code != http.StatusConflict {
+		t.Fatalf("second chunk during the first: %d %s", w.Code, w.Body)
+	}
+
+	// The lease is lost while the client stalls, so its bytes aren't saved
+	db.Model(&models.UploadSession{}).Where("id = ?", session.ID).Update("lock_token", "another-request")
+	client.Close()
+	if w := <-done; w.Code != http.StatusConflict {
+		t.Fatalf("chunk after losing the lease: %d %s", w.Code, w.Body)
+	}
+	var saved models.UploadSession
+	db.First(&saved, "id = ?", session.ID)
+	if saved.Received != 0 {
+		t.Errorf("received = %d after losing the lease, want 0", saved.Received)
+	}
+}
@@ -4,44 +4,109 @@ import (
 	"net/http"
 	"strconv"
 
+	"genomic-api/audit"
 	"genomic-api/config"
+	"genomic-api/middleware"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// userList is what ListUsers can filter and sort on
+var userList = listSpec{
+	filters: map[string]filter{
+		"email":          {expr: "email = ?"},
+		"role":           {expr: "role = ?"},
+		"created_after":  {expr: "created_at >= ?", kind: timeParam},
+		"created_before": {expr: "created_at < ?", kind: timeParam},
+	},
+	sorts: map[string]string{
+		"id": "id", "email": "email", "role": "role", "created_at": "created_at",
+	},
+	defaultSort: "id",
+}
+
 // ListUsers godoc
 // @Summary      List users
-// @Description  Get all users
+// @Description  Get users a page at a time. The total is returned in X-Total-Count and page links in Link.
 // @Tags         users
 // @Produce      json
-// @Success      200  {array}  models.User
+// @Param        email           query  string  false  "Email"
+// @Param        role            query  string  false  "Role"
+// @Param        created_after   query  string  false  "Created at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        created_before  query  string  false  "Created before (RFC 3339 or YYYY-MM-DD)"
+// @Param        sort            query  string  false  "Comma-separated keys: id, email, role, created_at; prefix - for descending"
+// @Param        page            query  int     false  "Page number, from 1"
+// @Param        per_page        query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.User
+// @Failure      400  {object}  map[string]string
 // @Router       /api/users [get]
 func ListUsers(c *gin.Context) {
 	var users []models.User
-	if err := config.DB.Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, users)
+	listPage(c, config.DB.Model(&models.User{}), userList, &users)
+}
+
+// CreateUserInput is the request body for creating a user
+type CreateUserInput struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+	Role     string `json:"role" binding:"omitempty,oneof=admin researcher lab_technician guest"`
+}
+
+// UpdateUserInput is the request body for updating a user; omitted fields are left unchanged
+type UpdateUserInput struct {
+	Email    string `json:"email" binding:"omitempty,email"`
+	Password string `json:"password" binding:"omitempty,min=8,max=72"`
+	Role     string `json:"role" binding:"omitempty,oneof=admin researcher lab_technician guest"`
+}
+
+// ChangePasswordInput is the request body for changing your own password
+type ChangePasswordInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8,max=72"`
+}
+
+// ResetPasswordInput is the request body for an admin password reset
+type ResetPasswordInput struct {
+	NewPassword string `json:"new_password" binding:"required,min=8,max=72"`
 }
 
 // CreateUser godoc
 // @Summary      Create user
-// @Description  Add a new user
+// @Description  Add a new user; the password is stored as a salted hash
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        user  body  models.User  true  "User info"
+// @Param        user  body  CreateUserInput  true  "User info"
 // @Success      201  {object}  models.User
 // @Router       /api/users [post]
 func CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var input CreateUserInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Create(&user).Error; err != nil {
+	hash, err := middleware.HashPassword(input.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+	// New accounts get the least privileged role unless one is given
+	if input.Role == "" {
+		input.Role = models.RoleGuest
+	}
+	user := models.User{
+		Email:        input.Email,
+		PasswordHash: hash,
+		Role:         input.Role,
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceUser, user.ID, nil, user)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -69,12 +134,12 @@ func GetUser(c *gin.Context) {
 
 // UpdateUser godoc
 // @Summary      Update user
-// @Description  Update user by ID
+// @Description  Update user by ID; a supplied password is re-hashed and logs the user out everywhere
 // @Tags         users
 // @Accept       json
 // @Produce      json
-// @Param        id    path      int        true  "User ID"
-// @Param        user  body      models.User true  "User info"
+// @Param        id    path      int              true  "User ID"
+// @Param        user  body      UpdateUserInput  true  "User info"
 // @Success      200   {object}  models.User
 // @Failure      404   {object}  map[string]string
 // @Router       /api/users/{id} [put]
@@ -85,11 +150,37 @@ func UpdateUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	if err := c.ShouldBindJSON(&user); err != nil {
+	before := user
+	input := UpdateUserInput{Email: user.Email, Role: user.Role}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Save(&user).Error; err != nil {
+	user.Email = input.Email
+	user.Role = input.Role
+	if input.Password != "" {
+		hash, err := middleware.HashPassword(input.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+			return
+		}
+		user.PasswordHash = hash
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		var extra map[string]interface{}
+		if input.Password != "" {
+			// Sessions opened with the old password shouldn't outlive it
+			if err := middleware.RevokeUserSessions(tx, user.ID); err != nil {
+				return err
+			}
+			// The hash never reaches the audit trail, so note that it changed
+			extra = map[string]interface{}{"password_changed": true}
+		}
+		return audit.Record(tx, auditEntry(c, audit.ActionUpdate, audit.ResourceUser, user.ID, before, user, extra))
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -98,7 +189,7 @@ func UpdateUser(c *gin.Context) {
 
 // DeleteUser godoc
 // @Summary      Delete user
-// @Description  Delete user by ID
+// @Description  Delete user by ID; their sessions are revoked
 // @Tags         users
 // @Produce      json
 // @Param        id   path      int  true  "User ID"
@@ -107,9 +198,153 @@ func UpdateUser(c *gin.Context) {
 // @Router       /api/users/{id} [delete]
 func DeleteUser(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := config.DB.Delete(&models.User{}, id).Error; err != nil {
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Revoke first: the user's refresh tokens go with them, and the
+		// revocations of their access tokens have to stay behind
+		if err := middleware.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceUser, user.ID, user, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
 }
+
+// ChangePassword godoc
+// @Summary      Change own password
+// @Description  Change the password of the logged-in user; requires the current password. Every other session of the user is logged out.
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        password  body      ChangePasswordInput  true  "Current and new password"
+// @Success      200       {object}  map[string]string
+// @Failure      401       {object}  map[string]string
+// @Router       /api/me/password [put]
+func ChangePassword(c *gin.Context) {
+	userID, ok := middleware.CurrentUserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	var input ChangePasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var user models.User
+	if err := config.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if ok, _ := middleware.CheckPassword(user.PasswordHash, input.CurrentPassword); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+	hash, err := middleware.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":        hash,
+			"must_change_password": false,
+		}).Error; err != nil {
+			return err
+		}
+		// Other sessions may be someone who learnt the old password
+		if err := middleware.RevokeOtherSessions(tx, user.ID, middleware.CurrentSessionID(c)); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionPasswordChange, audit.ResourceUser, user.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed"})
+}
+
+// ResetPassword godoc
+// @Summary      Reset user password
+// @Description  Set a new password for a user and require them to change it at next login
+// @Tags         users
+// @Accept       json
+// @Produce      json
+// @Param        id        path      int                 true  "User ID"
+// @Param        password  body      ResetPasswordInput  true  "New password"
+// @Success      200       {object}  map[string]string
+// @Failure      404       {object}  map[string]string
+// @Router       /api/users/{id}/reset-password [post]
+func ResetPassword(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hash, err := middleware.HashPassword(input.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not hash password"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":        hash,
+			"must_change_password": true,
+		}).Error; err != nil {
+			return err
+		}
+		// Sessions opened with the old password shouldn't outlive the reset
+		if err := middleware.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionPasswordReset, audit.ResourceUser, user.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset"})
+}
+
+// RevokeUserSessions godoc
+// @Summary      Revoke user sessions
+// @Description  Log a user out everywhere: revoke all refresh tokens and reject all outstanding access tokens
+// @Tags         users
+// @Produce      json
+// @Param        id   path      int  true  "User ID"
+// @Success      200  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Router       /api/users/{id}/revoke-sessions [post]
+func RevokeUserSessions(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	var user models.User
+	if err := config.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := middleware.RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionRevokeSessions, audit.ResourceUser, user.ID, nil, nil)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "User sessions revoked"})
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"genomic-api/binning"
+	"genomic-api/config"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// region is a stretch of one chromosome, 1-based and inclusive; End is 0
+// for "to the end of the chromosome"
+type region struct {
+	Chrom      string
+	Start, End int64
+}
+
+// parseRegion accepts samtools-style regions: chr17, chr17:43044295 (from
+// there on) and chr17:43,044,295-43,125,483
+func parseRegion(value string) (region, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return region{}, errors.New("region is required, e.g. chr17:43044295-43125483")
+	}
+	r := region{Chrom: value, Start: 1}
+	// Contig names can themselves contain colons (HLA-A*01:01:01:01), so
+	// only treat the last one as a separator if what follows is a range
+	colon := strings.LastIndexByte(value, ':')
+	if colon <= 0 {
+		return r, nil
+	}
+	span := strings.ReplaceAll(value[colon+1:], ",", "")
+	startText, endText, hasEnd := strings.Cut(span, "-")
+	start, err := strconv.ParseInt(startText, 10, 64)
+	if err != nil {
+		return r, nil
+	}
+	var end int64
+	if hasEnd && endText != "" {
+		if end, err = strconv.ParseInt(endText, 10, 64); err != nil {
+			return region{}, fmt.Errorf("invalid region end %q", endText)
+		}
+	}
+	if start < 1 || (end != 0 && end < start) {
+		return region{}, fmt.Errorf("invalid region %q: positions are 1-based and start must not be after end", value)
+	}
+	return region{Chrom: value[:colon], Start: start, End: end}, nil
+}
+
+// chromNames is a chromosome under both the UCSC ("chr17") and Ensembl
+// ("17") naming conventions, so files from either match
+func chromNames(chrom string) []string {
+	if trimmed := strings.TrimPrefix(chrom, "chr"); trimmed != chrom {
+		return []string{chrom, trimmed}
+	}
+	return []string{chrom, "chr" + chrom}
+}
+
+// ingestedVariants is every variant record whose file was ingested in full;
+// records of a file still being ingested are left out
+func ingestedVariants() *gorm.DB {
+	return config.DB.Model(&models.Variant{}).Where("variant_file_id IN (?)",
+		config.DB.Model(&models.VariantFile{}).Select("id").Where("ingest_status = ?", models.IngestSucceeded))
+}
+
+// inRegion narrows a variants query to the records overlapping r
+func inRegion(query *gorm.DB, r region) *gorm.DB {
+	query = query.Where("chrom IN ?", chromNames(r.Chrom))
+	switch {
+	case r.End > 0:
+		// Only the bins that can hold an overlapping record are read
+		query = query.Where("bin IN ? AND pos <= ? AND end_pos >= ?", binning.Overlapping(r.Start-1, r.End), r.End, r.Start)
+	case r.Start > 1:
+		query = query.Where("end_pos >= ?", r.Start)
+	}
+	return query
+}
+
+// variantQueryFilters are the optional filters of QueryVariants
+var variantQueryFilters = listSpec{
+	filters: map[string]filter{
+		"sample_id":       {expr: "sample_id = ?", kind: intParam},
+		"genome_id":       {expr: "genome_id = ?", kind: intParam},
+		"cohort_id":       {expr: "sample_id IN (SELECT sample_id FROM cohort_samples WHERE cohort_id = ?)", kind: intParam},
+		"variant_file_id": {expr: "variant_file_id = ?", kind: intParam},
+		"min_qual":        {expr: "qual >= ?", kind: floatParam},
+		"filter":          {expr: "filter = ?"},
+		"genotype":        {expr: "replace(genotype, '|', '/') = replace(?, '|', '/')"},
+		"ref":             {expr: "ref = upper(?)"},
+		"alt":             {expr: "upper(?) = ANY(string_to_array(alt, ','))"},
+		"vcf_id":          {expr: "vcf_id = ?"},
+	},
+}
+
+// QueryVariants godoc
+// @Summary      Query variants by region
+// @Description  Stream the ingested variant records overlapping a genomic region, sorted by position, as a JSON array or as VCF. Chromosome names match with or without the chr prefix. Region lookups use a binning index, so they stay fast across many samples.
+// @Tags         variants
+// @Produce      json
+// @Produce      text/vcf
+// @Param        region           query  string  true   "Region: chr17, chr17:43044295 or chr17:43044295-43125483 (1-based, inclusive)"
+// @Param        sample_id        query  int     false  "Only this sample"
+// @Param        genome_id        query  int     false  "Only this reference genome"
+// @Param        cohort_id        query  int     false  "Only samples in this cohort"
+// @Param        variant_file_id  query  int     false  "Only this variant file"
+// @Param        min_qual         query  number  false  "Minimum QUAL"
+// @Param        filter           query  string  false  "FILTER value, e.g. PASS"
+// @Param        genotype         query  string  false  "GT of the record's sample, e.g. 0/1 (phased and unphased match)"
+// @Param        ref              query  string  false  "Reference allele"
+// @Param        alt              query  string  false  "One of the alternate alleles"
+// @Param        vcf_id           query  string  false  "VCF ID, e.g. rs80357906"
+// @Param        limit            query  int     false  "Return at most this many records"
+// @Param        format           query  string  false  "json (default) or vcf"
+// @Success      200  {array}   models.Variant
+// @Failure      400  {object}  map[string]string
+// @Router       /api/variants/query [get]
+func QueryVariants(c *gin.Context) {
+	r, err := parseRegion(c.Query("region"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "vcf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or vcf"})
+		return
+	}
+
+	query, err := variantQueryFilters.applyFilters(c, inRegion(ingestedVariants(), r))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit: must be a positive integer"})
+			return
+		}
+		query = query.Limit(limit)
+	}
+
+	// Stream rows straight to the client; a whole chromosome across a large
+	// cohort won't fit in memory
+	rows, err := query.Order("pos, end_pos, id").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer rows.Close()
+
+	next := func() (*models.Variant, error) {
+		if !rows.Next() {
+			return nil, rows.Err()
+		}
+		var variant models.Variant
+		err := config.DB.ScanRows(rows, &variant)
+		return &variant, err
+	}
+	if format == "vcf" {
+		writeVariantsVCF(c, next)
+		return
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	out := bufio.NewWriter(c.Writer)
+	defer out.Flush()
+	encoder := json.NewEncoder(out)
+	out.WriteString("[")
+	for n := 0; ; n++ {
+		variant, err := next()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if variant == nil {
+			break
+		}
+		if n > 0 {
+			out.WriteString(",")
+		}
+		if err := encoder.Encode(variant); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+	out.WriteString("]\n")
+}
+
+// writeVariantsVCF writes records as VCF. Each line is one stored record,
+// tagged with the sample and variant file it came from. When the query is
+// for one sample its genotype is included as a sample column.
+func writeVariantsVCF(c *gin.Context, next func() (*models.Variant, error)) {
+	header := []string{
+		"##fileformat=VCFv4.2",
+		"##source=genomic-api",
+	}
+	if genomeID, err := strconv.Atoi(c.Query("genome_id")); err == nil {
+		var genome models.Genome
+		if config.DB.First(&genome, genomeID).Error == nil && genome.ReferenceVersion != "" {
+			header = append(header, "##reference="+genome.ReferenceVersion)
+		}
+	}
+	header = append(header,
+		`##INFO=<ID=SAMPLE_ID,Number=1,Type=Integer,Description="Sample the record belongs to">`,
+		`##INFO=<ID=VARIANT_FILE_ID,Number=1,Type=Integer,Description="Variant file the record was ingested from">`,
+	)
+	columns := "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO"
+	withSample := false
+	if sampleID, err := strconv.Atoi(c.Query("sample_id")); err == nil {
+		var sample models.Sample
+		if config.DB.First(&sample, sampleID).Error == nil {
+			name := sample.DonorID
+			if name == "" {
+				name = "sample-" + strconv.Itoa(sample.ID)
+			}
+			header = append(header, `##FORMAT=<ID=GT,Number=1,Type=String,Description="Genotype">`)
+			columns += "\tFORMAT\t" + name
+			withSample = true
+		}
+	}
+
+	c.Header("Content-Type", "text/vcf; charset=utf-8")
+	out := bufio.NewWriter(c.Writer)
+	defer out.Flush()
+	for _, line := range header {
+		out.WriteString(line + "\n")
+	}
+	out.WriteString(columns + "\n")
+	for {
+		variant, err := next()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		if variant == nil {
+			return
+		}
+		fields := []string{
+			variant.Chrom,
+			strconv.FormatInt(variant.Pos, 10),
+			orMissing(variant.VcfID),
+			variant.Ref,
+			variant.Alt,
+			".",
+			orMissing(variant.Filter),
+			vcfInfo(variant),
+		}
+		if variant.Qual != nil {
+			fields[5] = strconv.FormatFloat(*variant.Qual, 'g', -1, 64)
+		}
+		if withSample {
+			fields = append(fields, "GT", orMissing(variant.Genotype))
+		}
+		out.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+}
+
+// vcfInfo rebuilds a record's INFO column, in key order, with its provenance
+func vcfInfo(variant *models.Variant) string {
+	var info map[string]interface{}
+	json.Unmarshal(variant.Info, &info)
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]string, 0, len(keys)+2)
+	for _, key := range keys {
+		switch value := info[key].(type) {
+		case bool:
+			if value {
+				entries = append(entries, key)
+			}
+		case string:
+			entries = append(entries, key+"="+value)
+		default:
+			entries = append(entries, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	entries = append(entries,
+		"SAMPLE_ID="+strconv.Itoa(variant.SampleID),
+		"VARIANT_FILE_ID="+strconv.Itoa(variant.VariantFileID))
+	return strings.Join(entries, ";")
+}
+
+// orMissing is value, or the VCF missing value "." if it is empty
+func orMissing(value string) string {
+	if value == "" {
+		return "."
+	}
+	return value
+}
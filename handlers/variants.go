@@ -3,45 +3,120 @@ package handlers
 import (
 	"net/http"
 	"strconv"
+	"time"
 
+	"genomic-api/audit"
 	"genomic-api/config"
+	"genomic-api/filetype"
+	"genomic-api/headercheck"
+	"genomic-api/middleware"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// CreateVariantFileInput is the request body for registering a variant file
+// already in storage. Checksums, size and verification results are recorded
+// by the server, never taken from the client.
+type CreateVariantFileInput struct {
+	SampleID int    `json:"sample_id" binding:"required"`
+	GenomeID int    `json:"genome_id" binding:"required"`
+	FilePath string `json:"file_path" binding:"required"` // storage key
+	FileName string `json:"file_name"`
+	FileType string `json:"file_type" binding:"required"` // VCF, JSON or GFF
+}
+
+// variantFileList is what ListVariants can filter and sort on
+var variantFileList = listSpec{
+	filters: map[string]filter{
+		"sample_id":           {expr: "sample_id = ?", kind: intParam},
+		"genome_id":           {expr: "genome_id = ?", kind: intParam},
+		"file_type":           {expr: "file_type = ?"},
+		"uploaded_by":         {expr: "uploaded_by = ?", kind: intParam},
+		"uploaded_after":      {expr: "uploaded_at >= ?", kind: timeParam},
+		"uploaded_before":     {expr: "uploaded_at < ?", kind: timeParam},
+		"verification_status": {expr: "verification_status = ?"},
+		"ingest_status":       {expr: "ingest_status = ?"},
+		"header_status":       {expr: "header_status = ?"},
+	},
+	sorts: map[string]string{
+		"id": "id", "sample_id": "sample_id", "genome_id": "genome_id",
+		"file_type": "file_type", "uploaded_at": "uploaded_at",
+	},
+	defaultSort: "id",
+}
+
 // ListVariants godoc
 // @Summary      List variant files
-// @Description  Get all variant files
+// @Description  Get variant files a page at a time. The total is returned in X-Total-Count and page links in Link.
 // @Tags         variants
 // @Produce      json
-// @Success      200  {array}  models.VariantFile
+// @Param        sample_id            query  int     false  "Sample ID"
+// @Param        genome_id            query  int     false  "Reference genome ID"
+// @Param        file_type            query  string  false  "File type, e.g. VCF"
+// @Param        uploaded_by          query  int     false  "Uploading user ID"
+// @Param        uploaded_after       query  string  false  "Uploaded at or after (RFC 3339 or YYYY-MM-DD)"
+// @Param        uploaded_before      query  string  false  "Uploaded before (RFC 3339 or YYYY-MM-DD)"
+// @Param        verification_status  query  string  false  "Result of the last checksum verification: ok, mismatch, missing, no_checksum or error"
+// @Param        ingest_status        query  string  false  "VCF ingest status: queued, running, succeeded or failed"
+// @Param        header_status        query  string  false  "Result of the VCF header check: ok, mismatch or unchecked"
+// @Param        sort                 query  string  false  "Comma-separated keys: id, sample_id, genome_id, file_type, uploaded_at; prefix - for descending"
+// @Param        page                 query  int     false  "Page number, from 1"
+// @Param        per_page             query  int     false  "Page size (default 50, max 500)"
+// @Success      200  {array}   models.VariantFile
+// @Failure      400  {object}  map[string]string
 // @Router       /api/variants [get]
 func ListVariants(c *gin.Context) {
 	var variants []models.VariantFile
-	if err := config.DB.Find(&variants).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-	c.JSON(http.StatusOK, variants)
+	listPage(c, config.DB.Model(&models.VariantFile{}), variantFileList, &variants)
 }
 
 // CreateVariant godoc
 // @Summary      Create variant file
-// @Description  Add a new variant file record
+// @Description  Register a file already in storage as a variant file. file_type must be VCF, JSON or GFF (GFF3; common spellings such as vcf.gz are accepted and normalized); a stored file whose content is something else is refused with 422. A stored VCF's header is checked against the genome and the sample's donor ID; mismatches are refused with 422 unless HEADER_VALIDATION=flag. The size is read from storage; checksums are only recorded for uploads.
 // @Tags         variants
 // @Accept       json
 // @Produce      json
-// @Param        variant_file  body  models.VariantFile  true  "Variant file info"
+// @Param        variant_file  body  CreateVariantFileInput  true  "Variant file info"
 // @Success      201  {object}  models.VariantFile
+// @Failure      400  {object}  map[string]string
+// @Failure      422  {object}  map[string]interface{}
 // @Router       /api/variants [post]
 func CreateVariant(c *gin.Context) {
-	var variant models.VariantFile
-	if err := c.ShouldBindJSON(&variant); err != nil {
+	var input CreateVariantFileInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if err := config.DB.Create(&variant).Error; err != nil {
+	variant := models.VariantFile{
+		SampleID: input.SampleID, GenomeID: input.GenomeID, FilePath: input.FilePath, FileName: input.FileName, FileType: input.FileType,
+		SizeBytes: storedSize(c.Request.Context(), input.FilePath), UploadedAt: time.Now(),
+	}
+	if userID, ok := middleware.CurrentUserID(c); ok {
+		variant.UploadedBy = &userID
+	}
+	if !normalizeFileType(c, &variant.FileType, filetype.Variant) || !checkContent(c, variant.FilePath, variant.FileType) {
+		return
+	}
+	report, err := headercheck.CheckStored(c.Request.Context(), config.DB, variant.FilePath,
+		headerFormat(variant.FileType, variant.FileName, variant.FilePath), variant.SampleID, variant.GenomeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !applyHeaderCheck(c, report, &variant.HeaderStatus, &variant.HeaderReport) {
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPayload(tx, variant.FilePath); err != nil {
+			return err
+		}
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionCreate, audit.ResourceVariantFile, variant.ID, nil, variant)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -77,9 +152,21 @@ func GetSampleVariants(c *gin.Context) {
 // @Router       /api/variants/{id} [delete]
 func DeleteVariant(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	if err := config.DB.Delete(&models.VariantFile{}, id).Error; err != nil {
+	var variant models.VariantFile
+	if err := config.DB.First(&variant, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant file not found"})
+		return
+	}
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&variant).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, c, audit.ActionDelete, audit.ResourceVariantFile, variant.ID, variant, nil)
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	releasePayload(c.Request.Context(), variant.FilePath)
+	releasePayload(c.Request.Context(), variant.IndexPath)
 	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted"})
 }
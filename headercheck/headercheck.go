@@ -0,0 +1,285 @@
+// Package headercheck compares the headers of BAM and VCF files with the
+// sample and reference genome they are registered against, to catch
+// mislabelled files: a GRCh37 BAM filed under GRCh38, or one donor's calls
+// filed under another.
+package headercheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+	"genomic-api/models"
+	"genomic-api/storage"
+	"genomic-api/vcf"
+
+	"gorm.io/gorm"
+)
+
+// Results of a check
+const (
+	StatusOK        = "ok"
+	StatusMismatch  = "mismatch"
+	StatusUnchecked = "unchecked" // not a BAM or VCF, or its header couldn't be read
+)
+
+// What an issue is about
+const (
+	CheckContig = "contig" // BAM @SQ or VCF ##contig against the genome's contigs
+	CheckSample = "sample" // BAM @RG SM or VCF sample column against the donor ID
+)
+
+// maxIssues is how many issues a report lists
+const maxIssues = 100
+
+// Issue is a way a header disagrees with the file's sample or genome
+type Issue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// Report is the outcome of checking one file
+type Report struct {
+	Status     string   `json:"status"`
+	Format     string   `json:"format,omitempty"` // BAM or VCF
+	Genome     string   `json:"genome,omitempty"`
+	Contigs    int      `json:"contigs"` // contigs the header declares
+	Samples    []string `json:"samples"` // VCF sample columns or @RG SM values
+	IssueCount int      `json:"issue_count"`
+	Issues     []Issue  `json:"issues"`   // the first mismatches found
+	Warnings   []string `json:"warnings"` // what couldn't be checked, and why
+}
+
+func (r *Report) addIssue(check, format string, args ...interface{}) {
+	r.IssueCount++
+	if len(r.Issues) < maxIssues {
+		r.Issues = append(r.Issues, Issue{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Expected is what a file's header should agree with
+type Expected struct {
+	DonorID string
+	Genome  string          // reference version or name, for messages; empty without a genome
+	Contigs []models.Contig // empty when the genome's FASTA isn't indexed
+}
+
+// Expect loads what a file of the sample should declare. genomeID is the
+// genome a variant file was called against; 0 means the sample's genome,
+// which its reads are aligned to.
+func Expect(db *gorm.DB, sampleID, genomeID int) (Expected, error) {
+	var want Expected
+	var sample models.Sample
+	if err := db.Limit(1).Find(&sample, sampleID).Error; err != nil {
+		return want, err
+	}
+	want.DonorID = sample.DonorID
+	if genomeID == 0 {
+		genomeID = sample.GenomeID
+	}
+	var genome models.Genome
+	if err := db.Limit(1).Find(&genome, genomeID).Error; err != nil {
+		return want, err
+	}
+	if genome.ID == 0 {
+		return want, nil
+	}
+	want.Genome = genome.ReferenceVersion
+	if want.Genome == "" {
+		want.Genome = genome.Name
+	}
+	if genome.ReferenceStatus == models.IngestSucceeded {
+		if err := db.Where("genome_id = ?", genome.ID).Order("id").Find(&want.Contigs).Error; err != nil {
+			return want, err
+		}
+	}
+	return want, nil
+}
+
+// Format is the header format of a file going by its declared type or, failing
+// that, its name: BAM, VCF, or "" for files whose headers aren't checked
+func Format(fileType, fileName string) string {
+	fileType, fileName = strings.ToUpper(strings.TrimSpace(fileType)), strings.ToLower(fileName)
+	switch {
+	case fileType == "BAM" || (fileType == "" && strings.HasSuffix(fileName, ".bam")):
+		return "BAM"
+	case fileType == "VCF":
+		return "VCF"
+	}
+	if fileType == "" {
+		for _, suffix := range []string{".vcf", ".vcf.gz", ".vcf.bgz"} {
+			if strings.HasSuffix(fileName, suffix) {
+				return "VCF"
+			}
+		}
+	}
+	return ""
+}
+
+// declaredContig is a contig as a header declares it
+type declaredContig struct {
+	name   string
+	length int64  // 0 when not given
+	md5    string // empty when not given
+}
+
+// Check reads the header of a file in the given format from r and compares
+// it with want
+func Check(r io.Reader, format string, want Expected) Report {
+	report := newReport(format, want)
+	var contigs []declaredContig
+	switch format {
+	case "BAM":
+		header, err := bam.ReadHeader(bgzf.NewReader(r))
+		if err != nil {
+			report.warn("could not read the BAM header: %v", err)
+			return report
+		}
+		md5s := map[string]string{}
+		for _, sq := range header.Lines("@SQ") {
+			md5s[sq["SN"]] = sq["M5"]
+		}
+		for _, ref := range header.Refs {
+			contigs = append(contigs, declaredContig{name: ref.Name, length: ref.Length, md5: md5s[ref.Name]})
+		}
+		checkContigs(&report, contigs, want)
+		checkReadGroups(&report, header.Lines("@RG"), want)
+	case "VCF":
+		reader, err := vcf.NewReader(r)
+		if err != nil {
+			report.warn("could not read the VCF header: %v", err)
+			return report
+		}
+		header := reader.Header()
+		for _, contig := range header.Contigs() {
+			contigs = append(contigs, declaredContig{name: contig.ID, length: contig.Length, md5: contig.MD5})
+		}
+		checkContigs(&report, contigs, want)
+		checkSampleColumns(&report, header.Samples, want)
+	default:
+		report.warn("only BAM and VCF headers are checked")
+		return report
+	}
+	report.Status = StatusOK
+	if report.IssueCount > 0 {
+		report.Status = StatusMismatch
+	}
+	return report
+}
+
+// CheckStored checks the header of a stored file; a file that can't be read
+// from storage is reported as unchecked
+func CheckStored(ctx context.Context, db *gorm.DB, key, format string, sampleID, genomeID int) (Report, error) {
+	want, err := Expect(db, sampleID, genomeID)
+	if err != nil {
+		return Report{}, err
+	}
+	var body io.ReadCloser = io.NopCloser(strings.NewReader(""))
+	if format != "" {
+		if body, err = storage.Default.Get(ctx, key); err != nil {
+			report := newReport(format, want)
+			report.warn("could not read the file: %v", err)
+			return report, nil
+		}
+	}
+	defer body.Close()
+	return Check(body, format, want), nil
+}
+
+// newReport is an unchecked report, to be filled in
+func newReport(format string, want Expected) Report {
+	return Report{Status: StatusUnchecked, Format: format, Genome: want.Genome, Samples: []string{}, Issues: []Issue{}, Warnings: []string{}}
+}
+
+// checkContigs compares the contigs a header declares with the genome's.
+// Names match with or without a "chr" prefix; lengths and MD5s, where the
+// header gives them, must be equal.
+func checkContigs(report *Report, contigs []declaredContig, want Expected) {
+	report.Contigs = len(contigs)
+	switch {
+	case len(contigs) == 0:
+		report.warn("the header declares no contigs, so they were not checked")
+		return
+	case want.Genome == "":
+		report.warn("the file has no genome, so its contigs were not checked")
+		return
+	case len(want.Contigs) == 0:
+		report.warn("genome %s has no indexed reference FASTA, so contigs were not checked", want.Genome)
+		return
+	}
+	byName := make(map[string]models.Contig, len(want.Contigs))
+	for _, contig := range want.Contigs {
+		byName[contig.Name] = contig
+	}
+	for _, declared := range contigs {
+		ref, ok := byName[declared.name]
+		if !ok {
+			alias := "chr" + declared.name
+			if trimmed := strings.TrimPrefix(declared.name, "chr"); trimmed != declared.name {
+				alias = trimmed
+			}
+			ref, ok = byName[alias]
+		}
+		switch {
+		case !ok:
+			report.addIssue(CheckContig, "%s is not a contig of %s", declared.name, want.Genome)
+		case declared.length != 0 && declared.length != ref.Length:
+			report.addIssue(CheckContig, "%s is %d bp long in the file but %d bp in %s", declared.name, declared.length, ref.Length, want.Genome)
+		case declared.md5 != "" && ref.MD5 != "" && !strings.EqualFold(declared.md5, ref.MD5):
+			report.addIssue(CheckContig, "%s has MD5 %s in the file but %s in %s", declared.name, declared.md5, ref.MD5, want.Genome)
+		}
+	}
+}
+
+// checkSampleColumns looks for the donor among a VCF's sample columns
+func checkSampleColumns(report *Report, samples []string, want Expected) {
+	report.Samples = append(report.Samples, samples...)
+	switch {
+	case len(samples) == 0:
+		report.warn("the VCF has no sample columns, so the sample was not checked")
+	case want.DonorID == "":
+		report.warn("the sample has no donor_id, so sample columns were not checked")
+	case len(samples) == 1 && samples[0] != want.DonorID:
+		report.addIssue(CheckSample, "the VCF sample column is %s but the sample's donor_id is %s", samples[0], want.DonorID)
+	case len(samples) > 1:
+		for _, sample := range samples {
+			if sample == want.DonorID {
+				return
+			}
+		}
+		report.addIssue(CheckSample, "none of the VCF's %d sample columns is the sample's donor_id %s", len(samples), want.DonorID)
+	}
+}
+
+// checkReadGroups checks that every BAM read group's SM is the donor
+func checkReadGroups(report *Report, readGroups []map[string]string, want Expected) {
+	if len(readGroups) == 0 {
+		report.warn("the BAM has no @RG lines, so the sample was not checked")
+		return
+	}
+	seen := map[string]bool{}
+	for _, rg := range readGroups {
+		sm, ok := rg["SM"]
+		switch {
+		case !ok:
+			report.warn("read group %s has no SM tag", rg["ID"])
+			continue
+		case !seen[sm]:
+			seen[sm] = true
+			report.Samples = append(report.Samples, sm)
+		}
+		if want.DonorID != "" && sm != want.DonorID {
+			report.addIssue(CheckSample, "read group %s has SM %s but the sample's donor_id is %s", rg["ID"], sm, want.DonorID)
+		}
+	}
+	if want.DonorID == "" {
+		report.warn("the sample has no donor_id, so read groups were not checked")
+	}
+}
@@ -0,0 +1,237 @@
+package headercheck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"genomic-api/models"
+)
+
+// ../bam/testdata/small.bam declares chr1 (1000 bp, with an M5) and chr2
+// (500 bp), and read groups rg1 and rg2, both of DONOR1
+const smallMD5 = "0123456789abcdef0123456789abcdef"
+
+func grch38(contigs ...models.Contig) Expected {
+	return Expected{DonorID: "DONOR1", Genome: "GRCh38", Contigs: contigs}
+}
+
+var (
+	chr1 = models.Contig{Name: "chr1", Length: 1000, MD5: smallMD5}
+	chr2 = models.Contig{Name: "chr2", Length: 500}
+)
+
+func TestCheckBAM(t *testing.T) {
+	bam, err := os.ReadFile("../bam/testdata/small.bam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name     string
+		want     Expected
+		status   string
+		issues   []Issue
+		warnings []string
+	}{
+		{name: "matching", want: grch38(chr1, chr2), status: StatusOK},
+		{
+			name:   "names without chr",
+			want:   grch38(models.Contig{Name: "1", Length: 1000}, models.Contig{Name: "2", Length: 500}),
+			status: StatusOK,
+		},
+		{
+			name:   "other donor",
+			want:   Expected{DonorID: "DONOR2", Genome: "GRCh38", Contigs: []models.Contig{chr1, chr2}},
+			status: StatusMismatch,
+			issues: []Issue{
+				{CheckSample, "read group rg1 has SM DONOR1 but the sample's donor_id is DONOR2"},
+				{CheckSample, "read group rg2 has SM DONOR1 but the sample's donor_id is DONOR2"},
+			},
+		},
+		{
+			name:   "other genome",
+			want:   grch38(chr1, models.Contig{Name: "chr2", Length: 600}),
+			status: StatusMismatch,
+			issues: []Issue{{CheckContig, "chr2 is 500 bp long in the file but 600 bp in GRCh38"}},
+		},
+		{
+			name:   "other MD5",
+			want:   grch38(models.Contig{Name: "chr1", Length: 1000, MD5: strings.Repeat("f", 32)}, chr2),
+			status: StatusMismatch,
+			issues: []Issue{{CheckContig, fmt.Sprintf("chr1 has MD5 %s in the file but %s in GRCh38", smallMD5, strings.Repeat("f", 32))}},
+		},
+		{
+			name:   "missing contig",
+			want:   grch38(chr1),
+			status: StatusMismatch,
+			issues: []Issue{{CheckContig, "chr2 is not a contig of GRCh38"}},
+		},
+		{
+			name:     "genome not indexed",
+			want:     grch38(),
+			status:   StatusOK,
+			warnings: []string{"genome GRCh38 has no indexed reference FASTA, so contigs were not checked"},
+		},
+		{
+			name:     "no genome",
+			want:     Expected{DonorID: "DONOR1"},
+			status:   StatusOK,
+			warnings: []string{"the file has no genome, so its contigs were not checked"},
+		},
+		{
+			name:     "no donor",
+			want:     Expected{Genome: "GRCh38", Contigs: []models.Contig{chr1, chr2}},
+			status:   StatusOK,
+			warnings: []string{"the sample has no donor_id, so read groups were not checked"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			report := Check(bytes.NewReader(bam), "BAM", test.want)
+			if report.Status != test.status || report.Format != "BAM" || report.Contigs != 2 {
+				t.Errorf("Check = %s, %s with %d contigs; want %s, BAM with 2", report.Status, report.Format, report.Contigs, test.status)
+			}
+			if !reflect.DeepEqual(report.Samples, []string{"DONOR1"}) {
+				t.Errorf("Samples = %q, want DONOR1", report.Samples)
+			}
+			if test.issues == nil {
+				test.issues = []Issue{}
+			}
+			if test.warnings == nil {
+				test.warnings = []string{}
+			}
+			if report.IssueCount != len(test.issues) || !reflect.DeepEqual(report.Issues, test.issues) {
+				t.Errorf("Issues = %d: %v, want %v", report.IssueCount, report.Issues, test.issues)
+			}
+			if !reflect.DeepEqual(report.Warnings, test.warnings) {
+				t.Errorf("Warnings = %q, want %q", report.Warnings, test.warnings)
+			}
+		})
+	}
+}
+
+// testVCF is a VCF header declaring the given contigs and sample columns
+func testVCF(contigs []string, samples ...string) string {
+	var b strings.Builder
+	b.WriteString("##fileformat=VCFv4.2\n")
+	for _, contig := range contigs {
+		fmt.Fprintf(&b, "##contig=<%s>\n", contig)
+	}
+	b.WriteString("#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO")
+	if len(samples) > 0 {
+		b.WriteString("\tFORMAT\t" + strings.Join(samples, "\t"))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func TestCheckVCF(t *testing.T) {
+	contigs := []string{"ID=chr1,length=1000,md5=" + smallMD5, "ID=chr2"}
+	for _, test := range []struct {
+		name     string
+		vcf      string
+		status   string
+		issues   []Issue
+		warnings []string
+	}{
+		{name: "matching", vcf: testVCF(contigs, "DONOR1"), status: StatusOK},
+		{name: "one of several samples", vcf: testVCF(contigs, "DONOR0", "DONOR1"), status: StatusOK},
+		{
+			name:   "other sample",
+			vcf:    testVCF(contigs, "DONOR2"),
+			status: StatusMismatch,
+			issues: []Issue{{CheckSample, "the VCF sample column is DONOR2 but the sample's donor_id is DONOR1"}},
+		},
+		{
+			name:   "none of several samples",
+			vcf:    testVCF(contigs, "DONOR2", "DONOR3"),
+			status: StatusMismatch,
+			issues: []Issue{{CheckSample, "none of the VCF's 2 sample columns is the sample's donor_id DONOR1"}},
+		},
+		{
+			name:     "sites only",
+			vcf:      testVCF(contigs),
+			status:   StatusOK,
+			warnings: []string{"the VCF has no sample columns, so the sample was not checked"},
+		},
+		{
+			name:   "other genome",
+			vcf:    testVCF([]string{"ID=chr1,length=248956422", "ID=chrUn_KI270302v1"}, "DONOR1"),
+			status: StatusMismatch,
+			issues: []Issue{
+				{CheckContig, "chr1 is 248956422 bp long in the file but 1000 bp in GRCh38"},
+				{CheckContig, "chrUn_KI270302v1 is not a contig of GRCh38"},
+			},
+		},
+		{
+			name:     "no contigs",
+			vcf:      testVCF(nil, "DONOR1"),
+			status:   StatusOK,
+			warnings: []string{"the header declares no contigs, so they were not checked"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			report := Check(strings.NewReader(test.vcf), "VCF", grch38(chr1, chr2))
+			if test.issues == nil {
+				test.issues = []Issue{}
+			}
+			if test.warnings == nil {
+				test.warnings = []string{}
+			}
+			if report.Status != test.status || !reflect.DeepEqual(report.Issues, test.issues) || !reflect.DeepEqual(report.Warnings, test.warnings) {
+				t.Errorf("Check = %s, issues %v, warnings %q; want %s, %v, %q", report.Status, report.Issues, report.Warnings,
+					test.status, test.issues, test.warnings)
+			}
+		})
+	}
+}
+
+func TestCheckLimitsIssues(t *testing.T) {
+	var contigs []string
+	for i := 0; i < maxIssues+50; i++ {
+		contigs = append(contigs, fmt.Sprintf("ID=scaffold%d", i))
+	}
+	report := Check(strings.NewReader(testVCF(contigs, "DONOR1")), "VCF", grch38(chr1))
+	if report.IssueCount != maxIssues+50 || len(report.Issues) != maxIssues {
+		t.Errorf("Check gave %d issues, listing %d; want %d, listing %d", report.IssueCount, len(report.Issues), maxIssues+50, maxIssues)
+	}
+}
+
+func TestCheckUnreadable(t *testing.T) {
+	for _, test := range []struct {
+		format  string
+		content string
+		warning string
+	}{
+		{"BAM", "not a BAM", "could not read the BAM header: not a BAM file"},
+		{"", "anything", "only BAM and VCF headers are checked"},
+	} {
+		report := Check(strings.NewReader(test.content), test.format, grch38(chr1))
+		if report.Status != StatusUnchecked || len(report.Warnings) != 1 || !strings.HasPrefix(report.Warnings[0], test.warning) {
+			t.Errorf("Check(%q) = %s, warnings %q; want unchecked, %q", test.format, report.Status, report.Warnings, test.warning)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, test := range []struct {
+		fileType, fileName, want string
+	}{
+		{"BAM", "reads", "BAM"},
+		{" bam ", "reads.cram", "BAM"},
+		{"", "reads.BAM", "BAM"},
+		{"CRAM", "reads.bam", ""},
+		{"VCF", "calls.txt", "VCF"},
+		{"", "calls.vcf", "VCF"},
+		{"", "calls.vcf.gz", "VCF"},
+		{"", "calls.vcf.bgz", "VCF"},
+		{"FASTQ", "calls.vcf", ""},
+		{"", "reads.fastq.gz", ""},
+	} {
+		if got := Format(test.fileType, test.fileName); got != test.want {
+			t.Errorf("Format(%q, %q) = %q, want %q", test.fileType, test.fileName, got, test.want)
+		}
+	}
+}
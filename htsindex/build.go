@@ -0,0 +1,185 @@
+package htsindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"genomic-api/bgzf"
+	"genomic-api/binning"
+)
+
+// pseudoBin holds a reference's record counts and offsets in BAI and TBI
+// indexes built with the SAM scheme
+const pseudoBin = 37450
+
+// linearShift is the size of a linear index window, 16 kb
+const linearShift = 14
+
+// Builder builds a BAI or TBI index from records added in file order
+type Builder struct {
+	refs     []builtReference
+	ref      int   // reference of the last placed record, -1 before the first
+	beg      int64 // its start
+	unplaced uint64
+}
+
+// builtReference is the index of one reference sequence as it is built
+type builtReference struct {
+	bins             map[uint32][]Chunk
+	linear           []bgzf.Offset // 0 for windows no record has reached yet
+	first, last      bgzf.Offset   // start of its first record, end of its last
+	mapped, unmapped uint64
+}
+
+// NewBuilder starts an index of a file with the given number of reference
+// sequences; TBI indexes add them as records name them
+func NewBuilder(refs int) *Builder {
+	b := &Builder{refs: make([]builtReference, refs), ref: -1}
+	for i := range b.refs {
+		b.refs[i].bins = map[uint32][]Chunk{}
+	}
+	return b
+}
+
+// Add indexes the record between virtual offsets start and stop, covering
+// [beg, end) of reference ref, 0-based. Records without a position have a
+// ref of -1 and come after all the others. Records must be sorted by
+// reference and then start.
+func (b *Builder) Add(ref int, beg, end int64, mapped bool, start, stop bgzf.Offset) error {
+	if ref < 0 {
+		b.unplaced++
+		return nil
+	}
+	if b.unplaced > 0 {
+		return fmt.Errorf("not sorted by coordinate: a record at %d on reference %d follows unplaced records", beg+1, ref)
+	}
+	if ref < b.ref || ref == b.ref && beg < b.beg {
+		return fmt.Errorf("not sorted by coordinate: a record at %d follows one at %d", beg+1, b.beg+1)
+	}
+	if beg < 0 {
+		beg = 0
+	}
+	if end <= beg {
+		end = beg + 1
+	}
+	for ref >= len(b.refs) {
+		b.refs = append(b.refs, builtReference{bins: map[uint32][]Chunk{}})
+	}
+	b.ref, b.beg = ref, beg
+
+	r := &b.refs[ref]
+	if r.mapped+r.unmapped == 0 {
+		r.first = start
+	}
+	r.last = stop
+	if mapped {
+		r.mapped++
+	} else {
+		r.unmapped++
+	}
+
+	// A record in the same block as the end of its bin's last chunk extends it
+	bin := uint32(binning.For(beg, end))
+	chunks := r.bins[bin]
+	if n := len(chunks); n > 0 && chunks[n-1].End.Block() >= start.Block() {
+		chunks[n-1].End = stop
+	} else {
+		r.bins[bin] = append(chunks, Chunk{start, stop})
+	}
+
+	last := (end - 1) >> linearShift
+	if last >= binning.MaxPos>>linearShift {
+		last = binning.MaxPos>>linearShift - 1
+	}
+	for w := beg >> linearShift; w <= last; w++ {
+		for int64(len(r.linear)) <= w {
+			r.linear = append(r.linear, 0)
+		}
+		if r.linear[w] == 0 {
+			r.linear[w] = start
+		}
+	}
+	return nil
+}
+
+// WriteBAI writes the index as a BAI
+func (b *Builder) WriteBAI(w io.Writer) error {
+	var out bytes.Buffer
+	out.WriteString("BAI\x01")
+	binary.Write(&out, binary.LittleEndian, int32(len(b.refs)))
+	b.encodeReferences(&out)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// WriteTBI writes the index as a bgzip-compressed TBI of a VCF whose
+// reference sequences are names, in the order records first named them
+func (b *Builder) WriteTBI(w io.Writer, names []string) error {
+	if len(names) != len(b.refs) {
+		return fmt.Errorf("%d names for %d references", len(names), len(b.refs))
+	}
+	var joined bytes.Buffer
+	for _, name := range names {
+		joined.WriteString(name)
+		joined.WriteByte(0)
+	}
+	var out bytes.Buffer
+	out.WriteString("TBI\x01")
+	// references, format (VCF), sequence, start and end columns, meta
+	// character and lines skipped, then the names
+	for _, field := range []int32{int32(len(names)), 2, 1, 2, 0, '#', 0, int32(joined.Len())} {
+		binary.Write(&out, binary.LittleEndian, field)
+	}
+	out.Write(joined.Bytes())
+	b.encodeReferences(&out)
+	if _, err := w.Write(bgzf.Compress(out.Bytes())); err != nil {
+		return err
+	}
+	_, err := w.Write(bgzf.EOF)
+	return err
+}
+
+// encodeReferences writes the bins and linear index of each reference, and
+// the count of unplaced records
+func (b *Builder) encodeReferences(out *bytes.Buffer) {
+	le := binary.LittleEndian
+	for _, r := range b.refs {
+		bins := make([]uint32, 0, len(r.bins))
+		for bin := range r.bins {
+			bins = append(bins, bin)
+		}
+		sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+		count := len(bins)
+		if r.mapped+r.unmapped > 0 {
+			count++
+		}
+		binary.Write(out, le, int32(count))
+		for _, bin := range bins {
+			binary.Write(out, le, bin)
+			binary.Write(out, le, int32(len(r.bins[bin])))
+			for _, chunk := range r.bins[bin] {
+				binary.Write(out, le, [2]uint64{uint64(chunk.Beg), uint64(chunk.End)})
+			}
+		}
+		if r.mapped+r.unmapped > 0 {
+			binary.Write(out, le, uint32(pseudoBin))
+			binary.Write(out, le, int32(2))
+			binary.Write(out, le, [4]uint64{uint64(r.first), uint64(r.last), r.mapped, r.unmapped})
+		}
+
+		// Windows no record reaches start where the previous one did
+		binary.Write(out, le, int32(len(r.linear)))
+		var previous bgzf.Offset
+		for _, offset := range r.linear {
+			if offset == 0 {
+				offset = previous
+			}
+			binary.Write(out, le, uint64(offset))
+			previous = offset
+		}
+	}
+	binary.Write(out, le, b.unplaced)
+}
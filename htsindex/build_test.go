@@ -0,0 +1,248 @@
+package htsindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"testing"
+
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+)
+
+// span is where one record lies in the file and on its reference
+type span struct {
+	ref         int
+	beg, end    int64
+	start, stop bgzf.Offset
+}
+
+// indexBAM indexes a BAM as ingest does, returning the BAI and the records
+func indexBAM(t *testing.T, name string) ([]byte, []span) {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	reader := bgzf.NewReader(bufio.NewReader(f))
+	header, err := bam.ReadHeader(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewBuilder(len(header.Refs))
+	var records []span
+	for {
+		start := reader.Offset()
+		a, err := bam.ReadAlignment(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := span{int(a.RefID), int64(a.Pos), int64(a.End), start, reader.Offset()}
+		if err := builder.Add(s.ref, s.beg, s.end, a.Flag&bam.FlagUnmapped == 0, s.start, s.stop); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		records = append(records, s)
+	}
+	var bai bytes.Buffer
+	if err := builder.WriteBAI(&bai); err != nil {
+		t.Fatal(err)
+	}
+	return bai.Bytes(), records
+}
+
+// within reports whether offset is in one of chunks
+func within(offset bgzf.Offset, chunks []Chunk) bool {
+	for _, chunk := range chunks {
+		if chunk.Beg <= offset && offset < chunk.End {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBuildBAI(t *testing.T) {
+	// ../bam/testdata/small.bam has five records on chr1, four on chr2 and
+	// one unplaced; the third straddles its two record blocks
+	bai, records := indexBAM(t, "../bam/testdata/small.bam")
+	ix, err := Read(bytes.NewReader(bai))
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if ix.Format != "BAI" || ix.Refs() != 2 {
+		t.Fatalf("Read = %s with %d references, want BAI with 2", ix.Format, ix.Refs())
+	}
+	// Each reference's records run on from one another, so make one chunk
+	for ref, want := range [][]Chunk{
+		{{records[0].start, records[4].stop}},
+		{{records[5].start, records[8].stop}},
+	} {
+		if got := ix.Query(ref, 0, 0); !reflect.DeepEqual(got, want) {
+			t.Errorf("Query(%d, 0, 0) = %v, want %v", ref, got, want)
+		}
+	}
+	if end := ix.End(); end != records[8].stop {
+		t.Errorf("End = %s, want %s", end, records[8].stop)
+	}
+	if unplaced := binary.LittleEndian.Uint64(bai[len(bai)-8:]); unplaced != 1 {
+		t.Errorf("%d unplaced records, want 1", unplaced)
+	}
+
+	for _, q := range []struct {
+		ref      int
+		beg, end int64
+	}{
+		{0, 0, 100}, {0, 150, 250}, {0, 399, 400}, {0, 304, 305}, {1, 25, 30}, {1, 48, 0},
+	} {
+		chunks := ix.Query(q.ref, q.beg, q.end)
+		for i, r := range records {
+			if r.ref == q.ref && r.end > q.beg && (q.end == 0 || r.beg < q.end) && !within(r.start, chunks) {
+				t.Errorf("Query(%d, %d, %d) = %v misses record %d at %s", q.ref, q.beg, q.end, chunks, i+1, r.start)
+			}
+		}
+	}
+}
+
+func TestBuildTBI(t *testing.T) {
+	// chr1:16000 spans two windows, so sits in the 128 kb bin 585
+	blocks := [][]span{
+		{{0, 99, 100, 0, 0}, {0, 15999, 17000, 0, 0}},
+		{{0, 59999, 60000, 0, 0}},
+		{{1, 99, 100, 0, 0}},
+	}
+	names := []string{"chr1", "chr2"}
+	vcf := bgzf.Compress([]byte("##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n"))
+	for _, block := range blocks {
+		var text bytes.Buffer
+		for _, r := range block {
+			fmt.Fprintf(&text, "%s\t%d\t.\tA\tC\t.\t.\tEND=%d\n", names[r.ref], r.beg+1, r.end)
+		}
+		vcf = append(vcf, bgzf.Compress(text.Bytes())...)
+	}
+	vcf = append(vcf, bgzf.EOF...)
+
+	reader := bgzf.NewReader(bytes.NewReader(vcf))
+	builder := NewBuilder(0)
+	var records []span
+	for _, block := range blocks {
+		for _, r := range block {
+			r.start = reader.Offset()
+			line, err := reader.ReadBytes('\n')
+			for len(line) > 0 && line[0] == '#' {
+				r.start = reader.Offset()
+				line, err = reader.ReadBytes('\n')
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.stop = reader.Offset()
+			if err := builder.Add(r.ref, r.beg, r.end, true, r.start, r.stop); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			records = append(records, r)
+		}
+	}
+	var tbi bytes.Buffer
+	if err := builder.WriteTBI(&tbi, names); err != nil {
+		t.Fatalf("WriteTBI: %v", err)
+	}
+	ix, err := Read(&tbi)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if ix.Format != "TBI" || !reflect.DeepEqual(ix.Names, names) {
+		t.Fatalf("Read = %s of %q, want TBI of %q", ix.Format, ix.Names, names)
+	}
+
+	chunk := func(first, last int) Chunk { return Chunk{records[first].start, records[last].stop} }
+	for _, test := range []struct {
+		ref      int
+		beg, end int64
+		want     []Chunk
+	}{
+		{0, 0, 0, []Chunk{chunk(0, 2)}},
+		{0, 100, 15000, []Chunk{chunk(0, 1)}},
+		// Window 2 has no record of its own, so starts where window 1 does
+		{0, 40000, 40001, []Chunk{chunk(1, 1)}},
+		// chr1:16000's chunk ends before window 3's first record
+		{0, 60000, 60001, []Chunk{chunk(2, 2)}},
+		{1, 0, 0, []Chunk{chunk(3, 3)}},
+	} {
+		if got := ix.Query(test.ref, test.beg, test.end); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Query(%d, %d, %d) = %v, want %v", test.ref, test.beg, test.end, got, test.want)
+		}
+	}
+	linear := []bgzf.Offset{records[0].start, records[1].start, records[1].start, records[2].start}
+	if got := ix.refs[0].linear; !reflect.DeepEqual(got, linear) {
+		t.Errorf("linear index %v, want %v", got, linear)
+	}
+
+	if err := builder.WriteTBI(io.Discard, names[:1]); err == nil || err.Error() != "1 names for 2 references" {
+		t.Errorf("WriteTBI with too few names = %v", err)
+	}
+}
+
+func TestBuilderSortErrors(t *testing.T) {
+	type record struct {
+		ref int
+		beg int64
+	}
+	for _, test := range []struct {
+		name    string
+		records []record
+		want    string
+	}{
+		{"earlier position", []record{{0, 100}, {0, 50}}, "not sorted by coordinate: a record at 51 follows one at 101"},
+		{"earlier reference", []record{{1, 100}, {0, 200}}, "not sorted by coordinate: a record at 201 follows one at 101"},
+		{"after unplaced", []record{{0, 100}, {-1, 0}, {1, 10}}, "not sorted by coordinate: a record at 11 on reference 1 follows unplaced records"},
+		{"sorted", []record{{0, 100}, {0, 100}, {1, 0}, {-1, 0}, {-1, 0}}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			b := NewBuilder(2)
+			var err error
+			for _, r := range test.records {
+				if err = b.Add(r.ref, r.beg, r.beg+10, true, 0, 0); err != nil {
+					break
+				}
+			}
+			if (err == nil && test.want != "") || (err != nil && err.Error() != test.want) {
+				t.Errorf("Add = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestBuilderChunks(t *testing.T) {
+	o := bgzf.MakeOffset
+	b := NewBuilder(1)
+	for _, r := range []span{
+		{0, 0, 10, o(0, 0), o(0, 50)},
+		// Ends at the start of the next block
+		{0, 10, 20, o(0, 50), o(100, 0)},
+		// Starts in the block the chunk ends in, so extends it
+		{0, 20, 30, o(100, 0), o(100, 40)},
+		// A block further on starts a new chunk
+		{0, 30, 40, o(200, 0), o(200, 40)},
+		// Empty spans count as one base
+		{0, 40, 40, o(200, 40), o(200, 80)},
+	} {
+		if err := b.Add(r.ref, r.beg, r.end, r.beg != r.end, r.start, r.stop); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := b.refs[0]
+	want := map[uint32][]Chunk{4681: {{o(0, 0), o(100, 40)}, {o(200, 0), o(200, 80)}}}
+	if !reflect.DeepEqual(r.bins, want) {
+		t.Errorf("bins = %v, want %v", r.bins, want)
+	}
+	if r.first != o(0, 0) || r.last != o(200, 80) || r.mapped != 4 || r.unmapped != 1 {
+		t.Errorf("pseudo-bin %s to %s, %d mapped, %d unmapped", r.first, r.last, r.mapped, r.unmapped)
+	}
+}
@@ -0,0 +1,112 @@
+package htsindex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CRAIEntry is one line of a CRAI index: the records of one slice on one
+// reference sequence
+type CRAIEntry struct {
+	Ref       int   // position in the CRAM header's @SQ lines, -1 for unplaced reads
+	Start     int64 // 1-based
+	Span      int64
+	Container int64 // file offset of the container holding the slice
+	Slice     int64 // offset of the slice after the container header
+	Size      int64 // bytes in the slice
+}
+
+// CRAI is a parsed CRAI index
+type CRAI []CRAIEntry
+
+// ReadCRAI parses a CRAI index, gzip-compressed or not
+func ReadCRAI(r io.Reader) (CRAI, error) {
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		buffered = bufio.NewReader(gz)
+	}
+	var index CRAI
+	scanner := bufio.NewScanner(buffered)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+		fields := strings.Split(text, "\t")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("CRAI line %d has %d fields, expected 6", line, len(fields))
+		}
+		var values [6]int64
+		for i, field := range fields {
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || (i > 0 && value < 0) {
+				return nil, fmt.Errorf("CRAI line %d: invalid field %q", line, field)
+			}
+			values[i] = value
+		}
+		if values[0] < -1 {
+			return nil, fmt.Errorf("CRAI line %d: invalid reference %d", line, values[0])
+		}
+		index = append(index, CRAIEntry{
+			Ref: int(values[0]), Start: values[1], Span: values[2],
+			Container: values[3], Slice: values[4], Size: values[5],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read CRAI index: %w", err)
+	}
+	return index, nil
+}
+
+// Containers returns the file offsets, in order, of the containers with
+// records of reference ref overlapping [beg, end), 0-based; an end of 0
+// means the end of the reference. A ref of -1 selects unplaced reads.
+func (ix CRAI) Containers(ref int, beg, end int64) []int64 {
+	seen := map[int64]bool{}
+	var offsets []int64
+	for _, entry := range ix {
+		if entry.Ref != ref || seen[entry.Container] {
+			continue
+		}
+		if ref >= 0 {
+			entryBeg, span := entry.Start-1, entry.Span
+			if span < 1 {
+				span = 1
+			}
+			if (end > 0 && entryBeg >= end) || entryBeg+span <= beg {
+				continue
+			}
+		}
+		seen[entry.Container] = true
+		offsets = append(offsets, entry.Container)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// Offsets returns the file offset of every container, in order
+func (ix CRAI) Offsets() []int64 {
+	offsets := make([]int64, 0, len(ix))
+	for _, entry := range ix {
+		offsets = append(offsets, entry.Container)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	unique := offsets[:0]
+	for _, offset := range offsets {
+		if len(unique) == 0 || offset != unique[len(unique)-1] {
+			unique = append(unique, offset)
+		}
+	}
+	return unique
+}
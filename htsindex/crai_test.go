@@ -0,0 +1,104 @@
+package htsindex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/small.cram.crai indexes the data containers of
+// ../cram/testdata/small.cram, at offsets 241 and 301: the first holds a
+// slice of chr1, the second two slices of chr2 and one of unplaced reads
+var smallCRAI = CRAI{
+	{Ref: 0, Start: 10001, Span: 5000, Container: 241, Slice: 0, Size: 40},
+	{Ref: 1, Start: 2, Span: 150000, Container: 301, Slice: 0, Size: 30},
+	{Ref: 1, Start: 150002, Span: 150000, Container: 301, Slice: 30, Size: 30},
+	{Ref: -1, Start: 0, Span: 0, Container: 301, Slice: 60, Size: 0},
+}
+
+func TestReadCRAI(t *testing.T) {
+	compressed, err := os.ReadFile("testdata/small.cram.crai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf := bytes.ReplaceAll(plain, []byte("\n"), []byte("\r\n\n"))
+
+	for name, data := range map[string][]byte{"gzip": compressed, "plain": plain, "CRLF and blank lines": crlf} {
+		t.Run(name, func(t *testing.T) {
+			index, err := ReadCRAI(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("ReadCRAI: %v", err)
+			}
+			if !reflect.DeepEqual(index, smallCRAI) {
+				t.Errorf("ReadCRAI = %v, want %v", index, smallCRAI)
+			}
+		})
+	}
+}
+
+func TestCRAIContainers(t *testing.T) {
+	for _, test := range []struct {
+		ref      int
+		beg, end int64
+		want     []int64
+	}{
+		{0, 0, 0, []int64{241}},
+		// chr1's slice covers [10000, 15000)
+		{0, 10000, 10001, []int64{241}},
+		{0, 0, 10000, nil},
+		{0, 14999, 0, []int64{241}},
+		{0, 15000, 0, nil},
+		// Both of chr2's slices are in one container
+		{1, 0, 0, []int64{301}},
+		{1, 200000, 200001, []int64{301}},
+		{1, 300001, 0, nil},
+		{-1, 0, 0, []int64{301}},
+		{2, 0, 0, nil},
+	} {
+		if got := smallCRAI.Containers(test.ref, test.beg, test.end); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Containers(%d, %d, %d) = %v, want %v", test.ref, test.beg, test.end, got, test.want)
+		}
+	}
+
+	// A slice with no span still holds its first position
+	empty := CRAI{{Ref: 0, Start: 100, Span: 0, Container: 5}}
+	if got := empty.Containers(0, 99, 100); !reflect.DeepEqual(got, []int64{5}) {
+		t.Errorf("Containers of an empty slice = %v, want [5]", got)
+	}
+	if got := smallCRAI.Offsets(); !reflect.DeepEqual(got, []int64{241, 301}) {
+		t.Errorf("Offsets = %v, want [241 301]", got)
+	}
+}
+
+func TestReadCRAIErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		crai string
+		want string
+	}{
+		{"too few fields", "0\t1\t100\t26\t0\n", "CRAI line 1 has 5 fields, expected 6"},
+		{"not a number", "0\t1\t100\t26\t0\t40\n0\t1\tx\t26\t0\t40\n", `CRAI line 2: invalid field "x"`},
+		{"negative span", "0\t1\t-100\t26\t0\t40\n", `CRAI line 1: invalid field "-100"`},
+		{"negative reference", "-2\t1\t100\t26\t0\t40\n", "CRAI line 1: invalid reference -2"},
+		{"broken gzip", "\x1f\x8b\x09\x00\x00\x00\x00\x00\x00\xff", "gzip: invalid header"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ReadCRAI(strings.NewReader(test.crai))
+			if err == nil || err.Error() != test.want {
+				t.Errorf("ReadCRAI = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+// Package htsindex reads the BAI, CSI and tabix (TBI) indexes of BGZF
+// files, to find which parts of a BAM or bgzipped VCF hold the records
+// overlapping a region, and the CRAI indexes of CRAM files. It also builds
+// BAI and TBI indexes.
+package htsindex
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"genomic-api/bgzf"
+	"genomic-api/binning"
+)
+
+// Chunk is a run of records between two virtual offsets, End exclusive
+type Chunk struct {
+	Beg, End bgzf.Offset
+}
+
+// Index is a parsed BAI, CSI or TBI index
+type Index struct {
+	Format   string // BAI, CSI or TBI
+	MinShift uint
+	Depth    uint
+	// Names are the reference sequences, in index order. TBI and tabix-style
+	// CSI indexes carry them; for BAI they are in the BAM header instead.
+	Names []string
+	refs  []reference
+}
+
+// reference is the index of one reference sequence
+type reference struct {
+	bins     map[uint32][]Chunk
+	loffsets map[uint32]bgzf.Offset // CSI: first record overlapping each bin
+	linear   []bgzf.Offset          // BAI, TBI: first record in each 16 kb window
+}
+
+// Read parses an index; BGZF-compressed indexes (TBI, CSI) are decompressed
+func Read(r io.Reader) (*Index, error) {
+	buffered := bufio.NewReader(r)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = bufio.NewReader(gz)
+	} else {
+		r = buffered
+	}
+	d := &decoder{r: r}
+	magic := string(d.bytes(4))
+	if d.err != nil {
+		return nil, fmt.Errorf("read index: %w", d.err)
+	}
+	ix := &Index{MinShift: 14, Depth: 5}
+	var refs int
+	switch magic {
+	case "BAI\x01":
+		ix.Format = "BAI"
+	case "TBI\x01":
+		ix.Format = "TBI"
+		refs = d.count(4)
+		ix.Names = d.tabixNames()
+		if d.err == nil && len(ix.Names) != refs {
+			return nil, fmt.Errorf("tabix index has %d names for %d references", len(ix.Names), refs)
+		}
+	case "CSI\x01":
+		ix.Format = "CSI"
+		ix.MinShift, ix.Depth = uint(d.int32()), uint(d.int32())
+		if ix.MinShift+3*ix.Depth > 62 {
+			return nil, fmt.Errorf("CSI index with min_shift %d and depth %d is not supported", ix.MinShift, ix.Depth)
+		}
+		aux := d.bytes(d.int32())
+		if len(aux) >= 28 {
+			ix.Names = (&decoder{r: bytes.NewReader(aux)}).tabixNames()
+		}
+	default:
+		return nil, errors.New("not a BAI, CSI or TBI index")
+	}
+	if ix.Format != "TBI" {
+		refs = d.count(4)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("read %s index: %w", ix.Format, d.err)
+	}
+
+	// The pseudo-bin comes after the last real bin, 37450 at the usual depth
+	pseudoBin := uint32((1<<(3*(ix.Depth+1))-1)/7 + 1)
+	for i := 0; i < refs && d.err == nil; i++ {
+		ref := reference{bins: map[uint32][]Chunk{}}
+		bins := d.count(8)
+		for b := 0; b < bins && d.err == nil; b++ {
+			bin := d.uint32()
+			var loffset bgzf.Offset
+			if ix.Format == "CSI" {
+				loffset = bgzf.Offset(d.uint64())
+			}
+			chunks := make([]Chunk, d.count(16))
+			for c := range chunks {
+				chunks[c] = Chunk{bgzf.Offset(d.uint64()), bgzf.Offset(d.uint64())}
+			}
+			// The pseudo-bin holds read counts, not records
+			if bin == pseudoBin {
+				continue
+			}
+			ref.bins[bin] = chunks
+			if ix.Format == "CSI" {
+				if ref.loffsets == nil {
+					ref.loffsets = map[uint32]bgzf.Offset{}
+				}
+				ref.loffsets[bin] = loffset
+			}
+		}
+		if ix.Format != "CSI" {
+			ref.linear = make([]bgzf.Offset, d.count(8))
+			for w := range ref.linear {
+				ref.linear[w] = bgzf.Offset(d.uint64())
+			}
+		}
+		ix.refs = append(ix.refs, ref)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("read %s index: %w", ix.Format, d.err)
+	}
+	return ix, nil
+}
+
+// Ref is the position of a reference sequence in Names
+func (ix *Index) Ref(name string) (int, bool) {
+	for i, n := range ix.Names {
+		if n == name {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Refs is the number of reference sequences the index covers
+func (ix *Index) Refs() int {
+	return len(ix.refs)
+}
+
+// Query returns the chunks that may hold records of reference ref
+// overlapping [beg, end), 0-based, in file order and merged where they touch.
+// An end of 0 means the end of the reference.
+func (ix *Index) Query(ref int, beg, end int64) []Chunk {
+	if ref < 0 || ref >= len(ix.refs) {
+		return nil
+	}
+	r := ix.refs[ref]
+	if end <= 0 {
+		end = 1 << (ix.MinShift + 3*ix.Depth)
+	}
+
+	// Chunks ending before the first record that could overlap beg are skipped
+	var min bgzf.Offset
+	window := beg >> ix.MinShift
+	if len(r.linear) > 0 {
+		if window >= int64(len(r.linear)) {
+			window = int64(len(r.linear)) - 1
+		}
+		min = r.linear[window]
+	} else if r.loffsets != nil {
+		bin := (1<<(3*ix.Depth)-1)/7 + window
+		for {
+			if offset, ok := r.loffsets[uint32(bin)]; ok {
+				min = offset
+				break
+			}
+			if bin == 0 {
+				break
+			}
+			bin = (bin - 1) >> 3
+		}
+	}
+
+	var chunks []Chunk
+	for _, bin := range binning.OverlappingIn(beg, end, ix.MinShift, ix.Depth) {
+		for _, chunk := range r.bins[uint32(bin)] {
+			if chunk.End > min {
+				chunks = append(chunks, chunk)
+			}
+		}
+	}
+	return merge(chunks)
+}
+
+// End is the virtual offset after the last indexed record. In a BAM file,
+// unmapped reads without a position follow it.
+func (ix *Index) End() bgzf.Offset {
+	var end bgzf.Offset
+	for _, r := range ix.refs {
+		for _, chunks := range r.bins {
+			for _, chunk := range chunks {
+				if chunk.End > end {
+					end = chunk.End
+				}
+			}
+		}
+	}
+	return end
+}
+
+// merge sorts chunks and joins those that overlap or touch
+func merge(chunks []Chunk) []Chunk {
+	if len(chunks) == 0 {
+		return nil
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Beg < chunks[j].Beg })
+	merged := []Chunk{chunks[0]}
+	for _, chunk := range chunks[1:] {
+		last := &merged[len(merged)-1]
+		if chunk.Beg <= last.End {
+			if chunk.End > last.End {
+				last.End = chunk.End
+			}
+			continue
+		}
+		merged = append(merged, chunk)
+	}
+	return merged
+}
+
+// decoder reads little-endian fields, remembering the first error
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > 1<<28 {
+		d.err = fmt.Errorf("implausible length %d", n)
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = err
+		if err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	return buf
+}
+
+func (d *decoder) uint32() uint32 {
+	if buf := d.bytes(4); buf != nil {
+		return binary.LittleEndian.Uint32(buf)
+	}
+	return 0
+}
+
+func (d *decoder) int32() int {
+	return int(int32(d.uint32()))
+}
+
+func (d *decoder) uint64() uint64 {
+	if buf := d.bytes(8); buf != nil {
+		return binary.LittleEndian.Uint64(buf)
+	}
+	return 0
+}
+
+// count reads an item count, checking it against the bytes per item so a
+// corrupt index can't ask for an absurd allocation
+func (d *decoder) count(itemSize int) int {
+	n := d.int32()
+	if d.err == nil && (n < 0 || n > (1<<28)/itemSize) {
+		d.err = fmt.Errorf("implausible count %d", n)
+	}
+	if d.err != nil {
+		return 0
+	}
+	return n
+}
+
+// tabixNames reads the tabix header fields that follow the reference count
+// (format, columns, meta character and skipped lines) and returns the
+// reference names
+func (d *decoder) tabixNames() []string {
+	d.bytes(24)
+	names := d.bytes(d.int32())
+	if len(names) == 0 {
+		return nil
+	}
+	var list []string
+	for _, name := range bytes.Split(bytes.TrimSuffix(names, []byte{0}), []byte{0}) {
+		list = append(list, string(name))
+	}
+	return list
+}
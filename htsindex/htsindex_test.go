@@ -0,0 +1,148 @@
+package htsindex
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+// The indexes in testdata describe the same two references. Reference 0
+// has three bins:
+//
+//	bin 4681 ([0, 16 kb)):      0:100  to 0:500
+//	bin 4682 ([16 kb, 32 kb)):  1000:0 to 1000:300
+//	bin 0 (the whole reference): 0:500  to 1000:0
+//
+// and a linear index of 0:100, 1000:0, 1000:0. The CSI gives each bin's
+// first record instead: 0:100, 1000:0 and 0:100. Reference 1 is empty.
+// Each also has a pseudo-bin whose first "chunk" runs to 2000:0, beyond
+// every record. The TBI and CSI name the references chr1 and chr2.
+var (
+	bin4681 = Chunk{bgzf.MakeOffset(0, 100), bgzf.MakeOffset(0, 500)}
+	bin4682 = Chunk{bgzf.MakeOffset(1000, 0), bgzf.MakeOffset(1000, 300)}
+	bin0    = Chunk{bgzf.MakeOffset(0, 500), bgzf.MakeOffset(1000, 0)}
+)
+
+func readIndex(t *testing.T, name string) *Index {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ix, err := Read(f)
+	if err != nil {
+		t.Fatalf("Read %s: %v", name, err)
+	}
+	return ix
+}
+
+func TestRead(t *testing.T) {
+	for _, test := range []struct {
+		file   string
+		format string
+		names  []string
+		depth  uint
+	}{
+		{"two-refs.bai", "BAI", nil, 5},
+		{"two-refs.vcf.gz.tbi", "TBI", []string{"chr1", "chr2"}, 5},
+		{"two-refs.vcf.gz.csi", "CSI", []string{"chr1", "chr2"}, 5},
+	} {
+		t.Run(test.format, func(t *testing.T) {
+			ix := readIndex(t, test.file)
+			if ix.Format != test.format || ix.MinShift != 14 || ix.Depth != test.depth || !reflect.DeepEqual(ix.Names, test.names) {
+				t.Errorf("Read = %s, min_shift %d, depth %d, names %q", ix.Format, ix.MinShift, ix.Depth, ix.Names)
+			}
+			if ix.Refs() != 2 {
+				t.Errorf("Refs = %d, want 2", ix.Refs())
+			}
+			// The pseudo-bin isn't taken for records
+			if end := ix.End(); end != bin4682.End {
+				t.Errorf("End = %s, want %s", end, bin4682.End)
+			}
+			if ref, ok := ix.Ref("chr2"); test.names != nil && (!ok || ref != 1) {
+				t.Errorf("Ref(chr2) = %d, %v", ref, ok)
+			}
+			if _, ok := ix.Ref("chr3"); ok {
+				t.Error("Ref(chr3) found")
+			}
+		})
+	}
+}
+
+func TestQuery(t *testing.T) {
+	type query struct {
+		ref      int
+		beg, end int64
+		want     []Chunk
+	}
+	shared := []query{
+		// Touching chunks are merged
+		{0, 0, 100, []Chunk{{bin4681.Beg, bin0.End}}},
+		{0, 0, 0, []Chunk{{bin4681.Beg, bin4682.End}}},
+		// The linear index starts the second window at 1000:0, so bin 0's
+		// chunk, which ends there, can't hold anything overlapping it
+		{0, 20000, 20001, []Chunk{bin4682}},
+		{1, 0, 0, nil},
+		{2, 0, 0, nil},
+		{-1, 0, 0, nil},
+	}
+	for _, test := range []struct {
+		file    string
+		queries []query
+	}{
+		{"two-refs.bai", append(shared,
+			query{0, 40000, 40001, nil},
+			// Past the linear index its last window is used
+			query{0, 1 << 20, 0, nil},
+		)},
+		{"two-refs.vcf.gz.tbi", shared},
+		// No bin for the third window; its parents up to bin 0 are tried for
+		// the first record, so bin 0's chunk is kept
+		{"two-refs.vcf.gz.csi", append(shared, query{0, 40000, 40001, []Chunk{bin0}})},
+	} {
+		ix := readIndex(t, test.file)
+		for _, q := range test.queries {
+			if got := ix.Query(q.ref, q.beg, q.end); !reflect.DeepEqual(got, q.want) {
+				t.Errorf("%s: Query(%d, %d, %d) = %v, want %v", ix.Format, q.ref, q.beg, q.end, got, q.want)
+			}
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	o := func(block int64) bgzf.Offset { return bgzf.MakeOffset(block, 0) }
+	got := merge([]Chunk{{o(30), o(40)}, {o(0), o(10)}, {o(5), o(8)}, {o(10), o(20)}, {o(35), o(50)}})
+	want := []Chunk{{o(0), o(20)}, {o(30), o(50)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merge = %v, want %v", got, want)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	bai, err := os.ReadFile("testdata/two-refs.bai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not an index", []byte("BAM\x01\x00\x00\x00\x00"), "not a BAI, CSI or TBI index"},
+		{"empty", nil, "read index"},
+		{"truncated", bai[:50], "read BAI index: unexpected EOF"},
+		{"negative count", []byte("BAI\x01\xff\xff\xff\xff"), "implausible count -1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Read(bytes.NewReader(test.data))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Read = %v, want %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+	"genomic-api/htsindex"
+	"genomic-api/models"
+	"genomic-api/storage"
+	"genomic-api/vcf"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// indexHeartbeatRecords is how often, in records, index progress is reported
+const indexHeartbeatRecords = 100000
+
+// ingestSequenceIndex builds a BAI index of a coordinate-sorted BAM
+func ingestSequenceIndex(ctx context.Context, r *run) error {
+	if r.job.SequenceFileID == nil {
+		return errors.New("job has no sequence file")
+	}
+	var file models.SequenceFile
+	if err := r.db.First(&file, *r.job.SequenceFileID).Error; err != nil {
+		return fmt.Errorf("load sequence file: %w", err)
+	}
+	if QCFormat(file) != "BAM" {
+		r.addError(0, "Indexes are only generated for BAM files; attach a .crai to a CRAM")
+		return nil
+	}
+	// An index attached since the job was queued is kept
+	if indexed, err := hasIndex(r.db, "sequence_file_id", file.ID); err != nil || indexed {
+		return err
+	}
+
+	body, err := storage.Default.Get(ctx, file.FilePath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+	defer body.Close()
+	reader := bgzf.NewReader(bufio.NewReaderSize(body, 1<<16))
+	header, err := bam.ReadHeader(reader)
+	if err != nil {
+		r.addError(0, err.Error())
+		return nil
+	}
+	if hd := header.Lines("@HD"); len(hd) > 0 && hd[0]["SO"] != "" && hd[0]["SO"] != "coordinate" {
+		r.addError(0, fmt.Sprintf("BAM is sorted by %s; only coordinate-sorted BAMs can be indexed", hd[0]["SO"]))
+		return nil
+	}
+
+	builder := htsindex.NewBuilder(len(header.Refs))
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := reader.Offset()
+		alignment, err := bam.ReadAlignment(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.addError(0, fmt.Sprintf("record %d: %v", r.job.Records+1, err))
+			return nil
+		}
+		ref := int(alignment.RefID)
+		if ref >= len(header.Refs) {
+			r.addError(0, fmt.Sprintf("record %d: reference %d is not in the header", r.job.Records+1, ref))
+			return nil
+		}
+		mapped := alignment.Flag&bam.FlagUnmapped == 0
+		err = builder.Add(ref, int64(alignment.Pos), int64(alignment.End), mapped, start, reader.Offset())
+		if err != nil {
+			r.addError(0, fmt.Sprintf("record %d: %v", r.job.Records+1, err))
+			return nil
+		}
+		r.job.Records++
+		if r.job.Records%indexHeartbeatRecords == 0 {
+			if err := r.heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+
+	var index bytes.Buffer
+	if err := builder.WriteBAI(&index); err != nil {
+		return err
+	}
+	return storeIndex(ctx, r, models.IndexFile{SequenceFileID: &file.ID, Format: models.IndexBAI}, file.FileName, index.Bytes())
+}
+
+// ingestVariantIndex builds a tabix index of a bgzipped, sorted VCF
+func ingestVariantIndex(ctx context.Context, r *run) error {
+	if r.job.VariantFileID == nil {
+		return errors.New("job has no variant file")
+	}
+	var file models.VariantFile
+	if err := r.db.First(&file, *r.job.VariantFileID).Error; err != nil {
+		return fmt.Errorf("load variant file: %w", err)
+	}
+	if !IsVCF(file) {
+		r.addError(0, "Indexes are only generated for VCF files")
+		return nil
+	}
+	// An index attached since the job was queued is kept
+	if indexed, err := hasIndex(r.db, "variant_file_id", file.ID); err != nil || indexed {
+		return err
+	}
+
+	body, err := storage.Default.Get(ctx, file.FilePath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+	defer body.Close()
+	buffered := bufio.NewReaderSize(body, 1<<16)
+	if magic, _ := buffered.Peek(18); !bgzf.IsBGZF(magic) {
+		r.addError(0, "Only bgzip-compressed VCFs can be indexed")
+		return nil
+	}
+	reader := bgzf.NewReader(buffered)
+
+	builder := htsindex.NewBuilder(0)
+	var names []string
+	refs := map[string]int{}
+	for line := int64(1); ; line++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := reader.Offset()
+		text, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(text) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		text = bytes.TrimRight(text, "\r\n")
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+		chrom, beg, end, err := vcfSpan(string(text))
+		if err != nil {
+			r.addError(line, err.Error())
+			return nil
+		}
+		ref, ok := refs[chrom]
+		if !ok {
+			ref = len(names)
+			refs[chrom] = ref
+			names = append(names, chrom)
+		} else if ref != len(names)-1 {
+			r.addError(line, fmt.Sprintf("not sorted: a %s record follows %s records", chrom, names[len(names)-1]))
+			return nil
+		}
+		if err := builder.Add(ref, beg, end, true, start, reader.Offset()); err != nil {
+			r.addError(line, err.Error())
+			return nil
+		}
+		r.job.Records++
+		if r.job.Records%indexHeartbeatRecords == 0 {
+			if err := r.heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+
+	var index bytes.Buffer
+	if err := builder.WriteTBI(&index, names); err != nil {
+		return err
+	}
+	return storeIndex(ctx, r, models.IndexFile{VariantFileID: &file.ID, Format: models.IndexTBI}, file.FileName, index.Bytes())
+}
+
+// vcfSpan is the chromosome and 0-based [beg, end) a VCF record covers
+func vcfSpan(line string) (string, int64, int64, error) {
+	fields := strings.SplitN(line, "\t", 9)
+	if len(fields) < 8 {
+		return "", 0, 0, fmt.Errorf("expected at least 8 tab-separated columns, got %d", len(fields))
+	}
+	pos, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || pos < 0 {
+		return "", 0, 0, fmt.Errorf("invalid POS %q", fields[1])
+	}
+	rec := vcf.Record{Pos: pos, Ref: fields[3], Info: map[string]string{}}
+	for _, entry := range strings.Split(fields[7], ";") {
+		if value, ok := strings.CutPrefix(entry, "END="); ok {
+			rec.Info["END"] = value
+		}
+	}
+	return fields[0], pos - 1, rec.End(), nil
+}
+
+// hasIndex reports whether the sequence or variant file with the given ID,
+// by column, already has an index
+func hasIndex(db *gorm.DB, column string, id int) (bool, error) {
+	var count int64
+	err := db.Model(&models.IndexFile{}).Where(column+" = ?", id).Count(&count).Error
+	return count > 0, err
+}
+
+// storeIndex stores a generated index and attaches it to its file, unless
+// an index was attached while the job ran, which is kept
+func storeIndex(ctx context.Context, r *run, index models.IndexFile, dataName string, data []byte) error {
+	sha := sha256.Sum256(data)
+	md5Sum := md5.Sum(data)
+	index.Checksum, index.MD5 = hex.EncodeToString(sha[:]), hex.EncodeToString(md5Sum[:])
+	index.FilePath, index.SizeBytes = storage.ContentKey(index.Checksum), int64(len(data))
+	index.Generated, index.UploadedAt = true, time.Now()
+	if dataName != "" {
+		index.FileName = path.Base(dataName) + "." + strings.ToLower(index.Format)
+	}
+	if info, err := storage.Default.Stat(ctx, index.FilePath); err != nil || info.Size != index.SizeBytes {
+		if err := storage.Default.Put(ctx, index.FilePath, bytes.NewReader(data), index.SizeBytes); err != nil {
+			return fmt.Errorf("store index: %w", err)
+		}
+	}
+
+	var model interface{} = &models.SequenceFile{}
+	column, id := "sequence_file_id", index.SequenceFileID
+	if index.VariantFileID != nil {
+		model, column, id = &models.VariantFile{}, "variant_file_id", index.VariantFileID
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the file so an index can't be attached at the same time
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(model, *id).Error; err != nil {
+			return err
+		}
+		if indexed, err := hasIndex(tx, column, *id); err != nil || indexed {
+			return err
+		}
+		if err := tx.Create(&index).Error; err != nil {
+			return err
+		}
+		return tx.Model(model).Where("id = ?", *id).Update("index_path", index.FilePath).Error
+	})
+}
+
+// finishSequenceIndex records how a sequence file's index generation ended
+func finishSequenceIndex(tx *gorm.DB, job *models.IngestJob, status string) error {
+	if job.SequenceFileID == nil {
+		return nil
+	}
+	return tx.Model(&models.SequenceFile{}).Where("id = ?", *job.SequenceFileID).Update("index_status", status).Error
+}
+
+// finishVariantIndex records how a variant file's index generation ended
+func finishVariantIndex(tx *gorm.DB, job *models.IngestJob, status string) error {
+	if job.VariantFileID == nil {
+		return nil
+	}
+	return tx.Model(&models.VariantFile{}).Where("id = ?", *job.VariantFileID).Update("index_status", status).Error
+}
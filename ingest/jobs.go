@@ -0,0 +1,320 @@
+// Package ingest runs background processing of uploaded files, such as
+// parsing a VCF into variant records. Jobs are rows in ingest_jobs, so any
+// instance can pick them up and they survive restarts.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"genomic-api/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// staleAfter is how long a running job can go without a heartbeat
+	// before it is assumed lost with its instance and run again
+	staleAfter = 10 * time.Minute
+	// maxAttempts is how many times a job is started before giving up
+	maxAttempts = 3
+	// maxReportedErrors is how many errors a job keeps for its report
+	maxReportedErrors = 100
+)
+
+// errJobGone means a job was deleted or claimed by another worker while it ran
+var errJobGone = errors.New("ingest job no longer owned by this worker")
+
+var jobsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "ingest_jobs_total",
+		Help: "Finished ingest jobs by kind and status",
+	},
+	[]string{"kind", "status"},
+)
+
+func init() {
+	prometheus.MustRegister(jobsTotal)
+}
+
+// processor does the work for one kind of job
+type processor struct {
+	// run reports bad input through run.addError and returns an error only
+	// when it can't go on
+	run func(ctx context.Context, r *run) error
+	// finish updates the job's record once the job has succeeded or failed; it
+	// runs in the transaction that records the result
+	finish func(tx *gorm.DB, job *models.IngestJob, status string) error
+	// target is the kind of record the jobs are for
+	target target
+}
+
+// target is a kind of record jobs are queued for, which shows the status of
+// its latest job
+type target struct {
+	model        interface{}
+	column       string // ingest_jobs column holding the record's ID
+	statusColumn string // the record's column holding the job status
+	set          func(job *models.IngestJob, id int)
+}
+
+var (
+	variantFileTarget = target{
+		model: &models.VariantFile{}, column: "variant_file_id", statusColumn: "ingest_status",
+		set: func(job *models.IngestJob, id int) { job.VariantFileID = &id },
+	}
+	genomeTarget = target{
+		model: &models.Genome{}, column: "genome_id", statusColumn: "reference_status",
+		set: func(job *models.IngestJob, id int) { job.GenomeID = &id },
+	}
+	sequenceFileTarget = target{
+		model: &models.SequenceFile{}, column: "sequence_file_id", statusColumn: "qc_status",
+		set: func(job *models.IngestJob, id int) { job.SequenceFileID = &id },
+	}
+	sequenceIndexTarget = target{
+		model: &models.SequenceFile{}, column: "sequence_file_id", statusColumn: "index_status",
+		set: func(job *models.IngestJob, id int) { job.SequenceFileID = &id },
+	}
+	variantIndexTarget = target{
+		model: &models.VariantFile{}, column: "variant_file_id", statusColumn: "index_status",
+		set: func(job *models.IngestJob, id int) { job.VariantFileID = &id },
+	}
+)
+
+var processors = map[string]processor{
+	models.IngestVariants:      {run: ingestVariants, finish: finishVariants, target: variantFileTarget},
+	models.IngestReference:     {run: ingestReference, finish: finishReference, target: genomeTarget},
+	models.IngestQC:            {run: ingestQC, finish: finishQC, target: sequenceFileTarget},
+	models.IngestSequenceIndex: {run: ingestSequenceIndex, finish: finishSequenceIndex, target: sequenceIndexTarget},
+	models.IngestVariantIndex:  {run: ingestVariantIndex, finish: finishVariantIndex, target: variantIndexTarget},
+}
+
+// run is a claimed job being processed
+type run struct {
+	db     *gorm.DB
+	job    *models.IngestJob
+	errors []models.IngestError
+}
+
+// addError counts a problem with the input, keeping the first ones for the report
+func (r *run) addError(line int64, message string) {
+	r.job.ErrorCount++
+	if len(r.errors) < maxReportedErrors {
+		r.errors = append(r.errors, models.IngestError{Line: line, Message: message})
+	}
+}
+
+// report saves progress so far; it returns errJobGone if the job was
+// deleted or reclaimed in the meantime
+func (r *run) report(db *gorm.DB, updates map[string]interface{}) error {
+	errs, err := json.Marshal(r.errors)
+	if err != nil {
+		return err
+	}
+	updates["records"] = r.job.Records
+	updates["error_count"] = r.job.ErrorCount
+	updates["errors"] = models.JSON(errs)
+	updates["updated_at"] = time.Now()
+	result := db.Model(&models.IngestJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", r.job.ID, models.IngestRunning, r.job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errJobGone
+	}
+	return nil
+}
+
+// heartbeat records progress and keeps the job from being reclaimed
+func (r *run) heartbeat() error {
+	return r.report(r.db, map[string]interface{}{})
+}
+
+// Enqueue queues a job of the given kind for the record it works on: a
+// variant file for IngestVariants and IngestVariantIndex, a genome for
+// IngestReference, a sequence file for IngestQC and IngestSequenceIndex
+func Enqueue(tx *gorm.DB, kind string, id int) (models.IngestJob, error) {
+	t := processors[kind].target
+	job := models.IngestJob{Kind: kind, Status: models.IngestQueued}
+	t.set(&job, id)
+	if err := tx.Create(&job).Error; err != nil {
+		return job, err
+	}
+	err := tx.Model(t.model).Where("id = ?", id).Update(t.statusColumn, models.IngestQueued).Error
+	return job, err
+}
+
+// Active returns the queued or running job of the given kind for a record,
+// or gorm.ErrRecordNotFound if there is none
+func Active(db *gorm.DB, kind string, id int) (models.IngestJob, error) {
+	var job models.IngestJob
+	err := db.Where("kind = ? AND "+processors[kind].target.column+" = ? AND status IN ?",
+		kind, id, []string{models.IngestQueued, models.IngestRunning}).
+		Take(&job).Error
+	return job, err
+}
+
+// Latest returns the most recent job of the given kind for a record, or
+// gorm.ErrRecordNotFound if there has been none
+func Latest(db *gorm.DB, kind string, id int) (models.IngestJob, error) {
+	var job models.IngestJob
+	err := db.Where("kind = ? AND "+processors[kind].target.column+" = ?", kind, id).
+		Order("id DESC").Take(&job).Error
+	return job, err
+}
+
+// wake tells this instance's workers a job has been queued, so they don't
+// wait for the next poll
+var wake = make(chan struct{}, 1)
+
+// Notify wakes a worker to look for queued jobs. Call it after the
+// transaction that queued them commits.
+func Notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+// claim takes the oldest queued job, or a running one whose instance stopped
+// sending heartbeats. It returns nil when there is nothing to do.
+func claim(db *gorm.DB) (*models.IngestJob, error) {
+	for {
+		var job models.IngestJob
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? OR (status = ? AND updated_at < ?)",
+					models.IngestQueued, models.IngestRunning, time.Now().Add(-staleAfter)).
+				Order("id").
+				Take(&job).Error
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			job.Attempts++
+			job.Status = models.IngestRunning
+			job.Records, job.ErrorCount, job.Errors = 0, 0, nil
+			job.StartedAt, job.FinishedAt, job.UpdatedAt = &now, nil, now
+			if job.Attempts > maxAttempts {
+				// It keeps taking its instance down with it, or never finishing
+				job.Status = models.IngestFailed
+				job.FinishedAt = &now
+				job.ErrorCount = 1
+				job.Errors = models.JSON(fmt.Sprintf(`[{"message": "gave up after %d attempts"}]`, maxAttempts))
+				if p, ok := processors[job.Kind]; ok {
+					if err := p.finish(tx, &job, job.Status); err != nil {
+						return err
+					}
+				}
+			}
+			return tx.Model(&job).
+				Select("status", "attempts", "records", "error_count", "errors", "started_at", "finished_at", "updated_at").
+				Updates(&job).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if job.Status == models.IngestRunning {
+			return &job, nil
+		}
+		jobsTotal.WithLabelValues(job.Kind, job.Status).Inc()
+		log.Error().Int("job_id", job.ID).Str("kind", job.Kind).Msg("ingest job abandoned")
+	}
+}
+
+// process runs a claimed job and records how it ended
+func process(ctx context.Context, db *gorm.DB, job *models.IngestJob) {
+	r := &run{db: db, job: job}
+	p, ok := processors[job.Kind]
+	var err error
+	if ok {
+		err = p.run(ctx, r)
+	} else {
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	if ctx.Err() != nil || errors.Is(err, errJobGone) {
+		// Shutting down, or the job is no longer ours; whoever has it now
+		// (or the next claim after its heartbeat goes stale) finishes it
+		return
+	}
+	if err != nil {
+		r.addError(0, err.Error())
+	}
+
+	status := models.IngestSucceeded
+	if job.ErrorCount > 0 {
+		status = models.IngestFailed
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := r.report(tx, map[string]interface{}{"status": status, "finished_at": time.Now()}); err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		return p.finish(tx, job, status)
+	})
+	if err != nil {
+		log.Error().Err(err).Int("job_id", job.ID).Msg("failed to record ingest job result")
+		return
+	}
+	jobsTotal.WithLabelValues(job.Kind, status).Inc()
+	event := log.Info()
+	if status != models.IngestSucceeded {
+		event = log.Error()
+	}
+	event.Int("job_id", job.ID).Str("kind", job.Kind).Str("status", status).
+		Int64("records", job.Records).Int("errors", job.ErrorCount).Msg("ingest job finished")
+}
+
+// work processes jobs until none are left, then waits for a Notify or the
+// next poll
+func work(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for ctx.Err() == nil {
+			job, err := claim(db)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to claim ingest job")
+				break
+			}
+			if job == nil {
+				break
+			}
+			process(ctx, db, job)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// Run processes ingest jobs with the given number of workers, polling for
+// jobs queued by other instances every interval, until ctx is cancelled
+func Run(ctx context.Context, db *gorm.DB, workers int, interval time.Duration) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work(ctx, db, interval)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package ingest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"genomic-api/models"
+	"genomic-api/testdb"
+
+	"gorm.io/gorm"
+)
+
+// queueVariantJob registers a variant file and queues an ingest job for it
+func queueVariantJob(t *testing.T, db *gorm.DB) models.IngestJob {
+	t.Helper()
+	var fileID int
+	if err := db.Raw(`INSERT INTO variant_files (file_path, file_type) VALUES ('variants.vcf', 'VCF') RETURNING id`).Scan(&fileID).Error; err != nil {
+		t.Fatalf("insert variant file: %v", err)
+	}
+	job, err := Enqueue(db, models.IngestVariants, fileID)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return job
+}
+
+func mustClaim(t *testing.T, db *gorm.DB) *models.IngestJob {
+	t.Helper()
+	job, err := claim(db)
+	if err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	return job
+}
+
+func TestClaimTakesOldestQueuedJob(t *testing.T) {
+	db := testdb.Open(t)
+	first := queueVariantJob(t, db)
+	second := queueVariantJob(t, db)
+
+	job := mustClaim(t, db)
+	if job == nil || job.ID != first.ID || job.Status != models.IngestRunning || job.Attempts != 1 || job.StartedAt == nil {
+		t.Fatalf("first claim = %+v, want job %d running on its first attempt", job, first.ID)
+	}
+	if job = mustClaim(t, db); job == nil || job.ID != second.ID {
+		t.Fatalf("second claim = %+v, want job %d", job, second.ID)
+	}
+	// Both are running and sending heartbeats
+	if job = mustClaim(t, db); job != nil {
+		t.Fatalf("third claim = %+v, want nothing", job)
+	}
+}
+
+func TestClaimSkipsLockedJob(t *testing.T) {
+	db := testdb.Open(t)
+	first := queueVariantJob(t, db)
+	second := queueVariantJob(t, db)
+
+	// Another worker is part way through claiming the first job
+	tx := db.Begin()
+	defer tx.Rollback()
+	if err := tx.Exec("SELECT id FROM ingest_jobs WHERE id = ? FOR UPDATE", first.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if job := mustClaim(t, db); job == nil || job.ID != second.ID {
+		t.Fatalf("claim = %+v, want job %d past the locked one", job, second.ID)
+	}
+}
+
+func TestClaimReclaimsStaleJob(t *testing.T) {
+	db := testdb.Open(t)
+	queued := queueVariantJob(t, db)
+	job := mustClaim(t, db)
+	lost := &run{db: db, job: job}
+
+	// Its worker stopped sending heartbeats
+	db.Model(&models.IngestJob{}).Where("id = ?", queued.ID).Update("updated_at", time.Now().Add(-staleAfter-time.Minute))
+	reclaimed := mustClaim(t, db)
+	if reclaimed == nil || reclaimed.ID != queued.ID || reclaimed.Attempts != 2 {
+		t.Fatalf("claim = %+v, want job %d on its second attempt", reclaimed, queued.ID)
+	}
+	if err := lost.heartbeat(); !errors.Is(err, errJobGone) {
+		t.Fatalf("heartbeat of the lost worker = %v, want errJobGone", err)
+	}
+	if err := (&run{db: db, job: reclaimed}).heartbeat(); err != nil {
+		t.Fatalf("heartbeat of the new worker: %v", err)
+	}
+}
+
+func TestClaimGivesUpAfterMaxAttempts(t *testing.T) {
+	db := testdb.Open(t)
+	abandoned := queueVariantJob(t, db)
+	next := queueVariantJob(t, db)
+	db.Model(&models.IngestJob{}).Where("id = ?", abandoned.ID).Updates(map[string]interface{}{
+		"status":     models.IngestRunning,
+		"attempts":   maxAttempts,
+		"updated_at": time.Now().Add(-staleAfter - time.Minute),
+	})
+
+	if job := mustClaim(t, db); job == nil || job.ID != next.ID {
+		t.Fatalf("claim = %+v, want job %d after giving up on %d", job, next.ID, abandoned.ID)
+	}
+	var job models.IngestJob
+	db.First(&job, abandoned.ID)
+	if job.Status != models.IngestFailed || job.FinishedAt == nil || job.ErrorCount != 1 {
+		t.Fatalf("abandoned job = %+v, want failed", job)
+	}
+	var file models.VariantFile
+	db.First(&file, *job.VariantFileID)
+	if file.IngestStatus != models.IngestFailed {
+		t.Fatalf("variant file ingest_status = %q, want failed", file.IngestStatus)
+	}
+}
+
+func TestActiveAndLatest(t *testing.T) {
+	db := testdb.Open(t)
+	queued := queueVariantJob(t, db)
+	fileID := *queued.VariantFileID
+
+	if job, err := Active(db, models.IngestVariants, fileID); err != nil || job.ID != queued.ID {
+		t.Fatalf("Active = %+v, %v; want job %d", job, err, queued.ID)
+	}
+	db.Model(&models.IngestJob{}).Where("id = ?", queued.ID).Update("status", models.IngestSucceeded)
+	if _, err := Active(db, models.IngestVariants, fileID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("Active after the job finished: %v, want ErrRecordNotFound", err)
+	}
+	if job, err := Latest(db, models.IngestVariants, fileID); err != nil || job.ID != queued.ID {
+		t.Fatalf("Latest = %+v, %v; want job %d", job, err, queued.ID)
+	}
+}
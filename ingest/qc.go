@@ -0,0 +1,295 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"genomic-api/bam"
+	"genomic-api/bgzf"
+	"genomic-api/cram"
+	"genomic-api/fastq"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"gorm.io/gorm"
+)
+
+// qcHeartbeatReads is how often, in reads or alignments, QC progress is
+// reported
+const qcHeartbeatReads = 100000
+
+// qcHeartbeatContainers is how often, in containers, CRAM QC progress is
+// reported; a container usually holds about 10,000 records
+const qcHeartbeatContainers = 10
+
+// QCFormat is the format a sequence file's QC metrics are computed for,
+// going by its declared type or, failing that, its name: FASTQ, BAM, CRAM,
+// or "" for files without QC
+func QCFormat(file models.SequenceFile) string {
+	fileType := strings.ToUpper(strings.TrimSpace(file.FileType))
+	switch fileType {
+	case "FASTQ", "BAM", "CRAM":
+		return fileType
+	case "":
+	default:
+		return ""
+	}
+	name := strings.ToLower(file.FileName)
+	for _, suffix := range []string{".fastq", ".fq", ".fastq.gz", ".fq.gz"} {
+		if strings.HasSuffix(name, suffix) {
+			return "FASTQ"
+		}
+	}
+	switch {
+	case strings.HasSuffix(name, ".bam"):
+		return "BAM"
+	case strings.HasSuffix(name, ".cram"):
+		return "CRAM"
+	}
+	return ""
+}
+
+// ingestQC reads a sequence file through and stores its metrics: read
+// metrics for a FASTQ, header and flag counts for a BAM or CRAM. The records
+// after a malformed one can't be trusted, so the first fails the job.
+func ingestQC(ctx context.Context, r *run) error {
+	if r.job.SequenceFileID == nil {
+		return errors.New("job has no sequence file")
+	}
+	var file models.SequenceFile
+	if err := r.db.First(&file, *r.job.SequenceFileID).Error; err != nil {
+		return fmt.Errorf("load sequence file: %w", err)
+	}
+	format := QCFormat(file)
+	if format == "" {
+		r.addError(0, "QC metrics are only computed for FASTQ, BAM and CRAM files")
+		return nil
+	}
+	if err := r.db.Model(&file).Update("qc_status", models.IngestRunning).Error; err != nil {
+		return err
+	}
+	// Start from nothing, so a failed run doesn't leave old metrics behind
+	if err := deleteQCMetrics(r.db, file.ID); err != nil {
+		return err
+	}
+
+	body, err := storage.Default.Get(ctx, file.FilePath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+	defer body.Close()
+	if format == "FASTQ" {
+		return fastqQC(ctx, r, file, body)
+	}
+	return alignmentQC(ctx, r, file, format, bufio.NewReaderSize(body, 1<<16))
+}
+
+// fastqQC computes the read metrics of a FASTQ
+func fastqQC(ctx context.Context, r *run, file models.SequenceFile, body io.Reader) error {
+	reader, err := fastq.NewReader(body)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+
+	stats := fastq.NewStats()
+	var parseErr *fastq.ParseError
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if errors.As(err, &parseErr) {
+			r.addError(parseErr.Line, parseErr.Msg)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", reader.Line()+1, err)
+		}
+		stats.Add(rec)
+		r.job.Records++
+		if r.job.Records%qcHeartbeatReads == 0 {
+			if err := r.heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+	if r.job.Records == 0 {
+		r.addError(0, "FASTQ has no reads")
+		return nil
+	}
+
+	m := stats.Metrics()
+	lengths, err := json.Marshal(m.LengthDistribution)
+	if err != nil {
+		return err
+	}
+	positions, err := json.Marshal(m.PositionQuality)
+	if err != nil {
+		return err
+	}
+	return r.db.Create(&models.FastqMetrics{
+		SequenceFileID: file.ID, Reads: m.Reads, Bases: m.Bases,
+		MinLength: m.MinLength, MaxLength: m.MaxLength, MeanLength: m.MeanLength,
+		MeanQuality: m.MeanQuality, Q30Rate: m.Q30Rate, GCContent: m.GCContent, NRate: m.NRate,
+		DuplicateRate: m.DuplicateRate, LengthDistribution: models.JSON(lengths), PositionQuality: models.JSON(positions),
+		ComputedAt: time.Now(),
+	}).Error
+}
+
+// alignmentQC records what a BAM or CRAM header declares and tallies a
+// BAM's alignments by flag
+func alignmentQC(ctx context.Context, r *run, file models.SequenceFile, format string, body io.Reader) error {
+	var header *bam.Header
+	var counts *bam.Flagstat
+	switch format {
+	case "CRAM":
+		reader, err := cram.NewReader(body)
+		if err != nil {
+			r.addError(0, err.Error())
+			return nil
+		}
+		header = reader.Header()
+		// Records aren't decoded, but the container headers count them
+		for containers := 1; ; containers++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			records, err := reader.NextContainer()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.addError(0, fmt.Sprintf("container %d: %v", containers, err))
+				return nil
+			}
+			r.job.Records += records
+			if containers%qcHeartbeatContainers == 0 {
+				if err := r.heartbeat(); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		reader := bgzf.NewReader(body)
+		var err error
+		if header, err = bam.ReadHeader(reader); err != nil {
+			r.addError(0, err.Error())
+			return nil
+		}
+		counts = &bam.Flagstat{}
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			alignment, err := bam.ReadAlignment(reader)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				r.addError(0, fmt.Sprintf("record %d: %v", r.job.Records+1, err))
+				return nil
+			}
+			counts.Add(alignment)
+			r.job.Records++
+			if r.job.Records%qcHeartbeatReads == 0 {
+				if err := r.heartbeat(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	metrics := models.AlignmentMetrics{
+		SequenceFileID: file.ID, Format: format, ReferenceCount: len(header.Refs),
+		TotalReads: r.job.Records, ComputedAt: time.Now(),
+	}
+	if hd := header.Lines("@HD"); len(hd) > 0 {
+		metrics.SortOrder = hd[0]["SO"]
+	}
+	for _, sq := range header.Lines("@SQ") {
+		if sq["AS"] != "" {
+			metrics.Assembly = sq["AS"]
+			break
+		}
+	}
+	type reference struct {
+		Name   string `json:"name"`
+		Length int64  `json:"length"`
+	}
+	references := make([]reference, len(header.Refs))
+	for i, ref := range header.Refs {
+		references[i] = reference{Name: ref.Name, Length: ref.Length}
+	}
+	for _, field := range []struct {
+		dest  *models.JSON
+		value interface{}
+	}{
+		{&metrics.ReferenceSequences, references},
+		{&metrics.ReadGroups, headerLines(header, "@RG")},
+		{&metrics.Programs, headerLines(header, "@PG")},
+	} {
+		encoded, err := json.Marshal(field.value)
+		if err != nil {
+			return err
+		}
+		*field.dest = models.JSON(encoded)
+	}
+	if counts != nil {
+		metrics.Mapped, metrics.Paired, metrics.ProperlyPaired = &counts.Mapped, &counts.Paired, &counts.ProperlyPaired
+		metrics.Duplicates, metrics.Secondary, metrics.Supplementary = &counts.Duplicates, &counts.Secondary, &counts.Supplementary
+		metrics.QCFailed, metrics.Singletons, metrics.MateOtherChrom = &counts.QCFailed, &counts.Singletons, &counts.MateOtherChrom
+		metrics.MappedRate = rate(counts.Mapped, counts.Total)
+		metrics.ProperlyPairedRate = rate(counts.ProperlyPaired, counts.Paired)
+		metrics.DuplicateRate = rate(counts.Duplicates, counts.Total)
+	}
+	return r.db.Create(&metrics).Error
+}
+
+// headerLines are the header lines of one record type, never nil
+func headerLines(header *bam.Header, recordType string) []map[string]string {
+	lines := header.Lines(recordType)
+	if lines == nil {
+		lines = []map[string]string{}
+	}
+	return lines
+}
+
+// rate is part/whole rounded to 4 decimal places, or nil when whole is 0
+func rate(part, whole int64) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	r := math.Round(float64(part)/float64(whole)*1e4) / 1e4
+	return &r
+}
+
+// deleteQCMetrics removes the metrics computed for a sequence file
+func deleteQCMetrics(tx *gorm.DB, id int) error {
+	if err := tx.Where("sequence_file_id = ?", id).Delete(&models.FastqMetrics{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("sequence_file_id = ?", id).Delete(&models.AlignmentMetrics{}).Error
+}
+
+// finishQC keeps a sequence file's metrics only if the whole file was read
+func finishQC(tx *gorm.DB, job *models.IngestJob, status string) error {
+	if job.SequenceFileID == nil {
+		return nil
+	}
+	if status != models.IngestSucceeded {
+		if err := deleteQCMetrics(tx, *job.SequenceFileID); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.SequenceFile{}).Where("id = ?", *job.SequenceFileID).Update("qc_status", status).Error
+}
@@ -0,0 +1,168 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"genomic-api/fasta"
+	"genomic-api/models"
+	"genomic-api/storage"
+
+	"gorm.io/gorm"
+)
+
+// contigBatchSize is how many contigs are inserted at a time, and how often
+// progress is reported
+const contigBatchSize = 1000
+
+// ingestReference reads a genome's reference FASTA into contigs: each
+// sequence's length, refget digests and layout in the file. When the genome
+// has a .fai, it must describe the FASTA exactly.
+func ingestReference(ctx context.Context, r *run) error {
+	if r.job.GenomeID == nil {
+		return errors.New("job has no genome")
+	}
+	var genome models.Genome
+	if err := r.db.First(&genome, *r.job.GenomeID).Error; err != nil {
+		return fmt.Errorf("load genome: %w", err)
+	}
+	if genome.FastaPath == "" {
+		r.addError(0, "genome has no fasta_path")
+		return nil
+	}
+	if err := r.db.Model(&genome).Update("reference_status", models.IngestRunning).Error; err != nil {
+		return err
+	}
+	// Start from nothing, so a retry or a new FASTA doesn't duplicate contigs
+	if err := r.db.Where("genome_id = ?", genome.ID).Delete(&models.Contig{}).Error; err != nil {
+		return err
+	}
+
+	var parseErr *fasta.ParseError
+	var indexed map[string]fasta.Sequence
+	var indexOrder []string
+	if genome.FaiPath != "" {
+		body, err := storage.Default.Get(ctx, genome.FaiPath)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", genome.FaiPath, err)
+		}
+		entries, err := fasta.ReadIndex(body)
+		body.Close()
+		if errors.As(err, &parseErr) {
+			r.addError(parseErr.Line, ".fai: "+parseErr.Msg)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read %s: %w", genome.FaiPath, err)
+		}
+		indexed = make(map[string]fasta.Sequence, len(entries))
+		for _, entry := range entries {
+			indexed[entry.Name] = entry
+			indexOrder = append(indexOrder, entry.Name)
+		}
+	}
+
+	body, err := storage.Default.Get(ctx, genome.FastaPath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", genome.FastaPath, err)
+	}
+	defer body.Close()
+	scanner := fasta.NewScanner(body)
+
+	seen := map[string]bool{}
+	batch := make([]models.Contig, 0, contigBatchSize)
+	flush := func() error {
+		if len(batch) > 0 && r.job.ErrorCount == 0 {
+			if err := r.db.Create(&batch).Error; err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return r.heartbeat()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		seq, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		if errors.As(err, &parseErr) {
+			// The layout of the rest of the file can't be trusted
+			r.addError(parseErr.Line, parseErr.Msg)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		r.job.Records++
+		if seen[seq.Name] {
+			r.addError(seq.Line, fmt.Sprintf("sequence %s appears more than once", seq.Name))
+			continue
+		}
+		seen[seq.Name] = true
+		if indexed != nil {
+			if msg := compareIndex(seq, indexed); msg != "" {
+				r.addError(seq.Line, msg)
+			}
+		}
+		if r.job.ErrorCount == 0 {
+			batch = append(batch, models.Contig{
+				GenomeID: genome.ID, Name: seq.Name, Length: seq.Length, MD5: seq.MD5, SHA512t24u: seq.SHA512t24u,
+				FastaOffset: seq.Offset, LineBases: seq.LineBases, LineWidth: seq.LineWidth,
+			})
+		}
+		if r.job.Records%contigBatchSize == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range indexOrder {
+		if !seen[name] {
+			r.addError(indexed[name].Line, fmt.Sprintf(".fai lists %s, which is not in the FASTA", name))
+		}
+	}
+	if r.job.Records == 0 {
+		r.addError(0, "FASTA has no sequences")
+	}
+	return flush()
+}
+
+// compareIndex describes how the .fai entry for seq disagrees with the
+// FASTA, or returns "" if it matches
+func compareIndex(seq *fasta.Sequence, indexed map[string]fasta.Sequence) string {
+	entry, ok := indexed[seq.Name]
+	switch {
+	case !ok:
+		return fmt.Sprintf("sequence %s is not in the .fai", seq.Name)
+	case entry.Length != seq.Length:
+		return fmt.Sprintf("sequence %s has %d bases but the .fai says %d", seq.Name, seq.Length, entry.Length)
+	case entry.Offset != seq.Offset || (seq.Length > 0 && (entry.LineBases != seq.LineBases || entry.LineWidth != seq.LineWidth)):
+		return fmt.Sprintf("sequence %s is at offset %d with %d bases in %d-byte lines but the .fai says offset %d, %d bases in %d-byte lines",
+			seq.Name, seq.Offset, seq.LineBases, seq.LineWidth, entry.Offset, entry.LineBases, entry.LineWidth)
+	}
+	return ""
+}
+
+// finishReference makes a genome's contigs available only if the whole
+// FASTA was indexed
+func finishReference(tx *gorm.DB, job *models.IngestJob, status string) error {
+	if job.GenomeID == nil {
+		return nil
+	}
+	count := job.Records
+	if status != models.IngestSucceeded {
+		count = 0
+		if err := tx.Where("genome_id = ?", *job.GenomeID).Delete(&models.Contig{}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.Genome{}).Where("id = ?", *job.GenomeID).Updates(map[string]interface{}{
+		"reference_status": status,
+		"contig_count":     count,
+	}).Error
+}
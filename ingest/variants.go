@@ -0,0 +1,212 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"genomic-api/binning"
+	"genomic-api/models"
+	"genomic-api/storage"
+	"genomic-api/vcf"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// variantBatchSize is how many records are inserted at a time, and how
+	// often progress is reported
+	variantBatchSize = 1000
+	// maxVariantErrors stops parsing a file that is clearly not valid VCF
+	maxVariantErrors = 1000
+)
+
+// IsVCF reports whether a variant file should be ingested as VCF, going by
+// its declared type or, failing that, its name
+func IsVCF(file models.VariantFile) bool {
+	if strings.EqualFold(strings.TrimSpace(file.FileType), "VCF") {
+		return true
+	}
+	name := strings.ToLower(file.FileName)
+	for _, suffix := range []string{".vcf", ".vcf.gz", ".vcf.bgz"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ingestVariants parses a variant file's VCF into variants. A file with any
+// malformed line is rejected as a whole, but parsing carries on to report
+// as many of its errors as possible in one go.
+func ingestVariants(ctx context.Context, r *run) error {
+	if r.job.VariantFileID == nil {
+		return errors.New("job has no variant file")
+	}
+	var file models.VariantFile
+	if err := r.db.First(&file, *r.job.VariantFileID).Error; err != nil {
+		return fmt.Errorf("load variant file: %w", err)
+	}
+	// The file's own sample column, matched on donor ID when there are several
+	var donorID string
+	r.db.Model(&models.Sample{}).Where("id = ?", file.SampleID).Pluck("donor_id", &donorID)
+
+	if err := r.db.Model(&file).Update("ingest_status", models.IngestRunning).Error; err != nil {
+		return err
+	}
+	// Start from nothing, so a retry or a repeated ingest doesn't duplicate records
+	if err := r.db.Where("variant_file_id = ?", file.ID).Delete(&models.Variant{}).Error; err != nil {
+		return err
+	}
+
+	body, err := storage.Default.Get(ctx, file.FilePath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", file.FilePath, err)
+	}
+	defer body.Close()
+	reader, err := vcf.NewReader(body)
+	var parseErr *vcf.ParseError
+	if errors.As(err, &parseErr) {
+		r.addError(parseErr.Line, parseErr.Msg)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	samples := reader.Header().Samples
+	own := sampleColumn(samples, donorID)
+
+	batch := make([]models.Variant, 0, variantBatchSize)
+	flush := func() error {
+		if len(batch) > 0 && r.job.ErrorCount == 0 {
+			if err := r.db.Create(&batch).Error; err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return r.heartbeat()
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if errors.As(err, &parseErr) {
+			r.job.Records++
+			r.addError(parseErr.Line, parseErr.Msg)
+			if r.job.ErrorCount >= maxVariantErrors {
+				return fmt.Errorf("stopped after %d errors", maxVariantErrors)
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", reader.Line()+1, err)
+		}
+		r.job.Records++
+		// Once the file is known to be bad, only look for more errors
+		if r.job.ErrorCount == 0 {
+			variant, err := newVariant(rec, file, samples, own)
+			if err != nil {
+				r.addError(rec.Line, err.Error())
+				continue
+			}
+			batch = append(batch, variant)
+		}
+		if r.job.Records%variantBatchSize == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return flush()
+}
+
+// finishVariants makes a variant file's records queryable only if the whole
+// file was ingested
+func finishVariants(tx *gorm.DB, job *models.IngestJob, status string) error {
+	if job.VariantFileID == nil {
+		return nil
+	}
+	count := job.Records
+	if status != models.IngestSucceeded {
+		count = 0
+		if err := tx.Where("variant_file_id = ?", *job.VariantFileID).Delete(&models.Variant{}).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Model(&models.VariantFile{}).Where("id = ?", *job.VariantFileID).Updates(map[string]interface{}{
+		"ingest_status": status,
+		"variant_count": count,
+	}).Error
+}
+
+// sampleColumn picks the column holding the variant file's own sample: the
+// only one, or the one named after the sample's donor ID. It returns -1 if
+// neither applies.
+func sampleColumn(samples []string, donorID string) int {
+	if len(samples) == 1 {
+		return 0
+	}
+	for i, name := range samples {
+		if donorID != "" && name == donorID {
+			return i
+		}
+	}
+	return -1
+}
+
+// newVariant converts a VCF record to a row; own is the file's sample column
+func newVariant(rec *vcf.Record, file models.VariantFile, samples []string, own int) (models.Variant, error) {
+	info := make(map[string]interface{}, len(rec.Info))
+	for key, value := range rec.Info {
+		if value == "" {
+			info[key] = true // flag
+		} else {
+			info[key] = value
+		}
+	}
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return models.Variant{}, err
+	}
+
+	variant := models.Variant{
+		VariantFileID: file.ID,
+		SampleID:      file.SampleID,
+		GenomeID:      file.GenomeID,
+		Line:          rec.Line,
+		Chrom:         rec.Chrom,
+		Pos:           rec.Pos,
+		EndPos:        rec.End(),
+		Bin:           binning.For(rec.Pos-1, rec.End()),
+		Ref:           rec.Ref,
+		Alt:           strings.Join(rec.Alt, ","),
+		Qual:          rec.Qual,
+		Filter:        strings.Join(rec.Filter, ";"),
+		Info:          models.JSON(infoJSON),
+	}
+	if rec.ID != "." {
+		variant.VcfID = rec.ID
+	}
+	if len(samples) > 0 {
+		genotypes := make(map[string]map[string]string, len(samples))
+		for i, name := range samples {
+			genotypes[name] = rec.Samples[i]
+		}
+		genotypesJSON, err := json.Marshal(genotypes)
+		if err != nil {
+			return models.Variant{}, err
+		}
+		variant.Genotypes = models.JSON(genotypesJSON)
+	}
+	if own >= 0 {
+		variant.Genotype = rec.Samples[own]["GT"]
+	}
+	return variant, nil
+}
@@ -0,0 +1,94 @@
+package integrity
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// Prometheus metrics, served on /metrics with the HTTP metrics
+var (
+	filesByStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "stored_files_verification_status",
+			Help: "Stored files by kind and result of their last verification (unverified for never checked)",
+		},
+		[]string{"kind", "status"},
+	)
+
+	verificationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "file_verifications_total",
+			Help: "File payload verifications by kind and result",
+		},
+		[]string{"kind", "status"},
+	)
+
+	lastScrubTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "file_scrub_last_completed_timestamp_seconds",
+			Help: "When the last full scrub pass finished",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(filesByStatus, verificationsTotal, lastScrubTimestamp)
+}
+
+// statusUnverified labels files the scrubber hasn't reached yet
+const statusUnverified = "unverified"
+
+// lastScrub is when this process last finished a full pass
+var lastScrub atomic.Pointer[time.Time]
+
+// Summary is how many files of each kind are in each verification status
+type Summary struct {
+	Counts         map[string]map[string]int64 `json:"counts"` // kind -> status -> files
+	LastScrub      *time.Time                  `json:"last_scrub_completed_at"`
+	ScrubRequested bool                        `json:"scrub_requested"` // an on-demand scrub is waiting to start
+}
+
+// Summarize counts files by kind and verification status
+func Summarize(db *gorm.DB) (Summary, error) {
+	summary := Summary{
+		Counts:         map[string]map[string]int64{},
+		LastScrub:      lastScrub.Load(),
+		ScrubRequested: len(requests) > 0,
+	}
+	for kind, table := range tables {
+		var rows []struct {
+			Status string
+			Files  int64
+		}
+		err := db.Table(table).
+			Select("COALESCE(NULLIF(verification_status, ''), ?) AS status, COUNT(*) AS files", statusUnverified).
+			Group("1").
+			Scan(&rows).Error
+		if err != nil {
+			return summary, err
+		}
+		summary.Counts[kind] = map[string]int64{}
+		for _, row := range rows {
+			summary.Counts[kind][row.Status] = row.Files
+		}
+	}
+	return summary, nil
+}
+
+// refreshGauges sets the per-status gauges from the database
+func refreshGauges(db *gorm.DB) error {
+	summary, err := Summarize(db)
+	if err != nil {
+		return err
+	}
+	filesByStatus.Reset()
+	for kind, counts := range summary.Counts {
+		for _, status := range []string{StatusOK, StatusMismatch, StatusMissing, StatusNoChecksum, StatusError, statusUnverified} {
+			filesByStatus.WithLabelValues(kind, status).Set(float64(counts[status]))
+		}
+	}
+	return nil
+}
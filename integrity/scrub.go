@@ -0,0 +1,205 @@
+// Package integrity re-hashes stored file payloads to catch bit rot and
+// missing objects before anyone downloads them.
+package integrity
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"genomic-api/storage"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Verification results stored in verification_status
+const (
+	StatusOK         = "ok"
+	StatusMismatch   = "mismatch"    // stored bytes don't hash to the recorded checksum
+	StatusMissing    = "missing"     // nothing in storage under file_path
+	StatusNoChecksum = "no_checksum" // nothing to compare against
+	StatusError      = "error"       // storage failed; retried on the next pass
+)
+
+// Kinds of file the scrubber checks, named after their audit resource types
+const (
+	KindSequenceFile = "sequence_file"
+	KindVariantFile  = "variant_file"
+)
+
+// tables maps each kind of file to its table
+var tables = map[string]string{
+	KindSequenceFile: "sequence_files",
+	KindVariantFile:  "variant_files",
+}
+
+// scrubBatchSize is how many files a pass loads at a time
+const scrubBatchSize = 100
+
+// storedFile is the part of a sequence or variant file the scrubber needs
+type storedFile struct {
+	ID        int
+	FilePath  string
+	Checksum  string
+	SizeBytes int64
+}
+
+// Result is the outcome of verifying one file
+type Result struct {
+	Kind       string    `json:"kind"`
+	ID         int       `json:"id"`
+	Status     string    `json:"status"`
+	Detail     string    `json:"detail,omitempty"`
+	VerifiedAt time.Time `json:"verified_at"`
+}
+
+// check hashes the stored payload of f and compares it with the recorded checksum
+func check(ctx context.Context, f storedFile) (status, detail string) {
+	body, err := storage.Default.Get(ctx, f.FilePath)
+	if errors.Is(err, storage.ErrNotFound) {
+		return StatusMissing, ""
+	}
+	if err != nil {
+		return StatusError, err.Error()
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, body)
+	if err != nil {
+		return StatusError, err.Error()
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	switch {
+	case f.Checksum == "":
+		return StatusNoChecksum, "sha256 " + sum
+	case !strings.EqualFold(f.Checksum, sum):
+		return StatusMismatch, "sha256 " + sum
+	case f.SizeBytes > 0 && n != f.SizeBytes:
+		return StatusMismatch, "size differs from size_bytes"
+	}
+	return StatusOK, ""
+}
+
+// verify checks one file and records the outcome on its row
+func verify(ctx context.Context, db *gorm.DB, kind string, f storedFile) (Result, error) {
+	status, detail := check(ctx, f)
+	if ctx.Err() != nil {
+		// Cancelled part way; don't record a bogus error
+		return Result{}, ctx.Err()
+	}
+	result := Result{Kind: kind, ID: f.ID, Status: status, Detail: detail, VerifiedAt: time.Now()}
+	err := db.Table(tables[kind]).Where("id = ?", f.ID).Updates(map[string]interface{}{
+		"last_verified_at":    result.VerifiedAt,
+		"verification_status": status,
+	}).Error
+	if err != nil {
+		return result, err
+	}
+
+	verificationsTotal.WithLabelValues(kind, status).Inc()
+	event := log.Info()
+	if status != StatusOK {
+		event = log.Error()
+	}
+	event.Str("kind", kind).Int("id", f.ID).Str("file_path", f.FilePath).
+		Str("status", status).Str("detail", detail).Msg("file verification")
+	return result, nil
+}
+
+// VerifyFile re-hashes one sequence or variant file now
+func VerifyFile(ctx context.Context, db *gorm.DB, kind string, id int) (Result, error) {
+	table, ok := tables[kind]
+	if !ok {
+		return Result{}, errors.New("unknown file kind " + kind)
+	}
+	var f storedFile
+	if err := db.Table(table).Where("id = ?", id).Take(&f).Error; err != nil {
+		return Result{}, err
+	}
+	result, err := verify(ctx, db, kind, f)
+	if err == nil {
+		err = refreshGauges(db)
+	}
+	return result, err
+}
+
+// Scrub verifies every file not verified since cutoff, oldest first
+func Scrub(ctx context.Context, db *gorm.DB, cutoff time.Time) error {
+	defer func() {
+		if err := refreshGauges(db); err != nil {
+			log.Error().Err(err).Msg("failed to refresh file verification metrics")
+		}
+	}()
+	for kind, table := range tables {
+		// Files verified during this pass move past cutoff, so each query
+		// picks up where the last one left off
+		for {
+			var batch []storedFile
+			err := db.Table(table).
+				Where("last_verified_at IS NULL OR last_verified_at < ?", cutoff).
+				Order("last_verified_at NULLS FIRST, id").
+				Limit(scrubBatchSize).
+				Find(&batch).Error
+			if err != nil {
+				return err
+			}
+			for _, f := range batch {
+				if _, err := verify(ctx, db, kind, f); err != nil {
+					return err
+				}
+			}
+			if len(batch) < scrubBatchSize {
+				break
+			}
+		}
+	}
+	now := time.Now()
+	lastScrub.Store(&now)
+	lastScrubTimestamp.Set(float64(now.Unix()))
+	return nil
+}
+
+// requests carries on-demand scrubs to Run; the buffer of one means repeated
+// requests while a pass is queued collapse into it
+var requests = make(chan time.Time, 1)
+
+// RequestScrub asks Run to verify every file now, whenever it was last
+// checked. It returns false if a full scrub is already queued.
+func RequestScrub() bool {
+	select {
+	case requests <- time.Now():
+		return true
+	default:
+		return false
+	}
+}
+
+// Run scrubs every interval, re-verifying files last checked more than
+// maxAge ago, and serves RequestScrub until ctx is cancelled. Only one
+// instance of the API should run it.
+func Run(ctx context.Context, db *gorm.DB, interval, maxAge time.Duration) {
+	if err := refreshGauges(db); err != nil {
+		log.Error().Err(err).Msg("failed to refresh file verification metrics")
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var cutoff time.Time
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff = time.Now().Add(-maxAge)
+		case cutoff = <-requests:
+		}
+		if err := Scrub(ctx, db, cutoff); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("file scrub failed")
+		}
+	}
+}
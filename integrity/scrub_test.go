@@ -0,0 +1,115 @@
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"genomic-api/storage"
+	"genomic-api/testdb"
+)
+
+// readsSHA256 is the SHA-256 of testdata/reads.fastq
+const readsSHA256 = "64fd11e42c2b5708c41db70d3cb33a8b9e82b3583ba684197393d9281dccf4d2"
+
+// useStorage stores testdata/reads.fastq under "reads.fastq" in a temporary
+// local backend for the rest of the test
+func useStorage(t *testing.T) int64 {
+	t.Helper()
+	local, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := storage.Default
+	storage.Default = local
+	t.Cleanup(func() { storage.Default = old })
+
+	reads, err := os.ReadFile("testdata/reads.fastq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Put(context.Background(), "reads.fastq", bytes.NewReader(reads), int64(len(reads))); err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(reads))
+}
+
+func TestCheck(t *testing.T) {
+	size := useStorage(t)
+	tests := []struct {
+		name string
+		file storedFile
+		want string
+	}{
+		{"matching checksum", storedFile{FilePath: "reads.fastq", Checksum: readsSHA256, SizeBytes: size}, StatusOK},
+		{"checksum in upper case", storedFile{FilePath: "reads.fastq", Checksum: "64FD11E42C2B5708C41DB70D3CB33A8B9E82B3583BA684197393D9281DCCF4D2"}, StatusOK},
+		{"unknown size", storedFile{FilePath: "reads.fastq", Checksum: readsSHA256}, StatusOK},
+		{"different checksum", storedFile{FilePath: "reads.fastq", Checksum: "00" + readsSHA256[2:], SizeBytes: size}, StatusMismatch},
+		{"different size", storedFile{FilePath: "reads.fastq", Checksum: readsSHA256, SizeBytes: size + 1}, StatusMismatch},
+		{"no checksum", storedFile{FilePath: "reads.fastq"}, StatusNoChecksum},
+		{"missing object", storedFile{FilePath: "gone.fastq", Checksum: readsSHA256}, StatusMissing},
+		{"invalid key", storedFile{FilePath: "../outside", Checksum: readsSHA256}, StatusError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, detail := check(context.Background(), tt.file)
+			if status != tt.want {
+				t.Errorf("check = %s (%s), want %s", status, detail, tt.want)
+			}
+			if tt.want == StatusNoChecksum && detail != "sha256 "+readsSHA256 {
+				t.Errorf("detail = %q, want the computed sha256", detail)
+			}
+		})
+	}
+}
+
+func TestScrub(t *testing.T) {
+	db := testdb.Open(t)
+	size := useStorage(t)
+	cutoff := time.Now().Add(-time.Hour)
+	recently := time.Now().Add(-time.Minute)
+
+	rows := []map[string]interface{}{
+		{"file_path": "reads.fastq", "checksum": readsSHA256, "size_bytes": size},
+		{"file_path": "reads.fastq", "checksum": "00" + readsSHA256[2:]},
+		{"file_path": "gone.fastq", "checksum": readsSHA256},
+		// Checked after cutoff, so left alone although it would now fail
+		{"file_path": "gone.fastq", "checksum": readsSHA256, "last_verified_at": recently, "verification_status": StatusOK},
+	}
+	var ids []int
+	for _, row := range rows {
+		if err := db.Table("sequence_files").Create(row).Error; err != nil {
+			t.Fatalf("insert sequence file: %v", err)
+		}
+		var id int
+		db.Raw("SELECT MAX(id) FROM sequence_files").Scan(&id)
+		ids = append(ids, id)
+	}
+	if err := db.Table("variant_files").Create(map[string]interface{}{"file_path": "reads.fastq"}).Error; err != nil {
+		t.Fatalf("insert variant file: %v", err)
+	}
+
+	if err := Scrub(context.Background(), db, cutoff); err != nil {
+		t.Fatalf("Scrub: %v", err)
+	}
+	want := []string{StatusOK, StatusMismatch, StatusMissing, StatusOK}
+	for i, id := range ids {
+		var status string
+		db.Raw("SELECT verification_status FROM sequence_files WHERE id = ?", id).Scan(&status)
+		if status != want[i] {
+			t.Errorf("sequence file %d: status %q, want %q", i, status, want[i])
+		}
+	}
+	var variantStatus string
+	db.Raw("SELECT verification_status FROM variant_files").Scan(&variantStatus)
+	if variantStatus != StatusNoChecksum {
+		t.Errorf("variant file: status %q, want %q", variantStatus, StatusNoChecksum)
+	}
+
+	result, err := VerifyFile(context.Background(), db, KindSequenceFile, ids[3])
+	if err != nil || result.Status != StatusMissing {
+		t.Errorf("VerifyFile = %+v, %v; want the file checked now and found missing", result, err)
+	}
+}
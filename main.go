@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"genomic-api/audit"
 	"genomic-api/config"
+	"genomic-api/ingest"
+	"genomic-api/integrity"
+	"genomic-api/middleware"
 	"genomic-api/routes"
+	"genomic-api/storage"
 )
 
 // init logging + metrics registration
@@ -18,9 +27,36 @@ func init() {
 }
 
 func main() {
+	// `go run main.go verify-audit` checks the audit chain and exits non-zero if it's broken
+	if len(os.Args) > 1 && os.Args[1] == "verify-audit" {
+		config.InitDB()
+		code := verifyAudit()
+		config.CloseDB()
+		os.Exit(code)
+	}
+
+	if err := middleware.LoadSigningKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load JWT signing keys")
+	}
+
+	if err := storage.Init(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to initialize file storage")
+	}
+
 	config.InitDB()
 	defer config.CloseDB()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go audit.RunCheckpoints(ctx, config.DB, durationFromEnv("AUDIT_CHECKPOINT_INTERVAL", time.Hour))
+	// Run the scrubber on one instance only; SCRUB_INTERVAL=0 turns it off
+	if os.Getenv("SCRUB_INTERVAL") != "0" {
+		go integrity.Run(ctx, config.DB,
+			durationFromEnv("SCRUB_INTERVAL", time.Hour),
+			durationFromEnv("SCRUB_MAX_AGE", 7*24*time.Hour))
+	}
+	go ingest.Run(ctx, config.DB, intFromEnv("INGEST_WORKERS", 2), durationFromEnv("INGEST_POLL_INTERVAL", 10*time.Second))
+
 	r := routes.SetupRouter()
 
 	fmt.Println("Server is running on http://localhost:8080")
@@ -28,3 +64,46 @@ func main() {
 		log.Fatal().Err(err).Msg("Server failed")
 	}
 }
+
+// verifyAudit prints the audit chain verification result as JSON
+func verifyAudit() int {
+	result, err := audit.Verify(config.DB)
+	if err != nil {
+		log.Error().Err(err).Msg("Audit verification failed")
+		return 2
+	}
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
+
+// durationFromEnv parses a Go duration such as "30m" from the environment
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Warn().Str(name, value).Msg("invalid duration, using default")
+		return fallback
+	}
+	return d
+}
+
+// intFromEnv parses a non-negative integer from the environment
+func intFromEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Warn().Str(name, value).Msg("invalid number, using default")
+		return fallback
+	}
+	return n
+}
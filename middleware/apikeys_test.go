@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// scopeRouter serves a route that admins and read:samples keys may call
+func scopeRouter(authenticate gin.HandlerFunc) *gin.Engine {
+	r := authRouter()
+	r.GET("/api/samples", authenticate, RequireScope("read:samples", models.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+// createTestKey issues a key with scopes to a new service account, letting
+// change alter the key and account before they are stored
+func createTestKey(t *testing.T, db *gorm.DB, scopes string, change func(*models.APIKey, *models.ServiceAccount)) string {
+	t.Helper()
+	plaintext, prefix, hash := GenerateAPIKey()
+	account := models.ServiceAccount{Name: "pipeline"}
+	key := models.APIKey{Name: "ci", Prefix: prefix, KeyHash: hash, Scopes: scopes}
+	if change != nil {
+		change(&key, &account)
+	}
+	if err := db.Create(&account).Error; err != nil {
+		t.Fatalf("create service account: %v", err)
+	}
+	key.ServiceAccountID = account.ID
+	if err := db.Create(&key).Error; err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	return plaintext
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	db := useTestDB(t)
+	r := scopeRouter(JWTAuth())
+	hour := time.Hour
+	ago := func(d time.Duration) *time.Time { at := time.Now().Add(-d); return &at }
+
+	for _, test := range []struct {
+		name   string
+		key    func(t *testing.T) string
+		status int
+	}{
+		{"valid", func(t *testing.T) string {
+			return createTestKey(t, db, "read:samples write:samples", nil)
+		}, http.StatusOK},
+		{"not yet expired", func(t *testing.T) string {
+			return createTestKey(t, db, "read:samples", func(key *models.APIKey, _ *models.ServiceAccount) { key.ExpiresAt = ago(-hour) })
+		}, http.StatusOK},
+		{"wrong scope", func(t *testing.T) string {
+			return createTestKey(t, db, "read:variants write:samples", nil)
+		}, http.StatusForbidden},
+		{"no scopes", func(t *testing.T) string {
+			return createTestKey(t, db, "", nil)
+		}, http.StatusForbidden},
+		{"expired", func(t *testing.T) string {
+			return createTestKey(t, db, "read:samples", func(key *models.APIKey, _ *models.ServiceAccount) { key.ExpiresAt = ago(hour) })
+		}, http.StatusUnauthorized},
+		{"revoked", func(t *testing.T) string {
+			return createTestKey(t, db, "read:samples", func(key *models.APIKey, _ *models.ServiceAccount) { key.RevokedAt = ago(hour) })
+		}, http.StatusUnauthorized},
+		{"disabled service account", func(t *testing.T) string {
+			return createTestKey(t, db, "read:samples", func(_ *models.APIKey, account *models.ServiceAccount) { account.Disabled = true })
+		}, http.StatusUnauthorized},
+		{"wrong secret", func(t *testing.T) string {
+			key := createTestKey(t, db, "read:samples", nil)
+			return key[:strings.LastIndex(key, "_")+1] + "not-the-secret"
+		}, http.StatusUnauthorized},
+		{"unknown prefix", func(t *testing.T) string {
+			key, _, _ := GenerateAPIKey()
+			return key
+		}, http.StatusUnauthorized},
+		{"no prefix", func(t *testing.T) string { return "gk__secret" }, http.StatusUnauthorized},
+		{"no separator", func(t *testing.T) string { return "gk_secret" }, http.StatusUnauthorized},
+		{"marker only", func(t *testing.T) string { return "gk_" }, http.StatusUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/samples", nil)
+			req.Header.Set("Authorization", "Bearer "+test.key(t))
+			if w := serve(r, req); w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		caller func(c *gin.Context)
+		status int
+	}{
+		{"key with scope", func(c *gin.Context) { SetAPIKey(c, 1, "read:variants", "read:samples") }, http.StatusOK},
+		{"key without scope", func(c *gin.Context) { SetAPIKey(c, 1, "read:variants") }, http.StatusForbidden},
+		{"key with write scope only", func(c *gin.Context) { SetAPIKey(c, 1, "write:samples") }, http.StatusForbidden},
+		{"key with no scopes", func(c *gin.Context) { SetAPIKey(c, 1) }, http.StatusForbidden},
+		// A key's scopes matter, not the role of whoever made the request
+		{"key and admin role", func(c *gin.Context) { SetUser(c, 1, models.RoleAdmin); SetAPIKey(c, 1) }, http.StatusForbidden},
+		{"allowed role", func(c *gin.Context) { SetUser(c, 1, models.RoleAdmin) }, http.StatusOK},
+		{"other role", func(c *gin.Context) { SetUser(c, 1, models.RoleResearcher) }, http.StatusForbidden},
+		{"nobody", func(c *gin.Context) {}, http.StatusForbidden},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := scopeRouter(test.caller)
+			w := serve(r, httptest.NewRequest(http.MethodGet, "/api/samples", nil))
+			if w.Code != test.status {
+				t.Errorf("status %d, want %d: %s", w.Code, test.status, w.Body)
+			}
+		})
+	}
+}
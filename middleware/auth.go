@@ -2,18 +2,16 @@ package middleware
 
 import (
 	"net/http"
-	"time"
 
+	"genomic-api/audit"
 	"genomic-api/config"
 	"genomic-api/models"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
 )
 
-// Secret key for JWT signing (load from env in production)
-//var jwtSecret = []byte("my_secret_key")
-
 type LoginInput struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -28,28 +26,64 @@ func Login(c *gin.Context) {
 
 	var user models.User
 	if err := config.DB.Where("email = ?", input.Email).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		// Burn the same bcrypt cost as a real check so unknown emails aren't detectable by timing
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(input.Password))
+		recordLogin(c, audit.ActionLoginFailed, 0, input.Email, "unknown email")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Basic string match for simplicity — use hashed password comparison in real projects
-	if input.Password != user.PasswordHash {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect password"})
+	ok, legacy := CheckPassword(user.PasswordHash, input.Password)
+	if !ok {
+		recordLogin(c, audit.ActionLoginFailed, user.ID, input.Email, "incorrect password")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 		return
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+	// Upgrade plaintext rows left over from before hashing was introduced
+	if legacy {
+		if hash, err := HashPassword(input.Password); err != nil {
+			log.Error().Err(err).Int("user_id", user.ID).Msg("failed to hash legacy password")
+		} else if err := config.DB.Model(&user).Update("password_hash", hash).Error; err != nil {
+			log.Error().Err(err).Int("user_id", user.ID).Msg("failed to re-hash legacy password")
+		}
+	}
 
-	tokenString, err := token.SignedString(jwtSecret)
+	// Create a short-lived access token and the refresh token that starts a new session
+	pair, err := issueTokens(config.DB, user, randomToken(16))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not create token"})
 		return
 	}
+	recordLogin(c, audit.ActionLogin, user.ID, input.Email, "")
 
-	c.JSON(http.StatusOK, gin.H{"token": tokenString})
+	c.JSON(http.StatusOK, gin.H{
+		"token":                    pair.Token,
+		"refresh_token":            pair.RefreshToken,
+		"expires_in":               pair.ExpiresIn,
+		"password_change_required": user.MustChangePassword,
+	})
+}
+
+// recordLogin audits a login attempt. A failure to write the audit row is
+// logged rather than failing the request, so the audit table being down
+// can't be used to probe credentials.
+func recordLogin(c *gin.Context, action string, userID int, email, reason string) {
+	extra := map[string]interface{}{
+		"email":      email,
+		"ip":         c.ClientIP(),
+		"user_agent": c.Request.UserAgent(),
+	}
+	if reason != "" {
+		extra["reason"] = reason
+	}
+	if err := audit.Record(config.DB, audit.Entry{
+		UserID:       userID,
+		Action:       action,
+		ResourceType: audit.ResourceUser,
+		ResourceID:   userID,
+		Extra:        extra,
+	}); err != nil {
+		log.Error().Err(err).Str("action", action).Str("email", email).Msg("failed to write login audit entry")
+	}
 }
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SetUser records a logged-in user in the context the way JWTAuth does for
+// a valid token, for callers authenticated some other way, such as tests
+func SetUser(c *gin.Context, userID int, role string) {
+	c.Set("user", jwt.MapClaims{"user_id": float64(userID), "role": role})
+}
+
+// SetAPIKey records a service account's API key with the given scopes in
+// the context the way JWTAuth does for a valid key
+func SetAPIKey(c *gin.Context, serviceAccountID int, scopes ...string) {
+	principal := &apiKeyPrincipal{serviceAccountID: serviceAccountID, scopes: map[string]bool{}}
+	for _, scope := range scopes {
+		principal.scopes[strings.TrimSpace(scope)] = true
+	}
+	c.Set("api_key", principal)
+}
@@ -1,14 +1,23 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
+	"genomic-api/config"
+	"genomic-api/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-var jwtSecret = []byte("my_secret_key")
+// passwordChangeRoutes are the only routes open to a user who has to change
+// their password, such as after an admin reset or on the seeded admin account
+var passwordChangeRoutes = map[string]bool{
+	"PUT /api/me/password": true,
+}
 
 func JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -21,13 +30,21 @@ func JWTAuth() gin.HandlerFunc {
 
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			// Validate signing algorithm
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
+		// Service accounts send an API key instead of a JWT
+		if strings.HasPrefix(tokenStr, apiKeyMarker) {
+			principal, err := authenticateAPIKey(tokenStr)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+				c.Abort()
+				return
 			}
-			return jwtSecret, nil
-		})
+			c.Set("api_key", principal)
+			c.Next()
+			return
+		}
+
+		token, err := jwt.Parse(tokenStr, verificationKey,
+			jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}))
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
@@ -35,8 +52,109 @@ func JWTAuth() gin.HandlerFunc {
 			return
 		}
 
+		// Reject tokens revoked by logout or an admin before they expire
+		jti, _ := token.Claims.(jwt.MapClaims)["jti"].(string)
+		if jti == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		revoked, err := isRevoked(jti)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check token revocation"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// The account must still exist with the role the token was issued
+		// for; a deleted user or a changed role needs a new login
+		claims := token.Claims.(jwt.MapClaims)
+		userID, _ := claims["user_id"].(float64)
+		role, _ := claims["role"].(string)
+		var user models.User
+		err = config.DB.Select("id", "role", "must_change_password").First(&user, int(userID)).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && user.Role != role) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not check token subject"})
+			c.Abort()
+			return
+		}
+
+		// Users whose password was reset must change it before anything else
+		if user.MustChangePassword && !passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "password_change_required": true})
+			c.Abort()
+			return
+		}
+
 		// Optionally store claims in context
 		c.Set("user", token.Claims)
 		c.Next()
 	}
 }
+
+// OptionalAuth is JWTAuth for routes that also serve anonymous callers.
+// Requests without an Authorization header pass through unauthenticated;
+// a token that is sent must still be valid.
+func OptionalAuth() gin.HandlerFunc {
+	auth := JWTAuth()
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" {
+			c.Next()
+			return
+		}
+		auth(c)
+	}
+}
+
+// CurrentUserID returns the user ID from the claims stored by JWTAuth
+func CurrentUserID(c *gin.Context) (int, bool) {
+	claims, ok := c.Get("user")
+	if !ok {
+		return 0, false
+	}
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return 0, false
+	}
+	// JSON numbers decode as float64
+	id, ok := mapClaims["user_id"].(float64)
+	if !ok {
+		return 0, false
+	}
+	return int(id), true
+}
+
+// CurrentSessionID returns the login session the token validated by JWTAuth
+// belongs to
+func CurrentSessionID(c *gin.Context) string {
+	return currentClaim(c, "sid")
+}
+
+// CurrentRole returns the role from the claims stored by JWTAuth
+func CurrentRole(c *gin.Context) string {
+	return currentClaim(c, "role")
+}
+
+// currentClaim returns a string claim from the token validated by JWTAuth
+func currentClaim(c *gin.Context, name string) string {
+	claims, ok := c.Get("user")
+	if !ok {
+		return ""
+	}
+	mapClaims, ok := claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	value, _ := mapClaims[name].(string)
+	return value
+}
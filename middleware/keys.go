@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minHMACSecretLen is the shortest HS256 secret we accept (256 bits)
+const minHMACSecretLen = 32
+
+// signingKey is one entry of the key ring. Keys without a private half are
+// only used to verify tokens, e.g. a retired key kept until its tokens expire.
+type signingKey struct {
+	kid    string
+	method jwt.SigningMethod
+	sign   interface{} // HMAC secret or private key; nil for verify-only keys
+	verify interface{} // HMAC secret or public key
+}
+
+// keyRing holds every key that can verify tokens and the one that signs them
+type keyRing struct {
+	active *signingKey
+	byKID  map[string]*signingKey
+	order  []string
+}
+
+var keys *keyRing
+
+// LoadSigningKeys builds the JWT key ring from the environment.
+//
+// JWT_KEYS is a comma-separated list of kid:ALG:path entries, where ALG is
+// HS256, RS256 or ES256 and path points to the HMAC secret or a PEM key.
+// JWT_ACTIVE_KID picks the key that signs new tokens (default: the first
+// entry); the others stay valid for verification so keys can be rotated
+// without logging everyone out. When JWT_KEYS is unset, JWT_SECRET is used
+// as a single HS256 key with kid "default".
+func LoadSigningKeys() error {
+	ring := &keyRing{byKID: map[string]*signingKey{}}
+
+	if spec := strings.TrimSpace(os.Getenv("JWT_KEYS")); spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+			if len(parts) != 3 {
+				return fmt.Errorf("JWT_KEYS entry %q is not kid:ALG:path", entry)
+			}
+			data, err := os.ReadFile(parts[2])
+			if err != nil {
+				return fmt.Errorf("read key %s: %w", parts[0], err)
+			}
+			key, err := parseSigningKey(parts[0], parts[1], data)
+			if err != nil {
+				return err
+			}
+			if err := ring.add(key); err != nil {
+				return err
+			}
+		}
+	} else if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key, err := parseSigningKey("default", "HS256", []byte(secret))
+		if err != nil {
+			return err
+		}
+		ring.add(key)
+	} else {
+		return errors.New("no JWT signing key configured: set JWT_SECRET or JWT_KEYS")
+	}
+
+	activeKID := os.Getenv("JWT_ACTIVE_KID")
+	if activeKID == "" {
+		activeKID = ring.order[0]
+	}
+	active, ok := ring.byKID[activeKID]
+	if !ok {
+		return fmt.Errorf("JWT_ACTIVE_KID %q is not in JWT_KEYS", activeKID)
+	}
+	if active.sign == nil {
+		return fmt.Errorf("active key %q has no private key to sign with", activeKID)
+	}
+	ring.active = active
+
+	keys = ring
+	return nil
+}
+
+func (r *keyRing) add(key *signingKey) error {
+	if _, dup := r.byKID[key.kid]; dup {
+		return fmt.Errorf("duplicate JWT key id %q", key.kid)
+	}
+	r.byKID[key.kid] = key
+	r.order = append(r.order, key.kid)
+	return nil
+}
+
+// parseSigningKey decodes an HMAC secret or a PEM private/public key for alg
+func parseSigningKey(kid, alg string, data []byte) (*signingKey, error) {
+	key := &signingKey{kid: kid}
+	switch alg {
+	case "HS256":
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < minHMACSecretLen {
+			return nil, fmt.Errorf("key %s: HS256 secret must be at least %d bytes", kid, minHMACSecretLen)
+		}
+		key.method = jwt.SigningMethodHS256
+		key.sign, key.verify = secret, secret
+	case "RS256":
+		key.method = jwt.SigningMethodRS256
+		if priv, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.sign, key.verify = priv, &priv.PublicKey
+		} else if pub, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			key.verify = pub
+		} else {
+			return nil, fmt.Errorf("key %s: not an RSA PEM key", kid)
+		}
+	case "ES256":
+		key.method = jwt.SigningMethodES256
+		var pub *ecdsa.PublicKey
+		if priv, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			key.sign, pub = priv, &priv.PublicKey
+		} else if pub, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("key %s: not an EC PEM key", kid)
+		}
+		if pub.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("key %s: ES256 requires a P-256 key", kid)
+		}
+		key.verify = pub
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q", kid, alg)
+	}
+	return key, nil
+}
+
+// signToken signs claims with the active key and tags the token with its kid
+func signToken(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		return "", errors.New("signing keys not loaded")
+	}
+	token := jwt.NewWithClaims(keys.active.method, claims)
+	token.Header["kid"] = keys.active.kid
+	return token.SignedString(keys.active.sign)
+}
+
+// verificationKey is the jwt.Keyfunc used by JWTAuth. Tokens are matched to a
+// key by their kid header, and the algorithm must be the one the key was
+// configured for so an RSA public key can never be used as an HMAC secret.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return nil, errors.New("signing keys not loaded")
+	}
+	key := keys.active
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = keys.byKID[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, jwt.ErrSignatureInvalid
+	}
+	return key.verify, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys other services can use to verify tokens issued by this API. HMAC keys are never published.
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string][]JWK
+// @Router       /.well-known/jwks.json [get]
+func JWKS(c *gin.Context) {
+	set := []JWK{}
+	if keys != nil {
+		for _, kid := range keys.order {
+			if jwk, ok := toJWK(keys.byKID[kid]); ok {
+				set = append(set, jwk)
+			}
+		}
+	}
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": set})
+}
+
+func toJWK(key *signingKey) (JWK, bool) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	switch pub := key.verify.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA", Kid: key.kid, Use: "sig", Alg: key.method.Alg(),
+			N: b64(pub.N.Bytes()),
+			E: b64(big.NewInt(int64(pub.E)).Bytes()),
+		}, true
+	case *ecdsa.PublicKey:
+		// Coordinates are fixed-width for the curve (32 bytes for P-256)
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC", Kid: key.kid, Use: "sig", Alg: key.method.Alg(),
+			Crv: pub.Curve.Params().Name,
+			X:   b64(pub.X.FillBytes(make([]byte, size))),
+			Y:   b64(pub.Y.FillBytes(make([]byte, size))),
+		}, true
+	}
+	return JWK{}, false
+}
@@ -0,0 +1,271 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testSecret is an HS256 secret of the shortest length accepted
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// testKeys are generated once for the package's tests
+var (
+	testRSAKey    = mustRSAKey()
+	testOldRSAKey = mustRSAKey()
+	testECKey     = mustECKey(elliptic.P256())
+	testP384Key   = mustECKey(elliptic.P384())
+	testRSAPublic = pemBlock("PUBLIC KEY", must(x509.MarshalPKIXPublicKey(&testRSAKey.PublicKey)))
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func mustECKey(curve elliptic.Curve) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func must(der []byte, err error) []byte {
+	if err != nil {
+		panic(err)
+	}
+	return der
+}
+
+func pemBlock(kind string, der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der})
+}
+
+// writeKey writes a key file for JWT_KEYS and returns its path
+func writeKey(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useTestKeys loads a key ring for the rest of the test: rsa signs, and
+// hmac, ec and the verify-only old are accepted
+func useTestKeys(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_KEYS", strings.Join([]string{
+		"rsa:RS256:" + writeKey(t, "rsa.pem", pemBlock("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testRSAKey))),
+		"hmac:HS256:" + writeKey(t, "hmac", []byte(testSecret+"\n")),
+		"ec:ES256:" + writeKey(t, "ec.pem", pemBlock("EC PRIVATE KEY", must(x509.MarshalECPrivateKey(testECKey)))),
+		"old:RS256:" + writeKey(t, "old.pem", pemBlock("PUBLIC KEY", must(x509.MarshalPKIXPublicKey(&testOldRSAKey.PublicKey)))),
+	}, ","))
+	t.Setenv("JWT_ACTIVE_KID", "rsa")
+	old := keys
+	t.Cleanup(func() { keys = old })
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatalf("LoadSigningKeys: %v", err)
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		alg    string
+		data   []byte
+		signs  bool
+		errMsg string
+	}{
+		{"HMAC secret", "HS256", []byte(testSecret), true, ""},
+		{"HMAC secret with a newline", "HS256", []byte(testSecret + "\n"), true, ""},
+		{"short HMAC secret", "HS256", []byte(testSecret[1:] + "\n"), false, "key k: HS256 secret must be at least 32 bytes"},
+		{"RSA private key", "RS256", pemBlock("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testRSAKey)), true, ""},
+		{"RSA public key", "RS256", testRSAPublic, false, ""},
+		{"EC key as RSA", "RS256", pemBlock("EC PRIVATE KEY", must(x509.MarshalECPrivateKey(testECKey))), false, "key k: not an RSA PEM key"},
+		{"EC private key", "ES256", pemBlock("EC PRIVATE KEY", must(x509.MarshalECPrivateKey(testECKey))), true, ""},
+		{"EC public key", "ES256", pemBlock("PUBLIC KEY", must(x509.MarshalPKIXPublicKey(&testECKey.PublicKey))), false, ""},
+		{"P-384 key", "ES256", pemBlock("EC PRIVATE KEY", must(x509.MarshalECPrivateKey(testP384Key))), false, "key k: ES256 requires a P-256 key"},
+		{"not PEM", "ES256", []byte(testSecret), false, "key k: not an EC PEM key"},
+		{"unsupported algorithm", "none", []byte(testSecret), false, `key k: unsupported algorithm "none"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := parseSigningKey("k", test.alg, test.data)
+			if test.errMsg != "" {
+				if err == nil || err.Error() != test.errMsg {
+					t.Fatalf("parseSigningKey = %v, want %q", err, test.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSigningKey: %v", err)
+			}
+			if key.method.Alg() != test.alg || (key.sign != nil) != test.signs || key.verify == nil {
+				t.Errorf("parseSigningKey = %s key, signs %v; want %s, signs %v", key.method.Alg(), key.sign != nil, test.alg, test.signs)
+			}
+		})
+	}
+}
+
+func TestLoadSigningKeys(t *testing.T) {
+	rsaPath := writeKey(t, "rsa.pem", pemBlock("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(testRSAKey)))
+	publicPath := writeKey(t, "public.pem", testRSAPublic)
+	for _, test := range []struct {
+		name               string
+		keys, active       string
+		secret             string
+		wantActive, errMsg string
+	}{
+		{name: "JWT_SECRET", secret: testSecret, wantActive: "default"},
+		{name: "short JWT_SECRET", secret: "too-short", errMsg: "key default: HS256 secret must be at least 32 bytes"},
+		{name: "nothing", errMsg: "no JWT signing key configured: set JWT_SECRET or JWT_KEYS"},
+		{name: "first key signs", keys: "a:RS256:" + rsaPath + ",b:RS256:" + publicPath, wantActive: "a"},
+		{name: "JWT_KEYS wins", keys: "a:RS256:" + rsaPath, secret: testSecret, wantActive: "a"},
+		{name: "verify-only active key", keys: "a:RS256:" + rsaPath + ",b:RS256:" + publicPath, active: "b", errMsg: `active key "b" has no private key to sign with`},
+		{name: "unknown active key", keys: "a:RS256:" + rsaPath, active: "c", errMsg: `JWT_ACTIVE_KID "c" is not in JWT_KEYS`},
+		{name: "duplicate kid", keys: "a:RS256:" + rsaPath + ",a:RS256:" + publicPath, errMsg: `duplicate JWT key id "a"`},
+		{name: "malformed entry", keys: "a:RS256", errMsg: `JWT_KEYS entry "a:RS256" is not kid:ALG:path`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("JWT_KEYS", test.keys)
+			t.Setenv("JWT_ACTIVE_KID", test.active)
+			t.Setenv("JWT_SECRET", test.secret)
+			old := keys
+			t.Cleanup(func() { keys = old })
+
+			err := LoadSigningKeys()
+			if test.errMsg != "" {
+				if err == nil || err.Error() != test.errMsg {
+					t.Fatalf("LoadSigningKeys = %v, want %q", err, test.errMsg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSigningKeys: %v", err)
+			}
+			if keys.active.kid != test.wantActive {
+				t.Errorf("active key %q, want %q", keys.active.kid, test.wantActive)
+			}
+		})
+	}
+}
+
+// parseToken verifies a token as JWTAuth does
+func parseToken(token string) error {
+	_, err := jwt.Parse(token, verificationKey, jwt.WithValidMethods([]string{"HS256", "RS256", "ES256"}))
+	return err
+}
+
+// signWith signs a token with the given method, key and, unless empty, kid
+func signWith(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"user_id": 1, "jti": "j"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerificationKey(t *testing.T) {
+	useTestKeys(t)
+	active, err := signToken(jwt.MapClaims{"user_id": 1, "jti": "j"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"signed by the active key", active, true},
+		{"no kid falls back to the active key", signWith(t, jwt.SigningMethodRS256, testRSAKey, ""), true},
+		{"HMAC key", signWith(t, jwt.SigningMethodHS256, []byte(testSecret), "hmac"), true},
+		{"EC key", signWith(t, jwt.SigningMethodES256, testECKey, "ec"), true},
+		{"retired key kept to verify", signWith(t, jwt.SigningMethodRS256, testOldRSAKey, "old"), true},
+		// Algorithm confusion: the published public key used as an HMAC secret
+		{"HS256 with the RSA public key", signWith(t, jwt.SigningMethodHS256, testRSAPublic, "rsa"), false},
+		{"HS256 with the RSA public key and no kid", signWith(t, jwt.SigningMethodHS256, testRSAPublic, ""), false},
+		{"HMAC kid signed with RSA", signWith(t, jwt.SigningMethodRS256, testRSAKey, "hmac"), false},
+		{"EC kid signed with RSA", signWith(t, jwt.SigningMethodRS256, testRSAKey, "ec"), false},
+		{"unknown kid", signWith(t, jwt.SigningMethodRS256, testRSAKey, "other"), false},
+		{"no kid, another key", signWith(t, jwt.SigningMethodHS256, []byte(testSecret), ""), false},
+		{"wrong key for the kid", signWith(t, jwt.SigningMethodRS256, testRSAKey, "old"), false},
+		{"unsigned", signWith(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "rsa"), false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if err := parseToken(test.token); (err == nil) != test.valid {
+				t.Errorf("parse = %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	useTestKeys(t)
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	JWKS(c)
+	if w.Code != http.StatusOK {
+		t.Fatalf("JWKS: %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), base64.RawURLEncoding.EncodeToString([]byte(testSecret))) ||
+		strings.Contains(w.Body.String(), testSecret) || strings.Contains(w.Body.String(), `"k"`) {
+		t.Fatalf("JWKS publishes the HMAC secret: %s", w.Body)
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	var kids []string
+	for _, key := range set.Keys {
+		kids = append(kids, key["kid"])
+		for field := range key {
+			// Private RSA and EC parts
+			if field == "d" || field == "p" || field == "q" {
+				t.Errorf("key %s has private field %s", key["kid"], field)
+			}
+		}
+	}
+	if strings.Join(kids, ",") != "rsa,ec,old" {
+		t.Fatalf("JWKS kids = %v, want rsa, ec and old", kids)
+	}
+
+	b64 := func(n *big.Int) string { return base64.RawURLEncoding.EncodeToString(n.Bytes()) }
+	rsaKey, ecKey := set.Keys[0], set.Keys[1]
+	if rsaKey["kty"] != "RSA" || rsaKey["alg"] != "RS256" || rsaKey["n"] != b64(testRSAKey.N) || rsaKey["e"] != "AQAB" {
+		t.Errorf("RSA key = %v", rsaKey)
+	}
+	if ecKey["kty"] != "EC" || ecKey["alg"] != "ES256" || ecKey["crv"] != "P-256" ||
+		ecKey["x"] != base64.RawURLEncoding.EncodeToString(testECKey.X.FillBytes(make([]byte, 32))) ||
+		ecKey["y"] != base64.RawURLEncoding.EncodeToString(testECKey.Y.FillBytes(make([]byte, 32))) {
+		t.Errorf("EC key = %v", ecKey)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when a login names an unknown email so the
+// response time doesn't reveal which accounts exist.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("genomic-api-dummy"), bcrypt.DefaultCost)
+
+// HashPassword returns a salted bcrypt hash of a plaintext password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword compares a plaintext password against the stored value.
+// Rows created before passwords were hashed hold the plaintext itself; those
+// are still accepted and reported as legacy so the caller can re-hash them.
+func CheckPassword(stored, password string) (ok bool, legacy bool) {
+	if !isBcryptHash(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil, false
+}
+
+func isBcryptHash(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenPair is returned by login and refresh
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+}
+
+// randomToken returns n random bytes, URL-safe encoded
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand never fails on supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokens signs a new access token and stores the refresh token paired
+// with it. familyID ties every rotation of one login session together.
+func issueTokens(tx *gorm.DB, user models.User, familyID string) (TokenPair, error) {
+	now := time.Now()
+	jti := randomToken(16)
+	access, err := signToken(jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+		"jti":     jti,
+		"sid":     familyID,
+		"iat":     now.Unix(),
+		"exp":     now.Add(accessTokenTTL).Unix(),
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refresh := randomToken(32)
+	row := models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refresh),
+		AccessJTI: jti,
+		ExpiresAt: now.Add(refreshTokenTTL),
+	}
+	if err := tx.Create(&row).Error; err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokeSessions revokes the refresh tokens selected by scope and puts every
+// access token issued with them on the revocation list. Each access token is
+// issued alongside a refresh token row, so the rows created within the access
+// token lifetime cover every access token that could still be valid.
+func revokeSessions(tx *gorm.DB, scope func(*gorm.DB) *gorm.DB) error {
+	now := time.Now()
+
+	var live []models.RefreshToken
+	if err := tx.Scopes(scope).Where("created_at > ?", now.Add(-accessTokenTTL)).Find(&live).Error; err != nil {
+		return err
+	}
+	for _, rt := range live {
+		revoked := models.RevokedToken{
+			JTI:       rt.AccessJTI,
+			UserID:    rt.UserID,
+			ExpiresAt: rt.CreatedAt.Add(accessTokenTTL),
+			RevokedAt: now,
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&models.RefreshToken{}).Scopes(scope).
+		Where("revoked_at IS NULL").Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+
+	// Entries for tokens that have expired anyway are no longer needed
+	return tx.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error
+}
+
+// RevokeUserSessions logs a user out everywhere: all refresh tokens are
+// revoked and all outstanding access tokens are rejected from now on.
+func RevokeUserSessions(tx *gorm.DB, userID int) error {
+	return revokeSessions(tx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
+	})
+}
+
+// RevokeOtherSessions is RevokeUserSessions except for the session keepSID,
+// so a user changing their password stays logged in where they did it
+func RevokeOtherSessions(tx *gorm.DB, userID int, keepSID string) error {
+	return revokeSessions(tx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ? AND family_id <> ?", userID, keepSID)
+	})
+}
+
+func revokeFamily(tx *gorm.DB, familyID string) error {
+	return revokeSessions(tx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("family_id = ?", familyID)
+	})
+}
+
+// isRevoked reports whether an access token's jti is on the revocation list
+func isRevoked(jti string) (bool, error) {
+	var count int64
+	err := config.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+var errRefreshReused = errors.New("refresh token reused")
+
+// Refresh godoc
+// @Summary      Refresh tokens
+// @Description  Exchange a refresh token for a new access token and a new refresh token. Each refresh token works once; presenting a used one revokes the whole session.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        refresh  body      RefreshInput  true  "Refresh token"
+// @Success      200      {object}  TokenPair
+// @Failure      401      {object}  map[string]string
+// @Router       /api/token/refresh [post]
+func Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing refresh token"})
+		return
+	}
+
+	var pair TokenPair
+	var reusedFamily string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(input.RefreshToken)).First(&current).Error; err != nil {
+			return err
+		}
+		if current.RevokedAt != nil {
+			reusedFamily = current.FamilyID
+			return errRefreshReused
+		}
+		if time.Now().After(current.ExpiresAt) {
+			return gorm.ErrRecordNotFound
+		}
+
+		var user models.User
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&current).Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		var err error
+		pair, err = issueTokens(tx, user, current.FamilyID)
+		return err
+	})
+
+	// A rotated-out token came back: assume it was stolen and kill the session.
+	// This runs in its own transaction since the one above was rolled back.
+	if errors.Is(err, errRefreshReused) {
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			return revokeFamily(tx, reusedFamily)
+		})
+		if err == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token already used; session revoked"})
+			return
+		}
+	}
+
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, pair)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not refresh token"})
+	}
+}
+
+// Logout godoc
+// @Summary      Log out
+// @Description  Revoke the current session: its refresh token and every access token issued for it
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object}  map[string]string
+// @Router       /api/logout [post]
+func Logout(c *gin.Context) {
+	sid := currentClaim(c, "sid")
+	if sid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	userID, _ := CurrentUserID(c)
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := revokeFamily(tx, sid); err != nil {
+			return err
+		}
+		return audit.Record(tx, audit.Entry{
+			UserID:       userID,
+			Action:       audit.ActionLogout,
+			ResourceType: audit.ResourceUser,
+			ResourceID:   userID,
+		})
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not log out"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
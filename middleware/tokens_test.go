@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"genomic-api/audit"
+	"genomic-api/config"
+	"genomic-api/models"
+	"genomic-api/testdb"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+)
+
+// useTestDB points config.DB at a throwaway database for the rest of the
+// test, and loads the test keys
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := testdb.Open(t)
+	old := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = old })
+	useTestKeys(t)
+	return db
+}
+
+// createTestUser inserts a researcher who needn't change their password
+func createTestUser(t *testing.T, db *gorm.DB) models.User {
+	t.Helper()
+	user := models.User{Email: "researcher@example.com", PasswordHash: "x", Role: models.RoleResearcher}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// authRouter serves refresh and logout, and a route that only checks the token
+func authRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	gin.DefaultErrorWriter = io.Discard
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	r := gin.New()
+	r.POST("/api/token/refresh", Refresh)
+	r.POST("/api/logout", JWTAuth(), Logout)
+	r.GET("/api/me", JWTAuth(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return r
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// refresh exchanges a refresh token, returning the response and new pair
+func refresh(t *testing.T, r http.Handler, token string) (*httptest.ResponseRecorder, TokenPair) {
+	t.Helper()
+	body, _ := json.Marshal(RefreshInput{RefreshToken: token})
+	w := serve(r, httptest.NewRequest(http.MethodPost, "/api/token/refresh", bytes.NewReader(body)))
+	var pair TokenPair
+	json.Unmarshal(w.Body.Bytes(), &pair)
+	return w, pair
+}
+
+// authorized makes a request with an access token and returns its status
+func authorized(r http.Handler, method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return serve(r, req).Code
+}
+
+func login(t *testing.T, db *gorm.DB, user models.User) TokenPair {
+	t.Helper()
+	pair, err := issueTokens(db, user, randomToken(16))
+	if err != nil {
+		t.Fatalf("issue tokens: %v", err)
+	}
+	return pair
+}
+
+func TestRefreshRotates(t *testing.T) {
+	db := useTestDB(t)
+	user := createTestUser(t, db)
+	r := authRouter()
+	first := login(t, db, user)
+
+	w, second := refresh(t, r, first.RefreshToken)
+	if w.Code != http.StatusOK || second.Token == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("refresh: %d %s", w.Code, w.Body)
+	}
+	if code := authorized(r, http.MethodGet, "/api/me", second.Token); code != http.StatusOK {
+		t.Fatalf("new access token: %d", code)
+	}
+	var rows []models.RefreshToken
+	db.Order("id").Find(&rows)
+	if len(rows) != 2 || rows[0].RevokedAt == nil || rows[1].RevokedAt != nil || rows[0].FamilyID != rows[1].FamilyID {
+		t.Fatalf("refresh tokens after rotating: %+v", rows)
+	}
+
+	if w, _ := refresh(t, r, "not-a-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown refresh token: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	db := useTestDB(t)
+	user := createTestUser(t, db)
+	r := authRouter()
+	first := login(t, db, user)
+	other := login(t, db, user) // another session of the same user
+
+	_, second := refresh(t, r, first.RefreshToken)
+	_, third := refresh(t, r, second.RefreshToken)
+
+	// The first token comes back, e.g. from whoever stole it
+	if w, _ := refresh(t, r, first.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: %d %s", w.Code, w.Body)
+	}
+	// The whole session is gone, including what the legitimate client holds
+	if w, _ := refresh(t, r, third.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("latest refresh token of a revoked session: %d %s", w.Code, w.Body)
+	}
+	for name, token := range map[string]string{"first": first.Token, "second": second.Token, "third": third.Token} {
+		if code := authorized(r, http.MethodGet, "/api/me", token); code != http.StatusUnauthorized {
+			t.Errorf("%s access token of a revoked session: %d", name, code)
+		}
+	}
+	// Other sessions carry on
+	if code := authorized(r, http.MethodGet, "/api/me", other.Token); code != http.StatusOK {
+		t.Errorf("access token of another session: %d", code)
+	}
+	if w, _ := refresh(t, r, other.RefreshToken); w.Code != http.StatusOK {
+		t.Errorf("refresh token of another session: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestJWTAuthRejectsRevokedToken(t *testing.T) {
+	db := useTestDB(t)
+	user := createTestUser(t, db)
+	r := authRouter()
+	pair := login(t, db, user)
+
+	if code := authorized(r, http.MethodGet, "/api/me", pair.Token); code != http.StatusOK {
+		t.Fatalf("before revoking: %d", code)
+	}
+	if err := RevokeUserSessions(db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/me", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.Token)
+	w := serve(r, req)
+	if w.Code != http.StatusUnauthorized || !bytes.Contains(w.Body.Bytes(), []byte("Token has been revoked")) {
+		t.Errorf("revoked token: %d %s", w.Code, w.Body)
+	}
+	var revoked int64
+	db.Model(&models.RevokedToken{}).Where("user_id = ?", user.ID).Count(&revoked)
+	if revoked != 1 {
+		t.Errorf("%d revoked tokens, want 1", revoked)
+	}
+}
+
+func TestLogoutRevokesBothTokens(t *testing.T) {
+	db := useTestDB(t)
+	user := createTestUser(t, db)
+	r := authRouter()
+	pair := login(t, db, user)
+	other := login(t, db, user)
+
+	if code := authorized(r, http.MethodPost, "/api/logout", pair.Token); code != http.StatusOK {
+		t.Fatalf("logout: %d", code)
+	}
+	if code := authorized(r, http.MethodGet, "/api/me", pair.Token); code != http.StatusUnauthorized {
+		t.Errorf("access token after logout: %d", code)
+	}
+	if w, _ := refresh(t, r, pair.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token after logout: %d %s", w.Code, w.Body)
+	}
+	if code := authorized(r, http.MethodGet, "/api/me", other.Token); code != http.StatusOK {
+		t.Errorf("another session after logout: %d", code)
+	}
+	var logouts int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", audit.ActionLogout, user.ID).Count(&logouts)
+	if logouts != 1 {
+		t.Errorf("%d logout audit entries, want 1", logouts)
+	}
+}
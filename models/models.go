@@ -1,13 +1,27 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// User roles
+const (
+	RoleAdmin         = "admin"
+	RoleResearcher    = "researcher"
+	RoleLabTechnician = "lab_technician"
+	RoleGuest         = "guest"
+)
 
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         string    `json:"role"` // admin, researcher, guest, lab_technician
-	CreatedAt    time.Time `json:"created_at"`
+	ID                 int       `json:"id"`
+	Email              string    `json:"email"`
+	PasswordHash       string    `json:"-"`
+	Role               string    `json:"role"` // admin, researcher, guest, lab_technician
+	MustChangePassword bool      `json:"must_change_password"`
+	CreatedAt          time.Time `json:"created_at"`
 }
 
 type Genome struct {
@@ -17,6 +31,24 @@ type Genome struct {
 	ReferenceVersion string    `json:"reference_version"`
 	CreatedBy        int       `json:"created_by"`
 	CreatedAt        time.Time `json:"created_at"`
+
+	FastaPath       string `json:"fasta_path"`       // storage key of the reference FASTA, uncompressed
+	FaiPath         string `json:"fai_path"`         // storage key of its .fai index, if any
+	ReferenceStatus string `json:"reference_status"` // contig indexing: queued, running, succeeded or failed; empty without a FASTA
+	ContigCount     int64  `json:"contig_count"`
+}
+
+// Contig is a sequence of a genome's reference FASTA
+type Contig struct {
+	ID          int    `json:"id"`
+	GenomeID    int    `json:"genome_id"`
+	Name        string `json:"name"`
+	Length      int64  `json:"length"`
+	MD5         string `json:"md5"`                                 // of the uppercase sequence, as refget computes it
+	SHA512t24u  string `gorm:"column:sha512t24u" json:"sha512t24u"` // GA4GH digest; the refget ID is SQ.<sha512t24u>
+	FastaOffset int64  `json:"fasta_offset"`                        // where its first base is in the FASTA
+	LineBases   int    `json:"line_bases"`
+	LineWidth   int    `json:"line_width"` // bytes per line, with the line ending
 }
 
 type Sample struct {
@@ -30,14 +62,93 @@ type Sample struct {
 	CreatedAt      time.Time `json:"created_at"`
 }
 
+// Cohort is a named group of samples analysed together
+type Cohort struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	SampleIDs   []int     `gorm:"-" json:"sample_ids"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CohortSample is one sample's membership of a cohort
+type CohortSample struct {
+	CohortID int `gorm:"primaryKey"`
+	SampleID int `gorm:"primaryKey"`
+}
+
 type SequenceFile struct {
 	ID         int       `json:"id"`
 	SampleID   int       `json:"sample_id"`
 	FilePath   string    `json:"file_path"`
-	FileType   string    `json:"file_type"`
-	Checksum   string    `json:"checksum"`
-	UploadedBy int       `json:"uploaded_by"`
+	FileName   string    `json:"file_name"` // original name, used for downloads
+	FileType   string    `json:"file_type"` // FASTQ, BAM or CRAM
+	Checksum   string    `json:"checksum"`  // SHA-256, hex
+	MD5        string    `json:"md5"`
+	SizeBytes  int64     `json:"size_bytes"`
+	UploadedBy *int      `json:"uploaded_by"` // nil for service account uploads
 	UploadedAt time.Time `json:"uploaded_at"`
+
+	LastVerifiedAt     *time.Time `json:"last_verified_at"`
+	VerificationStatus string     `json:"verification_status"` // see integrity.Status*; empty until first checked
+
+	IndexPath   string `json:"index_path"`   // storage key of the .bai, .csi or .crai index, if any
+	IndexStatus string `json:"index_status"` // latest index generation job: queued, running, succeeded or failed; empty if never run
+
+	HeaderStatus string `json:"header_status"`                      // see headercheck.Status*; empty until checked
+	HeaderReport JSON   `json:"header_report" swaggertype:"object"` // headercheck.Report
+
+	QCStatus string `gorm:"column:qc_status" json:"qc_status"` // latest QC job: queued, running, succeeded or failed; empty if never run
+}
+
+// FastqMetrics are the read metrics of a FASTQ sequence file, computed by
+// its QC job
+type FastqMetrics struct {
+	SequenceFileID     int       `gorm:"primaryKey;autoIncrement:false" json:"sequence_file_id"`
+	Reads              int64     `json:"reads"`
+	Bases              int64     `json:"bases"`
+	MinLength          int       `json:"min_length"`
+	MaxLength          int       `json:"max_length"`
+	MeanLength         float64   `json:"mean_length"`
+	MeanQuality        float64   `json:"mean_quality"`                                   // Phred, over all bases
+	Q30Rate            float64   `gorm:"column:q30_rate" json:"q30_rate"`                // fraction of bases with quality 30 or more
+	GCContent          float64   `gorm:"column:gc_content" json:"gc_content"`            // fraction of A, C, G and T bases that are G or C
+	NRate              float64   `gorm:"column:n_rate" json:"n_rate"`                    // fraction of bases that are N
+	DuplicateRate      float64   `json:"duplicate_rate"`                                 // estimated fraction of reads repeating an earlier one
+	LengthDistribution JSON      `json:"length_distribution" swaggertype:"array,object"` // [{min, max, reads}]
+	PositionQuality    JSON      `json:"position_quality" swaggertype:"array,object"`    // [{start, end, mean_quality}], 1-based
+	ComputedAt         time.Time `json:"computed_at"`
+}
+
+// AlignmentMetrics are what a BAM or CRAM sequence file's header declares
+// and how its reads aligned, computed by its QC job. The flag counts are
+// nil for CRAM, whose records aren't decoded.
+type AlignmentMetrics struct {
+	SequenceFileID     int    `gorm:"primaryKey;autoIncrement:false" json:"sequence_file_id"`
+	Format             string `json:"format"`     // BAM or CRAM
+	SortOrder          string `json:"sort_order"` // @HD SO
+	Assembly           string `json:"assembly"`   // @SQ AS, if the header names one
+	ReferenceCount     int    `json:"reference_count"`
+	ReferenceSequences JSON   `json:"reference_sequences" swaggertype:"array,object"` // [{name, length}], from @SQ
+	ReadGroups         JSON   `json:"read_groups" swaggertype:"array,object"`         // @RG tag -> value
+	Programs           JSON   `json:"programs" swaggertype:"array,object"`            // @PG tag -> value
+
+	TotalReads         int64    `json:"total_reads"` // alignments, secondary and supplementary included
+	Mapped             *int64   `json:"mapped"`
+	MappedRate         *float64 `json:"mapped_rate"` // of total_reads
+	Paired             *int64   `json:"paired"`      // primary alignments of paired reads
+	ProperlyPaired     *int64   `json:"properly_paired"`
+	ProperlyPairedRate *float64 `json:"properly_paired_rate"` // of paired
+	Duplicates         *int64   `json:"duplicates"`
+	DuplicateRate      *float64 `json:"duplicate_rate"` // of total_reads
+	Secondary          *int64   `json:"secondary"`
+	Supplementary      *int64   `json:"supplementary"`
+	QCFailed           *int64   `gorm:"column:qc_failed" json:"qc_failed"`
+	Singletons         *int64   `json:"singletons"`                                      // mapped, with the mate unmapped
+	MateOtherChrom     *int64   `gorm:"column:mate_other_chrom" json:"mate_other_chrom"` // mate mapped to a different reference
+
+	ComputedAt time.Time `json:"computed_at"`
 }
 
 type VariantFile struct {
@@ -45,18 +156,257 @@ type VariantFile struct {
 	SampleID   int       `json:"sample_id"`
 	GenomeID   int       `json:"genome_id"`
 	FilePath   string    `json:"file_path"`
-	FileType   string    `json:"file_type"`
-	Checksum   string    `json:"checksum"`
-	UploadedBy int       `json:"uploaded_by"`
+	FileName   string    `json:"file_name"` // original name, used for downloads
+	FileType   string    `json:"file_type"` // VCF, JSON or GFF
+	Checksum   string    `json:"checksum"`  // SHA-256, hex
+	MD5        string    `json:"md5"`
+	SizeBytes  int64     `json:"size_bytes"`
+	UploadedBy *int      `json:"uploaded_by"` // nil for service account uploads
 	UploadedAt time.Time `json:"uploaded_at"`
+
+	LastVerifiedAt     *time.Time `json:"last_verified_at"`
+	VerificationStatus string     `json:"verification_status"` // see integrity.Status*; empty until first checked
+
+	IngestStatus string `json:"ingest_status"` // queued, running, succeeded or failed; empty if never ingested
+	VariantCount int64  `json:"variant_count"` // records ingested into variants
+
+	IndexPath   string `json:"index_path"`   // storage key of the .tbi or .csi index, if any
+	IndexStatus string `json:"index_status"` // latest index generation job: queued, running, succeeded or failed; empty if never run
+
+	HeaderStatus string `json:"header_status"`                      // see headercheck.Status*; empty until checked
+	HeaderReport JSON   `json:"header_report" swaggertype:"object"` // headercheck.Report
+}
+
+// Index formats
+const (
+	IndexBAI  = "BAI"
+	IndexCSI  = "CSI"
+	IndexTBI  = "TBI"
+	IndexCRAI = "CRAI"
+)
+
+// IndexFile is the index of a sequence or variant file, stored as a file of
+// its own: a .bai or .csi of a BAM, a .crai of a CRAM, or a .tbi or .csi of
+// a bgzipped VCF. A file has at most one.
+type IndexFile struct {
+	ID             int       `json:"id"`
+	SequenceFileID *int      `json:"sequence_file_id,omitempty"`
+	VariantFileID  *int      `json:"variant_file_id,omitempty"`
+	Format         string    `json:"format"` // BAI, CSI, TBI or CRAI
+	FilePath       string    `json:"file_path"`
+	FileName       string    `json:"file_name"` // used for downloads
+	Checksum       string    `json:"checksum"`  // SHA-256, hex
+	MD5            string    `json:"md5"`
+	SizeBytes      int64     `json:"size_bytes"`
+	Generated      bool      `json:"generated"`   // built by the server rather than uploaded
+	UploadedBy     *int      `json:"uploaded_by"` // nil when generated or uploaded by a service account
+	UploadedAt     time.Time `json:"uploaded_at"`
 }
 
 type AuditLog struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"user_id"`
-	Action       string    `json:"action"`
-	ResourceType string    `json:"resource_type"`
-	ResourceID   int       `json:"resource_id"`
-	Timestamp    time.Time `json:"timestamp"`
-	Details      string    `json:"details"`
+	ID               int       `json:"id"`
+	UserID           *int      `json:"user_id"`            // null for failed logins of unknown users
+	ServiceAccountID *int      `json:"service_account_id"` // set when the actor used an API key
+	Action           string    `json:"action"`
+	ResourceType     string    `json:"resource_type"`
+	ResourceID       int       `json:"resource_id"`
+	Timestamp        time.Time `json:"timestamp"`
+	Details          string    `json:"details"`   // JSON: created/deleted state or per-field changes
+	PrevHash         string    `json:"prev_hash"` // Hash of the previous entry
+	Hash             string    `json:"hash"`      // SHA-256 over this entry's contents and PrevHash
+}
+
+// AuditCheckpoint pins the head of the audit hash chain at a point in time
+// so that truncating or rewriting the chain after it can be detected.
+type AuditCheckpoint struct {
+	ID         int       `json:"id"`
+	AuditLogID int       `json:"audit_log_id"`
+	Hash       string    `json:"hash"`
+	Signature  string    `json:"signature"` // HMAC-SHA256 of AuditLogID and Hash when a checkpoint key is configured
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RefreshToken is one link in a rotating refresh token family. Only a hash of
+// the token is stored; AccessJTI is the access token issued alongside it.
+type RefreshToken struct {
+	ID        int        `json:"id"`
+	UserID    int        `json:"user_id"`
+	FamilyID  string     `json:"family_id"`
+	TokenHash string     `json:"-"`
+	AccessJTI string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token that must be rejected before it expires
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	UserID    int       `json:"user_id"` // kept after the user is deleted
+	ExpiresAt time.Time `json:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// ServiceAccount is a non-human caller such as a pipeline, authenticated with API keys
+type ServiceAccount struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Disabled    bool      `json:"disabled"`
+	CreatedBy   int       `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// APIKey is a credential for a service account. Only a hash of the key is
+// stored; Prefix is the public part used to look it up and identify it.
+type APIKey struct {
+	ID               int        `json:"id"`
+	ServiceAccountID int        `json:"service_account_id"`
+	Name             string     `json:"name"`
+	Prefix           string     `json:"prefix"`
+	KeyHash          string     `json:"-"`
+	Scopes           string     `json:"scopes"` // space-separated, e.g. "read:samples write:variants"
+	ExpiresAt        *time.Time `json:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Kinds of upload; each matches the audit resource type of the file it creates
+const (
+	UploadSequenceFile = "sequence_file"
+	UploadVariantFile  = "variant_file"
+)
+
+// UploadSession tracks a resumable file upload. Chunks are appended to a
+// staging file, and the running MD5 and SHA-256 states are saved after each
+// one so hashing picks up where the last chunk ended.
+type UploadSession struct {
+	ID               string     `gorm:"primaryKey" json:"id"`
+	Kind             string     `json:"kind"`
+	SampleID         int        `json:"sample_id"`
+	GenomeID         int        `json:"genome_id,omitempty"` // variant files only
+	FileType         string     `json:"file_type"`
+	FileName         string     `json:"file_name"`
+	Size             int64      `json:"size"`
+	Received         int64      `json:"received"`
+	ExpectedMD5      string     `json:"expected_md5,omitempty"`
+	ExpectedSHA256   string     `json:"expected_sha256,omitempty"`
+	MD5State         []byte     `json:"-"`
+	SHA256State      []byte     `json:"-"`
+	UserID           int        `json:"user_id,omitempty"`
+	ServiceAccountID int        `json:"service_account_id,omitempty"`
+	SequenceFileID   *int       `json:"sequence_file_id"` // set once a sequence file upload is complete
+	VariantFileID    *int       `json:"variant_file_id"`  // set once a variant file upload is complete
+	LockToken        *string    `json:"-"`                // lease of the request receiving a chunk
+	LockedUntil      *time.Time `json:"-"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// JSON is a json or jsonb column, passed through to API responses as-is
+type JSON json.RawMessage
+
+// Value implements driver.Valuer
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner
+func (j *JSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], v...)
+	case string:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into JSON", src)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// Variant is one record of an ingested VCF. Text columns hold the VCF text
+// as written, so "PASS" or "q10;s50" for Filter and "A,T" for Alt.
+type Variant struct {
+	ID            int64    `json:"id"`
+	VariantFileID int      `json:"variant_file_id"`
+	SampleID      int      `json:"sample_id"`
+	GenomeID      int      `json:"genome_id"`
+	Line          int64    `json:"line"` // line number in the VCF
+	Chrom         string   `json:"chrom"`
+	Pos           int64    `json:"pos"`     // 1-based
+	EndPos        int64    `json:"end_pos"` // last reference base covered
+	Bin           int      `json:"-"`       // binning.For(pos-1, end_pos), for region queries
+	VcfID         string   `json:"vcf_id"`
+	Ref           string   `json:"ref"`
+	Alt           string   `json:"alt"`
+	Qual          *float64 `json:"qual"`
+	Filter        string   `json:"filter"`
+	Info          JSON     `json:"info" swaggertype:"object"`      // key -> value; flags are true
+	Genotype      string   `json:"genotype"`                       // GT of the file's sample
+	Genotypes     JSON     `json:"genotypes" swaggertype:"object"` // sample name -> FORMAT key -> value
+}
+
+// Ingest job kinds
+const (
+	IngestVariants      = "variants"       // parse a VCF into variants
+	IngestReference     = "reference"      // index a genome's FASTA into contigs
+	IngestQC            = "qc"             // compute a sequence file's QC metrics
+	IngestSequenceIndex = "sequence_index" // build a BAM's BAI index
+	IngestVariantIndex  = "variant_index"  // build a bgzipped VCF's tabix index
+)
+
+// Ingest job statuses
+const (
+	IngestQueued    = "queued"
+	IngestRunning   = "running"
+	IngestSucceeded = "succeeded"
+	IngestFailed    = "failed"
+)
+
+// IngestError is a problem found while ingesting a file; Line is 0 when it
+// isn't about a particular line
+type IngestError struct {
+	Line    int64  `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+// IngestJob is background processing of an uploaded file. Workers on every
+// instance claim queued jobs; UpdatedAt is a heartbeat so a job left running
+// by a stopped instance is picked up again.
+type IngestJob struct {
+	ID             int        `json:"id"`
+	Kind           string     `json:"kind"`
+	VariantFileID  *int       `json:"variant_file_id,omitempty"`
+	GenomeID       *int       `json:"genome_id,omitempty"`
+	SequenceFileID *int       `json:"sequence_file_id,omitempty"`
+	Status         string     `json:"status"`
+	Records        int64      `json:"records"` // records processed so far
+	ErrorCount     int        `json:"error_count"`
+	Errors         JSON       `json:"errors" swaggertype:"array,object"` // the first IngestError values found
+	Attempts       int        `json:"attempts"`
+	CreatedAt      time.Time  `json:"created_at"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
 }
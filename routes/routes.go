@@ -4,7 +4,10 @@ import (
 	_ "genomic-api/docs"
 	"genomic-api/handlers"
 	"genomic-api/middleware"
+	"genomic-api/models"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -40,6 +43,22 @@ func init() {
 	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration)
 }
 
+// Role sets used by the route policies in SetupRouter
+var (
+	// anyRole is every authenticated user, including read-only guests
+	anyRole = []string{models.RoleAdmin, models.RoleResearcher, models.RoleLabTechnician, models.RoleGuest}
+	// labStaff register samples and sequencing output
+	labStaff = []string{models.RoleAdmin, models.RoleResearcher, models.RoleLabTechnician}
+	// curators manage reference genomes and variant calls
+	curators = []string{models.RoleAdmin, models.RoleResearcher}
+	// adminOnly covers user management, the audit trail and all deletes
+	adminOnly = []string{models.RoleAdmin}
+)
+
+// authenticate identifies the caller on every route that declares roles.
+// Tests replace it to exercise the route policies without tokens.
+var authenticate = middleware.JWTAuth
+
 // Middleware for observability
 func ObservabilityMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -66,15 +85,36 @@ func ObservabilityMiddleware() gin.HandlerFunc {
 	}
 }
 
+// trustedProxies reads TRUSTED_PROXIES, a comma-separated list of proxy IPs
+// or CIDRs. None are trusted by default.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
 // SetupRouter wires up all routes, middlewares, and observability
 func SetupRouter() *gin.Engine {
 	// Create Gin router with recovery and logging disabled (we’ll add observability middleware instead)
 	r := gin.New()
 	r.Use(gin.Recovery(), ObservabilityMiddleware())
 
+	// Only honour X-Forwarded-For from known proxies; client IPs are audited
+	// and bind signed download URLs, so they mustn't be spoofable
+	if err := r.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatal().Err(err).Msg("Invalid TRUSTED_PROXIES")
+	}
+
 	// ---- Swagger ----
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// ---- JWKS for services verifying our tokens ----
+	r.GET("/.well-known/jwks.json", middleware.JWKS)
+
 	// ---- Prometheus metrics ----
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
@@ -83,46 +123,180 @@ func SetupRouter() *gin.Engine {
 	{
 		// Public endpoints
 		api.POST("/login", middleware.Login)
+		api.POST("/token/refresh", middleware.Refresh)
+
+		// Signed download URLs carry their own authorization
+		api.GET("/sequence/:id/download", handlers.DownloadSequenceFile)
+		api.HEAD("/sequence/:id/download", handlers.DownloadSequenceFile)
+		api.GET("/variants/:id/download", handlers.DownloadVariantFile)
+		api.HEAD("/variants/:id/download", handlers.DownloadVariantFile)
+		api.GET("/sequence/:id/index/download", handlers.DownloadSequenceIndex)
+		api.HEAD("/sequence/:id/index/download", handlers.DownloadSequenceIndex)
+		api.GET("/variants/:id/index/download", handlers.DownloadVariantIndex)
+		api.HEAD("/variants/:id/index/download", handlers.DownloadVariantIndex)
 
-		// Protected group with JWT
+		// Protected group with JWT or API key; every route declares the roles allowed
+		// to call it, and RequireScope routes also accept API keys with that scope
 		protected := api.Group("/")
-		protected.Use(middleware.JWTAuth())
+		protected.Use(authenticate())
 		{
+			// Account
+			protected.POST("/logout", middleware.RequireRoles(anyRole...), middleware.Logout)
+			protected.PUT("/me/password", middleware.RequireRoles(anyRole...), handlers.ChangePassword)
+
 			// Users
-			protected.GET("/users", handlers.ListUsers)
-			protected.POST("/users", handlers.CreateUser)
-			protected.GET("/users/:id", handlers.GetUser)
-			protected.PUT("/users/:id", handlers.UpdateUser)
-			protected.DELETE("/users/:id", handlers.DeleteUser)
+			protected.GET("/users", middleware.RequireRoles(adminOnly...), handlers.ListUsers)
+			protected.POST("/users", middleware.RequireRoles(adminOnly...), handlers.CreateUser)
+			protected.GET("/users/:id", middleware.RequireRoles(adminOnly...), handlers.GetUser)
+			protected.PUT("/users/:id", middleware.RequireRoles(adminOnly...), handlers.UpdateUser)
+			protected.DELETE("/users/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteUser)
+			protected.POST("/users/:id/reset-password", middleware.RequireRoles(adminOnly...), handlers.ResetPassword)
+			protected.POST("/users/:id/revoke-sessions", middleware.RequireRoles(adminOnly...), handlers.RevokeUserSessions)
+			protected.GET("/users/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetUserHistory)
+
+			// Audit trail
+			protected.GET("/audit", middleware.RequireRoles(adminOnly...), handlers.ListAuditLogs)
+			protected.GET("/audit/export", middleware.RequireRoles(adminOnly...), handlers.ExportAuditLogs)
+			protected.GET("/audit/verify", middleware.RequireRoles(adminOnly...), handlers.VerifyAuditLog)
+
+			// Stored file integrity
+			protected.GET("/integrity", middleware.RequireRoles(adminOnly...), handlers.GetIntegritySummary)
+			protected.POST("/integrity/scrub", middleware.RequireRoles(adminOnly...), handlers.RequestScrub)
+
+			// Service accounts
+			protected.GET("/service-accounts", middleware.RequireRoles(adminOnly...), handlers.ListServiceAccounts)
+			protected.POST("/service-accounts", middleware.RequireRoles(adminOnly...), handlers.CreateServiceAccount)
+			protected.GET("/service-accounts/:id", middleware.RequireRoles(adminOnly...), handlers.GetServiceAccount)
+			protected.PUT("/service-accounts/:id", middleware.RequireRoles(adminOnly...), handlers.UpdateServiceAccount)
+			protected.GET("/service-accounts/:id/keys", middleware.RequireRoles(adminOnly...), handlers.ListAPIKeys)
+			protected.POST("/service-accounts/:id/keys", middleware.RequireRoles(adminOnly...), handlers.CreateAPIKey)
+			protected.DELETE("/service-accounts/:id/keys/:key_id", middleware.RequireRoles(adminOnly...), handlers.RevokeAPIKey)
 
 			// Genomes
-			protected.GET("/genomes", handlers.ListGenomes)
-			protected.POST("/genomes", handlers.CreateGenome)
-			protected.GET("/genomes/:id", handlers.GetGenome)
-			protected.PUT("/genomes/:id", handlers.UpdateGenome)
-			protected.DELETE("/genomes/:id", handlers.DeleteGenome)
+			protected.GET("/genomes", middleware.RequireScope("read:genomes", anyRole...), handlers.ListGenomes)
+			protected.POST("/genomes", middleware.RequireRoles(curators...), handlers.CreateGenome)
+			protected.GET("/genomes/:id", middleware.RequireScope("read:genomes", anyRole...), handlers.GetGenome)
+			protected.PUT("/genomes/:id", middleware.RequireRoles(curators...), handlers.UpdateGenome)
+			protected.DELETE("/genomes/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteGenome)
+			protected.GET("/genomes/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetGenomeHistory)
+			protected.GET("/genomes/:id/contigs", middleware.RequireScope("read:genomes", anyRole...), handlers.ListContigs)
+			protected.GET("/genomes/:id/reference", middleware.RequireScope("read:genomes", anyRole...), handlers.GetGenomeReference)
+			protected.POST("/genomes/:id/reference", middleware.RequireRoles(curators...), handlers.IndexGenomeReference)
 
 			// Samples
-			protected.GET("/samples", handlers.ListSamples)
-			protected.POST("/samples", handlers.CreateSample)
-			protected.GET("/samples/:id", handlers.GetSample)
-			protected.PUT("/samples/:id", handlers.UpdateSample)
-			protected.DELETE("/samples/:id", handlers.DeleteSample)
+			protected.GET("/samples", middleware.RequireScope("read:samples", anyRole...), handlers.ListSamples)
+			protected.POST("/samples", middleware.RequireScope("write:samples", labStaff...), handlers.CreateSample)
+			protected.GET("/samples/:id", middleware.RequireScope("read:samples", anyRole...), handlers.GetSample)
+			protected.PUT("/samples/:id", middleware.RequireScope("write:samples", labStaff...), handlers.UpdateSample)
+			protected.DELETE("/samples/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteSample)
+			protected.GET("/samples/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetSampleHistory)
+
+			// Cohorts
+			protected.GET("/cohorts", middleware.RequireScope("read:samples", anyRole...), handlers.ListCohorts)
+			protected.POST("/cohorts", middleware.RequireScope("write:samples", curators...), handlers.CreateCohort)
+			protected.GET("/cohorts/:id", middleware.RequireScope("read:samples", anyRole...), handlers.GetCohort)
+			protected.PUT("/cohorts/:id", middleware.RequireScope("write:samples", curators...), handlers.UpdateCohort)
+			protected.DELETE("/cohorts/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteCohort)
+			protected.GET("/cohorts/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetCohortHistory)
 
 			// Sequences
-			protected.GET("/sequence", handlers.ListSequenceFiles)
-			protected.POST("/sequence", handlers.CreateSequenceFile)
-			protected.GET("/sequence/:id", handlers.GetSequenceFile)
-			protected.PUT("/sequence/:id", handlers.UpdateSequenceFile)
-			protected.DELETE("/sequence/:id", handlers.DeleteSequenceFile)
+			protected.GET("/sequence", middleware.RequireScope("read:sequence", anyRole...), handlers.ListSequenceFiles)
+			protected.POST("/sequence", middleware.RequireScope("write:sequence", labStaff...), handlers.CreateSequenceFile)
+			protected.POST("/sequence/upload", middleware.RequireScope("write:sequence", labStaff...), handlers.UploadSequenceFile)
+			protected.POST("/sequence/uploads", middleware.RequireScope("write:sequence", labStaff...), handlers.StartSequenceUpload)
+			protected.GET("/sequence/uploads/:id", middleware.RequireScope("write:sequence", labStaff...), handlers.GetSequenceUpload)
+			protected.HEAD("/sequence/uploads/:id", middleware.RequireScope("write:sequence", labStaff...), handlers.GetSequenceUpload)
+			protected.PATCH("/sequence/uploads/:id", middleware.RequireScope("write:sequence", labStaff...), handlers.AppendSequenceUpload)
+			protected.DELETE("/sequence/uploads/:id", middleware.RequireScope("write:sequence", labStaff...), handlers.CancelSequenceUpload)
+			protected.GET("/sequence/:id", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceFile)
+			protected.GET("/sequence/:id/content", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceFileContent)
+			protected.HEAD("/sequence/:id/content", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceFileContent)
+			protected.POST("/sequence/:id/download-url", middleware.RequireScope("read:sequence", anyRole...), handlers.CreateSequenceDownloadURL)
+			protected.PUT("/sequence/:id", middleware.RequireScope("write:sequence", labStaff...), handlers.UpdateSequenceFile)
+			protected.DELETE("/sequence/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteSequenceFile)
+			protected.GET("/sequence/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetSequenceFileHistory)
+			protected.POST("/sequence/:id/verify", middleware.RequireRoles(adminOnly...), handlers.VerifySequenceFile)
+			protected.POST("/sequence/:id/check-header", middleware.RequireScope("write:sequence", labStaff...), handlers.CheckSequenceFileHeader)
+			protected.GET("/sequence/:id/qc", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceQC)
+			protected.POST("/sequence/:id/qc", middleware.RequireScope("write:sequence", labStaff...), handlers.ComputeSequenceQC)
+			protected.GET("/sequence/:id/index", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceIndex)
+			protected.PUT("/sequence/:id/index", middleware.RequireScope("write:sequence", labStaff...), handlers.AttachSequenceIndex)
+			protected.DELETE("/sequence/:id/index", middleware.RequireScope("write:sequence", labStaff...), handlers.DeleteSequenceIndex)
+			protected.GET("/sequence/:id/index/content", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceIndexContent)
+			protected.HEAD("/sequence/:id/index/content", middleware.RequireScope("read:sequence", anyRole...), handlers.GetSequenceIndexContent)
+			protected.POST("/sequence/:id/index/generate", middleware.RequireScope("write:sequence", labStaff...), handlers.GenerateSequenceIndex)
 
 			// Variants
-			protected.GET("/variants", handlers.ListVariants)
-			protected.POST("/variants", handlers.CreateVariant)
-			protected.GET("/samples/:id/variants", handlers.GetSampleVariants)
-			protected.DELETE("/variants/:id", handlers.DeleteVariant)
+			protected.GET("/variants", middleware.RequireScope("read:variants", anyRole...), handlers.ListVariants)
+			protected.POST("/variants", middleware.RequireScope("write:variants", curators...), handlers.CreateVariant)
+			protected.GET("/variants/query", middleware.RequireScope("read:variants", anyRole...), handlers.QueryVariants)
+			protected.POST("/variants/upload", middleware.RequireScope("write:variants", curators...), handlers.UploadVariantFile)
+			protected.POST("/variants/uploads", middleware.RequireScope("write:variants", curators...), handlers.StartVariantUpload)
+			protected.GET("/variants/uploads/:id", middleware.RequireScope("write:variants", curators...), handlers.GetVariantUpload)
+			protected.HEAD("/variants/uploads/:id", middleware.RequireScope("write:variants", curators...), handlers.GetVariantUpload)
+			protected.PATCH("/variants/uploads/:id", middleware.RequireScope("write:variants", curators...), handlers.AppendVariantUpload)
+			protected.DELETE("/variants/uploads/:id", middleware.RequireScope("write:variants", curators...), handlers.CancelVariantUpload)
+			protected.GET("/samples/:id/variants", middleware.RequireScope("read:variants", anyRole...), handlers.GetSampleVariants)
+			protected.GET("/variants/:id/content", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantFileContent)
+			protected.HEAD("/variants/:id/content", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantFileContent)
+			protected.POST("/variants/:id/download-url", middleware.RequireScope("read:variants", anyRole...), handlers.CreateVariantDownloadURL)
+			protected.GET("/variants/:id/records", middleware.RequireScope("read:variants", anyRole...), handlers.ListVariantRecords)
+			protected.GET("/variants/:id/ingest", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantIngest)
+			protected.POST("/variants/:id/ingest", middleware.RequireScope("write:variants", curators...), handlers.IngestVariantFile)
+			protected.DELETE("/variants/:id", middleware.RequireRoles(adminOnly...), handlers.DeleteVariant)
+			protected.GET("/variants/:id/history", middleware.RequireRoles(adminOnly...), handlers.GetVariantFileHistory)
+			protected.POST("/variants/:id/verify", middleware.RequireRoles(adminOnly...), handlers.VerifyVariantFile)
+			protected.POST("/variants/:id/check-header", middleware.RequireScope("write:variants", curators...), handlers.CheckVariantFileHeader)
+			protected.GET("/variants/:id/index", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantIndex)
+			protected.PUT("/variants/:id/index", middleware.RequireScope("write:variants", curators...), handlers.AttachVariantIndex)
+			protected.DELETE("/variants/:id/index", middleware.RequireScope("write:variants", curators...), handlers.DeleteVariantIndex)
+			protected.GET("/variants/:id/index/content", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantIndexContent)
+			protected.HEAD("/variants/:id/index/content", middleware.RequireScope("read:variants", anyRole...), handlers.GetVariantIndexContent)
+			protected.POST("/variants/:id/index/generate", middleware.RequireScope("write:variants", curators...), handlers.GenerateVariantIndex)
 		}
 	}
 
+	// ---- GA4GH htsget ----
+	// Same credentials as the API; tickets point at signed download URLs or
+	// the content endpoints
+	htsget := r.Group("/htsget")
+	htsget.Use(authenticate())
+	{
+		htsget.GET("/reads/:id", middleware.RequireScope("read:sequence", anyRole...), handlers.HtsgetReads)
+		htsget.GET("/variants/:id", middleware.RequireScope("read:variants", anyRole...), handlers.HtsgetVariants)
+	}
+
+	// ---- GA4GH Beacon v2 ----
+	// Open to anonymous callers; a token, if sent, must be valid and raises
+	// the granularity to the partner level
+	beacon := r.Group("/beacon")
+	beacon.Use(middleware.OptionalAuth())
+	{
+		beacon.GET("", handlers.GetBeaconInfo)
+		beacon.GET("/info", handlers.GetBeaconInfo)
+		beacon.GET("/g_variants", handlers.QueryBeaconVariants)
+		beacon.POST("/g_variants", handlers.QueryBeaconVariants)
+	}
+
+	// ---- GA4GH DRS ----
+	// Object IDs carry the record kind, so the scope is picked per object
+	r.GET("/ga4gh/drs/v1/service-info", handlers.GetDRSServiceInfo)
+	drs := r.Group("/ga4gh/drs/v1/objects")
+	drs.Use(authenticate(), middleware.RequireScopeOf(handlers.DRSScope, anyRole...))
+	{
+		drs.GET("/:object_id", handlers.GetDRSObject)
+		drs.GET("/:object_id/access/:access_id", handlers.GetDRSAccessURL)
+	}
+
+	// ---- GA4GH refget ----
+	// Sequences of the indexed reference genomes, by digest
+	r.GET("/ga4gh/refget/sequence/service-info", handlers.GetRefgetServiceInfo)
+	refget := r.Group("/ga4gh/refget/sequence")
+	refget.Use(authenticate(), middleware.RequireScope("read:genomes", anyRole...))
+	{
+		refget.GET("/:id", handlers.GetRefgetSequence)
+		refget.GET("/:id/metadata", handlers.GetRefgetMetadata)
+	}
+
 	return r
 }
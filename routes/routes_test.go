@@ -0,0 +1,314 @@
+package routes
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"genomic-api/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+// Role sets of the access matrix in the README, spelt out so the test
+// doesn't share its expectations with the code under test
+var (
+	everyone = []string{"admin", "researcher", "lab_technician", "guest"}
+	staff    = []string{"admin", "researcher", "lab_technician"}
+	curating = []string{"admin", "researcher"}
+	admins   = []string{"admin"}
+)
+
+// policy is who may call a route: users with one of roles, and API keys
+// carrying scope when it is set
+type policy struct {
+	method, path string
+	roles        []string
+	scope        string
+}
+
+var policies = []policy{
+	{"POST", "/api/logout", everyone, ""},
+	{"PUT", "/api/me/password", everyone, ""},
+	{"GET", "/api/users", admins, ""},
+	{"POST", "/api/users", admins, ""},
+	{"GET", "/api/users/:id", admins, ""},
+	{"PUT", "/api/users/:id", admins, ""},
+	{"DELETE", "/api/users/:id", admins, ""},
+	{"POST", "/api/users/:id/reset-password", admins, ""},
+	{"POST", "/api/users/:id/revoke-sessions", admins, ""},
+	{"GET", "/api/users/:id/history", admins, ""},
+	{"GET", "/api/audit", admins, ""},
+	{"GET", "/api/audit/export", admins, ""},
+	{"GET", "/api/audit/verify", admins, ""},
+	{"GET", "/api/integrity", admins, ""},
+	{"POST", "/api/integrity/scrub", admins, ""},
+	{"GET", "/api/service-accounts", admins, ""},
+	{"POST", "/api/service-accounts", admins, ""},
+	{"GET", "/api/service-accounts/:id", admins, ""},
+	{"PUT", "/api/service-accounts/:id", admins, ""},
+	{"GET", "/api/service-accounts/:id/keys", admins, ""},
+	{"POST", "/api/service-accounts/:id/keys", admins, ""},
+	{"DELETE", "/api/service-accounts/:id/keys/:key_id", admins, ""},
+	{"GET", "/api/genomes", everyone, "read:genomes"},
+	{"POST", "/api/genomes", curating, ""},
+	{"GET", "/api/genomes/:id", everyone, "read:genomes"},
+	{"PUT", "/api/genomes/:id", curating, ""},
+	{"DELETE", "/api/genomes/:id", admins, ""},
+	{"GET", "/api/genomes/:id/history", admins, ""},
+	{"GET", "/api/genomes/:id/contigs", everyone, "read:genomes"},
+	{"GET", "/api/genomes/:id/reference", everyone, "read:genomes"},
+	{"POST", "/api/genomes/:id/reference", curating, ""},
+	{"GET", "/api/samples", everyone, "read:samples"},
+	{"POST", "/api/samples", staff, "write:samples"},
+	{"GET", "/api/samples/:id", everyone, "read:samples"},
+	{"PUT", "/api/samples/:id", staff, "write:samples"},
+	{"DELETE", "/api/samples/:id", admins, ""},
+	{"GET", "/api/samples/:id/history", admins, ""},
+	{"GET", "/api/cohorts", everyone, "read:samples"},
+	{"POST", "/api/cohorts", curating, "write:samples"},
+	{"GET", "/api/cohorts/:id", everyone, "read:samples"},
+	{"PUT", "/api/cohorts/:id", curating, "write:samples"},
+	{"DELETE", "/api/cohorts/:id", admins, ""},
+	{"GET", "/api/cohorts/:id/history", admins, ""},
+	{"GET", "/api/sequence", everyone, "read:sequence"},
+	{"POST", "/api/sequence", staff, "write:sequence"},
+	{"POST", "/api/sequence/upload", staff, "write:sequence"},
+	{"POST", "/api/sequence/uploads", staff, "write:sequence"},
+	{"GET", "/api/sequence/uploads/:id", staff, "write:sequence"},
+	{"HEAD", "/api/sequence/uploads/:id", staff, "write:sequence"},
+	{"PATCH", "/api/sequence/uploads/:id", staff, "write:sequence"},
+	{"DELETE", "/api/sequence/uploads/:id", staff, "write:sequence"},
+	{"GET", "/api/sequence/:id", everyone, "read:sequence"},
+	{"GET", "/api/sequence/:id/content", everyone, "read:sequence"},
+	{"HEAD", "/api/sequence/:id/content", everyone, "read:sequence"},
+	{"POST", "/api/sequence/:id/download-url", everyone, "read:sequence"},
+	{"PUT", "/api/sequence/:id", staff, "write:sequence"},
+	{"DELETE", "/api/sequence/:id", admins, ""},
+	{"GET", "/api/sequence/:id/history", admins, ""},
+	{"POST", "/api/sequence/:id/verify", admins, ""},
+	{"POST", "/api/sequence/:id/check-header", staff, "write:sequence"},
+	{"GET", "/api/sequence/:id/qc", everyone, "read:sequence"},
+	{"POST", "/api/sequence/:id/qc", staff, "write:sequence"},
+	{"GET", "/api/sequence/:id/index", everyone, "read:sequence"},
+	{"PUT", "/api/sequence/:id/index", staff, "write:sequence"},
+	{"DELETE", "/api/sequence/:id/index", staff, "write:sequence"},
+	{"GET", "/api/sequence/:id/index/content", everyone, "read:sequence"},
+	{"HEAD", "/api/sequence/:id/index/content", everyone, "read:sequence"},
+	{"POST", "/api/sequence/:id/index/generate", staff, "write:sequence"},
+	{"GET", "/api/variants", everyone, "read:variants"},
+	{"POST", "/api/variants", curating, "write:variants"},
+	{"GET", "/api/variants/query", everyone, "read:variants"},
+	{"POST", "/api/variants/upload", curating, "write:variants"},
+	{"POST", "/api/variants/uploads", curating, "write:variants"},
+	{"GET", "/api/variants/uploads/:id", curating, "write:variants"},
+	{"HEAD", "/api/variants/uploads/:id", curating, "write:variants"},
+	{"PATCH", "/api/variants/uploads/:id", curating, "write:variants"},
+	{"DELETE", "/api/variants/uploads/:id", curating, "write:variants"},
+	{"GET", "/api/samples/:id/variants", everyone, "read:variants"},
+	{"GET", "/api/variants/:id/content", everyone, "read:variants"},
+	{"HEAD", "/api/variants/:id/content", everyone, "read:variants"},
+	{"POST", "/api/variants/:id/download-url", everyone, "read:variants"},
+	{"GET", "/api/variants/:id/records", everyone, "read:variants"},
+	{"GET", "/api/variants/:id/ingest", everyone, "read:variants"},
+	{"POST", "/api/variants/:id/ingest", curating, "write:variants"},
+	{"DELETE", "/api/variants/:id", admins, ""},
+	{"GET", "/api/variants/:id/history", admins, ""},
+	{"POST", "/api/variants/:id/verify", admins, ""},
+	{"POST", "/api/variants/:id/check-header", curating, "write:variants"},
+	{"GET", "/api/variants/:id/index", everyone, "read:variants"},
+	{"PUT", "/api/variants/:id/index", curating, "write:variants"},
+	{"DELETE", "/api/variants/:id/index", curating, "write:variants"},
+	{"GET", "/api/variants/:id/index/content", everyone, "read:variants"},
+	{"HEAD", "/api/variants/:id/index/content", everyone, "read:variants"},
+	{"POST", "/api/variants/:id/index/generate", curating, "write:variants"},
+	{"GET", "/htsget/reads/:id", everyone, "read:sequence"},
+	{"GET", "/htsget/variants/:id", everyone, "read:variants"},
+	{"GET", "/ga4gh/drs/v1/objects/:object_id", everyone, "read:sequence"},
+	{"GET", "/ga4gh/drs/v1/objects/:object_id", everyone, "read:variants"},
+	{"GET", "/ga4gh/drs/v1/objects/:object_id", everyone, "read:samples"},
+	{"GET", "/ga4gh/drs/v1/objects/:object_id/access/:access_id", everyone, "read:sequence"},
+	{"GET", "/ga4gh/drs/v1/objects/:object_id/access/:access_id", everyone, "read:variants"},
+	{"GET", "/ga4gh/refget/sequence/:id", everyone, "read:genomes"},
+	{"GET", "/ga4gh/refget/sequence/:id/metadata", everyone, "read:genomes"},
+}
+
+// publicRoutes need no credentials, or carry their own
+var publicRoutes = map[string]bool{
+	"GET /swagger/*any":                       true,
+	"GET /.well-known/jwks.json":              true,
+	"GET /metrics":                            true,
+	"POST /api/login":                         true,
+	"POST /api/token/refresh":                 true,
+	"GET /api/sequence/:id/download":          true,
+	"HEAD /api/sequence/:id/download":         true,
+	"GET /api/variants/:id/download":          true,
+	"HEAD /api/variants/:id/download":         true,
+	"GET /api/sequence/:id/index/download":    true,
+	"HEAD /api/sequence/:id/index/download":   true,
+	"GET /api/variants/:id/index/download":    true,
+	"HEAD /api/variants/:id/index/download":   true,
+	"GET /beacon":                             true,
+	"GET /beacon/info":                        true,
+	"GET /beacon/g_variants":                  true,
+	"POST /beacon/g_variants":                 true,
+	"GET /ga4gh/drs/v1/service-info":          true,
+	"GET /ga4gh/refget/sequence/service-info": true,
+}
+
+// stubAuth stands in for JWTAuth: X-Test-Role logs in a user with that role,
+// and X-Test-Scopes an API key with those space-separated scopes
+func stubAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if role := c.GetHeader("X-Test-Role"); role != "" {
+			middleware.SetUser(c, 1, role)
+		} else if scopes, ok := c.Request.Header["X-Test-Scopes"]; ok {
+			middleware.SetAPIKey(c, 1, strings.Fields(scopes[0])...)
+		}
+		c.Next()
+	}
+}
+
+func testRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// Handlers that get past the policy fail without a database; that is
+	// recovered as a 500, which is all these tests need
+	gin.DefaultErrorWriter = io.Discard
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	authenticate = stubAuth
+	t.Cleanup(func() { authenticate = middleware.JWTAuth })
+	return SetupRouter()
+}
+
+// drsObjects are DRS object IDs of each kind, by the scope reading them needs
+var drsObjects = map[string]string{
+	"read:sequence": "sequence-1",
+	"read:variants": "variant-1",
+	"read:samples":  "sample-1",
+}
+
+// requestURL fills in path parameters
+func (p policy) requestURL() string {
+	var parts []string
+	for _, part := range strings.Split(p.path, "/") {
+		switch {
+		case part == ":object_id":
+			part = drsObjects[p.scope]
+		case strings.HasPrefix(part, ":"):
+			part = "1"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// denied reports whether the route policy turned the request away
+func denied(w *httptest.ResponseRecorder) bool {
+	return w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), "Insufficient permissions")
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRoutePolicies(t *testing.T) {
+	r := testRouter(t)
+
+	type caller struct {
+		name    string
+		role    string
+		scopes  *string
+		allowed func(policy) bool
+	}
+	var callers []caller
+	for _, role := range everyone {
+		role := role
+		callers = append(callers, caller{
+			name: role, role: role,
+			allowed: func(p policy) bool { return contains(p.roles, role) },
+		})
+	}
+
+	for _, p := range policies {
+		p := p
+		// An API key with the route's scope, and one with every other scope
+		var others []string
+		for _, scope := range middleware.Scopes {
+			if scope != p.scope {
+				others = append(others, scope)
+			}
+		}
+		withScope, withoutScope := p.scope, strings.Join(others, " ")
+		keyCallers := []caller{
+			{name: "key with scope", scopes: &withScope, allowed: func(p policy) bool { return p.scope != "" }},
+			{name: "key without scope", scopes: &withoutScope, allowed: func(policy) bool { return false }},
+		}
+
+		for _, who := range append(callers, keyCallers...) {
+			t.Run(p.method+" "+p.requestURL()+" as "+who.name, func(t *testing.T) {
+				req := httptest.NewRequest(p.method, p.requestURL(), nil)
+				if who.role != "" {
+					req.Header.Set("X-Test-Role", who.role)
+				} else {
+					req.Header.Set("X-Test-Scopes", *who.scopes)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, req)
+
+				switch want := who.allowed(p); {
+				case want && denied(w):
+					t.Errorf("got 403, want the request to reach the handler")
+				case !want && !denied(w):
+					t.Errorf("got %d %s, want 403 Insufficient permissions", w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
+
+// TestRoutePoliciesCoverEveryRoute makes sure a route can't be added
+// without deciding who may call it
+func TestRoutePoliciesCoverEveryRoute(t *testing.T) {
+	r := testRouter(t)
+
+	listed := map[string]bool{}
+	for _, p := range policies {
+		listed[p.method+" "+p.path] = true
+	}
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if !listed[key] && !publicRoutes[key] {
+			t.Errorf("%s has no policy in this test", key)
+		}
+	}
+	for key := range listed {
+		if !registered[key] {
+			t.Errorf("%s is in the policy table but not registered", key)
+		}
+	}
+}
+
+// TestProtectedRoutesNeedCaller checks the policies reject requests that
+// reach them without a caller
+func TestProtectedRoutesNeedCaller(t *testing.T) {
+	r := testRouter(t)
+	for _, p := range policies {
+		req := httptest.NewRequest(p.method, p.requestURL(), nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if !denied(w) {
+			t.Errorf("%s %s without a caller: got %d, want 403", p.method, p.requestURL(), w.Code)
+		}
+	}
+}
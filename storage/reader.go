@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReader reads an object as an io.ReadSeeker, as http.ServeContent
+// needs. Nothing is fetched until the first Read, and each Seek starts a new
+// ranged read, so serving a Range request only transfers the bytes asked for.
+type ObjectReader struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+// NewObjectReader returns a reader over the size bytes of the object at key
+func NewObjectReader(ctx context.Context, backend Backend, key string, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+// Read reads from the current offset, opening the object on first use
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.backend.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+// Seek moves the offset; the next Read fetches from there
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of object")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the open read, if any
+func (r *ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,365 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3PartSize is the default chunk size for multipart uploads. Objects up
+	// to this size are sent in a single PUT; S3 allows 10,000 parts, so
+	// 64 MiB parts cover objects up to 640 GiB.
+	s3PartSize = 64 << 20
+
+	// unsignedPayload skips hashing request bodies; uploads are already
+	// checksummed end to end, and TLS protects them in transit
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+
+	amzDateFormat = "20060102T150405Z"
+)
+
+// S3 stores objects in a bucket of an S3-compatible service such as AWS S3
+// or MinIO. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	Endpoint        *url.URL // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PathStyle puts the bucket in the path (endpoint/bucket/key) instead of
+	// the host name (bucket.endpoint/key). MinIO needs path style.
+	PathStyle bool
+	// PartSize is the chunk size for multipart uploads, s3PartSize when 0
+	PartSize int64
+	Client   *http.Client
+}
+
+// NewS3FromEnv configures an S3 backend from S3_ENDPOINT, S3_REGION,
+// S3_BUCKET, S3_ACCESS_KEY_ID, S3_SECRET_ACCESS_KEY and S3_PATH_STYLE
+func NewS3FromEnv() (*S3, error) {
+	endpoint, err := url.Parse(envOr("S3_ENDPOINT", "https://s3.amazonaws.com"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", os.Getenv("S3_ENDPOINT"))
+	}
+	s3 := &S3{
+		Endpoint:        endpoint,
+		Region:          envOr("S3_REGION", "us-east-1"),
+		Bucket:          os.Getenv("S3_BUCKET"),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		PathStyle:       envOr("S3_PATH_STYLE", "true") == "true",
+		Client:          http.DefaultClient,
+	}
+	if s3.Bucket == "" || s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+		return nil, errors.New("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 storage backend")
+	}
+	return s3, nil
+}
+
+// objectURL returns the URL of key, optionally with a query string
+func (s *S3) objectURL(key string, query url.Values) *url.URL {
+	u := *s.Endpoint
+	if s.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	u.RawPath = uriEncode(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// uriEncode escapes a path the way SigV4 canonical requests do: everything
+// but letters, digits, -._~ and the / separators. Go's own path escaping
+// leaves characters such as $ and : alone, which S3 would then sign
+// differently.
+func uriEncode(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		ch := path[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' || ch == '/' {
+			b.WriteByte(ch)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", ch)
+	}
+	return b.String()
+}
+
+// partSize is the configured multipart chunk size or the default
+func (s *S3) partSize() int64 {
+	if s.PartSize > 0 {
+		return s.PartSize
+	}
+	return s3PartSize
+}
+
+// do signs and sends a request, turning error responses into Go errors
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	s.sign(req, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// Put uploads r in one request, or as a multipart upload when it's larger
+// than one part
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if size <= s.partSize() {
+		resp, err := s.do(ctx, http.MethodPut, key, nil, nil, r, size)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	return s.putMultipart(ctx, key, r, size)
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+func (s *S3) putMultipart(ctx context.Context, key string, r io.Reader, size int64) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	var initiated initiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("s3 initiate multipart upload: %w", err)
+	}
+
+	complete := completeMultipartUpload{}
+	err = func() error {
+		for part, sent := 1, int64(0); sent < size; part++ {
+			n := min(s.partSize(), size-sent)
+			query := url.Values{"partNumber": {strconv.Itoa(part)}, "uploadId": {initiated.UploadID}}
+			resp, err := s.do(ctx, http.MethodPut, key, query, nil, io.LimitReader(r, n), n)
+			if err != nil {
+				return err
+			}
+			resp.Body.Close()
+			complete.Parts = append(complete.Parts, completedPart{PartNumber: part, ETag: resp.Header.Get("ETag")})
+			sent += n
+		}
+		body, err := xml.Marshal(complete)
+		if err != nil {
+			return err
+		}
+		resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, nil, bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return err
+		}
+		// S3 can report a failed completion with a 200 and an error document
+		defer resp.Body.Close()
+		var result struct {
+			XMLName xml.Name
+			Message string `xml:"Message"`
+		}
+		if err := xml.NewDecoder(resp.Body).Decode(&result); err == nil && result.XMLName.Local == "Error" {
+			return fmt.Errorf("s3 complete multipart upload %s: %s", key, result.Message)
+		}
+		return nil
+	}()
+	if err != nil {
+		// Abort so the parts don't linger in the bucket; use a fresh context
+		// since ctx may be the reason for failing
+		if resp, abortErr := s.do(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {initiated.UploadID}}, nil, nil, 0); abortErr == nil {
+			resp.Body.Close()
+		}
+	}
+	return err
+}
+
+// Get downloads the object stored under key
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return s.GetRange(ctx, key, 0, -1)
+}
+
+// GetRange downloads part of the object stored under key
+func (s *S3) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	switch {
+	case length >= 0:
+		if length == 0 {
+			return io.NopCloser(strings.NewReader("")), nil
+		}
+		header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := s.do(ctx, http.MethodGet, key, nil, header, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat reads the object's size and modification time with a HEAD request
+func (s *S3) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	resp, err := s.do(ctx, http.MethodHead, key, nil, nil, nil, 0)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return ObjectInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// Delete removes the object; S3 doesn't report missing objects on delete
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil, 0)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Presign returns a query-signed GET URL for key, valid for ttl (at most 7 days)
+func (s *S3) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	return s.presign(key, ttl, time.Now().UTC()), nil
+}
+
+func (s *S3) presign(key string, ttl time.Duration, now time.Time) string {
+	scope := s.credentialScope(now)
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.AccessKeyID + "/" + scope},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.Itoa(int(ttl.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	u := s.objectURL(key, query)
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\n",
+		"host",
+		unsignedPayload,
+	}, "\n")
+	query.Set("X-Amz-Signature", s.signature(now, scope, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// sign adds the SigV4 Authorization header to req. The host, any Range and
+// all x-amz-* headers are signed.
+func (s *S3) sign(req *http.Request, now time.Time) {
+	if req.Header.Get("X-Amz-Content-Sha256") == "" {
+		req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	}
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	scope := s.credentialScope(now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKeyID, scope, signedHeaders, s.signature(now, scope, canonical)))
+}
+
+func (s *S3) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with the key derived for its date and region
+func (s *S3) signature(now time.Time, scope, canonicalRequest string) string {
+	hashed := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(amzDateFormat) + "\n" + scope + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string the way SigV4 expects: sorted by
+// key, with spaces as %20 rather than +
+func canonicalQuery(query url.Values) string {
+	return strings.ReplaceAll(query.Encode(), "+", "%20")
+}
@@ -0,0 +1,306 @@
+// Package vcf reads Variant Call Format files, plain or bgzip-compressed,
+// one record at a time.
+package vcf
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// fixedColumns are the columns every data line has before FORMAT
+var fixedColumns = []string{"#CHROM", "POS", "ID", "REF", "ALT", "QUAL", "FILTER", "INFO"}
+
+// ParseError is a problem with one line of the file. Read returns it for a
+// malformed record and can be called again to continue with the next line.
+type ParseError struct {
+	Line int64
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Header is the meta-information and sample names from the top of the file
+type Header struct {
+	FileFormat string   // e.g. VCFv4.2
+	Meta       []string // ## lines, without the leading ##
+	Samples    []string // sample columns after FORMAT, in file order
+}
+
+// Contig is a ##contig line: a reference sequence the records are on
+type Contig struct {
+	ID       string
+	Length   int64 // 0 when not given
+	MD5      string
+	Assembly string
+}
+
+// Contigs are the ##contig lines, in header order
+func (h *Header) Contigs() []Contig {
+	var contigs []Contig
+	for _, meta := range h.Meta {
+		value, ok := strings.CutPrefix(meta, "contig=<")
+		if !ok {
+			continue
+		}
+		fields := structuredFields(strings.TrimSuffix(value, ">"))
+		contig := Contig{ID: fields["ID"], MD5: fields["md5"], Assembly: fields["assembly"]}
+		contig.Length, _ = strconv.ParseInt(fields["length"], 10, 64)
+		if contig.ID != "" {
+			contigs = append(contigs, contig)
+		}
+	}
+	return contigs
+}
+
+// structuredFields splits the key=value pairs of a structured meta line,
+// such as ID=chr1,length=248956422, unquoting quoted values
+func structuredFields(s string) map[string]string {
+	fields := map[string]string{}
+	for s != "" {
+		key, rest, _ := strings.Cut(s, "=")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := 1
+			for end < len(rest) && (rest[end] != '"' || rest[end-1] == '\\') {
+				end++
+			}
+			value = strings.ReplaceAll(rest[1:min(end, len(rest))], `\"`, `"`)
+			rest = rest[min(end+1, len(rest)):]
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		fields[strings.TrimSpace(key)] = value
+		s = rest
+	}
+	return fields
+}
+
+// Record is one data line
+type Record struct {
+	Line   int64 // 1-based line number in the file
+	Chrom  string
+	Pos    int64 // 1-based
+	ID     string
+	Ref    string
+	Alt    []string
+	Qual   *float64 // nil when missing
+	Filter []string // nil when missing
+	Info   map[string]string
+	Format []string
+	// Samples holds each sample's FORMAT values, in header order. Trailing
+	// fields a sample leaves out are absent from its map.
+	Samples []map[string]string
+}
+
+// End is the last reference position the record covers: INFO END when
+// given (structural variants), otherwise the end of REF
+func (r *Record) End() int64 {
+	if end, err := strconv.ParseInt(r.Info["END"], 10, 64); err == nil && end >= r.Pos {
+		return end
+	}
+	return r.Pos + int64(len(r.Ref)) - 1
+}
+
+// Reader reads records from a VCF stream
+type Reader struct {
+	r      *bufio.Reader
+	line   int64
+	header Header
+}
+
+// NewReader reads the header from r, decompressing it first if it is gzip
+// or bgzip. A malformed header is reported as a *ParseError.
+func NewReader(r io.Reader) (*Reader, error) {
+	buffered := bufio.NewReaderSize(r, 1<<20)
+	magic, err := buffered.Peek(2)
+	if err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		// bgzip is a series of gzip members, which gzip reads as one stream
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		buffered = bufio.NewReaderSize(gz, 1<<20)
+	}
+	reader := &Reader{r: buffered}
+	if err := reader.readHeader(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Header returns the file's header
+func (r *Reader) Header() *Header {
+	return &r.header
+}
+
+// Line is the number of the last line read
+func (r *Reader) Line() int64 {
+	return r.line
+}
+
+// nextLine returns the next line without its line ending
+func (r *Reader) nextLine() (string, error) {
+	line, err := r.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	r.line++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (r *Reader) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{Line: r.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (r *Reader) readHeader() error {
+	for {
+		line, err := r.nextLine()
+		if err == io.EOF {
+			return &ParseError{Line: r.line + 1, Msg: "missing #CHROM header line"}
+		}
+		if err != nil {
+			return err
+		}
+		if r.line == 1 {
+			if !strings.HasPrefix(line, "##fileformat=VCF") {
+				return r.errorf("first line must be ##fileformat=VCFv4.x")
+			}
+			r.header.FileFormat = strings.TrimPrefix(line, "##fileformat=")
+		}
+		if strings.HasPrefix(line, "##") {
+			r.header.Meta = append(r.header.Meta, line[2:])
+			continue
+		}
+		if !strings.HasPrefix(line, "#CHROM") {
+			return r.errorf("expected #CHROM header line before the first record")
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < len(fixedColumns) {
+			return r.errorf("#CHROM line has %d columns, expected at least %d", len(columns), len(fixedColumns))
+		}
+		for i, name := range fixedColumns {
+			if columns[i] != name {
+				return r.errorf("column %d of the #CHROM line is %q, expected %s", i+1, columns[i], name)
+			}
+		}
+		if len(columns) > len(fixedColumns) {
+			if columns[8] != "FORMAT" {
+				return r.errorf("column 9 of the #CHROM line is %q, expected FORMAT", columns[8])
+			}
+			r.header.Samples = columns[9:]
+		}
+		return nil
+	}
+}
+
+// Read returns the next record, or io.EOF after the last one. A malformed
+// line is returned as a *ParseError, after which reading can continue.
+func (r *Reader) Read() (*Record, error) {
+	var line string
+	for {
+		var err error
+		line, err = r.nextLine()
+		if err != nil {
+			return nil, err
+		}
+		if line != "" {
+			break
+		}
+	}
+	if strings.IndexByte(line, 0) >= 0 {
+		return nil, r.errorf("contains a NUL byte")
+	}
+	fields := strings.Split(line, "\t")
+	want := len(fixedColumns)
+	if len(r.header.Samples) > 0 {
+		want += 1 + len(r.header.Samples)
+	}
+	if len(fields) != want {
+		return nil, r.errorf("expected %d tab-separated columns, got %d", want, len(fields))
+	}
+
+	rec := &Record{Line: r.line, Chrom: fields[0], ID: fields[2], Ref: fields[3]}
+	if rec.Chrom == "" || rec.Chrom == "." {
+		return nil, r.errorf("missing CHROM")
+	}
+	pos, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || pos < 0 {
+		return nil, r.errorf("invalid POS %q", fields[1])
+	}
+	rec.Pos = pos
+	if !isBases(rec.Ref) {
+		return nil, r.errorf("invalid REF %q: must be one or more of A, C, G, T, N", rec.Ref)
+	}
+	if fields[4] == "" {
+		return nil, r.errorf("missing ALT")
+	}
+	rec.Alt = strings.Split(fields[4], ",")
+	for _, alt := range rec.Alt {
+		if alt == "" {
+			return nil, r.errorf("empty allele in ALT %q", fields[4])
+		}
+	}
+	if fields[5] != "." {
+		qual, err := strconv.ParseFloat(fields[5], 64)
+		if err != nil {
+			return nil, r.errorf("invalid QUAL %q", fields[5])
+		}
+		rec.Qual = &qual
+	}
+	if fields[6] != "." && fields[6] != "" {
+		rec.Filter = strings.Split(fields[6], ";")
+	}
+	rec.Info = map[string]string{}
+	if fields[7] != "." && fields[7] != "" {
+		for _, entry := range strings.Split(fields[7], ";") {
+			key, value, _ := strings.Cut(entry, "=")
+			if key == "" {
+				return nil, r.errorf("empty key in INFO %q", fields[7])
+			}
+			rec.Info[key] = value
+		}
+	}
+
+	if len(r.header.Samples) == 0 {
+		return rec, nil
+	}
+	rec.Format = strings.Split(fields[8], ":")
+	rec.Samples = make([]map[string]string, len(r.header.Samples))
+	for i, column := range fields[9:] {
+		values := strings.Split(column, ":")
+		if len(values) > len(rec.Format) {
+			return nil, r.errorf("sample %s has %d values for %d FORMAT keys", r.header.Samples[i], len(values), len(rec.Format))
+		}
+		sample := make(map[string]string, len(values))
+		for j, value := range values {
+			sample[rec.Format[j]] = value
+		}
+		rec.Samples[i] = sample
+	}
+	return rec, nil
+}
+
+// isBases reports whether s is a non-empty run of A, C, G, T or N
+func isBases(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case 'A', 'C', 'G', 'T', 'N', 'a', 'c', 'g', 't', 'n':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,182 @@
+package vcf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"genomic-api/bgzf"
+)
+
+// result is what one call to Read gave: a record's position or an error's line
+type result struct {
+	line  int64
+	pos   int64
+	error string
+}
+
+// errorsVCF is what reading testdata/errors.vcf gives, line by line
+var errorsVCF = []result{
+	{line: 6, pos: 100},
+	{line: 7, pos: 200},
+	{line: 8, error: `invalid POS "abc"`},
+	{line: 9, error: `invalid REF "X": must be one or more of A, C, G, T, N`},
+	{line: 10, error: "expected 11 tab-separated columns, got 10"},
+	{line: 12, pos: 500},
+	{line: 13, error: `invalid QUAL "high"`},
+	{line: 14, error: `empty key in INFO "=5"`},
+	{line: 15, error: "sample S1 has 3 values for 1 FORMAT keys"},
+	{line: 16, pos: 900},
+}
+
+func readAll(t *testing.T, r *Reader) ([]result, []*Record) {
+	t.Helper()
+	var results []result
+	var records []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return results, records
+		}
+		var parseErr *ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			if parseErr.Line != r.Line() {
+				t.Errorf("error on line %d reported for line %d", r.Line(), parseErr.Line)
+			}
+			results = append(results, result{line: parseErr.Line, error: parseErr.Msg})
+		case err != nil:
+			t.Fatalf("Read: %v", err)
+		default:
+			results = append(results, result{line: rec.Line, pos: rec.Pos})
+			records = append(records, rec)
+		}
+	}
+}
+
+func TestReadContinuesAfterErrors(t *testing.T) {
+	f, err := os.Open("testdata/errors.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	results, records := readAll(t, r)
+	if !reflect.DeepEqual(results, errorsVCF) {
+		t.Fatalf("read\n%v\nwant\n%v", results, errorsVCF)
+	}
+
+	first := records[0]
+	if first.Chrom != "chr1" || first.ID != "rs1" || first.Ref != "A" || !reflect.DeepEqual(first.Alt, []string{"G"}) ||
+		first.Qual == nil || *first.Qual != 50 || !reflect.DeepEqual(first.Filter, []string{"PASS"}) ||
+		first.Info["DP"] != "10" || first.End() != 100 {
+		t.Errorf("first record = %+v", first)
+	}
+	wantSamples := []map[string]string{{"GT": "0/1", "DP": "12"}, {"GT": "1/1", "DP": "8"}}
+	if !reflect.DeepEqual(first.Samples, wantSamples) {
+		t.Errorf("first record samples = %v, want %v", first.Samples, wantSamples)
+	}
+
+	multiallelic := records[1]
+	if !reflect.DeepEqual(multiallelic.Alt, []string{"A", "T"}) || multiallelic.Qual != nil ||
+		multiallelic.Filter != nil || len(multiallelic.Info) != 0 || multiallelic.End() != 201 {
+		t.Errorf("second record = %+v", multiallelic)
+	}
+
+	deletion := records[2]
+	if deletion.End() != 900 || !reflect.DeepEqual(deletion.Filter, []string{"q10", "lowqual"}) ||
+		deletion.Info["SVTYPE"] != "DEL" || deletion.Info["IMPRECISE"] != "" {
+		t.Errorf("structural variant = %+v, End %d", deletion, deletion.End())
+	}
+	// Trailing FORMAT fields may be left out
+	if !reflect.DeepEqual(deletion.Samples[0], map[string]string{"GT": "0/1"}) {
+		t.Errorf("sample with trailing fields dropped = %v", deletion.Samples[0])
+	}
+}
+
+func TestHeader(t *testing.T) {
+	f, err := os.Open("testdata/errors.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	header := r.Header()
+	if header.FileFormat != "VCFv4.2" || !reflect.DeepEqual(header.Samples, []string{"S1", "S2"}) || len(header.Meta) != 4 {
+		t.Errorf("header = %+v", header)
+	}
+	want := []Contig{
+		{ID: "chr1", Length: 248956422, MD5: "0123abcd", Assembly: "GRCh38, primary"},
+		{ID: "chr2"},
+	}
+	if got := header.Contigs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Contigs = %+v, want %+v", got, want)
+	}
+}
+
+func TestReadBGZF(t *testing.T) {
+	plain, err := os.ReadFile("testdata/errors.vcf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Split across blocks mid-line, as bgzip does
+	compressed := append(bgzf.Compress(plain[:300]), bgzf.Compress(plain[300:])...)
+	compressed = append(compressed, bgzf.EOF...)
+	r, err := NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	if results, _ := readAll(t, r); !reflect.DeepEqual(results, errorsVCF) {
+		t.Fatalf("read\n%v\nwant\n%v", results, errorsVCF)
+	}
+}
+
+func TestReadCRLF(t *testing.T) {
+	data := "##fileformat=VCFv4.3\r\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\r\nchr1\t5\t.\tA\tC\t.\t.\t.\r\n"
+	r, err := NewReader(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	rec, err := r.Read()
+	if err != nil || rec.Pos != 5 || rec.Info == nil || rec.Samples != nil {
+		t.Fatalf("Read = %+v, %v", rec, err)
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("Read after the last record: %v, want io.EOF", err)
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int64
+		msg  string
+	}{
+		{"no fileformat", "#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\n", 1, "first line must be ##fileformat=VCFv4.x"},
+		{"no #CHROM line", "##fileformat=VCFv4.2\n##source=test\n", 3, "missing #CHROM header line"},
+		{"record before #CHROM", "##fileformat=VCFv4.2\nchr1\t1\t.\tA\tC\t.\t.\t.\n", 2, "expected #CHROM header line before the first record"},
+		{"too few columns", "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\n", 2, "#CHROM line has 3 columns, expected at least 8"},
+		{"misnamed column", "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTERS\tINFO\n", 2, `column 7 of the #CHROM line is "FILTERS", expected FILTER`},
+		{"samples without FORMAT", "##fileformat=VCFv4.2\n#CHROM\tPOS\tID\tREF\tALT\tQUAL\tFILTER\tINFO\tS1\n", 2, `column 9 of the #CHROM line is "S1", expected FORMAT`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(strings.NewReader(tt.data))
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != tt.line || parseErr.Msg != tt.msg {
+				t.Fatalf("NewReader error = %v, want line %d: %s", err, tt.line, tt.msg)
+			}
+		})
+	}
+}